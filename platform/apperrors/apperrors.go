@@ -0,0 +1,98 @@
+// Package apperrors defines the errors services return to tell callers what
+// kind of failure occurred, independent of the storage or transport.
+// Handlers map them to HTTP statuses; anything else is an internal error.
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of failure. Test for them with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrValidation   = errors.New("validation failed")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// FieldError describes a problem with one input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a failure of a given kind with a message that is safe to show to
+// clients. The underlying cause, if any, stays in the chain for logging.
+type Error struct {
+	Kind   error
+	Detail string
+	Fields []FieldError
+	// RetryAfter, if set, is how long the client should wait before trying
+	// again.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if len(e.Fields) > 0 {
+		parts := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			parts[i] = f.Field + ": " + f.Message
+		}
+		msg += " (" + strings.Join(parts, "; ") + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// NotFound reports that the named resource does not exist.
+func NotFound(format string, args ...any) error {
+	return &Error{Kind: ErrNotFound, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Conflict reports that the request conflicts with existing state, such as a
+// name that is already taken.
+func Conflict(format string, args ...any) error {
+	return &Error{Kind: ErrConflict, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Forbidden reports that the caller may not perform the request.
+func Forbidden(format string, args ...any) error {
+	return &Error{Kind: ErrForbidden, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Unauthorized reports that the caller could not be authenticated.
+func Unauthorized(format string, args ...any) error {
+	return &Error{Kind: ErrUnauthorized, Detail: fmt.Sprintf(format, args...)}
+}
+
+// RateLimited reports that the caller must wait retryAfter before trying
+// again.
+func RateLimited(retryAfter time.Duration, format string, args ...any) error {
+	return &Error{Kind: ErrRateLimited, Detail: fmt.Sprintf(format, args...), RetryAfter: retryAfter}
+}
+
+// Validation reports invalid input, with the offending fields if known.
+func Validation(detail string, fields ...FieldError) error {
+	return &Error{Kind: ErrValidation, Detail: detail, Fields: fields}
+}
+
+// Invalid reports invalid input in a single field.
+func Invalid(field, format string, args ...any) error {
+	return Validation("Invalid request", FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
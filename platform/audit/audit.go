@@ -0,0 +1,162 @@
+// Package audit records administrative changes in the append-only audit log.
+// The HTTP layer puts the acting user and client IP in the request context
+// with WithActor; services describe each change they make and the Recorder
+// adds who made it, from where and when.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// Actor is who a request acts for. Username is empty for requests that are
+// not authenticated, such as logins.
+type Actor struct {
+	Username string
+	IP       string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or the zero Actor.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// Recorder appends entries to the audit log. A nil Recorder records nothing.
+type Recorder struct {
+	store  repositories.AuditStore
+	users  repositories.UserStore
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewRecorder returns a recorder that resolves actors' user IDs with users.
+func NewRecorder(store repositories.AuditStore, users repositories.UserStore, logger *slog.Logger) *Recorder {
+	return &Recorder{store: store, users: users, logger: logger, now: time.Now}
+}
+
+// Record appends the entry. The actor and IP in ctx fill in whatever the
+// entry leaves unset, and the time is always now. The change the entry
+// describes has already been made, so a failure to record it is logged
+// rather than returned.
+func (r *Recorder) Record(ctx context.Context, entry models.AuditEntry) {
+	if r == nil {
+		return
+	}
+	actor := ActorFromContext(ctx)
+	if entry.IP == "" {
+		entry.IP = actor.IP
+	}
+	if entry.ActorID == nil && actor.Username != "" {
+		entry.ActorName = actor.Username
+		if user, err := r.users.GetUserByUsername(ctx, actor.Username); err == nil {
+			entry.ActorID = &user.ID
+		}
+	}
+	entry.CreatedAt = r.now().UTC()
+
+	if err := r.store.AddAuditEntry(ctx, entry); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to record audit entry",
+			"action", entry.Action, "target_type", entry.TargetType, "target_id", entry.TargetID, "error", err)
+	}
+}
+
+// By sets the entry's actor to the user, for changes made by a user the
+// request context does not name, such as their own registration.
+func By(entry models.AuditEntry, user models.User) models.AuditEntry {
+	entry.ActorID = &user.ID
+	entry.ActorName = user.Username
+	return entry
+}
+
+// Redacted replaces the value of a secret field in the audit log.
+const Redacted = "[redacted]"
+
+// Diff returns the JSON fields of before and after that differ. A nil before
+// or after, for a creation or deletion, returns every field of the other.
+// Fields tagged `audit:"redact"` are recorded as Redacted, so the log shows
+// that they changed but not their values.
+func Diff(before, after interface{}) (map[string]interface{}, map[string]interface{}) {
+	b, a := fields(before), fields(after)
+	if b != nil && a != nil {
+		for key, value := range b {
+			if other, ok := a[key]; ok && reflect.DeepEqual(value, other) {
+				delete(b, key)
+				delete(a, key)
+			}
+		}
+	}
+	redact(b, before)
+	redact(a, after)
+	return b, a
+}
+
+// redact replaces the values of v's fields tagged `audit:"redact"` in m, the
+// JSON object v encodes to.
+func redact(m map[string]interface{}, v interface{}) {
+	t := reflect.TypeOf(v)
+	if m == nil || t == nil {
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("audit") != "redact" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := m[name]; ok {
+			m[name] = Redacted
+		}
+	}
+}
+
+// fields returns the JSON object v encodes to, or nil.
+func fields(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Homes returns the distinct homes among the IDs, skipping nils.
+func Homes(ids ...*int) []int {
+	var homes []int
+	for _, id := range ids {
+		if id != nil && !slices.Contains(homes, *id) {
+			homes = append(homes, *id)
+		}
+	}
+	return homes
+}
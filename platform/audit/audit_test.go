@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type device struct {
+		Name   string `json:"name"`
+		HomeID *int   `json:"home_id,omitempty"`
+		Active bool   `json:"active"`
+	}
+	home := 3
+
+	before, after := Diff(device{Name: "d1", Active: true}, device{Name: "d1", HomeID: &home, Active: true})
+	if len(before) != 0 || !reflect.DeepEqual(after, map[string]interface{}{"home_id": 3.0}) {
+		t.Errorf("update: got %v -> %v, want only home_id", before, after)
+	}
+
+	before, after = Diff(nil, device{Name: "d1"})
+	if before != nil || len(after) != 2 {
+		t.Errorf("creation: got %v -> %v, want every field after", before, after)
+	}
+	if before, after := Diff(nil, nil); before != nil || after != nil {
+		t.Errorf("no change: got %v -> %v", before, after)
+	}
+
+	type secret struct {
+		Name    string `json:"name"`
+		Channel string `json:"channel" audit:"redact"`
+	}
+	before, after = Diff(secret{Name: "d1", Channel: "old"}, &secret{Name: "d1", Channel: "new"})
+	if !reflect.DeepEqual(before, map[string]interface{}{"channel": Redacted}) || !reflect.DeepEqual(after, before) {
+		t.Errorf("redacted change: got %v -> %v, want the channel redacted", before, after)
+	}
+	before, after = Diff(secret{Name: "d1", Channel: "old"}, secret{Name: "d2", Channel: "old"})
+	if _, ok := after["channel"]; ok || len(before) != 1 {
+		t.Errorf("unchanged redacted field: got %v -> %v, want only name", before, after)
+	}
+	if _, after = Diff(nil, secret{Name: "d1", Channel: "c1"}); after["channel"] != Redacted {
+		t.Errorf("creation: got %v, want the channel redacted", after)
+	}
+}
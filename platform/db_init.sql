@@ -2,28 +2,152 @@
 CREATE TABLE users (
                        id SERIAL PRIMARY KEY,
                        username TEXT NOT NULL UNIQUE,
-                       email TEXT NOT NULL UNIQUE,
+                       email TEXT UNIQUE,
                        password_hash TEXT NOT NULL,
-                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                       email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+                       failed_logins INTEGER NOT NULL DEFAULT 0,
+                       locked_until TIMESTAMPTZ,
+                       -- Set for service accounts, which have no email or password.
+                       owner_id INTEGER REFERENCES users(id),
+                       mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+                       -- Set by hand for the people who run the platform.
+                       platform_operator BOOLEAN NOT NULL DEFAULT FALSE,
+                       -- Login tokens carry it; bumping it revokes them.
+                       token_version INTEGER NOT NULL DEFAULT 0,
+                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                       CONSTRAINT users_email_check CHECK (email IS NOT NULL OR owner_id IS NOT NULL)
 );
 
--- Create Roles Table
-CREATE TABLE roles (
-                       id SERIAL PRIMARY KEY,
-                       name TEXT NOT NULL UNIQUE
+-- Create User Tokens Table
+-- Single-use email verification and password reset tokens. Only the SHA-256
+-- hash of a token is stored.
+CREATE TABLE user_tokens (
+                             id SERIAL PRIMARY KEY,
+                             user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             purpose TEXT NOT NULL,
+                             token_hash TEXT NOT NULL UNIQUE,
+                             expires_at TIMESTAMPTZ NOT NULL,
+                             used_at TIMESTAMPTZ,
+                             created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
--- Insert Default Roles (Admin, View)
-INSERT INTO roles (name) VALUES ('Admin'), ('View');
+-- Create API Keys Table
+-- Keys of service accounts. Only the SHA-256 hash of a key is stored; the
+-- prefix identifies it in listings. An empty home_ids is not restricted.
+CREATE TABLE api_keys (
+                          id SERIAL PRIMARY KEY,
+                          service_account_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          name TEXT NOT NULL,
+                          prefix TEXT NOT NULL,
+                          key_hash TEXT NOT NULL UNIQUE,
+                          scopes TEXT[] NOT NULL,
+                          home_ids INTEGER[] NOT NULL DEFAULT '{}',
+                          expires_at TIMESTAMPTZ,
+                          revoked_at TIMESTAMPTZ,
+                          last_used_at TIMESTAMPTZ,
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create User MFA Table
+-- TOTP enrollments. The secret is sealed with AES-GCM under the keys in
+-- MFA_ENCRYPTION_KEYS. enabled_at is NULL until the user confirms a code.
+CREATE TABLE user_mfa (
+                          user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                          sealed_secret TEXT NOT NULL,
+                          enabled_at TIMESTAMPTZ,
+                          last_step BIGINT NOT NULL DEFAULT 0,
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create MFA Recovery Codes Table
+-- Single-use codes for users who lost their authenticator. Only the SHA-256
+-- hash of a code is stored.
+CREATE TABLE mfa_recovery_codes (
+                                    id SERIAL PRIMARY KEY,
+                                    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                    code_hash TEXT NOT NULL,
+                                    used_at TIMESTAMPTZ,
+                                    UNIQUE (user_id, code_hash)
+);
+
+-- Create User Identities Table
+-- Links users to their accounts at OpenID Connect identity providers.
+CREATE TABLE user_identities (
+                                 id SERIAL PRIMARY KEY,
+                                 user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                 provider TEXT NOT NULL,
+                                 subject TEXT NOT NULL,
+                                 created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                 UNIQUE (provider, subject)
+);
+
+-- Create SSO Logins Table
+-- Single sign-on logins waiting for the identity provider to redirect back.
+-- Only the SHA-256 hash of the state is stored. Rows are deleted when used,
+-- and expired ones when the next login starts.
+CREATE TABLE sso_logins (
+                            id SERIAL PRIMARY KEY,
+                            provider TEXT NOT NULL,
+                            state_hash TEXT NOT NULL UNIQUE,
+                            nonce TEXT NOT NULL,
+                            verifier TEXT NOT NULL,
+                            expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Create Organizations Table
+-- Customers that own homes and sites. The plan and quotas are set by
+-- billing; a NULL quota is unlimited.
+CREATE TABLE organizations (
+                               id SERIAL PRIMARY KEY,
+                               name TEXT NOT NULL UNIQUE,
+                               plan TEXT NOT NULL DEFAULT 'free',
+                               billing_email TEXT NOT NULL DEFAULT '',
+                               max_homes INTEGER CHECK (max_homes >= 0),
+                               max_devices INTEGER CHECK (max_devices >= 0),
+                               max_members INTEGER CHECK (max_members >= 0),
+                               created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create Organization Members Table
+-- Organization roles are inherited in every home of the organization.
+CREATE TABLE organization_members (
+                                      org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                      user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                      role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'operator', 'viewer')),
+                                      created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                      PRIMARY KEY (org_id, user_id)
+);
 
 -- Create Homes Table
 CREATE TABLE homes (
                        id SERIAL PRIMARY KEY,
                        home_name TEXT NOT NULL,
                        user_id INTEGER NOT NULL REFERENCES users(id),
+                       org_id INTEGER REFERENCES organizations(id),
+                       require_mfa BOOLEAN NOT NULL DEFAULT FALSE,
                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX homes_org_id_idx ON homes (org_id);
+
+-- Create Roles Table
+-- A role is a set of permissions. The built-in roles have no home; custom
+-- roles belong to the home that created them and go with it.
+CREATE TABLE roles (
+                       id SERIAL PRIMARY KEY,
+                       name TEXT NOT NULL,
+                       home_id INTEGER REFERENCES homes(id) ON DELETE CASCADE,
+                       permissions TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- Role names are unique among the built-in roles and within each home.
+CREATE UNIQUE INDEX roles_name_key ON roles (COALESCE(home_id, 0), name);
+
+-- Insert Default Roles (Admin, View)
+INSERT INTO roles (name, permissions) VALUES
+    ('Admin', ARRAY['home.manage', 'home.members.manage', 'home.roles.manage', 'device.assign', 'device.command', 'telemetry.read', 'audit.read']),
+    ('View', ARRAY['telemetry.read']);
+
 -- Create Home-User Mapping Table
 CREATE TABLE home_users (
                             id SERIAL PRIMARY KEY,
@@ -33,6 +157,56 @@ CREATE TABLE home_users (
                             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Create Home Invitations Table
+-- Invitations offer a role in a home to an email address, and to its user
+-- if known. Only one invitation per address and home may be pending.
+-- Addresses are matched case-insensitively.
+CREATE TABLE home_invitations (
+                                  id SERIAL PRIMARY KEY,
+                                  home_id INTEGER NOT NULL REFERENCES homes(id) ON DELETE CASCADE,
+                                  email TEXT NOT NULL,
+                                  user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+                                  role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                  invited_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+                                  expires_at TIMESTAMPTZ NOT NULL,
+                                  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  responded_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX home_invitations_email_key ON home_invitations (home_id, lower(email)) WHERE status = 'pending';
+CREATE INDEX home_invitations_user_id_idx ON home_invitations (user_id) WHERE status = 'pending';
+
+-- Create Device Types Table
+CREATE TABLE device_types (
+                              id SERIAL PRIMARY KEY,
+                              name TEXT NOT NULL UNIQUE,
+                              manufacturer TEXT NOT NULL DEFAULT '',
+                              model TEXT NOT NULL DEFAULT '',
+                              decoder TEXT NOT NULL DEFAULT '',
+                              validation_mode TEXT NOT NULL DEFAULT '',
+                              fields JSONB NOT NULL DEFAULT '[]',
+                              commands JSONB NOT NULL DEFAULT '[]',
+                              created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create Spaces Table
+-- Spaces are the buildings, floors, rooms and zones of a home, arranged as a
+-- tree. A space is nested only in a space of an earlier kind, in the order
+-- listed in the check, which the platform enforces, so the tree has no
+-- cycles. Names are unique among siblings.
+CREATE TABLE spaces (
+                        id SERIAL PRIMARY KEY,
+                        home_id INTEGER NOT NULL REFERENCES homes(id) ON DELETE CASCADE,
+                        parent_id INTEGER REFERENCES spaces(id),
+                        name TEXT NOT NULL,
+                        kind TEXT NOT NULL CHECK (kind IN ('building', 'floor', 'room', 'zone')),
+                        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX spaces_name_key ON spaces (home_id, COALESCE(parent_id, 0), name);
+CREATE INDEX spaces_parent_id_idx ON spaces (parent_id);
+
 -- Create Devices Table
 CREATE TABLE devices (
                          id SERIAL PRIMARY KEY,
@@ -44,18 +218,123 @@ CREATE TABLE devices (
                          is_active BOOLEAN DEFAULT TRUE,
                          user_id INTEGER NOT NULL REFERENCES users(id),
                          home_id INTEGER REFERENCES homes(id),
+                         -- A space of the device's home; the platform clears it when the device changes homes.
+                         space_id INTEGER REFERENCES spaces(id) ON DELETE SET NULL,
+                         device_type_id INTEGER REFERENCES device_types(id),
+                         decoder TEXT NOT NULL DEFAULT '',
                          created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX devices_space_id_idx ON devices (space_id);
+
+-- Create Device Transfers Table
+-- A device has at most one pending transfer. Accepted transfers are kept:
+-- they bound what each owner may read of the device's telemetry.
+CREATE TABLE device_transfers (
+                                  id SERIAL PRIMARY KEY,
+                                  device_id TEXT NOT NULL REFERENCES devices(device_id) ON DELETE CASCADE,
+                                  from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                  to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                  keep_telemetry BOOLEAN NOT NULL DEFAULT FALSE,
+                                  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+                                  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  responded_at TIMESTAMPTZ,
+                                  CHECK (from_user_id <> to_user_id)
+);
+
+CREATE UNIQUE INDEX device_transfers_device_id_key ON device_transfers (device_id) WHERE status = 'pending';
+CREATE INDEX device_transfers_to_user_id_idx ON device_transfers (to_user_id);
+CREATE INDEX device_transfers_from_user_id_idx ON device_transfers (from_user_id);
+
+-- Create Device Tags Table
+CREATE TABLE device_tags (
+                             device_id TEXT NOT NULL REFERENCES devices(device_id) ON DELETE CASCADE,
+                             key TEXT NOT NULL,
+                             value TEXT NOT NULL DEFAULT '',
+                             PRIMARY KEY (device_id, key)
+);
+
+CREATE INDEX device_tags_key_value_idx ON device_tags (key, value);
+
+-- Create Device Groups Tables
+-- Static groups list their members; dynamic groups hold the devices of the
+-- home their selector matches.
+CREATE TABLE device_groups (
+                               id SERIAL PRIMARY KEY,
+                               home_id INTEGER NOT NULL REFERENCES homes(id) ON DELETE CASCADE,
+                               name TEXT NOT NULL,
+                               kind TEXT NOT NULL CHECK (kind IN ('static', 'dynamic')),
+                               selector JSONB,
+                               created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                               CONSTRAINT device_groups_name_key UNIQUE (home_id, name),
+                               CONSTRAINT device_groups_selector_check CHECK ((kind = 'dynamic') = (selector IS NOT NULL))
+);
+
+CREATE TABLE device_group_members (
+                                      group_id INTEGER NOT NULL REFERENCES device_groups(id) ON DELETE CASCADE,
+                                      device_id TEXT NOT NULL REFERENCES devices(device_id) ON DELETE CASCADE,
+                                      PRIMARY KEY (group_id, device_id)
+);
+
+-- Create Device Jobs Tables
+-- A job's devices are fixed when it is created, one pending result each.
+-- claimed_at is the lease of the worker running the job; a running job whose
+-- lease went stale is picked up again.
+CREATE TABLE device_jobs (
+                             id SERIAL PRIMARY KEY,
+                             home_id INTEGER NOT NULL REFERENCES homes(id) ON DELETE CASCADE,
+                             group_id INTEGER REFERENCES device_groups(id) ON DELETE SET NULL,
+                             action TEXT NOT NULL CHECK (action IN ('command', 'assign_home', 'set_active', 'firmware')),
+                             params JSONB NOT NULL DEFAULT '{}',
+                             status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'completed')),
+                             created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+                             created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             started_at TIMESTAMPTZ,
+                             finished_at TIMESTAMPTZ,
+                             claimed_at TIMESTAMPTZ
+);
+
+CREATE INDEX device_jobs_home_id_idx ON device_jobs (home_id, id);
+CREATE INDEX device_jobs_status_idx ON device_jobs (status) WHERE status <> 'completed';
+
+-- device_id is not a foreign key so results outlive deleted devices.
+CREATE TABLE device_job_results (
+                                    job_id INTEGER NOT NULL REFERENCES device_jobs(id) ON DELETE CASCADE,
+                                    device_id TEXT NOT NULL,
+                                    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+                                    error TEXT NOT NULL DEFAULT '',
+                                    finished_at TIMESTAMPTZ,
+                                    PRIMARY KEY (job_id, device_id)
+);
+
 -- Create Device Data Table
+-- Partitioned by day or month on created_at. Partitions are created and
+-- dropped by the platform (see TELEMETRY_PARTITION_INTERVAL).
 CREATE TABLE device_data (
-                             id SERIAL PRIMARY KEY,
+                             id BIGSERIAL,
                              device_id TEXT NOT NULL,
                              home_id INTEGER REFERENCES homes(id),
                              data JSONB NOT NULL,
-                             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                             schema_violations TEXT[],
+                             created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE INDEX device_data_device_created_idx ON device_data (device_id, created_at DESC);
+
+-- Create Retention Policies Table
+CREATE TABLE retention_policies (
+                                    id SERIAL PRIMARY KEY,
+                                    home_id INTEGER REFERENCES homes(id),
+                                    device_type_id INTEGER REFERENCES device_types(id),
+                                    retention_days INTEGER NOT NULL CHECK (retention_days > 0),
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                    CHECK ((home_id IS NULL) <> (device_type_id IS NULL))
 );
 
+CREATE UNIQUE INDEX retention_policies_home_idx ON retention_policies (home_id) WHERE home_id IS NOT NULL;
+CREATE UNIQUE INDEX retention_policies_device_type_idx ON retention_policies (device_type_id) WHERE device_type_id IS NOT NULL;
+
 -- Create Device Analytics Table
 CREATE TABLE device_analytics (
                                   id SERIAL PRIMARY KEY,
@@ -69,5 +348,49 @@ CREATE TABLE device_analytics (
                                   avg_value NUMERIC,
                                   sum_value NUMERIC,
                                   aggregation_period TIMESTAMP,
+                                  granularity TEXT NOT NULL DEFAULT 'hour',
                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE UNIQUE INDEX device_analytics_bucket_idx
+    ON device_analytics (device_id, COALESCE(home_id, 0), metric, granularity, aggregation_period);
+
+-- Create Rate Limits Table
+-- Token buckets shared by all replicas when RATE_LIMIT_STORE=postgres.
+CREATE TABLE rate_limits (
+                             key TEXT PRIMARY KEY,
+                             tokens DOUBLE PRECISION NOT NULL,
+                             updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Create Audit Log Table
+-- Who changed what, kept for good: actor and target are not foreign keys so
+-- entries outlive them, and a trigger rejects updates and deletes.
+CREATE TABLE audit_log (
+                           id BIGSERIAL PRIMARY KEY,
+                           actor_id INTEGER,
+                           actor_name TEXT NOT NULL DEFAULT '',
+                           action TEXT NOT NULL,
+                           target_type TEXT NOT NULL,
+                           target_id TEXT NOT NULL,
+                           home_ids INTEGER[] NOT NULL DEFAULT '{}',
+                           before JSONB,
+                           after JSONB,
+                           ip TEXT NOT NULL DEFAULT '',
+                           created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_home_ids_idx ON audit_log USING GIN (home_ids);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id, id);
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id, id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
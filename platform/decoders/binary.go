@@ -0,0 +1,144 @@
+package decoders
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// BinaryField describes one value inside a fixed-layout binary frame.
+type BinaryField struct {
+	Name      string  `json:"name"`
+	Offset    int     `json:"offset"`
+	Type      string  `json:"type"`                 // uint8, int8, uint16, int16, uint32, int32, uint64, int64, float32, float64, bool, string
+	Length    int     `json:"length,omitempty"`     // byte length, string fields only
+	ByteOrder string  `json:"byte_order,omitempty"` // overrides the layout's byte order
+	Scale     float64 `json:"scale,omitempty"`      // multiplier applied to numeric values, 0 means 1
+	Bias      float64 `json:"bias,omitempty"`       // added after scaling
+}
+
+// BinaryLayout is a declarative description of a compact binary frame.
+type BinaryLayout struct {
+	ByteOrder string        `json:"byte_order"` // "big" (default) or "little"
+	Fields    []BinaryField `json:"fields"`
+}
+
+// BinaryDecoder decodes frames according to a BinaryLayout.
+type BinaryDecoder struct {
+	layout BinaryLayout
+}
+
+// NewBinaryDecoder validates the layout and returns a decoder for it.
+func NewBinaryDecoder(layout BinaryLayout) (*BinaryDecoder, error) {
+	if _, err := byteOrder(layout.ByteOrder); err != nil {
+		return nil, err
+	}
+	for _, field := range layout.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("binary layout field at offset %d has no name", field.Offset)
+		}
+		if field.Offset < 0 {
+			return nil, fmt.Errorf("binary layout field %s has a negative offset", field.Name)
+		}
+		if _, err := byteOrder(field.ByteOrder); err != nil {
+			return nil, fmt.Errorf("binary layout field %s: %w", field.Name, err)
+		}
+		size, err := fieldSize(field)
+		if err != nil {
+			return nil, err
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("binary layout field %s has no length", field.Name)
+		}
+	}
+	return &BinaryDecoder{layout: layout}, nil
+}
+
+func (d *BinaryDecoder) Decode(payload []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(d.layout.Fields))
+	for _, field := range d.layout.Fields {
+		size, _ := fieldSize(field)
+		if field.Offset+size > len(payload) {
+			return nil, fmt.Errorf("binary payload too short for field %s: need %d bytes, got %d", field.Name, field.Offset+size, len(payload))
+		}
+
+		orderName := field.ByteOrder
+		if orderName == "" {
+			orderName = d.layout.ByteOrder
+		}
+		order, _ := byteOrder(orderName)
+
+		value := readField(payload[field.Offset:field.Offset+size], field.Type, order)
+		if number, ok := value.(float64); ok {
+			if field.Scale != 0 {
+				number *= field.Scale
+			}
+			value = number + field.Bias
+		}
+		data[field.Name] = value
+	}
+	return data, nil
+}
+
+func byteOrder(name string) (binary.ByteOrder, error) {
+	switch name {
+	case "", "big":
+		return binary.BigEndian, nil
+	case "little":
+		return binary.LittleEndian, nil
+	default:
+		return nil, fmt.Errorf("unsupported byte order: %s", name)
+	}
+}
+
+func fieldSize(field BinaryField) (int, error) {
+	switch field.Type {
+	case "uint8", "int8", "bool":
+		return 1, nil
+	case "uint16", "int16":
+		return 2, nil
+	case "uint32", "int32", "float32":
+		return 4, nil
+	case "uint64", "int64", "float64":
+		return 8, nil
+	case "string":
+		return field.Length, nil
+	default:
+		return 0, fmt.Errorf("binary layout field %s has unsupported type %q", field.Name, field.Type)
+	}
+}
+
+// readField returns numbers as float64 to match what the JSON decoder produces.
+func readField(b []byte, fieldType string, order binary.ByteOrder) interface{} {
+	switch fieldType {
+	case "uint8":
+		return float64(b[0])
+	case "int8":
+		return float64(int8(b[0]))
+	case "bool":
+		return b[0] != 0
+	case "uint16":
+		return float64(order.Uint16(b))
+	case "int16":
+		return float64(int16(order.Uint16(b)))
+	case "uint32":
+		return float64(order.Uint32(b))
+	case "int32":
+		return float64(int32(order.Uint32(b)))
+	case "float32":
+		return float64(math.Float32frombits(order.Uint32(b)))
+	case "uint64":
+		return float64(order.Uint64(b))
+	case "int64":
+		return float64(int64(order.Uint64(b)))
+	case "float64":
+		return math.Float64frombits(order.Uint64(b))
+	default:
+		// Strings are NUL padded to their declared length.
+		end := len(b)
+		for end > 0 && b[end-1] == 0 {
+			end--
+		}
+		return string(b[:end])
+	}
+}
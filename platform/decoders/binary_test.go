@@ -0,0 +1,119 @@
+package decoders
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBinaryDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  BinaryLayout
+		payload []byte
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "big endian by default",
+			layout:  BinaryLayout{Fields: []BinaryField{{Name: "v", Type: "uint16"}}},
+			payload: []byte{0x01, 0x02},
+			want:    map[string]interface{}{"v": 258.0},
+		},
+		{
+			name:    "little endian",
+			layout:  BinaryLayout{ByteOrder: "little", Fields: []BinaryField{{Name: "v", Type: "uint16"}}},
+			payload: []byte{0x01, 0x02},
+			want:    map[string]interface{}{"v": 513.0},
+		},
+		{
+			name: "field byte order overrides the layout's",
+			layout: BinaryLayout{ByteOrder: "little", Fields: []BinaryField{
+				{Name: "le", Type: "uint16"},
+				{Name: "be", Offset: 2, Type: "uint16", ByteOrder: "big"},
+			}},
+			payload: []byte{0x01, 0x02, 0x01, 0x02},
+			want:    map[string]interface{}{"le": 513.0, "be": 258.0},
+		},
+		{
+			name: "signed values",
+			layout: BinaryLayout{Fields: []BinaryField{
+				{Name: "i8", Type: "int8"},
+				{Name: "i16", Offset: 1, Type: "int16"},
+				{Name: "i32", Offset: 3, Type: "int32"},
+			}},
+			payload: []byte{0xff, 0xff, 0xfe, 0xff, 0xff, 0xff, 0xfd},
+			want:    map[string]interface{}{"i8": -1.0, "i16": -2.0, "i32": -3.0},
+		},
+		{
+			name: "scale then bias",
+			layout: BinaryLayout{Fields: []BinaryField{
+				{Name: "temp", Type: "int16", Scale: 0.1, Bias: -40},
+				{Name: "raw", Offset: 2, Type: "uint8", Bias: 1},
+			}},
+			payload: []byte{0x01, 0xf4, 0x05},
+			want:    map[string]interface{}{"temp": 500*0.1 - 40, "raw": 6.0},
+		},
+		{
+			name: "floats, booleans and strings",
+			layout: BinaryLayout{Fields: []BinaryField{
+				{Name: "f", Type: "float32"},
+				{Name: "on", Offset: 4, Type: "bool"},
+				{Name: "label", Offset: 5, Type: "string", Length: 4},
+			}},
+			payload: []byte{0x3f, 0xc0, 0x00, 0x00, 0x01, 'a', 'b', 0, 0},
+			want:    map[string]interface{}{"f": 1.5, "on": true, "label": "ab"},
+		},
+		{
+			name:    "short payload",
+			layout:  BinaryLayout{Fields: []BinaryField{{Name: "v", Offset: 1, Type: "uint32"}}},
+			payload: []byte{0x00, 0x01, 0x02, 0x03},
+			wantErr: "too short for field v",
+		},
+		{
+			name:    "empty payload",
+			layout:  BinaryLayout{Fields: []BinaryField{{Name: "v", Type: "uint8"}}},
+			wantErr: "too short for field v",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder, err := NewBinaryDecoder(tt.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := decoder.Decode(tt.payload)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("decoded %v, want %v", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBinaryDecoderRejectsBadLayouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout BinaryLayout
+	}{
+		{"byte order", BinaryLayout{ByteOrder: "middle"}},
+		{"field byte order", BinaryLayout{Fields: []BinaryField{{Name: "v", Type: "uint8", ByteOrder: "middle"}}}},
+		{"unnamed field", BinaryLayout{Fields: []BinaryField{{Type: "uint8"}}}},
+		{"negative offset", BinaryLayout{Fields: []BinaryField{{Name: "v", Offset: -1, Type: "uint8"}}}},
+		{"unknown type", BinaryLayout{Fields: []BinaryField{{Name: "v", Type: "uint24"}}}},
+		{"string without length", BinaryLayout{Fields: []BinaryField{{Name: "v", Type: "string"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewBinaryDecoder(tt.layout); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
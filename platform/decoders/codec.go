@@ -0,0 +1,68 @@
+package decoders
+
+import (
+	"fmt"
+
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	cborHandle    = &codec.CborHandle{}
+	msgpackHandle = &codec.MsgpackHandle{}
+)
+
+func init() {
+	msgpackHandle.RawToString = true
+}
+
+func decodeCBOR(payload []byte) (map[string]interface{}, error) {
+	return decodeWithHandle(payload, cborHandle, FormatCBOR)
+}
+
+func decodeMsgPack(payload []byte) (map[string]interface{}, error) {
+	return decodeWithHandle(payload, msgpackHandle, FormatMsgPack)
+}
+
+func decodeWithHandle(payload []byte, handle codec.Handle, format string) (map[string]interface{}, error) {
+	var raw interface{}
+	if err := codec.NewDecoderBytes(payload, handle).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("error decoding %s payload: %w", format, err)
+	}
+
+	data, ok := normalize(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s payload is not a map", format)
+	}
+	return data, nil
+}
+
+// normalize rewrites decoded values into the shapes encoding/json produces,
+// so downstream code sees the same types whatever the wire format was.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = normalize(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalize(val)
+		}
+		return t
+	case int64:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,60 @@
+package decoders
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config lists the custom decoders to register at start-up. It is read from
+// the JSON file named by the DECODERS_CONFIG environment variable.
+type Config struct {
+	Binary   map[string]BinaryLayout   `json:"binary"`
+	Protobuf map[string]ProtobufConfig `json:"protobuf"`
+}
+
+// ProtobufConfig points at a compiled descriptor set and the message to decode.
+// DescriptorSet is resolved relative to the config file.
+type ProtobufConfig struct {
+	DescriptorSet string `json:"descriptor_set"`
+	Message       string `json:"message"`
+}
+
+// LoadFile registers every decoder described in the config file at path.
+func (r *Registry) LoadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading decoder config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return fmt.Errorf("error parsing decoder config %s: %w", path, err)
+	}
+
+	for name, layout := range cfg.Binary {
+		decoder, err := NewBinaryDecoder(layout)
+		if err != nil {
+			return fmt.Errorf("error loading binary decoder %s: %w", name, err)
+		}
+		r.Register(name, decoder)
+	}
+
+	for name, pb := range cfg.Protobuf {
+		descriptorPath := pb.DescriptorSet
+		if !filepath.IsAbs(descriptorPath) {
+			descriptorPath = filepath.Join(filepath.Dir(path), descriptorPath)
+		}
+		descriptorSet, err := os.ReadFile(descriptorPath)
+		if err != nil {
+			return fmt.Errorf("error reading descriptor set for decoder %s: %w", name, err)
+		}
+		decoder, err := NewProtobufDecoder(descriptorSet, pb.Message)
+		if err != nil {
+			return fmt.Errorf("error loading protobuf decoder %s: %w", name, err)
+		}
+		r.Register(name, decoder)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package decoders
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Built-in decoder names.
+const (
+	FormatJSON    = "json"
+	FormatCBOR    = "cbor"
+	FormatMsgPack = "msgpack"
+)
+
+// Decoder converts a raw device payload into the field map stored in DeviceData.Data.
+type Decoder interface {
+	Decode(payload []byte) (map[string]interface{}, error)
+}
+
+// DecoderFunc adapts an ordinary function to the Decoder interface.
+type DecoderFunc func(payload []byte) (map[string]interface{}, error)
+
+func (f DecoderFunc) Decode(payload []byte) (map[string]interface{}, error) {
+	return f(payload)
+}
+
+// Registry holds the named decoders available to the ingestion pipeline.
+type Registry struct {
+	mu       sync.RWMutex
+	decoders map[string]Decoder
+	fallback string
+}
+
+// NewRegistry returns a registry with the JSON, CBOR and MessagePack decoders
+// registered and JSON used when a device does not select a decoder.
+func NewRegistry() *Registry {
+	r := &Registry{
+		decoders: make(map[string]Decoder),
+		fallback: FormatJSON,
+	}
+	r.Register(FormatJSON, DecoderFunc(decodeJSON))
+	r.Register(FormatCBOR, DecoderFunc(decodeCBOR))
+	r.Register(FormatMsgPack, DecoderFunc(decodeMsgPack))
+	return r
+}
+
+func (r *Registry) Register(name string, decoder Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[name] = decoder
+}
+
+func (r *Registry) Get(name string) (Decoder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	decoder, ok := r.decoders[name]
+	return decoder, ok
+}
+
+// Resolve returns the decoder for the first non-empty name, in order of
+// precedence (e.g. the device's own setting before its type's default).
+// When every name is empty the fallback decoder is used.
+func (r *Registry) Resolve(names ...string) (Decoder, error) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		decoder, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown payload decoder: %s", name)
+		}
+		return decoder, nil
+	}
+	decoder, ok := r.Get(r.fallback)
+	if !ok {
+		return nil, fmt.Errorf("fallback payload decoder %s is not registered", r.fallback)
+	}
+	return decoder, nil
+}
+
+func decodeJSON(payload []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("error decoding JSON payload: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,126 @@
+package decoders
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// named returns a decoder that ignores the payload and reports its name.
+func named(name string) Decoder {
+	return DecoderFunc(func([]byte) (map[string]interface{}, error) {
+		return map[string]interface{}{"by": name}, nil
+	})
+}
+
+func TestResolve(t *testing.T) {
+	r := NewRegistry()
+	r.Register("device-format", named("device"))
+	r.Register("type-format", named("type"))
+
+	tests := []struct {
+		name       string
+		device     string
+		deviceType string
+		want       string
+		wantErr    bool
+	}{
+		{name: "device over type", device: "device-format", deviceType: "type-format", want: "device"},
+		{name: "type when the device has none", deviceType: "type-format", want: "type"},
+		{name: "default when neither has one", want: "json"},
+		{name: "built-in by name", device: FormatJSON, deviceType: "type-format", want: "json"},
+		{name: "unknown device decoder", device: "nope", deviceType: "type-format", wantErr: true},
+		{name: "unknown type decoder", deviceType: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder, err := r.Resolve(tt.device, tt.deviceType)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for an unknown decoder")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := decoder.Decode([]byte(`{"by": "json"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data["by"] != tt.want {
+				t.Errorf("resolved the %v decoder, want %s", data["by"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeNormalizes(t *testing.T) {
+	// Map keys that are not strings, and the integer and float32 types the
+	// codecs produce, come out as encoding/json would give them.
+	payload := map[interface{}]interface{}{
+		"temp":  float32(21.5),
+		uint(1): "first",
+		"nested": map[interface{}]interface{}{
+			true: int64(-3),
+		},
+		"list": []interface{}{uint64(7), map[interface{}]interface{}{2: "two"}},
+	}
+	want := map[string]interface{}{
+		"temp":   21.5,
+		"1":      "first",
+		"nested": map[string]interface{}{"true": -3.0},
+		"list":   []interface{}{7.0, map[string]interface{}{"2": "two"}},
+	}
+
+	tests := []struct {
+		format string
+		handle codec.Handle
+	}{
+		{FormatCBOR, &codec.CborHandle{}},
+		{FormatMsgPack, &codec.MsgpackHandle{WriteExt: true}},
+	}
+	r := NewRegistry()
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var encoded []byte
+			if err := codec.NewEncoderBytes(&encoded, tt.handle).Encode(payload); err != nil {
+				t.Fatal(err)
+			}
+			decoder, err := r.Resolve(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := decoder.Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, want) {
+				t.Errorf("decoded %#v, want %#v", data, want)
+			}
+			if _, err := json.Marshal(data); err != nil {
+				t.Errorf("decoded data is not JSON-compatible: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsNonMap(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCBOR, FormatMsgPack} {
+		var encoded []byte
+		switch format {
+		case FormatJSON:
+			encoded = []byte(`[1, 2]`)
+		case FormatCBOR:
+			codec.NewEncoderBytes(&encoded, &codec.CborHandle{}).MustEncode([]int{1, 2})
+		case FormatMsgPack:
+			codec.NewEncoderBytes(&encoded, &codec.MsgpackHandle{}).MustEncode([]int{1, 2})
+		}
+		decoder, _ := NewRegistry().Get(format)
+		if _, err := decoder.Decode(encoded); err == nil {
+			t.Errorf("%s: expected an error for a payload that is not a map", format)
+		}
+	}
+}
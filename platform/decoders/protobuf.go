@@ -0,0 +1,58 @@
+package decoders
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ProtobufDecoder decodes payloads as a single message type described by a
+// registered descriptor, without generated Go code.
+type ProtobufDecoder struct {
+	descriptor protoreflect.MessageDescriptor
+}
+
+// NewProtobufDecoder builds a decoder for messageName from a serialized
+// FileDescriptorSet, as written by `protoc --include_imports --descriptor_set_out`.
+func NewProtobufDecoder(descriptorSet []byte, messageName string) (*ProtobufDecoder, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("error parsing descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("error building descriptors: %w", err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, fmt.Errorf("error finding message %s: %w", messageName, err)
+	}
+
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", messageName)
+	}
+	return &ProtobufDecoder{descriptor: msgDesc}, nil
+}
+
+func (d *ProtobufDecoder) Decode(payload []byte) (map[string]interface{}, error) {
+	msg := dynamicpb.NewMessage(d.descriptor)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("error decoding protobuf payload as %s: %w", d.descriptor.FullName(), err)
+	}
+
+	// Go through the canonical JSON mapping so field names, enums and
+	// well-known types come out the same way a JSON device would send them.
+	encoded, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error converting protobuf payload: %w", err)
+	}
+	return decodeJSON(encoded)
+}
@@ -0,0 +1,567 @@
+// Package dto defines the bodies and query parameters of the HTTP API,
+// separate from the domain models so that what clients may send is declared
+// and validated independently of what is stored.
+//
+// Validation rules are declared in binding tags and checked by gin when a
+// request is bound.
+package dto
+
+import (
+	"time"
+
+	"PragatiIot/platform/models"
+)
+
+// RegisterRequest is the body of POST /register.
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50,username"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	// Password is limited to 72 bytes, the most bcrypt uses.
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// User returns the user the request registers. The password is hashed by
+// the service.
+func (r RegisterRequest) User() models.User {
+	return models.User{Username: r.Username, Email: r.Email}
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// MFALoginRequest is the body of POST /login/mfa: the MFA token from POST
+// /login and a TOTP or recovery code.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+// MFACodeRequest confirms an MFA change with a TOTP code, or a recovery
+// code where one is accepted.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+// VerifyEmailRequest is the body of POST /verify-email.
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordRequest is the body of POST /forgot-password.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest is the body of POST /reset-password.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// SSOCallbackQuery holds the query parameters the identity provider
+// redirects back to GET /oidc/{provider}/callback with: a code, or an error
+// if the user did not sign in.
+type SSOCallbackQuery struct {
+	State            string `form:"state" binding:"required"`
+	Code             string `form:"code" binding:"required_without=Error"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// ChangePasswordRequest is the body of POST /auth/me/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// UpdateProfileRequest is the body of PATCH /auth/me. Omitted fields are
+// left unchanged.
+type UpdateProfileRequest struct {
+	Email *string `json:"email,omitempty" binding:"omitempty,email,max=254"`
+}
+
+// DeleteAccountRequest is the body of DELETE /auth/me, confirming the
+// deletion with the user's password.
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AddHomeRequest is the body of POST /auth/home. The home is owned by the
+// authenticated user, and by the organization if org_id is set.
+type AddHomeRequest struct {
+	HomeName string `json:"home_name" binding:"required,max=100"`
+	OrgID    *int   `json:"org_id,omitempty" binding:"omitempty,gt=0"`
+}
+
+// Home returns the home the request creates for ownerID.
+func (r AddHomeRequest) Home(ownerID int) models.Home {
+	return models.Home{HomeName: r.HomeName, UserID: ownerID, OrgID: r.OrgID}
+}
+
+// AddUserToHomeRequest is the body of POST /auth/home/add-user. UserID must
+// be a service account, and Role names a built-in role or one of the home's
+// custom roles.
+type AddUserToHomeRequest struct {
+	HomeID int    `json:"home_id" binding:"required,gt=0"`
+	UserID int    `json:"user_id" binding:"required,gt=0"`
+	Role   string `json:"role" binding:"required,max=50"`
+}
+
+// CreateRoleRequest is the body of POST /auth/home/role.
+type CreateRoleRequest struct {
+	HomeID      int      `json:"home_id" binding:"required,gt=0"`
+	Name        string   `json:"name" binding:"required,max=50"`
+	Permissions []string `json:"permissions" binding:"required,min=1,dive,required"`
+}
+
+// UpdateRoleRequest is the body of PUT /auth/home/role. It replaces the
+// role's name and permissions.
+type UpdateRoleRequest struct {
+	HomeID      int      `json:"home_id" binding:"required,gt=0"`
+	RoleID      int      `json:"role_id" binding:"required,gt=0"`
+	Name        string   `json:"name" binding:"required,max=50"`
+	Permissions []string `json:"permissions" binding:"required,min=1,dive,required"`
+}
+
+// CreateSpaceRequest is the body of POST /auth/home/space. A space without
+// parent_id sits directly in the home.
+type CreateSpaceRequest struct {
+	HomeID   int    `json:"home_id" binding:"required,gt=0"`
+	ParentID *int   `json:"parent_id" binding:"omitempty,gt=0"`
+	Name     string `json:"name" binding:"required,max=100"`
+	Kind     string `json:"kind" binding:"required,oneof=building floor room zone"`
+}
+
+// UpdateSpaceRequest is the body of PUT /auth/home/space. It replaces the
+// space's parent, name and kind.
+type UpdateSpaceRequest struct {
+	HomeID   int    `json:"home_id" binding:"required,gt=0"`
+	SpaceID  int    `json:"space_id" binding:"required,gt=0"`
+	ParentID *int   `json:"parent_id" binding:"omitempty,gt=0"`
+	Name     string `json:"name" binding:"required,max=100"`
+	Kind     string `json:"kind" binding:"required,oneof=building floor room zone"`
+}
+
+// CreateInvitationRequest is the body of POST /auth/home/invitation. It
+// names the invitee by email address or username. Role names a built-in
+// role or one of the home's custom roles.
+type CreateInvitationRequest struct {
+	HomeID    int        `json:"home_id" binding:"required,gt=0"`
+	Email     string     `json:"email" binding:"required_without=Username,excluded_with=Username,omitempty,email,max=254"`
+	Username  string     `json:"username" binding:"omitempty,max=50"`
+	Role      string     `json:"role" binding:"required,max=50"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// InvitationQuery selects an invitation to a home.
+type InvitationQuery struct {
+	HomeID       int `form:"home_id" binding:"required,gt=0"`
+	InvitationID int `form:"invitation_id" binding:"required,gt=0"`
+}
+
+// InvitationAnswerRequest is the body of POST /auth/me/invitations/accept
+// and /auth/me/invitations/decline.
+type InvitationAnswerRequest struct {
+	InvitationID int `json:"invitation_id" binding:"required,gt=0"`
+}
+
+// SetHomeMFARequest is the body of PUT /auth/home/mfa.
+type SetHomeMFARequest struct {
+	HomeID     int   `json:"home_id" binding:"required,gt=0"`
+	RequireMFA *bool `json:"require_mfa" binding:"required"`
+}
+
+// AddDeviceRequest is the body of POST /auth/device. The device is owned by
+// the authenticated user.
+type AddDeviceRequest struct {
+	DeviceID       string    `json:"device_id" binding:"required,max=64"`
+	ChannelID      string    `json:"channel_id" binding:"required,max=128"`
+	ProductionDate time.Time `json:"production_date"`
+	// Warranty is in months.
+	Warranty     int    `json:"warranty" binding:"gte=0,lte=1200"`
+	Location     string `json:"location" binding:"max=200"`
+	IsActive     bool   `json:"is_active"`
+	HomeID       *int   `json:"home_id,omitempty" binding:"omitempty,gt=0"`
+	DeviceTypeID *int   `json:"device_type_id,omitempty" binding:"omitempty,gt=0"`
+	Decoder      string `json:"decoder,omitempty" binding:"max=64"`
+}
+
+// Device returns the device the request creates for ownerID.
+func (r AddDeviceRequest) Device(ownerID int) models.Device {
+	return models.Device{
+		DeviceID:       r.DeviceID,
+		ChannelID:      r.ChannelID,
+		ProductionDate: r.ProductionDate,
+		Warranty:       r.Warranty,
+		Location:       r.Location,
+		IsActive:       r.IsActive,
+		UserID:         ownerID,
+		HomeID:         r.HomeID,
+		DeviceTypeID:   r.DeviceTypeID,
+		Decoder:        r.Decoder,
+	}
+}
+
+// AssignDeviceRequest is the body of POST /auth/device/assign-home. Omitting
+// home_id removes the device from its home.
+type AssignDeviceRequest struct {
+	DeviceID string `json:"device_id" binding:"required"`
+	HomeID   *int   `json:"home_id" binding:"omitempty,gt=0"`
+}
+
+// AssignSpaceRequest is the body of POST /auth/device/assign-space.
+// Omitting space_id takes the device out of its space.
+type AssignSpaceRequest struct {
+	DeviceID string `json:"device_id" binding:"required"`
+	SpaceID  *int   `json:"space_id" binding:"omitempty,gt=0"`
+}
+
+// SetTagsRequest is the body of PUT /auth/device/tags. It replaces the
+// device's tags; an empty map clears them.
+type SetTagsRequest struct {
+	DeviceID string            `json:"device_id" binding:"required"`
+	Tags     map[string]string `json:"tags" binding:"max=50,dive,keys,min=1,max=64,endkeys,max=256"`
+}
+
+// DeviceSelectorRequest picks the devices of a dynamic group. A tag given
+// the value "*" matches devices with the tag set to anything.
+type DeviceSelectorRequest struct {
+	Tags         map[string]string `json:"tags" binding:"max=50,dive,keys,min=1,max=64,endkeys,max=256"`
+	SpaceID      *int              `json:"space_id" binding:"omitempty,gt=0"`
+	DeviceTypeID *int              `json:"device_type_id" binding:"omitempty,gt=0"`
+	IsActive     *bool             `json:"is_active"`
+}
+
+// Selector returns the selector the request describes, or nil without one.
+func (r *DeviceSelectorRequest) Selector() *models.DeviceSelector {
+	if r == nil {
+		return nil
+	}
+	return &models.DeviceSelector{Tags: r.Tags, SpaceID: r.SpaceID, DeviceTypeID: r.DeviceTypeID, IsActive: r.IsActive}
+}
+
+// CreateGroupRequest is the body of POST /auth/home/group. Dynamic groups
+// need a selector; static groups are given their devices through
+// /auth/home/group/members.
+type CreateGroupRequest struct {
+	HomeID   int                    `json:"home_id" binding:"required,gt=0"`
+	Name     string                 `json:"name" binding:"required,max=100"`
+	Kind     string                 `json:"kind" binding:"required,oneof=static dynamic"`
+	Selector *DeviceSelectorRequest `json:"selector"`
+}
+
+// UpdateGroupRequest is the body of PUT /auth/home/group. It renames the
+// group and replaces a dynamic group's selector.
+type UpdateGroupRequest struct {
+	HomeID   int                    `json:"home_id" binding:"required,gt=0"`
+	GroupID  int                    `json:"group_id" binding:"required,gt=0"`
+	Name     string                 `json:"name" binding:"required,max=100"`
+	Selector *DeviceSelectorRequest `json:"selector"`
+}
+
+// GroupMembersRequest is the body of POST /auth/home/group/members. It adds
+// and removes devices of a static group.
+type GroupMembersRequest struct {
+	HomeID  int      `json:"home_id" binding:"required,gt=0"`
+	GroupID int      `json:"group_id" binding:"required,gt=0"`
+	Add     []string `json:"add" binding:"max=1000,dive,required,max=64"`
+	Remove  []string `json:"remove" binding:"max=1000,dive,required,max=64"`
+}
+
+// CreateJobRequest is the body of POST /auth/home/group/job. Each action
+// reads its own fields: command and params for command, target_home_id for
+// assign_home, active for set_active, and firmware_version and firmware_url
+// for firmware.
+type CreateJobRequest struct {
+	HomeID          int                    `json:"home_id" binding:"required,gt=0"`
+	GroupID         int                    `json:"group_id" binding:"required,gt=0"`
+	Action          string                 `json:"action" binding:"required,oneof=command assign_home set_active firmware"`
+	Command         string                 `json:"command" binding:"max=64"`
+	Params          map[string]interface{} `json:"params"`
+	TargetHomeID    *int                   `json:"target_home_id" binding:"omitempty,gt=0"`
+	Active          *bool                  `json:"active"`
+	FirmwareVersion string                 `json:"firmware_version" binding:"max=64"`
+	FirmwareURL     string                 `json:"firmware_url" binding:"omitempty,url,max=2048"`
+}
+
+// Job returns the job the request creates for the user.
+func (r CreateJobRequest) Job(userID int) models.DeviceJob {
+	job := models.DeviceJob{HomeID: r.HomeID, GroupID: &r.GroupID, Action: r.Action, CreatedBy: &userID}
+	switch r.Action {
+	case models.JobCommand:
+		job.Params = models.JobParams{Command: r.Command, Params: r.Params}
+	case models.JobAssignHome:
+		job.Params = models.JobParams{HomeID: r.TargetHomeID}
+	case models.JobSetActive:
+		job.Params = models.JobParams{Active: r.Active}
+	case models.JobFirmware:
+		job.Params = models.JobParams{Version: r.FirmwareVersion, URL: r.FirmwareURL}
+	}
+	return job
+}
+
+// SendCommandRequest is the body of POST /auth/device/command. Params are
+// checked against the command's declaration in the device type.
+type SendCommandRequest struct {
+	DeviceID string                 `json:"device_id" binding:"required"`
+	Command  string                 `json:"command" binding:"required,max=64"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// TransferDeviceRequest is the body of POST /auth/device/transfer.
+// KeepTelemetry keeps the device's readings for the current owner;
+// otherwise they are purged when the recipient accepts.
+type TransferDeviceRequest struct {
+	DeviceID      string `json:"device_id" binding:"required"`
+	ToUsername    string `json:"to_username" binding:"required,max=50"`
+	KeepTelemetry bool   `json:"keep_telemetry"`
+}
+
+// AcceptTransferRequest is the body of POST /auth/device/transfer/accept.
+// The device moves to ChannelID, or to a random channel if it is empty.
+type AcceptTransferRequest struct {
+	TransferID int    `json:"transfer_id" binding:"required,gt=0"`
+	ChannelID  string `json:"channel_id" binding:"omitempty,max=128"`
+}
+
+// TransferAnswerRequest is the body of POST /auth/device/transfer/decline
+// and /auth/device/transfer/cancel.
+type TransferAnswerRequest struct {
+	TransferID int `json:"transfer_id" binding:"required,gt=0"`
+}
+
+// TelemetryFieldRequest declares a telemetry value or command parameter.
+type TelemetryFieldRequest struct {
+	Name     string   `json:"name" binding:"required,max=64"`
+	Type     string   `json:"type" binding:"required,oneof=number integer boolean string"`
+	Unit     string   `json:"unit,omitempty" binding:"max=32"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Required bool     `json:"required,omitempty"`
+}
+
+// DeviceCommandRequest declares a command a device type accepts.
+type DeviceCommandRequest struct {
+	Name        string                  `json:"name" binding:"required,max=64"`
+	Description string                  `json:"description,omitempty" binding:"max=500"`
+	Params      []TelemetryFieldRequest `json:"params,omitempty" binding:"dive"`
+}
+
+// AddDeviceTypeRequest is the body of POST /auth/device-type.
+type AddDeviceTypeRequest struct {
+	Name           string                  `json:"name" binding:"required,max=100"`
+	Manufacturer   string                  `json:"manufacturer" binding:"max=100"`
+	Model          string                  `json:"model" binding:"max=100"`
+	Decoder        string                  `json:"decoder,omitempty" binding:"max=64"`
+	ValidationMode string                  `json:"validation_mode,omitempty" binding:"omitempty,oneof=reject tag coerce"`
+	Fields         []TelemetryFieldRequest `json:"fields" binding:"dive"`
+	Commands       []DeviceCommandRequest  `json:"commands" binding:"dive"`
+}
+
+// DeviceType returns the device type the request creates.
+func (r AddDeviceTypeRequest) DeviceType() models.DeviceType {
+	commands := make([]models.DeviceCommand, len(r.Commands))
+	for i, cmd := range r.Commands {
+		commands[i] = models.DeviceCommand{Name: cmd.Name, Description: cmd.Description, Params: telemetryFields(cmd.Params)}
+	}
+	return models.DeviceType{
+		Name:           r.Name,
+		Manufacturer:   r.Manufacturer,
+		Model:          r.Model,
+		Decoder:        r.Decoder,
+		ValidationMode: r.ValidationMode,
+		Fields:         telemetryFields(r.Fields),
+		Commands:       commands,
+	}
+}
+
+func telemetryFields(fields []TelemetryFieldRequest) []models.TelemetryField {
+	out := make([]models.TelemetryField, len(fields))
+	for i, f := range fields {
+		out[i] = models.TelemetryField{Name: f.Name, Type: f.Type, Unit: f.Unit, Min: f.Min, Max: f.Max, Required: f.Required}
+	}
+	return out
+}
+
+// SetRetentionPolicyRequest is the body of PUT /auth/retention-policy.
+type SetRetentionPolicyRequest struct {
+	HomeID        int `json:"home_id" binding:"required,gt=0"`
+	RetentionDays int `json:"retention_days" binding:"required,gt=0,lte=3650"`
+}
+
+// RetentionPolicy returns the policy the request sets.
+func (r SetRetentionPolicyRequest) RetentionPolicy() models.RetentionPolicy {
+	homeID := r.HomeID
+	return models.RetentionPolicy{HomeID: &homeID, RetentionDays: r.RetentionDays}
+}
+
+// UserQuery selects the user whose homes or devices are listed.
+type UserQuery struct {
+	UserID int `form:"user_id" binding:"required,gt=0"`
+}
+
+// HomeQuery selects a home.
+type HomeQuery struct {
+	HomeID int `form:"home_id" binding:"required,gt=0"`
+}
+
+// RoleQuery selects a custom role of a home.
+type RoleQuery struct {
+	HomeID int `form:"home_id" binding:"required,gt=0"`
+	RoleID int `form:"role_id" binding:"required,gt=0"`
+}
+
+// DeviceTypeQuery selects a device type.
+type DeviceTypeQuery struct {
+	ID int `form:"id" binding:"required,gt=0"`
+}
+
+// SpaceQuery selects a space of a home.
+type SpaceQuery struct {
+	HomeID  int `form:"home_id" binding:"required,gt=0"`
+	SpaceID int `form:"space_id" binding:"required,gt=0"`
+}
+
+// DeviceQuery selects a device.
+type DeviceQuery struct {
+	DeviceID string `form:"device_id" binding:"required"`
+}
+
+// GroupQuery selects a device group of a home.
+type GroupQuery struct {
+	HomeID  int `form:"home_id" binding:"required,gt=0"`
+	GroupID int `form:"group_id" binding:"required,gt=0"`
+}
+
+// JobQuery selects a device job of a home.
+type JobQuery struct {
+	HomeID int `form:"home_id" binding:"required,gt=0"`
+	JobID  int `form:"job_id" binding:"required,gt=0"`
+}
+
+// JobsQuery selects the latest device jobs of a home, 50 unless limit says.
+type JobsQuery struct {
+	HomeID int `form:"home_id" binding:"required,gt=0"`
+	Limit  int `form:"limit" binding:"gte=0,lte=200"`
+}
+
+// HomeDevicesQuery selects the devices of a home, in a space if space_id is
+// given.
+type HomeDevicesQuery struct {
+	HomeID  int  `form:"home_id" binding:"required,gt=0"`
+	SpaceID *int `form:"space_id" binding:"omitempty,gt=0"`
+}
+
+// SpaceTelemetryQuery selects readings of the devices of a home, in a space
+// if space_id is given. The time range is read separately.
+type SpaceTelemetryQuery struct {
+	HomeID  int  `form:"home_id" binding:"required,gt=0"`
+	SpaceID *int `form:"space_id" binding:"omitempty,gt=0"`
+	Limit   int  `form:"limit" binding:"gte=0,lte=10000"`
+}
+
+// SpaceAnalyticsQuery selects rollups combined per space of a home. The
+// time range is read separately.
+type SpaceAnalyticsQuery struct {
+	HomeID      int    `form:"home_id" binding:"required,gt=0"`
+	SpaceID     *int   `form:"space_id" binding:"omitempty,gt=0"`
+	Kind        string `form:"kind" binding:"omitempty,oneof=building floor room zone"`
+	Metric      string `form:"metric" binding:"max=64"`
+	Granularity string `form:"granularity" binding:"omitempty,oneof=hour day"`
+}
+
+// TelemetryQuery selects readings of a device. The time range is read
+// separately.
+type TelemetryQuery struct {
+	DeviceID string `form:"device_id" binding:"required"`
+	Limit    int    `form:"limit" binding:"gte=0,lte=10000"`
+}
+
+// AnalyticsQuery selects rollups of a device in a home. The time range is
+// read separately.
+type AnalyticsQuery struct {
+	DeviceID    string `form:"device_id" binding:"required"`
+	HomeID      int    `form:"home_id" binding:"required,gt=0"`
+	Granularity string `form:"granularity" binding:"omitempty,oneof=hour day"`
+}
+
+// AuditQuery filters the audit log. Zero values do not filter. Entries come
+// newest first; pass the smallest id of a page as before_id for the next.
+type AuditQuery struct {
+	HomeID     int    `form:"home_id" binding:"gte=0"`
+	ActorID    int    `form:"actor_id" binding:"gte=0"`
+	Action     string `form:"action"`
+	TargetType string `form:"target_type"`
+	TargetID   string `form:"target_id"`
+	From       string `form:"from" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To         string `form:"to" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	BeforeID   int64  `form:"before_id" binding:"gte=0"`
+	Limit      int    `form:"limit" binding:"gte=0,lte=1000"`
+}
+
+// CreateServiceAccountRequest names a new service account. The name is its
+// username, so it follows the same rules.
+type CreateServiceAccountRequest struct {
+	Name string `json:"name" binding:"required,min=3,max=50,username"`
+}
+
+// ServiceAccountQuery selects a service account.
+type ServiceAccountQuery struct {
+	ID int `form:"id" binding:"required,gt=0"`
+}
+
+// CreateAPIKeyRequest describes a new key for a service account. Without
+// home_ids the key can reach every home the service account belongs to;
+// without expires_at it does not expire.
+type CreateAPIKeyRequest struct {
+	ServiceAccountID int        `json:"service_account_id" binding:"required,gt=0"`
+	Name             string     `json:"name" binding:"required,max=100"`
+	Scopes           []string   `json:"scopes" binding:"required,min=1"`
+	HomeIDs          []int      `json:"home_ids" binding:"omitempty,dive,gt=0"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+}
+
+// APIKeyQuery selects the keys of a service account.
+type APIKeyQuery struct {
+	ServiceAccountID int `form:"service_account_id" binding:"required,gt=0"`
+}
+
+// RevokeAPIKeyRequest selects the key to revoke.
+type RevokeAPIKeyRequest struct {
+	ID int `json:"id" binding:"required,gt=0"`
+}
+
+// CreateOrganizationRequest is the body of POST /auth/org.
+type CreateOrganizationRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	BillingEmail string `json:"billing_email" binding:"omitempty,email,max=254"`
+}
+
+// UpdateOrganizationRequest is the body of PATCH /auth/org. Fields left out
+// are unchanged.
+type UpdateOrganizationRequest struct {
+	OrgID        int     `json:"org_id" binding:"required,gt=0"`
+	Name         *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	BillingEmail *string `json:"billing_email,omitempty" binding:"omitempty,email,max=254"`
+}
+
+// OrgQuery selects an organization.
+type OrgQuery struct {
+	OrgID int `form:"org_id" binding:"required,gt=0"`
+}
+
+// SetOrgMemberRequest is the body of POST /auth/org/member.
+type SetOrgMemberRequest struct {
+	OrgID  int    `json:"org_id" binding:"required,gt=0"`
+	UserID int    `json:"user_id" binding:"required,gt=0"`
+	Role   string `json:"role" binding:"required,oneof=owner admin operator viewer"`
+}
+
+// OrgMemberQuery selects a member of an organization.
+type OrgMemberQuery struct {
+	OrgID  int `form:"org_id" binding:"required,gt=0"`
+	UserID int `form:"user_id" binding:"required,gt=0"`
+}
@@ -0,0 +1,718 @@
+package dto
+
+import (
+	"time"
+
+	"PragatiIot/platform/models"
+)
+
+// MessageResponse is the body of a successful request that returns no
+// resource.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// LoginResponse is the body of a successful POST /login. A user with MFA
+// enabled gets no token but an MFA token to pass to POST /login/mfa with a
+// code.
+type LoginResponse struct {
+	Message     string `json:"message"`
+	Token       string `json:"token,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// CreatedResponse is the body of a request that created a resource with a
+// numeric ID.
+type CreatedResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id"`
+}
+
+// UserResponse is a user as clients see it. The password hash is never
+// returned.
+type UserResponse struct {
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// FromUser returns the response for u.
+func FromUser(u models.User) UserResponse {
+	return UserResponse{ID: u.ID, Username: u.Username, Email: u.Email, EmailVerified: u.EmailVerified, MFAEnabled: u.MFAEnabled, CreatedAt: u.CreatedAt}
+}
+
+// MFAEnrollmentResponse is a new TOTP secret. URI is the otpauth:// URI to
+// show as a QR code; Secret is for typing in by hand.
+type MFAEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse lists new recovery codes, which cannot be shown
+// again.
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ServiceAccountResponse is a service account as its owner sees it.
+type ServiceAccountResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   int       `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FromServiceAccount returns the response for the service account u.
+func FromServiceAccount(u models.User) ServiceAccountResponse {
+	r := ServiceAccountResponse{ID: u.ID, Name: u.Username, CreatedAt: u.CreatedAt}
+	if u.OwnerID != nil {
+		r.OwnerID = *u.OwnerID
+	}
+	return r
+}
+
+// FromServiceAccounts returns the responses for accounts, never nil.
+func FromServiceAccounts(accounts []models.User) []ServiceAccountResponse {
+	return mapAll(accounts, FromServiceAccount)
+}
+
+// APIKeyResponse is an API key as its owner sees it. The key itself is only
+// returned when it is created.
+type APIKeyResponse struct {
+	ID               int        `json:"id"`
+	ServiceAccountID int        `json:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	Scopes           []string   `json:"scopes"`
+	HomeIDs          []int      `json:"home_ids"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// FromAPIKey returns the response for k.
+func FromAPIKey(k models.APIKey) APIKeyResponse {
+	homeIDs := k.HomeIDs
+	if homeIDs == nil {
+		homeIDs = []int{}
+	}
+	return APIKeyResponse{
+		ID:               k.ID,
+		ServiceAccountID: k.ServiceAccountID,
+		Name:             k.Name,
+		Prefix:           k.Prefix,
+		Scopes:           k.Scopes,
+		HomeIDs:          homeIDs,
+		ExpiresAt:        k.ExpiresAt,
+		RevokedAt:        k.RevokedAt,
+		LastUsedAt:       k.LastUsedAt,
+		CreatedAt:        k.CreatedAt,
+	}
+}
+
+// FromAPIKeys returns the responses for keys, never nil.
+func FromAPIKeys(keys []models.APIKey) []APIKeyResponse {
+	return mapAll(keys, FromAPIKey)
+}
+
+// CreatedAPIKeyResponse is a new API key with the key itself, which cannot
+// be shown again.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// HomeResponse is a home as clients see it.
+type HomeResponse struct {
+	ID         int       `json:"id"`
+	HomeName   string    `json:"home_name"`
+	OwnerID    int       `json:"user_id"`
+	OrgID      *int      `json:"org_id,omitempty"`
+	RequireMFA bool      `json:"require_mfa"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FromHome returns the response for h.
+func FromHome(h models.Home) HomeResponse {
+	return HomeResponse{ID: h.ID, HomeName: h.HomeName, OwnerID: h.UserID, OrgID: h.OrgID, RequireMFA: h.RequireMFA, CreatedAt: h.CreatedAt}
+}
+
+// FromHomes returns the responses for homes, never nil.
+func FromHomes(homes []models.Home) []HomeResponse {
+	return mapAll(homes, FromHome)
+}
+
+// RoleResponse is a role as clients see it. Built-in roles have no home.
+type RoleResponse struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	HomeID      *int     `json:"home_id,omitempty"`
+	BuiltIn     bool     `json:"built_in"`
+	Permissions []string `json:"permissions"`
+}
+
+// FromRole returns the response for r.
+func FromRole(r models.Role) RoleResponse {
+	permissions := r.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return RoleResponse{ID: r.ID, Name: r.Name, HomeID: r.HomeID, BuiltIn: r.HomeID == nil, Permissions: permissions}
+}
+
+// FromRoles returns the responses for roles, never nil.
+func FromRoles(roles []models.Role) []RoleResponse {
+	return mapAll(roles, FromRole)
+}
+
+// SpaceResponse is a space of a home. Top-level spaces have no parent.
+type SpaceResponse struct {
+	ID        int       `json:"id"`
+	HomeID    int       `json:"home_id"`
+	ParentID  *int      `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FromSpace returns the response for sp.
+func FromSpace(sp models.Space) SpaceResponse {
+	return SpaceResponse{ID: sp.ID, HomeID: sp.HomeID, ParentID: sp.ParentID, Name: sp.Name, Kind: sp.Kind, CreatedAt: sp.CreatedAt}
+}
+
+// FromSpaces returns the responses for spaces, never nil.
+func FromSpaces(spaces []models.Space) []SpaceResponse {
+	return mapAll(spaces, FromSpace)
+}
+
+// DeviceTagsResponse is the tags of a device.
+type DeviceTagsResponse struct {
+	DeviceID string            `json:"device_id"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// FromDeviceTags returns the response for the device's tags, never nil.
+func FromDeviceTags(deviceID string, tags map[string]string) DeviceTagsResponse {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return DeviceTagsResponse{DeviceID: deviceID, Tags: tags}
+}
+
+// DeviceSelectorResponse is the selector of a dynamic group.
+type DeviceSelectorResponse struct {
+	Tags         map[string]string `json:"tags,omitempty"`
+	SpaceID      *int              `json:"space_id,omitempty"`
+	DeviceTypeID *int              `json:"device_type_id,omitempty"`
+	IsActive     *bool             `json:"is_active,omitempty"`
+}
+
+// DeviceGroupResponse is a device group of a home. Only dynamic groups have
+// a selector.
+type DeviceGroupResponse struct {
+	ID        int                     `json:"id"`
+	HomeID    int                     `json:"home_id"`
+	Name      string                  `json:"name"`
+	Kind      string                  `json:"kind"`
+	Selector  *DeviceSelectorResponse `json:"selector,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// FromDeviceGroup returns the response for g.
+func FromDeviceGroup(g models.DeviceGroup) DeviceGroupResponse {
+	r := DeviceGroupResponse{ID: g.ID, HomeID: g.HomeID, Name: g.Name, Kind: g.Kind, CreatedAt: g.CreatedAt}
+	if sel := g.Selector; sel != nil {
+		r.Selector = &DeviceSelectorResponse{Tags: sel.Tags, SpaceID: sel.SpaceID, DeviceTypeID: sel.DeviceTypeID, IsActive: sel.IsActive}
+	}
+	return r
+}
+
+// FromDeviceGroups returns the responses for groups, never nil.
+func FromDeviceGroups(groups []models.DeviceGroup) []DeviceGroupResponse {
+	return mapAll(groups, FromDeviceGroup)
+}
+
+// DeviceJobResponse is a bulk job with its progress. Pending counts the
+// devices not tried yet; the job is completed when none are left.
+type DeviceJobResponse struct {
+	ID              int                    `json:"id"`
+	HomeID          int                    `json:"home_id"`
+	GroupID         *int                   `json:"group_id,omitempty"`
+	Action          string                 `json:"action"`
+	Command         string                 `json:"command,omitempty"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	TargetHomeID    *int                   `json:"target_home_id,omitempty"`
+	Active          *bool                  `json:"active,omitempty"`
+	FirmwareVersion string                 `json:"firmware_version,omitempty"`
+	FirmwareURL     string                 `json:"firmware_url,omitempty"`
+	Status          string                 `json:"status"`
+	Total           int                    `json:"total"`
+	Succeeded       int                    `json:"succeeded"`
+	Failed          int                    `json:"failed"`
+	Pending         int                    `json:"pending"`
+	CreatedBy       *int                   `json:"created_by,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	StartedAt       *time.Time             `json:"started_at,omitempty"`
+	FinishedAt      *time.Time             `json:"finished_at,omitempty"`
+}
+
+// FromDeviceJob returns the response for j.
+func FromDeviceJob(j models.DeviceJob) DeviceJobResponse {
+	return DeviceJobResponse{
+		ID:              j.ID,
+		HomeID:          j.HomeID,
+		GroupID:         j.GroupID,
+		Action:          j.Action,
+		Command:         j.Params.Command,
+		Params:          j.Params.Params,
+		TargetHomeID:    j.Params.HomeID,
+		Active:          j.Params.Active,
+		FirmwareVersion: j.Params.Version,
+		FirmwareURL:     j.Params.URL,
+		Status:          j.Status,
+		Total:           j.Total,
+		Succeeded:       j.Succeeded,
+		Failed:          j.Failed,
+		Pending:         j.Total - j.Succeeded - j.Failed,
+		CreatedBy:       j.CreatedBy,
+		CreatedAt:       j.CreatedAt,
+		StartedAt:       j.StartedAt,
+		FinishedAt:      j.FinishedAt,
+	}
+}
+
+// FromDeviceJobs returns the responses for jobs, never nil.
+func FromDeviceJobs(jobs []models.DeviceJob) []DeviceJobResponse {
+	return mapAll(jobs, FromDeviceJob)
+}
+
+// DeviceJobResultResponse is the outcome of a bulk job on one device.
+type DeviceJobResultResponse struct {
+	DeviceID   string     `json:"device_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// FromDeviceJobResult returns the response for r.
+func FromDeviceJobResult(r models.DeviceJobResult) DeviceJobResultResponse {
+	return DeviceJobResultResponse{DeviceID: r.DeviceID, Status: r.Status, Error: r.Error, FinishedAt: r.FinishedAt}
+}
+
+// FromDeviceJobResults returns the responses for results, never nil.
+func FromDeviceJobResults(results []models.DeviceJobResult) []DeviceJobResultResponse {
+	return mapAll(results, FromDeviceJobResult)
+}
+
+// DeviceResponse is a device as clients see it.
+type DeviceResponse struct {
+	ID             int       `json:"id"`
+	DeviceID       string    `json:"device_id"`
+	ChannelID      string    `json:"channel_id"`
+	ProductionDate time.Time `json:"production_date"`
+	Warranty       int       `json:"warranty"`
+	Location       string    `json:"location"`
+	IsActive       bool      `json:"is_active"`
+	OwnerID        int       `json:"user_id"`
+	HomeID         *int      `json:"home_id,omitempty"`
+	SpaceID        *int      `json:"space_id,omitempty"`
+	DeviceTypeID   *int      `json:"device_type_id,omitempty"`
+	Decoder        string    `json:"decoder,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FromDevice returns the response for d.
+func FromDevice(d models.Device) DeviceResponse {
+	return DeviceResponse{
+		ID:             d.ID,
+		DeviceID:       d.DeviceID,
+		ChannelID:      d.ChannelID,
+		ProductionDate: d.ProductionDate,
+		Warranty:       d.Warranty,
+		Location:       d.Location,
+		IsActive:       d.IsActive,
+		OwnerID:        d.UserID,
+		HomeID:         d.HomeID,
+		SpaceID:        d.SpaceID,
+		DeviceTypeID:   d.DeviceTypeID,
+		Decoder:        d.Decoder,
+		CreatedAt:      d.CreatedAt,
+	}
+}
+
+// FromDevices returns the responses for devices, never nil.
+func FromDevices(devices []models.Device) []DeviceResponse {
+	return mapAll(devices, FromDevice)
+}
+
+// TelemetryFieldResponse is a declared telemetry value or command parameter.
+type TelemetryFieldResponse struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Unit     string   `json:"unit,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Required bool     `json:"required,omitempty"`
+}
+
+func fromTelemetryField(f models.TelemetryField) TelemetryFieldResponse {
+	return TelemetryFieldResponse{Name: f.Name, Type: f.Type, Unit: f.Unit, Min: f.Min, Max: f.Max, Required: f.Required}
+}
+
+// DeviceCommandResponse is a command a device type accepts.
+type DeviceCommandResponse struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Params      []TelemetryFieldResponse `json:"params,omitempty"`
+}
+
+func fromDeviceCommand(cmd models.DeviceCommand) DeviceCommandResponse {
+	resp := DeviceCommandResponse{Name: cmd.Name, Description: cmd.Description}
+	if len(cmd.Params) > 0 {
+		resp.Params = mapAll(cmd.Params, fromTelemetryField)
+	}
+	return resp
+}
+
+// DeviceTypeResponse is a device type as clients see it.
+type DeviceTypeResponse struct {
+	ID             int                      `json:"id"`
+	Name           string                   `json:"name"`
+	Manufacturer   string                   `json:"manufacturer"`
+	Model          string                   `json:"model"`
+	Decoder        string                   `json:"decoder,omitempty"`
+	ValidationMode string                   `json:"validation_mode,omitempty"`
+	Fields         []TelemetryFieldResponse `json:"fields"`
+	Commands       []DeviceCommandResponse  `json:"commands"`
+	CreatedAt      time.Time                `json:"created_at"`
+}
+
+// FromDeviceType returns the response for t.
+func FromDeviceType(t models.DeviceType) DeviceTypeResponse {
+	return DeviceTypeResponse{
+		ID:             t.ID,
+		Name:           t.Name,
+		Manufacturer:   t.Manufacturer,
+		Model:          t.Model,
+		Decoder:        t.Decoder,
+		ValidationMode: t.ValidationMode,
+		Fields:         mapAll(t.Fields, fromTelemetryField),
+		Commands:       mapAll(t.Commands, fromDeviceCommand),
+		CreatedAt:      t.CreatedAt,
+	}
+}
+
+// FromDeviceTypes returns the responses for types, never nil.
+func FromDeviceTypes(types []models.DeviceType) []DeviceTypeResponse {
+	return mapAll(types, FromDeviceType)
+}
+
+// ReadingResponse is one stored telemetry reading.
+type ReadingResponse struct {
+	DeviceID         string                 `json:"device_id"`
+	HomeID           *int                   `json:"home_id"`
+	Data             map[string]interface{} `json:"data"`
+	SchemaViolations []string               `json:"schema_violations,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// FromReading returns the response for d.
+func FromReading(d models.DeviceData) ReadingResponse {
+	return ReadingResponse{
+		DeviceID:         d.DeviceID,
+		HomeID:           d.HomeID,
+		Data:             d.Data,
+		SchemaViolations: d.SchemaViolations,
+		CreatedAt:        d.CreatedAt,
+	}
+}
+
+// FromReadings returns the responses for readings, never nil.
+func FromReadings(readings []models.DeviceData) []ReadingResponse {
+	return mapAll(readings, FromReading)
+}
+
+// AnalyticsResponse is a rollup of one numeric field over an hour or a day.
+type AnalyticsResponse struct {
+	DeviceID    string    `json:"device_id"`
+	HomeID      *int      `json:"home_id"`
+	Metric      string    `json:"metric"`
+	Granularity string    `json:"granularity"`
+	Period      time.Time `json:"period"`
+	Count       int       `json:"count"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	Sum         float64   `json:"sum"`
+}
+
+// FromAnalytics returns the response for a.
+func FromAnalytics(a models.DeviceAnalytics) AnalyticsResponse {
+	return AnalyticsResponse{
+		DeviceID:    a.DeviceID,
+		HomeID:      a.HomeID,
+		Metric:      a.Metric,
+		Granularity: a.Granularity,
+		Period:      a.Period,
+		Count:       a.Count,
+		Min:         a.Min,
+		Max:         a.Max,
+		Avg:         a.Avg,
+		Sum:         a.Sum,
+	}
+}
+
+// FromAnalyticsList returns the responses for rollups, never nil.
+func FromAnalyticsList(rollups []models.DeviceAnalytics) []AnalyticsResponse {
+	return mapAll(rollups, FromAnalytics)
+}
+
+// SpaceAnalyticsResponse combines the rollups of one numeric field over an
+// hour or a day for the devices in a space and the spaces inside it.
+type SpaceAnalyticsResponse struct {
+	SpaceID     int       `json:"space_id"`
+	Metric      string    `json:"metric"`
+	Granularity string    `json:"granularity"`
+	Period      time.Time `json:"period"`
+	Devices     int       `json:"devices"`
+	Count       int       `json:"count"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	Sum         float64   `json:"sum"`
+}
+
+// FromSpaceAnalytics returns the response for a.
+func FromSpaceAnalytics(a models.SpaceAnalytics) SpaceAnalyticsResponse {
+	return SpaceAnalyticsResponse{
+		SpaceID:     a.SpaceID,
+		Metric:      a.Metric,
+		Granularity: a.Granularity,
+		Period:      a.Period,
+		Devices:     a.Devices,
+		Count:       a.Count,
+		Min:         a.Min,
+		Max:         a.Max,
+		Avg:         a.Avg,
+		Sum:         a.Sum,
+	}
+}
+
+// FromSpaceAnalyticsList returns the responses for analytics, never nil.
+func FromSpaceAnalyticsList(analytics []models.SpaceAnalytics) []SpaceAnalyticsResponse {
+	return mapAll(analytics, FromSpaceAnalytics)
+}
+
+// RetentionPolicyResponse is a retention policy for a home or a device type.
+type RetentionPolicyResponse struct {
+	ID            int  `json:"id"`
+	HomeID        *int `json:"home_id,omitempty"`
+	DeviceTypeID  *int `json:"device_type_id,omitempty"`
+	RetentionDays int  `json:"retention_days"`
+}
+
+// FromRetentionPolicy returns the response for p.
+func FromRetentionPolicy(p models.RetentionPolicy) RetentionPolicyResponse {
+	return RetentionPolicyResponse{ID: p.ID, HomeID: p.HomeID, DeviceTypeID: p.DeviceTypeID, RetentionDays: p.RetentionDays}
+}
+
+// FromRetentionPolicies returns the responses for policies, never nil.
+func FromRetentionPolicies(policies []models.RetentionPolicy) []RetentionPolicyResponse {
+	return mapAll(policies, FromRetentionPolicy)
+}
+
+// AuditEntryResponse is one entry of the audit log. Before and after hold
+// only the fields of the target that changed.
+type AuditEntryResponse struct {
+	ID         int64                  `json:"id"`
+	ActorID    *int                   `json:"actor_id"`
+	ActorName  string                 `json:"actor_name,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	HomeIDs    []int                  `json:"home_ids"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// FromAuditEntry returns the response for e.
+func FromAuditEntry(e models.AuditEntry) AuditEntryResponse {
+	homeIDs := e.HomeIDs
+	if homeIDs == nil {
+		homeIDs = []int{}
+	}
+	return AuditEntryResponse{
+		ID:         e.ID,
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		HomeIDs:    homeIDs,
+		Before:     e.Before,
+		After:      e.After,
+		IP:         e.IP,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+// FromAuditEntries returns the responses for entries, never nil.
+func FromAuditEntries(entries []models.AuditEntry) []AuditEntryResponse {
+	return mapAll(entries, FromAuditEntry)
+}
+
+// OrganizationResponse is an organization as its members see it, with the
+// caller's role in it. A null quota is unlimited.
+type OrganizationResponse struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Plan         string    `json:"plan"`
+	BillingEmail string    `json:"billing_email"`
+	MaxHomes     *int      `json:"max_homes"`
+	MaxDevices   *int      `json:"max_devices"`
+	MaxMembers   *int      `json:"max_members"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FromOrganization returns the response for o as seen by a member with
+// role.
+func FromOrganization(o models.Organization, role string) OrganizationResponse {
+	return OrganizationResponse{
+		ID:           o.ID,
+		Name:         o.Name,
+		Plan:         o.Plan,
+		BillingEmail: o.BillingEmail,
+		MaxHomes:     o.MaxHomes,
+		MaxDevices:   o.MaxDevices,
+		MaxMembers:   o.MaxMembers,
+		Role:         role,
+		CreatedAt:    o.CreatedAt,
+	}
+}
+
+// OrgUsageResponse is what an organization uses of its plan's quotas.
+type OrgUsageResponse struct {
+	OrgID      int    `json:"org_id"`
+	Plan       string `json:"plan"`
+	Homes      int    `json:"homes"`
+	MaxHomes   *int   `json:"max_homes"`
+	Devices    int    `json:"devices"`
+	MaxDevices *int   `json:"max_devices"`
+	Members    int    `json:"members"`
+	MaxMembers *int   `json:"max_members"`
+}
+
+// FromOrgUsage returns the response for the usage u of o.
+func FromOrgUsage(o models.Organization, u models.OrgUsage) OrgUsageResponse {
+	return OrgUsageResponse{
+		OrgID:      o.ID,
+		Plan:       o.Plan,
+		Homes:      u.Homes,
+		MaxHomes:   o.MaxHomes,
+		Devices:    u.Devices,
+		MaxDevices: o.MaxDevices,
+		Members:    u.Members,
+		MaxMembers: o.MaxMembers,
+	}
+}
+
+// OrgMemberResponse is a member of an organization.
+type OrgMemberResponse struct {
+	UserID    int       `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FromOrgMember returns the response for m.
+func FromOrgMember(m models.OrgMember) OrgMemberResponse {
+	return OrgMemberResponse{UserID: m.UserID, Role: m.Role, CreatedAt: m.CreatedAt}
+}
+
+// FromOrgMembers returns the responses for members, never nil.
+func FromOrgMembers(members []models.OrgMember) []OrgMemberResponse {
+	return mapAll(members, FromOrgMember)
+}
+
+// mapAll maps every element of in, returning an empty rather than a nil
+// slice so that lists are encoded as [] instead of null.
+func mapAll[T, R any](in []T, f func(T) R) []R {
+	out := make([]R, len(in))
+	for i, v := range in {
+		out[i] = f(v)
+	}
+	return out
+}
+
+// InvitationResponse is an invitation to a home as the inviter and invitee
+// see it.
+type InvitationResponse struct {
+	ID        int       `json:"id"`
+	HomeID    int       `json:"home_id"`
+	HomeName  string    `json:"home_name"`
+	Email     string    `json:"email"`
+	UserID    *int      `json:"user_id,omitempty"`
+	Role      string    `json:"role"`
+	InvitedBy int       `json:"invited_by"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FromInvitation returns the response for i.
+func FromInvitation(i models.HomeInvitation) InvitationResponse {
+	return InvitationResponse{
+		ID:        i.ID,
+		HomeID:    i.HomeID,
+		HomeName:  i.HomeName,
+		Email:     i.Email,
+		UserID:    i.UserID,
+		Role:      i.RoleName,
+		InvitedBy: i.InvitedBy,
+		Status:    i.Status,
+		ExpiresAt: i.ExpiresAt,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+// FromInvitations returns the responses for invitations, never nil.
+func FromInvitations(invitations []models.HomeInvitation) []InvitationResponse {
+	return mapAll(invitations, FromInvitation)
+}
+
+// TransferResponse is a transfer of a device as its parties see it.
+type TransferResponse struct {
+	ID            int       `json:"id"`
+	DeviceID      string    `json:"device_id"`
+	FromUserID    int       `json:"from_user_id"`
+	ToUserID      int       `json:"to_user_id"`
+	KeepTelemetry bool      `json:"keep_telemetry"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// FromTransfer returns the response for t.
+func FromTransfer(t models.DeviceTransfer) TransferResponse {
+	return TransferResponse{
+		ID:            t.ID,
+		DeviceID:      t.DeviceID,
+		FromUserID:    t.FromUserID,
+		ToUserID:      t.ToUserID,
+		KeepTelemetry: t.KeepTelemetry,
+		Status:        t.Status,
+		CreatedAt:     t.CreatedAt,
+	}
+}
+
+// FromTransfers returns the responses for transfers, never nil.
+func FromTransfers(transfers []models.DeviceTransfer) []TransferResponse {
+	return mapAll(transfers, FromTransfer)
+}
@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"PragatiIot/platform/models"
+)
+
+func TestUserResponseOmitsPasswordHash(t *testing.T) {
+	user := models.User{ID: 1, Username: "alice", Email: "alice@example.com", PasswordHash: "$2a$10$secret"}
+	for name, v := range map[string]any{"response": FromUser(user), "model": user} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "secret") || strings.Contains(string(b), "password") {
+			t.Errorf("%s leaks the password hash: %s", name, b)
+		}
+	}
+}
+
+func TestEmptyListsEncodeAsArrays(t *testing.T) {
+	for name, v := range map[string]any{
+		"homes":    FromHomes(nil),
+		"devices":  FromDevices(nil),
+		"readings": FromReadings(nil),
+		"types":    FromDeviceTypes(nil),
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "[]" {
+			t.Errorf("%s: got %s, want []", name, b)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyEmail verifies a user's email address
+// @Summary Verify email address
+// @Description Verifies the email address with the single-use token from the verification email
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param token body dto.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} dto.MessageResponse "Email address verified"
+// @Failure 400 {object} Problem "Invalid, used or expired token"
+// @Router /verify-email [post]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req dto.VerifyEmailRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Email address verified"})
+}
+
+// ForgotPassword mails a password reset link
+// @Summary Forgot password
+// @Description Mails a single-use password reset link to the address if it belongs to a user. The response is the same whether or not it does.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param email body dto.ForgotPasswordRequest true "Email address"
+// @Success 202 {object} dto.MessageResponse "Reset link sent if the address is registered"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Router /forgot-password [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.MessageResponse{Message: "If the address is registered, a reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password with a reset token
+// @Summary Reset password
+// @Description Sets a new password with the single-use token from the password reset email
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param reset body dto.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} dto.MessageResponse "Password reset"
+// @Failure 400 {object} Problem "Invalid payload, or invalid, used or expired token"
+// @Router /reset-password [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Password reset"})
+}
+
+// GetProfile returns the authenticated user
+// @Summary Get own profile
+// @Description Returns the authenticated user
+// @Tags account
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} dto.UserResponse "The authenticated user"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/me [get]
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromUser(user))
+}
+
+// UpdateProfile updates the authenticated user
+// @Summary Update own profile
+// @Description Updates the authenticated user's email address. A new address is unverified until the link mailed to it is followed.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param profile body dto.UpdateProfileRequest true "Fields to change"
+// @Success 200 {object} dto.UserResponse "The updated user"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 409 {object} Problem "Email already taken"
+// @Router /auth/me [patch]
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	var req dto.UpdateProfileRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err = h.accountService.UpdateProfile(c.Request.Context(), user.ID, req.Email)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromUser(user))
+}
+
+// ChangePassword changes the authenticated user's password
+// @Summary Change own password
+// @Description Changes the authenticated user's password after checking the current one
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param password body dto.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} dto.MessageResponse "Password changed"
+// @Failure 400 {object} Problem "Invalid payload or incorrect current password"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/me/password [post]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var req dto.ChangePasswordRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.ChangePassword(c.Request.Context(), user.ID, req.CurrentPassword, req.NewPassword); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Password changed"})
+}
+
+// ResendVerification mails a new verification link
+// @Summary Resend verification email
+// @Description Mails a new verification link to the authenticated user, replacing any earlier one
+// @Tags account
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} dto.MessageResponse "Verification email sent"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 409 {object} Problem "Email address already verified"
+// @Router /auth/me/verify-email [post]
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.ResendVerification(c.Request.Context(), user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.MessageResponse{Message: "Verification email sent"})
+}
+
+// DeleteAccount deletes the authenticated user
+// @Summary Delete own account
+// @Description Deletes the authenticated user after checking their password. Each home they own passes to its earliest other Admin member, or is deleted if there is none. Their devices are deleted with their telemetry.
+// @Tags account
+// @Accept json
+// @Security ApiKeyAuth
+// @Param confirmation body dto.DeleteAccountRequest true "Password"
+// @Success 204 "Account deleted"
+// @Failure 400 {object} Problem "Invalid payload or incorrect password"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/me [delete]
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+	var req dto.DeleteAccountRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.accountService.DeleteAccount(c.Request.Context(), user.ID, req.Password); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
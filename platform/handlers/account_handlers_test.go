@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/mailer"
+	"PragatiIot/platform/middleware"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mailbox is a Mailer that keeps the messages it is sent.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the link of the last message sent to
+// address.
+func (m *mailbox) lastToken(t *testing.T, address string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != address {
+			continue
+		}
+		match := tokenPattern.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("no token in %q", m.messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Fatalf("no message sent to %s", address)
+	return ""
+}
+
+func TestAccountLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+
+	var me dto.UserResponse
+	if code := s.do(t, http.MethodGet, "/auth/me", "alice", nil, &me); code != http.StatusOK || me.Username != "alice" || me.EmailVerified {
+		t.Fatalf("GET /auth/me: status %d, %+v", code, me)
+	}
+
+	verify := dto.VerifyEmailRequest{Token: s.mail.lastToken(t, "alice@example.com")}
+	if code := s.do(t, http.MethodPost, "/verify-email", "", verify, nil); code != http.StatusOK {
+		t.Errorf("verify email: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/verify-email", "", verify, nil); code != http.StatusBadRequest {
+		t.Errorf("verify email again: status %d, want 400", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/me/verify-email", "alice", nil, nil); code != http.StatusConflict {
+		t.Errorf("resend to a verified address: status %d, want 409", code)
+	}
+
+	// Forgot password answers the same for unknown addresses.
+	sent := len(s.mail.messages)
+	if code := s.do(t, http.MethodPost, "/forgot-password", "", dto.ForgotPasswordRequest{Email: "nobody@example.com"}, nil); code != http.StatusAccepted {
+		t.Errorf("forgot password, unknown address: status %d", code)
+	}
+	if len(s.mail.messages) != sent {
+		t.Error("mail sent to an unknown address")
+	}
+	if code := s.do(t, http.MethodPost, "/forgot-password", "", dto.ForgotPasswordRequest{Email: "alice@example.com"}, nil); code != http.StatusAccepted {
+		t.Errorf("forgot password: status %d", code)
+	}
+	reset := dto.ResetPasswordRequest{Token: s.mail.lastToken(t, "alice@example.com"), Password: "battery staple"}
+	if code := s.do(t, http.MethodPost, "/reset-password", "", reset, nil); code != http.StatusOK {
+		t.Errorf("reset password: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice", Password: "battery staple"}, nil); code != http.StatusOK {
+		t.Errorf("login with the new password: status %d", code)
+	}
+
+	email := "alice@example.org"
+	if code := s.do(t, http.MethodPatch, "/auth/me", "alice", dto.UpdateProfileRequest{Email: &email}, &me); code != http.StatusOK || me.Email != email || me.EmailVerified {
+		t.Errorf("PATCH /auth/me: status %d, %+v", code, me)
+	}
+
+	if code := s.do(t, http.MethodDelete, "/auth/me", "alice", dto.DeleteAccountRequest{Password: "correct horse"}, nil); code != http.StatusBadRequest {
+		t.Errorf("delete with the old password: status %d, want 400", code)
+	}
+	if code := s.do(t, http.MethodDelete, "/auth/me", "alice", dto.DeleteAccountRequest{Password: "battery staple"}, nil); code != http.StatusNoContent {
+		t.Errorf("delete account: status %d", code)
+	}
+	if code := s.do(t, http.MethodGet, "/auth/me", "alice", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET /auth/me after deletion: status %d, want 401", code)
+	}
+}
+
+func TestTokenRevocation(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+
+	var login dto.LoginResponse
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice", Password: "correct horse"}, &login); code != http.StatusOK {
+		t.Fatalf("login: status %d", code)
+	}
+	if code := s.doToken(t, http.MethodGet, "/auth/me", login.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /auth/me: status %d", code)
+	}
+
+	// A token signed with another key or past its lifetime is refused.
+	forged, err := middleware.NewTokens(middleware.TokenConfig{Key: []byte("another key that is 32 bytes long"), TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := s.users["alice"]
+	if code := s.doToken(t, http.MethodGet, "/auth/me", s.createToken(t, forged, alice), nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("token signed with another key: status %d, want 401", code)
+	}
+	jwt.TimeFunc = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	expired := s.createToken(t, s.tokens, alice)
+	jwt.TimeFunc = time.Now
+	if code := s.doToken(t, http.MethodGet, "/auth/me", expired, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expired token: status %d, want 401", code)
+	}
+
+	// Changing the password signs the user out everywhere.
+	change := dto.ChangePasswordRequest{CurrentPassword: "correct horse", NewPassword: "battery staple"}
+	if code := s.doToken(t, http.MethodPost, "/auth/me/password", login.Token, change, nil); code != http.StatusOK {
+		t.Fatalf("change password: status %d", code)
+	}
+	if code := s.doToken(t, http.MethodGet, "/auth/me", login.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("token issued before the password change: status %d, want 401", code)
+	}
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice", Password: "battery staple"}, &login); code != http.StatusOK {
+		t.Fatalf("login with the new password: status %d", code)
+	}
+	if code := s.doToken(t, http.MethodGet, "/auth/me", login.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("token issued after the password change: status %d", code)
+	}
+}
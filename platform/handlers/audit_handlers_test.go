@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.register(t, "alice")
+	s.register(t, "mallory")
+
+	var created dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Home"}, &created); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	path := fmt.Sprintf("/auth/audit?home_id=%d", created.ID)
+
+	var entries []dto.AuditEntryResponse
+	if code := s.do(t, http.MethodGet, path, "alice", nil, &entries); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(entries) != 1 || entries[0].Action != models.AuditHomeCreate {
+		t.Fatalf("entries = %+v, want the home's creation", entries)
+	}
+	// httptest requests come from 192.0.2.1.
+	if e := entries[0]; e.ActorID == nil || *e.ActorID != alice.ID || e.IP != "192.0.2.1" {
+		t.Errorf("entry made by %v from %q, want alice from 192.0.2.1", e.ActorID, e.IP)
+	}
+
+	if code := s.do(t, http.MethodGet, path, "mallory", nil, nil); code != http.StatusForbidden {
+		t.Errorf("another user's home: status %d", code)
+	}
+	var problem Problem
+	if code := s.do(t, http.MethodGet, "/auth/audit?from=yesterday", "alice", nil, &problem); code != http.StatusBadRequest {
+		t.Errorf("invalid from: status %d", code)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "from" {
+		t.Errorf("invalid from: problem %+v", problem)
+	}
+}
@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceGroupHandler struct {
+	groupService  *services.DeviceGroupService
+	jobService    *services.DeviceJobService
+	deviceService *services.DeviceService
+	homeService   *services.HomeService
+}
+
+func NewDeviceGroupHandler(groupService *services.DeviceGroupService, jobService *services.DeviceJobService, deviceService *services.DeviceService, homeService *services.HomeService) *DeviceGroupHandler {
+	return &DeviceGroupHandler{groupService: groupService, jobService: jobService, deviceService: deviceService, homeService: homeService}
+}
+
+// SetDeviceTags replaces the tags of a device
+// @Summary Set device tags
+// @Description Replaces the free-form key/value tags of a device; an empty map clears them. Dynamic groups select devices by their tags. Requires the device.assign permission in the device's home, or owning a device in no home.
+// @Tags device groups
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body dto.SetTagsRequest true "Device ID and tags"
+// @Success 200 {object} dto.DeviceTagsResponse "Tags set"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Missing the device.assign permission in the device's home"
+// @Failure 404 {object} Problem "Device not found"
+// @Router /auth/device/tags [put]
+func (h *DeviceGroupHandler) SetDeviceTags(c *gin.Context) {
+	var req dto.SetTagsRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.authorizeDevice(c, req.DeviceID, models.PermDeviceAssign) {
+		return
+	}
+
+	if err := h.groupService.SetTags(c.Request.Context(), req.DeviceID, req.Tags); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceTags(req.DeviceID, req.Tags))
+}
+
+// GetDeviceTags returns the tags of a device
+// @Summary Get device tags
+// @Description Returns the key/value tags of a device. Open to those who can see the device's home, or to the owner of a device in no home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param device_id query string true "Device ID"
+// @Success 200 {object} dto.DeviceTagsResponse "Tags"
+// @Failure 400 {object} Problem "Missing device ID"
+// @Failure 403 {object} Problem "Not allowed to view this device"
+// @Failure 404 {object} Problem "Device not found"
+// @Router /auth/device/tags [get]
+func (h *DeviceGroupHandler) GetDeviceTags(c *gin.Context) {
+	var query dto.DeviceQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.authorizeDevice(c, query.DeviceID, "") {
+		return
+	}
+
+	tags, err := h.groupService.GetTags(c.Request.Context(), query.DeviceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceTags(query.DeviceID, tags))
+}
+
+// GetGroups lists the device groups of a home
+// @Summary List device groups
+// @Description Lists the static and dynamic device groups of a home in the order they were added. Open to those who can see the home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Success 200 {array} dto.DeviceGroupResponse "Groups"
+// @Failure 400 {object} Problem "Invalid home ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Router /auth/home/group/list [get]
+func (h *DeviceGroupHandler) GetGroups(c *gin.Context) {
+	var query dto.HomeQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, "") {
+		return
+	}
+
+	groups, err := h.groupService.GetGroups(c.Request.Context(), query.HomeID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceGroups(groups))
+}
+
+// CreateGroup adds a device group to a home
+// @Summary Create a device group
+// @Description Adds a group of the home's devices. A static group lists its devices, added through /auth/home/group/members; a dynamic group holds whichever devices of the home match its selector of tags, space, device type and active flag when it is used. Requires the device.assign permission.
+// @Tags device groups
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param group body dto.CreateGroupRequest true "Group"
+// @Success 201 {object} dto.DeviceGroupResponse "Group created"
+// @Failure 400 {object} Problem "Invalid request payload or selector"
+// @Failure 403 {object} Problem "Missing the device.assign permission"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/group [post]
+func (h *DeviceGroupHandler) CreateGroup(c *gin.Context) {
+	var req dto.CreateGroupRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, models.PermDeviceAssign) {
+		return
+	}
+
+	group := models.DeviceGroup{HomeID: req.HomeID, Name: req.Name, Kind: req.Kind, Selector: req.Selector.Selector()}
+	group, err := h.groupService.AddGroup(c.Request.Context(), group)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromDeviceGroup(group))
+}
+
+// UpdateGroup changes a device group of a home
+// @Summary Update a device group
+// @Description Renames a group and replaces a dynamic group's selector. A group's kind does not change. Requires the device.assign permission.
+// @Tags device groups
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param group body dto.UpdateGroupRequest true "Group"
+// @Success 200 {object} dto.DeviceGroupResponse "Group updated"
+// @Failure 400 {object} Problem "Invalid request payload or selector"
+// @Failure 403 {object} Problem "Missing the device.assign permission"
+// @Failure 404 {object} Problem "Group not found"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/group [put]
+func (h *DeviceGroupHandler) UpdateGroup(c *gin.Context) {
+	var req dto.UpdateGroupRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, models.PermDeviceAssign) {
+		return
+	}
+
+	group := models.DeviceGroup{ID: req.GroupID, HomeID: req.HomeID, Name: req.Name, Selector: req.Selector.Selector()}
+	group, err := h.groupService.UpdateGroup(c.Request.Context(), group)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceGroup(group))
+}
+
+// DeleteGroup deletes a device group of a home
+// @Summary Delete a device group
+// @Description Deletes a group. Its devices are not affected, and jobs run on it are kept. Requires the device.assign permission.
+// @Tags device groups
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param group_id query int true "Group ID"
+// @Success 204 "Group deleted"
+// @Failure 400 {object} Problem "Invalid home or group ID"
+// @Failure 403 {object} Problem "Missing the device.assign permission"
+// @Failure 404 {object} Problem "Group not found"
+// @Router /auth/home/group [delete]
+func (h *DeviceGroupHandler) DeleteGroup(c *gin.Context) {
+	var query dto.GroupQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, models.PermDeviceAssign) {
+		return
+	}
+
+	if err := h.groupService.DeleteGroup(c.Request.Context(), query.HomeID, query.GroupID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateGroupMembers adds and removes devices of a static group
+// @Summary Update static group members
+// @Description Adds devices of the home to a static group and removes devices from it. A member that later leaves the home drops out of the group until it returns. Requires the device.assign permission.
+// @Tags device groups
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body dto.GroupMembersRequest true "Devices to add and remove"
+// @Success 200 {array} dto.DeviceResponse "Devices of the group"
+// @Failure 400 {object} Problem "Invalid request payload, a dynamic group, or a device not in the home"
+// @Failure 403 {object} Problem "Missing the device.assign permission"
+// @Failure 404 {object} Problem "Group not found"
+// @Router /auth/home/group/members [post]
+func (h *DeviceGroupHandler) UpdateGroupMembers(c *gin.Context) {
+	var req dto.GroupMembersRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, models.PermDeviceAssign) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if len(req.Add) > 0 {
+		if err := h.groupService.AddMembers(ctx, req.HomeID, req.GroupID, req.Add); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if len(req.Remove) > 0 {
+		if err := h.groupService.RemoveMembers(ctx, req.HomeID, req.GroupID, req.Remove); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	devices, err := h.groupService.GetDevices(ctx, req.HomeID, req.GroupID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDevices(devices))
+}
+
+// GetGroupDevices lists the devices a group holds
+// @Summary List group devices
+// @Description Lists the devices of the home a group holds now: the members of a static group, or the devices a dynamic group's selector matches. Open to those who can see the home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param group_id query int true "Group ID"
+// @Success 200 {array} dto.DeviceResponse "Devices"
+// @Failure 400 {object} Problem "Invalid home or group ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Failure 404 {object} Problem "Group not found"
+// @Router /auth/home/group/devices [get]
+func (h *DeviceGroupHandler) GetGroupDevices(c *gin.Context) {
+	var query dto.GroupQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, "") {
+		return
+	}
+
+	devices, err := h.groupService.GetDevices(c.Request.Context(), query.HomeID, query.GroupID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDevices(devices))
+}
+
+// CreateJob starts a bulk job on a device group
+// @Summary Run a bulk job on a group
+// @Description Queues an action on every device the group holds now, run in the background: command sends a command, firmware sends the firmware_update command with the image's version and URL, assign_home moves the devices to another home, and set_active activates or deactivates them. Each device's outcome is recorded, and a device that fails does not stop the others; poll /auth/home/job for progress. command and firmware jobs need the device.command permission, and the commands:send scope with an API key; set_active needs device.assign; assign_home needs device.assign in both homes.
+// @Tags device groups
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param job body dto.CreateJobRequest true "Job"
+// @Success 202 {object} dto.DeviceJobResponse "Job queued"
+// @Failure 400 {object} Problem "Invalid request payload, missing action parameters, or a group with no devices"
+// @Failure 403 {object} Problem "Missing the permission the action needs"
+// @Failure 404 {object} Problem "Group not found"
+// @Router /auth/home/group/job [post]
+func (h *DeviceGroupHandler) CreateJob(c *gin.Context) {
+	var req dto.CreateJobRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	permission := models.JobPermission(req.Action)
+	if permission == models.PermDeviceCommand {
+		if !scopeAllowed(c, models.ScopeCommandsSend) {
+			c.Error(apperrors.Forbidden("The API key lacks the %s scope", models.ScopeCommandsSend))
+			return
+		}
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, permission) {
+		return
+	}
+	if req.Action == models.JobAssignHome && req.TargetHomeID != nil && !authorizeHome(c, h.homeService, *req.TargetHomeID, models.PermDeviceAssign) {
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	job, err := h.jobService.CreateJob(c.Request.Context(), req.Job(user.ID))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.FromDeviceJob(job))
+}
+
+// GetJob returns a bulk job with its progress
+// @Summary Get a bulk job
+// @Description Returns a job of the home with the number of its devices that succeeded, failed and are still pending. Open to those who can see the home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param job_id query int true "Job ID"
+// @Success 200 {object} dto.DeviceJobResponse "Job"
+// @Failure 400 {object} Problem "Invalid home or job ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Failure 404 {object} Problem "Job not found"
+// @Router /auth/home/job [get]
+func (h *DeviceGroupHandler) GetJob(c *gin.Context) {
+	var query dto.JobQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, "") {
+		return
+	}
+
+	job, err := h.jobService.GetJob(c.Request.Context(), query.HomeID, query.JobID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceJob(job))
+}
+
+// GetJobs lists the bulk jobs of a home
+// @Summary List bulk jobs
+// @Description Lists the latest jobs of a home with their progress, newest first. Open to those who can see the home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param limit query int false "Maximum number of jobs (default 50)"
+// @Success 200 {array} dto.DeviceJobResponse "Jobs"
+// @Failure 400 {object} Problem "Invalid request parameters"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Router /auth/home/job/list [get]
+func (h *DeviceGroupHandler) GetJobs(c *gin.Context) {
+	var query dto.JobsQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, "") {
+		return
+	}
+
+	jobs, err := h.jobService.GetJobs(c.Request.Context(), query.HomeID, query.Limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceJobs(jobs))
+}
+
+// GetJobResults lists the outcome of a bulk job per device
+// @Summary Get bulk job results
+// @Description Lists the outcome of a job on each of its devices: pending, succeeded, or failed with the error. Open to those who can see the home.
+// @Tags device groups
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param job_id query int true "Job ID"
+// @Success 200 {array} dto.DeviceJobResultResponse "Results"
+// @Failure 400 {object} Problem "Invalid home or job ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Failure 404 {object} Problem "Job not found"
+// @Router /auth/home/job/results [get]
+func (h *DeviceGroupHandler) GetJobResults(c *gin.Context) {
+	var query dto.JobQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, "") {
+		return
+	}
+
+	results, err := h.jobService.GetResults(c.Request.Context(), query.HomeID, query.JobID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceJobResults(results))
+}
+
+// authorizeDevice is authorizeHome for the device's home. A device in no
+// home is left to its owner.
+func (h *DeviceGroupHandler) authorizeDevice(c *gin.Context, deviceID, permission string) bool {
+	device, err := h.deviceService.GetDeviceByID(c.Request.Context(), deviceID)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	if device.HomeID != nil {
+		return authorizeHome(c, h.homeService, *device.HomeID, permission)
+	}
+	if !homeAllowed(c, nil) {
+		c.Error(errHomeNotAllowed)
+		return false
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	if device.UserID != user.ID {
+		c.Error(apperrors.Forbidden("Not allowed to access this device"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestDeviceGroups(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.register(t, "alice")
+	bob := s.register(t, "bob")
+
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	if err := s.homes.AddUserToHome(ctx, home.ID, bob.ID, models.RoleView); err != nil {
+		t.Fatal(err)
+	}
+	for _, deviceID := range []string{"d1", "d2"} {
+		device := dto.AddDeviceRequest{DeviceID: deviceID, ChannelID: "c-" + deviceID, HomeID: &home.ID, IsActive: true}
+		if code := s.do(t, http.MethodPost, "/auth/device", "alice", device, nil); code != http.StatusCreated {
+			t.Fatalf("add device: status %d", code)
+		}
+	}
+
+	tags := dto.SetTagsRequest{DeviceID: "d1", Tags: map[string]string{"zone": "north"}}
+	if code := s.do(t, http.MethodPut, "/auth/device/tags", "bob", tags, nil); code != http.StatusForbidden {
+		t.Errorf("viewer tagging a device: status %d", code)
+	}
+	if code := s.do(t, http.MethodPut, "/auth/device/tags", "alice", tags, nil); code != http.StatusOK {
+		t.Fatalf("set tags: status %d", code)
+	}
+	var got dto.DeviceTagsResponse
+	if code := s.do(t, http.MethodGet, "/auth/device/tags?device_id=d1", "bob", nil, &got); code != http.StatusOK || got.Tags["zone"] != "north" {
+		t.Errorf("get tags: status %d, %+v", code, got)
+	}
+
+	req := dto.CreateGroupRequest{HomeID: home.ID, Name: "north", Kind: models.GroupDynamic, Selector: &dto.DeviceSelectorRequest{Tags: map[string]string{"zone": "north"}}}
+	if code := s.do(t, http.MethodPost, "/auth/home/group", "bob", req, nil); code != http.StatusForbidden {
+		t.Errorf("viewer adding a group: status %d", code)
+	}
+	var group dto.DeviceGroupResponse
+	if code := s.do(t, http.MethodPost, "/auth/home/group", "alice", req, &group); code != http.StatusCreated || group.Selector == nil {
+		t.Fatalf("add group: status %d, %+v", code, group)
+	}
+	var devices []dto.DeviceResponse
+	path := fmt.Sprintf("/auth/home/group/devices?home_id=%d&group_id=%d", home.ID, group.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &devices); code != http.StatusOK || len(devices) != 1 || devices[0].DeviceID != "d1" {
+		t.Errorf("group devices: status %d, %+v", code, devices)
+	}
+	members := dto.GroupMembersRequest{HomeID: home.ID, GroupID: group.ID, Add: []string{"d2"}}
+	if code := s.do(t, http.MethodPost, "/auth/home/group/members", "alice", members, nil); code != http.StatusBadRequest {
+		t.Errorf("members of a dynamic group: status %d", code)
+	}
+
+	inactive := false
+	job := dto.CreateJobRequest{HomeID: home.ID, GroupID: group.ID, Action: models.JobSetActive}
+	if code := s.do(t, http.MethodPost, "/auth/home/group/job", "alice", job, nil); code != http.StatusBadRequest {
+		t.Errorf("set_active job without active: status %d", code)
+	}
+	job.Active = &inactive
+	if code := s.do(t, http.MethodPost, "/auth/home/group/job", "bob", job, nil); code != http.StatusForbidden {
+		t.Errorf("viewer starting a job: status %d", code)
+	}
+	var queued dto.DeviceJobResponse
+	if code := s.do(t, http.MethodPost, "/auth/home/group/job", "alice", job, &queued); code != http.StatusAccepted || queued.Status != models.JobQueued || queued.Pending != 1 {
+		t.Fatalf("start job: status %d, %+v", code, queued)
+	}
+	s.jobs.RunPending(ctx)
+
+	var done dto.DeviceJobResponse
+	path = fmt.Sprintf("/auth/home/job?home_id=%d&job_id=%d", home.ID, queued.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &done); code != http.StatusOK || done.Status != models.JobCompleted || done.Succeeded != 1 {
+		t.Errorf("finished job: status %d, %+v", code, done)
+	}
+	var results []dto.DeviceJobResultResponse
+	path = fmt.Sprintf("/auth/home/job/results?home_id=%d&job_id=%d", home.ID, queued.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &results); code != http.StatusOK || len(results) != 1 || results[0].Status != models.JobResultSucceeded {
+		t.Errorf("job results: status %d, %+v", code, results)
+	}
+	if device, _ := s.devices.GetDeviceByID(ctx, "d1"); device.IsActive {
+		t.Error("device still active after the job")
+	}
+	var jobs []dto.DeviceJobResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/job/list?home_id=%d", home.ID), "bob", nil, &jobs); code != http.StatusOK || len(jobs) != 1 {
+		t.Errorf("list jobs: status %d, %+v", code, jobs)
+	}
+
+	del := fmt.Sprintf("/auth/home/group?home_id=%d&group_id=%d", home.ID, group.ID)
+	if code := s.do(t, http.MethodDelete, del, "alice", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete group: status %d", code)
+	}
+	var kept []dto.DeviceJobResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/job/list?home_id=%d", home.ID), "bob", nil, &kept); code != http.StatusOK || len(kept) != 1 || kept[0].GroupID != nil {
+		t.Errorf("jobs after deleting the group: status %d, %+v", code, kept)
+	}
+}
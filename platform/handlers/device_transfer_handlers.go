@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceTransferHandler struct {
+	transferService *services.DeviceTransferService
+}
+
+func NewDeviceTransferHandler(transferService *services.DeviceTransferService) *DeviceTransferHandler {
+	return &DeviceTransferHandler{transferService: transferService}
+}
+
+// TransferDevice offers a device to another user
+// @Summary Transfer a device
+// @Description Offers the authenticated user's device to another user, who becomes its owner on accepting. With keep_telemetry the device's readings stay readable by the current owner afterwards; otherwise they are purged on acceptance. A device has at most one pending transfer.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param transfer body dto.TransferDeviceRequest true "Transfer"
+// @Success 201 {object} dto.TransferResponse "Transfer offered"
+// @Failure 400 {object} Problem "Invalid request payload or recipient"
+// @Failure 403 {object} Problem "Not the device's owner"
+// @Failure 404 {object} Problem "Device not found"
+// @Failure 409 {object} Problem "A transfer of the device is already pending"
+// @Router /auth/device/transfer [post]
+func (h *DeviceTransferHandler) TransferDevice(c *gin.Context) {
+	var req dto.TransferDeviceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	transfer, err := h.transferService.Offer(c.Request.Context(), user.ID, req.DeviceID, req.ToUsername, req.KeepTelemetry)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromTransfer(transfer))
+}
+
+// GetTransfers lists the authenticated user's pending device transfers
+// @Summary List device transfers
+// @Description Lists the pending transfers of devices from or to the authenticated user
+// @Tags devices
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.TransferResponse "Transfers"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/device/transfer/list [get]
+func (h *DeviceTransferHandler) GetTransfers(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	transfers, err := h.transferService.GetUserTransfers(c.Request.Context(), user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromTransfers(transfers))
+}
+
+// AcceptTransfer accepts a device transfer
+// @Summary Accept a device transfer
+// @Description Makes the authenticated user the device's owner. The device leaves its home and moves to channel_id, or a random channel if none is given, which must then be configured on the device: the old channel stops working so that the previous owner cannot reach it.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param answer body dto.AcceptTransferRequest true "Transfer"
+// @Success 200 {object} dto.DeviceResponse "The device, with its new channel"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 404 {object} Problem "Transfer not found"
+// @Failure 409 {object} Problem "Transfer answered or cancelled, or channel ID taken"
+// @Router /auth/device/transfer/accept [post]
+func (h *DeviceTransferHandler) AcceptTransfer(c *gin.Context) {
+	var req dto.AcceptTransferRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	device, err := h.transferService.Accept(c.Request.Context(), user.ID, req.TransferID, req.ChannelID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDevice(device))
+}
+
+// DeclineTransfer declines a device transfer
+// @Summary Decline a device transfer
+// @Description Turns down a transfer offered to the authenticated user
+// @Tags devices
+// @Accept json
+// @Security ApiKeyAuth
+// @Param answer body dto.TransferAnswerRequest true "Transfer"
+// @Success 204 "Transfer declined"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 404 {object} Problem "Transfer not found"
+// @Failure 409 {object} Problem "Transfer answered or cancelled"
+// @Router /auth/device/transfer/decline [post]
+func (h *DeviceTransferHandler) DeclineTransfer(c *gin.Context) {
+	h.answer(c, h.transferService.Decline)
+}
+
+// CancelTransfer cancels a device transfer
+// @Summary Cancel a device transfer
+// @Description Withdraws a pending transfer the authenticated user offered
+// @Tags devices
+// @Accept json
+// @Security ApiKeyAuth
+// @Param answer body dto.TransferAnswerRequest true "Transfer"
+// @Success 204 "Transfer cancelled"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 404 {object} Problem "Transfer not found"
+// @Failure 409 {object} Problem "Transfer answered or cancelled"
+// @Router /auth/device/transfer/cancel [post]
+func (h *DeviceTransferHandler) CancelTransfer(c *gin.Context) {
+	h.answer(c, h.transferService.Cancel)
+}
+
+// answer binds the transfer the user acts on and acts on it with respond.
+func (h *DeviceTransferHandler) answer(c *gin.Context, respond func(ctx context.Context, userID, transferID int) error) {
+	var req dto.TransferAnswerRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := respond(c.Request.Context(), user.ID, req.TransferID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestDeviceTransfer(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.register(t, "alice")
+	bob := s.register(t, "bob")
+	s.register(t, "carol")
+
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	device := dto.AddDeviceRequest{DeviceID: "d1", ChannelID: "c1", HomeID: &home.ID}
+	if code := s.do(t, http.MethodPost, "/auth/device", "alice", device, nil); code != http.StatusCreated {
+		t.Fatalf("add device: status %d", code)
+	}
+	if err := s.devices.AddDeviceData(ctx, models.DeviceData{DeviceID: "d1", HomeID: &home.ID, CreatedAt: time.Now().Add(-time.Hour), Data: map[string]interface{}{"temp": 20}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := s.do(t, http.MethodPost, "/auth/device/transfer", "bob", dto.TransferDeviceRequest{DeviceID: "d1", ToUsername: "carol"}, nil); code != http.StatusForbidden {
+		t.Errorf("transfer by a non-owner: status %d", code)
+	}
+	var transfer dto.TransferResponse
+	req := dto.TransferDeviceRequest{DeviceID: "d1", ToUsername: "bob", KeepTelemetry: true}
+	if code := s.do(t, http.MethodPost, "/auth/device/transfer", "alice", req, &transfer); code != http.StatusCreated || transfer.ToUserID != bob.ID || transfer.Status != models.TransferPending {
+		t.Fatalf("transfer: status %d, %+v", code, transfer)
+	}
+	var pending []dto.TransferResponse
+	if code := s.do(t, http.MethodGet, "/auth/device/transfer/list", "bob", nil, &pending); code != http.StatusOK || len(pending) != 1 {
+		t.Errorf("bob's transfers: status %d, %+v", code, pending)
+	}
+
+	var moved dto.DeviceResponse
+	accept := dto.AcceptTransferRequest{TransferID: transfer.ID}
+	if code := s.do(t, http.MethodPost, "/auth/device/transfer/accept", "carol", accept, nil); code != http.StatusNotFound {
+		t.Errorf("accept by another user: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/transfer/accept", "bob", accept, &moved); code != http.StatusOK || moved.OwnerID != bob.ID || moved.HomeID != nil || moved.ChannelID == "c1" {
+		t.Fatalf("accept: status %d, %+v", code, moved)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/transfer/cancel", "alice", dto.TransferAnswerRequest{TransferID: transfer.ID}, nil); code != http.StatusConflict {
+		t.Errorf("cancel an accepted transfer: status %d", code)
+	}
+
+	// alice kept the telemetry from before the transfer; bob sees none of it.
+	for username, want := range map[string]int{"alice": 1, "bob": 0} {
+		var data []dto.ReadingResponse
+		if code := s.do(t, http.MethodGet, "/auth/device/telemetry?device_id=d1", username, nil, &data); code != http.StatusOK || len(data) != want {
+			t.Errorf("%s reading telemetry: status %d with %d readings, want %d", username, code, len(data), want)
+		}
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/command", "alice", dto.SendCommandRequest{DeviceID: "d1", Command: "reboot"}, nil); code != http.StatusForbidden {
+		t.Errorf("previous owner sending a command: status %d", code)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceTypeHandler struct {
+	deviceTypeService *services.DeviceTypeService
+}
+
+func NewDeviceTypeHandler(deviceTypeService *services.DeviceTypeService) *DeviceTypeHandler {
+	return &DeviceTypeHandler{deviceTypeService: deviceTypeService}
+}
+
+// AddDeviceType adds a product model to the device type catalog
+// @Summary Add a device type
+// @Description Adds a device type with its telemetry schema, supported commands and default decoder. The catalog is shared by every user, so only platform operators may add to it.
+// @Tags device-types
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param deviceType body dto.AddDeviceTypeRequest true "Device Type"
+// @Success 201 {object} dto.CreatedResponse "Device type added successfully"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Not a platform operator"
+// @Failure 409 {object} Problem "Device type name already taken"
+// @Failure 500 {object} Problem "Failed to add device type"
+// @Router /auth/device-type [post]
+func (h *DeviceTypeHandler) AddDeviceType(c *gin.Context) {
+	var req dto.AddDeviceTypeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !user.PlatformOperator {
+		c.Error(apperrors.Forbidden("Only platform operators can add device types"))
+		return
+	}
+
+	id, err := h.deviceTypeService.AddDeviceType(c.Request.Context(), req.DeviceType())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreatedResponse{Message: "Device type added successfully", ID: id})
+}
+
+// GetDeviceTypes lists the device type catalog
+// @Summary List device types
+// @Description Lists all device types in the catalog
+// @Tags device-types
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.DeviceTypeResponse "List of device types"
+// @Failure 500 {object} Problem "Failed to get device types"
+// @Router /auth/device-type/list [get]
+func (h *DeviceTypeHandler) GetDeviceTypes(c *gin.Context) {
+	deviceTypes, err := h.deviceTypeService.GetDeviceTypes(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceTypes(deviceTypes))
+}
+
+// GetDeviceType retrieves a single device type
+// @Summary Get device type
+// @Description Retrieves a device type by ID
+// @Tags device-types
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id query int true "Device Type ID"
+// @Success 200 {object} dto.DeviceTypeResponse "Device type"
+// @Failure 400 {object} Problem "Invalid device type ID"
+// @Failure 404 {object} Problem "Device type not found"
+// @Router /auth/device-type [get]
+func (h *DeviceTypeHandler) GetDeviceType(c *gin.Context) {
+	var query dto.DeviceTypeQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	deviceType, err := h.deviceTypeService.GetDeviceTypeByID(c.Request.Context(), query.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDeviceType(deviceType))
+}
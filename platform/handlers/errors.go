@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"PragatiIot/platform/apperrors"
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details body, returned for every failed
+// request.
+type Problem struct {
+	Type      string                 `json:"type"`
+	Title     string                 `json:"title"`
+	Status    int                    `json:"status"`
+	Detail    string                 `json:"detail,omitempty"`
+	Instance  string                 `json:"instance,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Errors    []apperrors.FieldError `json:"errors,omitempty"`
+}
+
+var errorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{apperrors.ErrValidation, http.StatusBadRequest},
+	{apperrors.ErrUnauthorized, http.StatusUnauthorized},
+	{apperrors.ErrForbidden, http.StatusForbidden},
+	{apperrors.ErrNotFound, http.StatusNotFound},
+	{apperrors.ErrConflict, http.StatusConflict},
+	{apperrors.ErrRateLimited, http.StatusTooManyRequests},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable},
+}
+
+// ErrorHandler renders the last error a handler recorded with c.Error as a
+// problem details response, unless the handler already wrote a response.
+// The status comes from the error's apperrors kind; errors of no known kind
+// are internal, and their message is logged but not returned.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		problem := newProblem(err)
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = c.Writer.Header().Get(RequestIDHeader)
+
+		var appErr *apperrors.Error
+		if errors.As(err, &appErr) && appErr.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+		}
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
+
+func newProblem(err error) Problem {
+	status := http.StatusInternalServerError
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.kind) {
+			status = s.status
+			break
+		}
+	}
+	problem := Problem{Type: "about:blank", Title: http.StatusText(status), Status: status}
+
+	var appErr *apperrors.Error
+	switch {
+	case status == http.StatusInternalServerError:
+		problem.Detail = "An unexpected error occurred"
+	case status == http.StatusServiceUnavailable:
+		problem.Detail = "The request timed out"
+	case errors.As(err, &appErr):
+		problem.Detail = appErr.Detail
+		problem.Errors = appErr.Fields
+	default:
+		// Other errors matching a kind, such as a schema violation, carry
+		// messages written for clients.
+		problem.Detail = err.Error()
+	}
+	return problem
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", map[string]string{"home_name": "Home"}, nil); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		body   interface{}
+		status int
+		field  string
+	}{
+		{"missing token", http.MethodGet, "/auth/device/list?user_id=1", "", nil, http.StatusUnauthorized, ""},
+		{"invalid query", http.MethodGet, "/auth/device/list?user_id=x", "alice", nil, http.StatusBadRequest, "user_id"},
+		{"unknown device", http.MethodPost, "/auth/device/assign-home", "alice", map[string]string{"device_id": "d1"}, http.StatusNotFound, ""},
+		{"unknown role", http.MethodPost, "/auth/home/add-user", "alice", map[string]interface{}{"home_id": 1, "user_id": 1, "role": "Owner"}, http.StatusBadRequest, "role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var problem Problem
+			if code := s.do(t, tt.method, tt.path, tt.user, tt.body, &problem); code != tt.status {
+				t.Errorf("status %d, want %d", code, tt.status)
+			}
+			if problem.Status != tt.status || problem.Title != http.StatusText(tt.status) || problem.Instance == "" {
+				t.Errorf("unexpected problem %+v", problem)
+			}
+			if tt.field != "" && (len(problem.Errors) == 0 || problem.Errors[0].Field != tt.field) {
+				t.Errorf("problem errors %+v, want field %s", problem.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestProblemContentType(t *testing.T) {
+	s := newTestServer(t)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/home/list", nil))
+	if got := w.Header().Get("Content-Type"); got != ProblemContentType {
+		t.Errorf("Content-Type %q, want %q", got, ProblemContentType)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/health"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	health *health.Health
+}
+
+func NewHealthHandler(health *health.Health) *HealthHandler {
+	return &HealthHandler{health: health}
+}
+
+// Liveness reports that the process is running
+// @Summary Liveness probe
+// @Description Always returns 200 while the process can serve requests. Dependencies are not checked, so a database outage does not restart the service.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string "Service is alive"
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+// Readiness reports whether the service can handle traffic
+// @Summary Readiness probe
+// @Description Checks the database pool, the MQTT connection and the RabbitMQ producer and consumer channels, reporting each component's status and check latency. Returns 503 if any component is down or the service is draining.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report "Service is ready"
+// @Failure 503 {object} health.Report "Service is not ready"
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.health.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
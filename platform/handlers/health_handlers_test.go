@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/health"
+)
+
+func TestReadiness(t *testing.T) {
+	s := newTestServer(t)
+	down := errors.New("connection refused")
+	var failing bool
+	s.health.Register("postgres", health.CheckerFunc(func(ctx context.Context) error {
+		if failing {
+			return down
+		}
+		return nil
+	}))
+
+	var report health.Report
+	if code := s.do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusOK || report.Status != health.StatusUp {
+		t.Errorf("healthy: status %d, report %+v", code, report)
+	}
+
+	failing = true
+	report = health.Report{}
+	if code := s.do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusServiceUnavailable {
+		t.Errorf("postgres down: status %d", code)
+	}
+	if got := report.Components["postgres"]; got.Status != health.StatusDown || got.Error != down.Error() {
+		t.Errorf("postgres down: component %+v", got)
+	}
+
+	failing = false
+	s.health.Drain("server", "shutting down")
+	report = health.Report{}
+	if code := s.do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusServiceUnavailable {
+		t.Errorf("draining: status %d", code)
+	}
+	if code := s.do(t, http.MethodGet, "/healthz", "", nil, nil); code != http.StatusOK {
+		t.Errorf("liveness while draining: status %d", code)
+	}
+}
@@ -5,92 +5,87 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"net/http"
-	"strconv"
+	"slices"
+	"time"
 
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
 	"PragatiIot/platform/middleware"
 	"PragatiIot/platform/models"
 	"PragatiIot/platform/services"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type UserHandler struct {
-	userService *services.UserService
+	userService    *services.UserService
+	accountService *services.AccountService
+	mfaService     *services.MFAService
+	tokens         *middleware.Tokens
 }
 
-func NewUserHandler(userService *services.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *services.UserService, accountService *services.AccountService, mfaService *services.MFAService, tokens *middleware.Tokens) *UserHandler {
+	return &UserHandler{userService: userService, accountService: accountService, mfaService: mfaService, tokens: tokens}
 }
 
 // RegisterUser @Summary Register new user
-// @Description Register a new user with username, password, and email
+// @Description Register a new user with username, password, and email. A verification link is mailed to the email address.
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body models.User required "User Info"
-// @Success 201 {object} models.ApiResponse "User registered successfully with token"
-// @Failure 400 {object} models.ApiResponse "Invalid request payload"
-// @Failure 500 {object} models.ApiResponse "Failed to register user or hash password"
+// @Param user body dto.RegisterRequest true "User Info"
+// @Success 201 {object} dto.MessageResponse "User registered successfully"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 409 {object} Problem "Username or email already taken"
+// @Failure 500 {object} Problem "Failed to register user or hash password"
 // @Router /register [post]
 func (h *UserHandler) RegisterUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid request payload"})
-		return
-	}
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to hash password"})
+	var req dto.RegisterRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
-	user.PasswordHash = string(hashedPassword)
 
-	if err := h.userService.AddUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to register user"})
+	if _, err := h.accountService.Register(c.Request.Context(), req.User(), req.Password); err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.ApiResponse{Message: "User registered successfully"})
+	c.JSON(http.StatusCreated, dto.MessageResponse{Message: "User registered successfully"})
 }
 
 // LoginUser logs in a user with username and password to receive a token
 // @Summary User login
-// @Description Login with username and password to receive a token
+// @Description Login with username and password to receive a token. Users with multi-factor authentication get an MFA token instead, to complete the login at /login/mfa.
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body models.User required "User Credentials"
-// @Success 200 {object} models.ApiResponse "message": "Login successful", "token": "JWT_TOKEN"
-// @Failure 400 {object} models.ApiResponse "Invalid request payload"
-// @Failure 401 {object} models.ApiResponse "Invalid username or password"
+// @Param user body dto.LoginRequest true "User Credentials"
+// @Success 200 {object} dto.LoginResponse "Login successful, or MFA required"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 401 {object} Problem "Invalid username or password"
+// @Failure 429 {object} Problem "Too many attempts or account temporarily locked; see Retry-After"
 // @Router /login [post]
 func (h *UserHandler) LoginUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid request payload"})
+	var req dto.LoginRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
 
-	dbUser, err := h.userService.GetUserByUsername(user.Username)
+	dbUser, err := h.accountService.Login(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ApiResponse{Error: "Invalid username or password"})
-		return
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(dbUser.PasswordHash), []byte(user.PasswordHash)); err != nil {
-		c.JSON(http.StatusUnauthorized, models.ApiResponse{Error: "Invalid username or password"})
+		c.Error(err)
 		return
 	}
 
-	token, err := middleware.CreateToken(dbUser.Username)
+	resp, err := loginResponse(c.Request.Context(), h.mfaService, h.tokens, dbUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to generate token"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.ApiResponse{Message: "Login successful", Token: token})
+	c.JSON(http.StatusOK, resp)
 }
 
 type HomeHandler struct {
@@ -103,85 +98,150 @@ func NewHomeHandler(homeService *services.HomeService) *HomeHandler {
 
 // AddHome adds a new home to the system
 // @Summary Add a home
-// @Description Adds a new home to the system
+// @Description Adds a new home owned by the authenticated user. With org_id, the home belongs to the organization, which requires the owner or admin role in it and counts against its homes quota.
 // @Tags homes
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param home body models.Home required "Home Info"
-// @Success 201 {object} map[string]string "Home added successfully"
-// @Failure 400 {object} map[string]string "Invalid request payload"
-// @Failure 500 {object} map[string]string "Failed to add home"
+// @Param home body dto.AddHomeRequest true "Home Info"
+// @Success 201 {object} dto.CreatedResponse "Home added successfully"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Not an owner or admin of the organization, or its homes quota is reached"
+// @Failure 404 {object} Problem "Organization not found"
+// @Failure 500 {object} Problem "Failed to add home"
 // @Router /auth/home [post]
 func (h *HomeHandler) AddHome(c *gin.Context) {
-	var home models.Home
-	if err := c.ShouldBindJSON(&home); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	var req dto.AddHomeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.homeService.AddHome(home); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add home"})
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, nil) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	id, err := h.homeService.AddHome(c.Request.Context(), req.Home(user.ID))
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Home added successfully"})
+	c.JSON(http.StatusCreated, dto.CreatedResponse{Message: "Home added successfully", ID: id})
 }
 
-// AddUserToHome adds a user to a home with a specific role
-// @Summary Add user to home
-// @Description Adds a user to a home with a specific role
+// AddUserToHome adds a service account to a home with a specific role
+// @Summary Add service account to home
+// @Description Adds a service account to a home with a built-in or custom role. People are invited through POST /auth/home/invitation instead and join only on accepting. Requires the home.members.manage permission, and only roles whose permissions the caller holds may be given. A home of an organization only admits the organization's members.
 // @Tags homes
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param req body models.AddUserToHomeRequest true "Home and User Info"
-// @Success 200 {object} models.ApiResponse "User added to home successfully"
-// @Failure 400 {object} models.ApiResponse "Invalid request payload"
-// @Failure 500 {object} models.ApiResponse "Failed to add user to home"
+// @Param req body dto.AddUserToHomeRequest true "Home and User Info"
+// @Success 200 {object} dto.MessageResponse "User added to home successfully"
+// @Failure 400 {object} Problem "Invalid request payload, or the user is not a service account"
+// @Failure 403 {object} Problem "Missing the permission, or the role grants more than the caller holds"
+// @Failure 500 {object} Problem "Failed to add user to home"
 // @Router /auth/home/add-user [post]
 func (h *HomeHandler) AddUserToHome(c *gin.Context) {
-	var req models.AddUserToHomeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid request payload"})
+	var req dto.AddUserToHomeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.homeService.AddMember(c.Request.Context(), user.ID, req.HomeID, req.UserID, req.Role); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "User added to home successfully"})
+}
+
+// SetRequireMFA sets whether a home requires MFA of its members
+// @Summary Require MFA in a home
+// @Description Sets whether members of the home must use multi-factor authentication. While it is required, members without MFA keep only the read permissions (telemetry.read and audit.read) in the home. Requires the home.manage permission, and only a caller with MFA enabled may turn it on.
+// @Tags homes
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body dto.SetHomeMFARequest true "Home and requirement"
+// @Success 200 {object} dto.MessageResponse "Home updated"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Missing the home.manage permission"
+// @Failure 409 {object} Problem "The caller has not enabled MFA"
+// @Router /auth/home/mfa [put]
+func (h *HomeHandler) SetRequireMFA(c *gin.Context) {
+	var req dto.SetHomeMFARequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.homeService.AddUserToHome(req.HomeID, req.UserID, req.Role); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to add user to home"})
+	if err := h.homeService.SetRequireMFA(c.Request.Context(), req.HomeID, user, *req.RequireMFA); err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.ApiResponse{Message: "User added to home successfully"})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Home updated"})
 }
 
 // GetHomesByUserID retrieves homes associated with a specific user ID
 // @Summary Get homes by user ID
-// @Description Retrieves homes associated with a specific user ID
+// @Description Retrieves homes owned by a specific user ID, leaving out those the authenticated user is neither the owner nor a member of
 // @Tags homes
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param user_id query int true "User ID"
-// @Success 200 {array} models.Home "List of homes associated with the user ID"
-// @Failure 400 {object} models.ApiResponse "Invalid user ID provided"
-// @Failure 500 {object} models.ApiResponse "Failed to retrieve homes due to a server error"
+// @Success 200 {array} dto.HomeResponse "List of homes associated with the user ID"
+// @Failure 400 {object} Problem "Invalid user ID provided"
+// @Failure 500 {object} Problem "Failed to retrieve homes due to a server error"
 // @Router /auth/home/list [get]
 func (h *HomeHandler) GetHomesByUserID(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	userID, err := strconv.Atoi(userIDStr)
+	var query dto.UserQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid user ID"})
+		c.Error(err)
 		return
 	}
 
-	homes, err := h.homeService.GetHomesByUserID(userID)
+	homes, err := h.homeService.GetHomesByUserID(c.Request.Context(), query.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to get homes"})
+		c.Error(err)
 		return
 	}
+	homes = slices.DeleteFunc(homes, func(home models.Home) bool {
+		return !homeAllowed(c, &home.ID) || !h.homeService.CanView(c.Request.Context(), home, user.ID)
+	})
 
-	c.JSON(http.StatusOK, homes)
+	c.JSON(http.StatusOK, dto.FromHomes(homes))
 }
 
 type DeviceHandler struct {
@@ -195,158 +255,439 @@ func NewDeviceHandler(deviceService *services.DeviceService, homeService *servic
 
 // AddDevice adds a new device to the system
 // @Summary Add a device
-// @Description Adds a new device to the system
+// @Description Adds a new device owned by the authenticated user. A device added to a home of an organization counts against its devices quota.
 // @Tags devices
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param device body models.Device required "Device Info"
-// @Success 201 {object} map[string]string "Device added successfully"
-// @Failure 400 {object} map[string]string "Invalid request payload"
-// @Failure 500 {object} map[string]string "Failed to add device"
+// @Param device body dto.AddDeviceRequest true "Device Info"
+// @Success 201 {object} dto.MessageResponse "Device added successfully"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Missing the device.assign permission in the home, or its organization's devices quota is reached"
+// @Failure 409 {object} Problem "Device or channel ID already registered"
+// @Failure 500 {object} Problem "Failed to add device"
 // @Router /auth/device [post]
 func (h *DeviceHandler) AddDevice(c *gin.Context) {
-	var device models.Device
-	if err := c.ShouldBindJSON(&device); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	var req dto.AddDeviceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.deviceService.AddDevice(device); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add device"})
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Device added successfully"})
+	device := req.Device(user.ID)
+	if !homeAllowed(c, device.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	if device.HomeID != nil {
+		if err := h.homeService.Authorize(c.Request.Context(), *device.HomeID, user.ID, models.PermDeviceAssign); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if err := h.deviceService.AddDevice(c.Request.Context(), device); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MessageResponse{Message: "Device added successfully"})
 }
 
 // AssignDeviceToHome assigns a device to a specified home
 // @Summary Assign device to home
-// @Description Assigns a device to a specified home
+// @Description Assigns a device to a specified home, or out of any home. The device's owner, or a holder of the device.assign permission in its current home, may move it to a home where they hold device.assign, within the devices quota of the home's organization.
 // @Tags devices
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param req body models.AssignDeviceRequest true "Device and Home IDs"
-// @Success 200 {object} models.ApiResponse "Device assigned to home successfully"
-// @Failure 400 {object} models.ApiResponse "Invalid request payload"
-// @Failure 500 {object} models.ApiResponse "Failed to assign device to home"
+// @Param req body dto.AssignDeviceRequest true "Device and Home IDs"
+// @Success 200 {object} dto.MessageResponse "Device assigned to home successfully"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Not allowed to move the device to the home, or the devices quota is reached"
+// @Failure 404 {object} Problem "Device not found"
+// @Failure 500 {object} Problem "Failed to assign device to home"
 // @Router /auth/device/assign-home [post]
 func (h *DeviceHandler) AssignDeviceToHome(c *gin.Context) {
-	var req models.AssignDeviceRequest
+	var req dto.AssignDeviceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	device, err := h.deviceService.GetDeviceByID(c.Request.Context(), req.DeviceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, device.HomeID) || !homeAllowed(c, req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
+	if device.UserID != user.ID {
+		if device.HomeID == nil {
+			c.Error(apperrors.Forbidden("Not allowed to move this device"))
+			return
+		}
+		if err := h.homeService.Authorize(c.Request.Context(), *device.HomeID, user.ID, models.PermDeviceAssign); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if req.HomeID != nil {
+		if err := h.homeService.Authorize(c.Request.Context(), *req.HomeID, user.ID, models.PermDeviceAssign); err != nil {
+			c.Error(err)
+			return
+		}
+	}
 
-	if err := h.deviceService.AssignDeviceToHome(req.DeviceID, req.HomeID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign device to home"})
+	if err := h.deviceService.AssignDeviceToHome(c.Request.Context(), req.DeviceID, req.HomeID); err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Device assigned to home successfully"})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Device assigned to home successfully"})
 }
 
 // GetDevicesByUserID retrieves devices associated with a specific user ID
 // @Summary Get devices by user ID
-// @Description Retrieves devices associated with a specific user ID, returning a list of devices.
+// @Description Retrieves devices owned by a specific user ID, leaving out those the authenticated user neither owns nor can see through a home.
 // @Tags devices
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param user_id query int true "User ID" // Make sure to clearly state that this parameter is required.
-// @Success 200 {array} models.Device "List of devices associated with the user ID"
-// @Failure 400 {object} models.ApiResponse "Invalid user ID provided"
-// @Failure 500 {object} models.ApiResponse "Failed to retrieve devices due to server error"
+// @Success 200 {array} dto.DeviceResponse "List of devices associated with the user ID"
+// @Failure 400 {object} Problem "Invalid user ID provided"
+// @Failure 500 {object} Problem "Failed to retrieve devices due to server error"
 // @Router /auth/device/list [get]
 func (h *DeviceHandler) GetDevicesByUserID(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	userID, err := strconv.Atoi(userIDStr)
+	var query dto.UserQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid user ID"})
+		c.Error(err)
 		return
 	}
 
-	devices, err := h.deviceService.GetDevicesByUserID(userID)
+	devices, err := h.deviceService.GetDevicesByUserID(c.Request.Context(), query.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to get devices"})
+		c.Error(err)
 		return
 	}
+	devices = slices.DeleteFunc(devices, func(device models.Device) bool {
+		if !homeAllowed(c, device.HomeID) {
+			return true
+		}
+		return device.UserID != user.ID && (device.HomeID == nil || !h.homeService.IsHomeMember(c.Request.Context(), *device.HomeID, user.ID))
+	})
+
+	c.JSON(http.StatusOK, dto.FromDevices(devices))
+}
 
-	c.JSON(http.StatusOK, devices)
+// SendCommand sends a command to a device
+// @Summary Send device command
+// @Description Sends a command supported by the device's type. Only the device owner or a holder of the device.command permission in its home may send commands.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body dto.SendCommandRequest true "Command"
+// @Success 202 {object} dto.MessageResponse "Command sent"
+// @Failure 400 {object} Problem "Invalid request payload or unsupported command"
+// @Failure 403 {object} Problem "Not allowed to send commands to this device"
+// @Failure 404 {object} Problem "Device not found"
+// @Router /auth/device/command [post]
+func (h *DeviceHandler) SendCommand(c *gin.Context) {
+	var req dto.SendCommandRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	device, err := h.deviceService.GetDeviceByID(c.Request.Context(), req.DeviceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !homeAllowed(c, device.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	if device.UserID != user.ID {
+		if device.HomeID == nil {
+			c.Error(apperrors.Forbidden("Not allowed to send commands to this device"))
+			return
+		}
+		if err := h.homeService.Authorize(c.Request.Context(), *device.HomeID, user.ID, models.PermDeviceCommand); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if err := h.deviceService.SendCommand(c.Request.Context(), req.DeviceID, req.Command, req.Params); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.MessageResponse{Message: "Command sent"})
 }
 
 type AnalyticsHandler struct {
-	deviceService *services.DeviceService
-	homeService   *services.HomeService
+	deviceService    *services.DeviceService
+	homeService      *services.HomeService
+	telemetryService *services.TelemetryService
 }
 
-func NewAnalyticsHandler(deviceService *services.DeviceService, homeService *services.HomeService) *AnalyticsHandler {
-	return &AnalyticsHandler{deviceService: deviceService, homeService: homeService}
+func NewAnalyticsHandler(deviceService *services.DeviceService, homeService *services.HomeService, telemetryService *services.TelemetryService) *AnalyticsHandler {
+	return &AnalyticsHandler{deviceService: deviceService, homeService: homeService, telemetryService: telemetryService}
 }
 
 // GetDeviceAnalytics retrieves analytics for a specific device within a specified home
 // @Summary Get device analytics
-// @Description Retrieves analytics for a specific device within a specified home, including usage statistics or other relevant data.
+// @Description Retrieves hourly or daily rollups (count, min, max, avg, sum) of each numeric telemetry field for a device within a home. Defaults to the last 24 hours.
 // @Tags analytics
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param device_id query string true "Device ID required for fetching analytics"
 // @Param home_id query int true "Home ID required for contextual analytics within a specific home"
-// @Success 200 {object} map[string]interface{} "Analytics data for the specified device within the given home."
-// @Failure 400 {object} models.ApiResponse "Invalid home or device ID provided."
-// @Failure 401 {object} models.ApiResponse "Unauthorized access attempt detected."
-// @Failure 500 {object} models.ApiResponse "Internal server error while retrieving device analytics."
+// @Param granularity query string false "hour (default) or day"
+// @Param from query string false "Start of the range, RFC 3339"
+// @Param to query string false "End of the range, RFC 3339"
+// @Success 200 {array} dto.AnalyticsResponse "Analytics data for the specified device within the given home."
+// @Failure 400 {object} Problem "Invalid home or device ID provided."
+// @Failure 403 {object} Problem "Missing the telemetry.read permission in the home."
+// @Failure 500 {object} Problem "Internal server error while retrieving device analytics."
 // @Router /auth/device-analytics [get]
 func (h *AnalyticsHandler) GetDeviceAnalytics(c *gin.Context) {
-	deviceID := c.Query("device_id")
-	homeIDStr := c.Query("home_id")
-	homeID, err := strconv.Atoi(homeIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{Error: "Invalid home ID"})
+	var query dto.AnalyticsQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
 		return
 	}
 
-	username, _ := c.Get("username")
-	user, err := h.homeService.GetUserByUsername(username.(string))
+	from, to, err := parseTimeRange(c, 24*time.Hour)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ApiResponse{Error: "Invalid username or password"})
+		c.Error(err)
 		return
 	}
 
-	roleID, err := h.homeService.GetHomeUserRole(homeID, user.ID)
+	user, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ApiResponse{Error: "Unauthorized to access analytics"})
+		c.Error(err)
+		return
+	}
+
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	if err := h.homeService.Authorize(c.Request.Context(), query.HomeID, user.ID, models.PermTelemetryRead); err != nil {
+		c.Error(err)
 		return
 	}
 
-	analytics, err := h.deviceService.GetDeviceAnalytics(deviceID, homeID, roleID)
+	analytics, err := h.telemetryService.GetDeviceAnalytics(c.Request.Context(), query.DeviceID, query.HomeID, query.Granularity, from, to)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{Error: "Failed to get device analytics"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, analytics)
+	c.JSON(http.StatusOK, dto.FromAnalyticsList(analytics))
+}
+
+// currentUser returns the user JWTAuthMiddleware authenticated the request
+// as.
+func currentUser(c *gin.Context) (models.User, error) {
+	user, ok := middleware.UserFromContext(c)
+	if !ok {
+		return user, services.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// authorizeHome checks that the user, and their API key if any, may act on
+// the home with the permission, or see it if permission is empty. It reports
+// the error and returns false if not.
+func authorizeHome(c *gin.Context, homeService *services.HomeService, homeID int, permission string) bool {
+	if !homeAllowed(c, &homeID) {
+		c.Error(errHomeNotAllowed)
+		return false
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	if permission == "" {
+		err = homeService.AuthorizeView(c.Request.Context(), homeID, user.ID)
+	} else {
+		err = homeService.Authorize(c.Request.Context(), homeID, user.ID, permission)
+	}
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
 }
 
-func SetupRoutes(router *gin.Engine, userHandler *UserHandler, homeHandler *HomeHandler, deviceHandler *DeviceHandler, analyticsHandler *AnalyticsHandler) {
-	router.POST("/register", userHandler.RegisterUser)
-	router.POST("/login", userHandler.LoginUser)
+// parseTimeRange reads the optional RFC 3339 "from" and "to" query
+// parameters. "to" defaults to now and "from" to window before "to".
+func parseTimeRange(c *gin.Context, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, apperrors.Invalid("to", "must be an RFC 3339 time")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-window)
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, apperrors.Invalid("from", "must be an RFC 3339 time")
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, apperrors.Invalid("from", "must be before to")
+	}
+	return from, to, nil
+}
+
+func SetupRoutes(router *gin.Engine, userHandler *UserHandler, homeHandler *HomeHandler, deviceHandler *DeviceHandler, deviceTypeHandler *DeviceTypeHandler, analyticsHandler *AnalyticsHandler, telemetryHandler *TelemetryHandler, auditHandler *AuditHandler, serviceAccountHandler *ServiceAccountHandler, ssoHandler *SSOHandler, organizationHandler *OrganizationHandler, invitationHandler *InvitationHandler, transferHandler *DeviceTransferHandler, spaceHandler *SpaceHandler, groupHandler *DeviceGroupHandler, healthHandler *HealthHandler, limits RateLimits) {
+	router.Use(MetricsMiddleware(), ErrorHandler())
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	auth := router.Group("/auth", middleware.JWTAuthMiddleware())
+	// Probes, metrics and docs are not rate limited.
+	api := router.Group("", RateLimit(limits.Store, "ip", limits.IP, ClientIP, limits.Logger), AuditActor())
+
+	account := api.Group("", RateLimit(limits.Store, "account", limits.Account, ClientIP, limits.Logger))
 	{
+		account.POST("/register", userHandler.RegisterUser)
+		account.POST("/login", userHandler.LoginUser)
+		account.POST("/login/mfa", userHandler.CompleteMFALogin)
+		account.POST("/verify-email", userHandler.VerifyEmail)
+		account.POST("/forgot-password", userHandler.ForgotPassword)
+		account.POST("/reset-password", userHandler.ResetPassword)
+
+		account.GET("/oidc/providers", ssoHandler.GetProviders)
+		account.GET("/oidc/:provider/login", ssoHandler.BeginLogin)
+		account.GET("/oidc/:provider/callback", ssoHandler.CompleteLogin)
+	}
+
+	// API keys are checked against their scopes before anything else runs.
+	auth := api.Group("/auth", middleware.JWTAuthMiddleware(userHandler.tokens, userHandler.userService, serviceAccountHandler.serviceAccountService), APIKeyScopes(), RateLimit(limits.Store, "user", limits.User, Username, limits.Logger), AuditActor())
+	{
+		auth.GET("/me", userHandler.GetProfile)
+		auth.PATCH("/me", userHandler.UpdateProfile)
+		auth.DELETE("/me", userHandler.DeleteAccount)
+		auth.POST("/me/password", userHandler.ChangePassword)
+		auth.POST("/me/verify-email", userHandler.ResendVerification)
+		auth.POST("/me/mfa", userHandler.BeginMFAEnrollment)
+		auth.POST("/me/mfa/confirm", userHandler.ConfirmMFAEnrollment)
+		auth.POST("/me/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+		auth.DELETE("/me/mfa", userHandler.DisableMFA)
+		auth.GET("/me/invitations", invitationHandler.GetMyInvitations)
+		auth.POST("/me/invitations/accept", invitationHandler.AcceptInvitation)
+		auth.POST("/me/invitations/decline", invitationHandler.DeclineInvitation)
+
 		auth.POST("/home", homeHandler.AddHome)
 		auth.POST("/home/add-user", homeHandler.AddUserToHome)
 		auth.GET("/home/list", homeHandler.GetHomesByUserID)
+		auth.PUT("/home/mfa", homeHandler.SetRequireMFA)
+		auth.GET("/home/role/list", homeHandler.GetRoles)
+		auth.POST("/home/role", homeHandler.CreateRole)
+		auth.PUT("/home/role", homeHandler.UpdateRole)
+		auth.DELETE("/home/role", homeHandler.DeleteRole)
+		auth.POST("/home/invitation", invitationHandler.CreateInvitation)
+		auth.GET("/home/invitation/list", invitationHandler.GetHomeInvitations)
+		auth.DELETE("/home/invitation", invitationHandler.RevokeInvitation)
+		auth.GET("/home/space/list", spaceHandler.GetSpaces)
+		auth.POST("/home/space", spaceHandler.CreateSpace)
+		auth.PUT("/home/space", spaceHandler.UpdateSpace)
+		auth.DELETE("/home/space", spaceHandler.DeleteSpace)
+		auth.GET("/home/device/list", spaceHandler.GetHomeDevices)
+		auth.GET("/home/space/telemetry", spaceHandler.GetSpaceTelemetry)
+		auth.GET("/home/space/analytics", spaceHandler.GetSpaceAnalytics)
+		auth.GET("/home/group/list", groupHandler.GetGroups)
+		auth.POST("/home/group", groupHandler.CreateGroup)
+		auth.PUT("/home/group", groupHandler.UpdateGroup)
+		auth.DELETE("/home/group", groupHandler.DeleteGroup)
+		auth.POST("/home/group/members", groupHandler.UpdateGroupMembers)
+		auth.GET("/home/group/devices", groupHandler.GetGroupDevices)
+		auth.POST("/home/group/job", groupHandler.CreateJob)
+		auth.GET("/home/job", groupHandler.GetJob)
+		auth.GET("/home/job/list", groupHandler.GetJobs)
+		auth.GET("/home/job/results", groupHandler.GetJobResults)
+
+		auth.POST("/org", organizationHandler.CreateOrganization)
+		auth.GET("/org/list", organizationHandler.GetOrganizations)
+		auth.PATCH("/org", organizationHandler.UpdateOrganization)
+		auth.GET("/org/usage", organizationHandler.GetUsage)
+		auth.GET("/org/member/list", organizationHandler.GetMembers)
+		auth.POST("/org/member", organizationHandler.SetMember)
+		auth.DELETE("/org/member", organizationHandler.RemoveMember)
+		auth.GET("/org/home/list", organizationHandler.GetHomes)
 
 		auth.POST("/device", deviceHandler.AddDevice)
 		auth.POST("/device/assign-home", deviceHandler.AssignDeviceToHome)
+		auth.POST("/device/assign-space", spaceHandler.AssignDeviceToSpace)
+		auth.PUT("/device/tags", groupHandler.SetDeviceTags)
+		auth.GET("/device/tags", groupHandler.GetDeviceTags)
 		auth.GET("/device/list", deviceHandler.GetDevicesByUserID)
+		auth.POST("/device/command", deviceHandler.SendCommand)
+		auth.POST("/device/transfer", transferHandler.TransferDevice)
+		auth.GET("/device/transfer/list", transferHandler.GetTransfers)
+		auth.POST("/device/transfer/accept", transferHandler.AcceptTransfer)
+		auth.POST("/device/transfer/decline", transferHandler.DeclineTransfer)
+		auth.POST("/device/transfer/cancel", transferHandler.CancelTransfer)
+
+		auth.POST("/device-type", deviceTypeHandler.AddDeviceType)
+		auth.GET("/device-type", deviceTypeHandler.GetDeviceType)
+		auth.GET("/device-type/list", deviceTypeHandler.GetDeviceTypes)
 
 		auth.GET("/device-analytics", analyticsHandler.GetDeviceAnalytics)
+		auth.GET("/device/telemetry", telemetryHandler.GetDeviceTelemetry)
+
+		auth.PUT("/retention-policy", telemetryHandler.SetRetentionPolicy)
+		auth.GET("/retention-policy/list", telemetryHandler.GetRetentionPolicies)
+
+		auth.GET("/audit", auditHandler.GetAuditLog)
 
+		auth.POST("/service-account", serviceAccountHandler.CreateServiceAccount)
+		auth.GET("/service-account/list", serviceAccountHandler.GetServiceAccounts)
+		auth.DELETE("/service-account", serviceAccountHandler.DeleteServiceAccount)
+		auth.POST("/service-account/key", serviceAccountHandler.CreateAPIKey)
+		auth.GET("/service-account/key/list", serviceAccountHandler.GetAPIKeys)
+		auth.POST("/service-account/key/revoke", serviceAccountHandler.RevokeAPIKey)
 	}
 }
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/health"
+	"PragatiIot/platform/middleware"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/notify"
+	"PragatiIot/platform/oidc"
+	"PragatiIot/platform/repositories/memory"
+	"PragatiIot/platform/services"
+	"PragatiIot/platform/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testServer serves the full route table backed by an in-memory store.
+type testServer struct {
+	router  *gin.Engine
+	store   *memory.Store
+	health  *health.Health
+	homes   *services.HomeService
+	devices *services.DeviceService
+	jobs    *services.DeviceJobService
+	mail    *mailbox
+	tokens  *middleware.Tokens
+	// users are the users tokens were last issued to, by username, so a
+	// deleted user's token can still be sent.
+	users map[string]models.User
+	// providers are the identity providers of the SSO routes. Tests add
+	// them.
+	providers map[string]*oidc.Provider
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newLimitedTestServer(t, RateLimits{})
+}
+
+// newLimitedTestServer is newTestServer with rate limits.
+func newLimitedTestServer(t *testing.T, limits RateLimits) *testServer {
+	t.Helper()
+	store := memory.New()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	recorder := audit.NewRecorder(store, store, logger)
+
+	userService := services.NewUserService(store, recorder)
+	tokens, err := middleware.NewTokens(middleware.TokenConfig{Key: make([]byte, 32), TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgService := services.NewOrganizationService(store, recorder, services.OrgConfig{})
+	homeService := services.NewHomeService(store, services.NewRoleService(store), userService, orgService, recorder)
+	deviceTypeService, err := services.NewDeviceTypeService(store, services.ValidationTag, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceService := services.NewDeviceService(store, homeService, deviceTypeService, recorder, logger)
+	telemetryService := services.NewTelemetryService(store, store, store, 0, recorder, logger)
+	mail := &mailbox{}
+	accountService := services.NewAccountService(store, store, mail, recorder, services.AccountConfig{BaseURL: "https://app.example.com"}, logger)
+	sealer, err := utils.NewSealer("test:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaService := services.NewMFAService(store, store, store, sealer, accountService, services.MFAConfig{})
+	healthChecks := health.New(time.Second)
+	providers := make(map[string]*oidc.Provider)
+	transferService := services.NewDeviceTransferService(store, store, store, recorder)
+	groupService := services.NewDeviceGroupService(store, store, store, store, recorder)
+	jobService := services.NewDeviceJobService(store, groupService, deviceService, homeService, store, recorder, services.DeviceJobConfig{}, logger)
+
+	router := gin.New()
+	// As in main without TRUSTED_PROXIES.
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	router.Use(RequestLogger(logger))
+	SetupRoutes(router,
+		NewUserHandler(userService, accountService, mfaService, tokens),
+		NewHomeHandler(homeService),
+		NewDeviceHandler(deviceService, homeService),
+		NewDeviceTypeHandler(deviceTypeService),
+		NewAnalyticsHandler(deviceService, homeService, telemetryService),
+		NewTelemetryHandler(telemetryService, deviceService, homeService, transferService),
+		NewAuditHandler(services.NewAuditService(store, store)),
+		NewServiceAccountHandler(services.NewServiceAccountService(store, store, store, recorder)),
+		NewSSOHandler(services.NewSSOService(providers, store, store, homeService, recorder, logger), mfaService, tokens),
+		NewOrganizationHandler(orgService, homeService),
+		NewInvitationHandler(services.NewInvitationService(store, store, homeService, notify.NewMailNotifier(mail), recorder, services.InvitationConfig{BaseURL: "https://app.example.com"}, logger)),
+		NewDeviceTransferHandler(transferService),
+		NewSpaceHandler(services.NewSpaceService(store, store, recorder), deviceService, homeService),
+		NewDeviceGroupHandler(groupService, jobService, deviceService, homeService),
+		NewHealthHandler(healthChecks),
+		limits,
+	)
+	return &testServer{router: router, store: store, health: healthChecks, homes: homeService, devices: deviceService, jobs: jobService, mail: mail, tokens: tokens, users: map[string]models.User{}, providers: providers}
+}
+
+// do sends a request as username, or unauthenticated if username is empty,
+// and decodes the JSON response into out if it is not nil.
+func (s *testServer) do(t *testing.T, method, path, username string, body, out interface{}) int {
+	t.Helper()
+	var token string
+	if username != "" {
+		token = s.token(t, username)
+	}
+	return s.doToken(t, method, path, token, body, out)
+}
+
+// token issues a token for the user with the username, as it is now or, if
+// it was deleted, as it was last.
+func (s *testServer) token(t *testing.T, username string) string {
+	t.Helper()
+	user, err := s.store.GetUserByUsername(context.Background(), username)
+	if err != nil {
+		user = s.users[username]
+	}
+	s.users[username] = user
+	return s.createToken(t, s.tokens, user)
+}
+
+func (s *testServer) createToken(t *testing.T, tokens *middleware.Tokens, user models.User) string {
+	t.Helper()
+	token, err := tokens.CreateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// doToken is do with a bearer token, or unauthenticated if token is empty.
+func (s *testServer) doToken(t *testing.T, method, path, token string, body, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+// register creates a user through the API and returns it with its ID.
+func (s *testServer) register(t *testing.T, username string) models.User {
+	t.Helper()
+	req := dto.RegisterRequest{Username: username, Email: username + "@example.com", Password: "correct horse"}
+	if code := s.do(t, http.MethodPost, "/register", "", req, nil); code != http.StatusCreated {
+		t.Fatalf("register %s: status %d", username, code)
+	}
+	user, err := s.store.GetUserByUsername(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// operator adds a platform operator, who cannot be made through the API.
+func (s *testServer) operator(t *testing.T, username string) models.User {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.store.AddUser(ctx, models.User{Username: username, Email: username + "@example.com", PlatformOperator: true}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+
+	var problem Problem
+	if code := s.do(t, http.MethodPost, "/register", "", dto.RegisterRequest{Username: "alice", Email: "other@example.com", Password: "correct horse"}, &problem); code != http.StatusConflict {
+		t.Errorf("duplicate registration: status %d", code)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "username" {
+		t.Errorf("duplicate registration: problem %+v", problem)
+	}
+
+	var resp dto.LoginResponse
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice", Password: "wrong"}, &resp); code != http.StatusUnauthorized {
+		t.Errorf("login with wrong password: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice", Password: "correct horse"}, &resp); code != http.StatusOK {
+		t.Fatalf("login: status %d", code)
+	}
+	if resp.Token == "" {
+		t.Error("login returned no token")
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	s := newTestServer(t)
+	if code := s.do(t, http.MethodGet, "/auth/device/list?user_id=1", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401", code)
+	}
+}
+
+func TestAddDeviceTypeRequiresOperator(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+	s.operator(t, "ops")
+
+	deviceType := dto.AddDeviceTypeRequest{Name: "switch"}
+	if code := s.do(t, http.MethodPost, "/auth/device-type", "alice", deviceType, nil); code != http.StatusForbidden {
+		t.Errorf("user adding a device type: status %d, want 403", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device-type", "ops", deviceType, nil); code != http.StatusCreated {
+		t.Errorf("operator adding a device type: status %d", code)
+	}
+	var types []dto.DeviceTypeResponse
+	if code := s.do(t, http.MethodGet, "/auth/device-type/list", "alice", nil, &types); code != http.StatusOK || len(types) != 1 {
+		t.Errorf("list device types: status %d, %+v", code, types)
+	}
+}
+
+func TestSendCommandAuthorization(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+	s.register(t, "mallory")
+	s.operator(t, "ops")
+
+	var created struct{ ID int }
+	deviceType := dto.AddDeviceTypeRequest{Name: "switch", Commands: []dto.DeviceCommandRequest{{Name: "toggle"}}}
+	if code := s.do(t, http.MethodPost, "/auth/device-type", "ops", deviceType, &created); code != http.StatusCreated {
+		t.Fatalf("add device type: status %d", code)
+	}
+	typeID := created.ID
+
+	device := dto.AddDeviceRequest{DeviceID: "d1", ChannelID: "c1", DeviceTypeID: &typeID}
+	if code := s.do(t, http.MethodPost, "/auth/device", "alice", device, nil); code != http.StatusCreated {
+		t.Fatalf("add device: status %d", code)
+	}
+	s.devices.SetCommandPublisher(publisherFunc(func(string, []byte) error { return nil }))
+
+	command := dto.SendCommandRequest{DeviceID: "d1", Command: "toggle"}
+	if code := s.do(t, http.MethodPost, "/auth/device/command", "mallory", command, nil); code != http.StatusForbidden {
+		t.Errorf("command from another user: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/command", "alice", command, nil); code != http.StatusAccepted {
+		t.Errorf("command from the owner: status %d", code)
+	}
+	missing := dto.SendCommandRequest{DeviceID: "d2", Command: "toggle"}
+	if code := s.do(t, http.MethodPost, "/auth/device/command", "alice", missing, nil); code != http.StatusNotFound {
+		t.Errorf("command to a missing device: status %d", code)
+	}
+}
+
+type publisherFunc func(channelID string, payload []byte) error
+
+func (f publisherFunc) PublishCommand(channelID string, payload []byte) error {
+	return f(channelID, payload)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationHandler struct {
+	invitationService *services.InvitationService
+}
+
+func NewInvitationHandler(invitationService *services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitationService: invitationService}
+}
+
+// CreateInvitation invites a user to a home
+// @Summary Invite to a home
+// @Description Invites the user with a username, or whoever holds an email address, to join a home with a role. The invitee is notified and becomes a member only on accepting. Requires the home.members.manage permission, and the role may only grant permissions the caller holds. Without expires_at the invitation is open for the configured TTL; it may be at most 30 days away.
+// @Tags homes
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param invitation body dto.CreateInvitationRequest true "Invitation"
+// @Success 201 {object} dto.InvitationResponse "Invitation created"
+// @Failure 400 {object} Problem "Invalid request payload, unknown username or role, or invitee who cannot join"
+// @Failure 403 {object} Problem "Missing the permission, or granting one the caller does not hold"
+// @Failure 409 {object} Problem "Already a member, or already invited"
+// @Router /auth/home/invitation [post]
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req dto.CreateInvitationRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	inv, err := h.invitationService.Invite(c.Request.Context(), user.ID, req.HomeID, req.Email, req.Username, req.Role, req.ExpiresAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromInvitation(inv))
+}
+
+// GetHomeInvitations lists a home's pending invitations
+// @Summary List home invitations
+// @Description Lists the home's pending invitations that have not expired. Requires the home.members.manage permission.
+// @Tags homes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Success 200 {array} dto.InvitationResponse "Invitations"
+// @Failure 400 {object} Problem "Invalid home ID"
+// @Failure 403 {object} Problem "Missing the permission"
+// @Router /auth/home/invitation/list [get]
+func (h *InvitationHandler) GetHomeInvitations(c *gin.Context) {
+	var query dto.HomeQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	invitations, err := h.invitationService.GetHomeInvitations(c.Request.Context(), user.ID, query.HomeID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromInvitations(invitations))
+}
+
+// RevokeInvitation withdraws a pending invitation
+// @Summary Revoke a home invitation
+// @Description Withdraws a pending invitation so it can no longer be accepted. Requires the home.members.manage permission.
+// @Tags homes
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param invitation_id query int true "Invitation ID"
+// @Success 204 "Invitation revoked"
+// @Failure 400 {object} Problem "Invalid home or invitation ID"
+// @Failure 403 {object} Problem "Missing the permission"
+// @Failure 404 {object} Problem "Invitation not found"
+// @Failure 409 {object} Problem "Invitation no longer pending"
+// @Router /auth/home/invitation [delete]
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	var query dto.InvitationQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.invitationService.Revoke(c.Request.Context(), user.ID, query.HomeID, query.InvitationID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetMyInvitations lists the invitations to the authenticated user
+// @Summary List my invitations
+// @Description Lists the pending invitations that have not expired and name the authenticated user, or their email address once verified
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.InvitationResponse "Invitations"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/me/invitations [get]
+func (h *InvitationHandler) GetMyInvitations(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	invitations, err := h.invitationService.GetUserInvitations(c.Request.Context(), user)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromInvitations(invitations))
+}
+
+// AcceptInvitation accepts an invitation to a home
+// @Summary Accept an invitation
+// @Description Joins the invitation's home with its role, and notifies the inviter
+// @Tags users
+// @Accept json
+// @Security ApiKeyAuth
+// @Param answer body dto.InvitationAnswerRequest true "Invitation"
+// @Success 204 "Invitation accepted"
+// @Failure 400 {object} Problem "Invalid request payload, or not a member of the home's organization"
+// @Failure 404 {object} Problem "Invitation not found"
+// @Failure 409 {object} Problem "Already a member, or invitation answered, revoked or expired"
+// @Router /auth/me/invitations/accept [post]
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	h.answer(c, h.invitationService.Accept)
+}
+
+// DeclineInvitation declines an invitation to a home
+// @Summary Decline an invitation
+// @Description Turns the invitation down, and notifies the inviter
+// @Tags users
+// @Accept json
+// @Security ApiKeyAuth
+// @Param answer body dto.InvitationAnswerRequest true "Invitation"
+// @Success 204 "Invitation declined"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 404 {object} Problem "Invitation not found"
+// @Failure 409 {object} Problem "Invitation answered, revoked or expired"
+// @Router /auth/me/invitations/decline [post]
+func (h *InvitationHandler) DeclineInvitation(c *gin.Context) {
+	h.answer(c, h.invitationService.Decline)
+}
+
+// answer binds the invitation the user answers and answers it with respond.
+func (h *InvitationHandler) answer(c *gin.Context, respond func(ctx context.Context, user models.User, invitationID int) error) {
+	var req dto.InvitationAnswerRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := respond(c.Request.Context(), user, req.InvitationID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestHomeInvitations(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+	bob := s.register(t, "bob")
+	s.register(t, "carol")
+
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+
+	if code := s.do(t, http.MethodPost, "/auth/home/invitation", "alice", dto.CreateInvitationRequest{HomeID: home.ID, Role: models.RoleView}, nil); code != http.StatusBadRequest {
+		t.Errorf("invitation without an invitee: status %d", code)
+	}
+	var inv dto.InvitationResponse
+	req := dto.CreateInvitationRequest{HomeID: home.ID, Username: "bob", Role: models.RoleView}
+	if code := s.do(t, http.MethodPost, "/auth/home/invitation", "alice", req, &inv); code != http.StatusCreated || inv.UserID == nil || *inv.UserID != bob.ID || inv.Status != models.InvitationPending {
+		t.Fatalf("invite bob: status %d, %+v", code, inv)
+	}
+	var carolInv dto.InvitationResponse
+	req = dto.CreateInvitationRequest{HomeID: home.ID, Username: "carol", Role: models.RoleView}
+	if code := s.do(t, http.MethodPost, "/auth/home/invitation", "alice", req, &carolInv); code != http.StatusCreated {
+		t.Fatalf("invite carol: status %d", code)
+	}
+
+	var listed []dto.InvitationResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/invitation/list?home_id=%d", home.ID), "alice", nil, &listed); code != http.StatusOK || len(listed) != 2 {
+		t.Errorf("list home invitations: status %d, %+v", code, listed)
+	}
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/invitation/list?home_id=%d", home.ID), "bob", nil, nil); code != http.StatusForbidden {
+		t.Errorf("non-member listing invitations: status %d", code)
+	}
+
+	var mine []dto.InvitationResponse
+	if code := s.do(t, http.MethodGet, "/auth/me/invitations", "bob", nil, &mine); code != http.StatusOK || len(mine) != 1 || mine[0].HomeName != "Lab" {
+		t.Fatalf("bob's invitations: status %d, %+v", code, mine)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/me/invitations/accept", "carol", dto.InvitationAnswerRequest{InvitationID: inv.ID}, nil); code != http.StatusNotFound {
+		t.Errorf("accepting another's invitation: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/me/invitations/accept", "bob", dto.InvitationAnswerRequest{InvitationID: inv.ID}, nil); code != http.StatusNoContent {
+		t.Fatalf("accept: status %d", code)
+	}
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/role/list?home_id=%d", home.ID), "bob", nil, nil); code != http.StatusOK {
+		t.Errorf("member viewing the home: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/me/invitations/decline", "bob", dto.InvitationAnswerRequest{InvitationID: inv.ID}, nil); code != http.StatusConflict {
+		t.Errorf("declining an accepted invitation: status %d", code)
+	}
+
+	revoke := fmt.Sprintf("/auth/home/invitation?home_id=%d&invitation_id=%d", home.ID, carolInv.ID)
+	if code := s.do(t, http.MethodDelete, revoke, "alice", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/me/invitations/accept", "carol", dto.InvitationAnswerRequest{InvitationID: carolInv.ID}, nil); code != http.StatusConflict {
+		t.Errorf("accepting a revoked invitation: status %d", code)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"PragatiIot/platform/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID. A value sent by the client is kept,
+// otherwise one is generated; either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// RequestLogger attaches a request ID to the request context and logs one
+// line per request, including any errors handlers recorded with c.Error.
+// Requests that fail with a 5xx status are logged at error level.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+		ctx := logging.WithAttrs(c.Request.Context(), slog.String(logging.RequestIDKey, requestID))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.Any("errors", c.Errors.Errors()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case probePaths[c.FullPath()]:
+			// Orchestrators probe every few seconds.
+			level = slog.LevelDebug
+		}
+		// c.Request is re-read so fields added by later middleware, such as
+		// the username, are included.
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/middleware"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+// loginResponse logs in a user who proved who they are: with a token, or,
+// if they enabled MFA, with a challenge to complete at POST /login/mfa.
+func loginResponse(ctx context.Context, mfaService *services.MFAService, tokens *middleware.Tokens, user models.User) (dto.LoginResponse, error) {
+	if user.MFAEnabled {
+		mfaToken, err := mfaService.Challenge(ctx, user)
+		if err != nil {
+			return dto.LoginResponse{}, err
+		}
+		return dto.LoginResponse{Message: "Multi-factor authentication required", MFARequired: true, MFAToken: mfaToken}, nil
+	}
+	token, err := tokens.CreateToken(user)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	return dto.LoginResponse{Message: "Login successful", Token: token}, nil
+}
+
+// CompleteMFALogin finishes a login with a TOTP or recovery code
+// @Summary Complete login with MFA
+// @Description Completes the login of a user with multi-factor authentication, using the MFA token from /login and a code from their authenticator app or an unused recovery code. Wrong codes count as failed logins.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param login body dto.MFALoginRequest true "MFA token and code"
+// @Success 200 {object} dto.LoginResponse "Login successful"
+// @Failure 400 {object} Problem "Invalid payload, incorrect code, or invalid or expired MFA token"
+// @Failure 429 {object} Problem "Too many attempts or account temporarily locked; see Retry-After"
+// @Router /login/mfa [post]
+func (h *UserHandler) CompleteMFALogin(c *gin.Context) {
+	var req dto.MFALoginRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := h.mfaService.CompleteLogin(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	token, err := h.tokens.CreateToken(user)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LoginResponse{Message: "Login successful", Token: token})
+}
+
+// BeginMFAEnrollment starts enrolling an authenticator app
+// @Summary Start MFA enrollment
+// @Description Creates a TOTP secret for the authenticated user. Show the URI as a QR code, then confirm a code at /auth/me/mfa/confirm to enable MFA. Starting again replaces an unconfirmed secret.
+// @Tags account
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 201 {object} dto.MFAEnrollmentResponse "TOTP secret and provisioning URI"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "MFA is not configured on this server"
+// @Failure 409 {object} Problem "MFA already enabled"
+// @Router /auth/me/mfa [post]
+func (h *UserHandler) BeginMFAEnrollment(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	secret, uri, err := h.mfaService.BeginEnrollment(c.Request.Context(), user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MFAEnrollmentResponse{Secret: secret, URI: uri})
+}
+
+// ConfirmMFAEnrollment enables MFA
+// @Summary Confirm MFA enrollment
+// @Description Enables multi-factor authentication once a code from the new secret is given, and returns recovery codes. The codes cannot be shown again.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code body dto.MFACodeRequest true "TOTP code"
+// @Success 200 {object} dto.RecoveryCodesResponse "MFA enabled"
+// @Failure 400 {object} Problem "Invalid payload or incorrect code"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 409 {object} Problem "No enrollment started, or MFA already enabled"
+// @Router /auth/me/mfa/confirm [post]
+func (h *UserHandler) ConfirmMFAEnrollment(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmEnrollment(c.Request.Context(), user.ID, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{Message: "Multi-factor authentication enabled", RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replaces the authenticated user's recovery codes, used or not, after checking a TOTP or recovery code
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param code body dto.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} dto.RecoveryCodesResponse "New recovery codes"
+// @Failure 400 {object} Problem "Invalid payload or incorrect code"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 409 {object} Problem "MFA not enabled"
+// @Router /auth/me/mfa/recovery-codes [post]
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.Request.Context(), user.ID, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{Message: "Recovery codes replaced", RecoveryCodes: codes})
+}
+
+// DisableMFA turns MFA off
+// @Summary Disable MFA
+// @Description Disables multi-factor authentication for the authenticated user after checking a TOTP or recovery code. Homes that require MFA refuse them Admin rights until they enable it again.
+// @Tags account
+// @Accept json
+// @Security ApiKeyAuth
+// @Param code body dto.MFACodeRequest true "TOTP or recovery code"
+// @Success 204 "MFA disabled"
+// @Failure 400 {object} Problem "Invalid payload or incorrect code"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 409 {object} Problem "MFA not enabled"
+// @Router /auth/me/mfa [delete]
+func (h *UserHandler) DisableMFA(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.mfaService.Disable(c.Request.Context(), user.ID, req.Code); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/totp"
+)
+
+func TestMFALogin(t *testing.T) {
+	s := newTestServer(t)
+	ada := s.register(t, "ada")
+	credentials := dto.LoginRequest{Username: "ada", Password: "correct horse"}
+
+	var enrollment dto.MFAEnrollmentResponse
+	if code := s.do(t, http.MethodPost, "/auth/me/mfa", "ada", nil, &enrollment); code != http.StatusCreated || enrollment.URI == "" {
+		t.Fatalf("enroll: status %d, %+v", code, enrollment)
+	}
+	now := totp.Step(time.Now())
+	current, _ := totp.Code(enrollment.Secret, now)
+	before := s.token(t, "ada")
+	var recovery dto.RecoveryCodesResponse
+	if code := s.doToken(t, http.MethodPost, "/auth/me/mfa/confirm", before, dto.MFACodeRequest{Code: current}, &recovery); code != http.StatusOK || len(recovery.RecoveryCodes) == 0 {
+		t.Fatalf("confirm: status %d, %+v", code, recovery)
+	}
+	// Tokens issued before MFA was enabled are revoked.
+	if code := s.doToken(t, http.MethodGet, "/auth/me", before, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("token issued before enabling MFA: status %d, want 401", code)
+	}
+
+	var login dto.LoginResponse
+	if code := s.do(t, http.MethodPost, "/login", "", credentials, &login); code != http.StatusOK || login.Token != "" || !login.MFARequired {
+		t.Fatalf("login: status %d, %+v", code, login)
+	}
+	if code := s.do(t, http.MethodPost, "/login/mfa", "", dto.MFALoginRequest{MFAToken: login.MFAToken, Code: "000000"}, nil); code != http.StatusBadRequest {
+		t.Errorf("wrong code: status %d", code)
+	}
+	next, _ := totp.Code(enrollment.Secret, now+1)
+	var done dto.LoginResponse
+	if code := s.do(t, http.MethodPost, "/login/mfa", "", dto.MFALoginRequest{MFAToken: login.MFAToken, Code: next}, &done); code != http.StatusOK || done.Token == "" {
+		t.Fatalf("second step: status %d, %+v", code, done)
+	}
+
+	// Only members with MFA keep more than read rights in a home requiring it.
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "ada", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	bob := s.register(t, "bob")
+	for _, user := range []int{ada.ID, bob.ID} {
+		if err := s.homes.AddUserToHome(context.Background(), home.ID, user, "Admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	require := true
+	if code := s.do(t, http.MethodPut, "/auth/home/mfa", "bob", dto.SetHomeMFARequest{HomeID: home.ID, RequireMFA: &require}, nil); code != http.StatusConflict {
+		t.Errorf("requiring MFA without it: status %d", code)
+	}
+	if code := s.do(t, http.MethodPut, "/auth/home/mfa", "ada", dto.SetHomeMFARequest{HomeID: home.ID, RequireMFA: &require}, nil); code != http.StatusOK {
+		t.Fatalf("require MFA: status %d", code)
+	}
+	policy := dto.SetRetentionPolicyRequest{HomeID: home.ID, RetentionDays: 30}
+	if code := s.do(t, http.MethodPut, "/auth/retention-policy", "bob", policy, nil); code != http.StatusForbidden {
+		t.Errorf("admin without MFA: status %d", code)
+	}
+	if code := s.do(t, http.MethodPut, "/auth/retention-policy", "ada", policy, nil); code != http.StatusOK {
+		t.Errorf("admin with MFA: status %d", code)
+	}
+
+	if code := s.do(t, http.MethodDelete, "/auth/me/mfa", "ada", dto.MFACodeRequest{Code: recovery.RecoveryCodes[0]}, nil); code != http.StatusNoContent {
+		t.Fatalf("disable: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/login", "", credentials, &done); code != http.StatusOK || done.Token == "" {
+		t.Errorf("login after disabling MFA: status %d, %+v", code, done)
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationHandler struct {
+	orgService  *services.OrganizationService
+	homeService *services.HomeService
+}
+
+func NewOrganizationHandler(orgService *services.OrganizationService, homeService *services.HomeService) *OrganizationHandler {
+	return &OrganizationHandler{orgService: orgService, homeService: homeService}
+}
+
+// CreateOrganization adds an organization
+// @Summary Create an organization
+// @Description Adds an organization on the default plan with the authenticated user as its owner. Homes added to it are shared with its members according to their organization roles.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param org body dto.CreateOrganizationRequest true "Organization"
+// @Success 201 {object} dto.OrganizationResponse "Organization created"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/org [post]
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req dto.CreateOrganizationRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(c.Request.Context(), user.ID, req.Name, req.BillingEmail)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromOrganization(org, models.OrgRoleOwner))
+}
+
+// GetOrganizations lists the user's organizations
+// @Summary List organizations
+// @Description Lists the organizations the authenticated user is a member of, with their role in each
+// @Tags organizations
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.OrganizationResponse "Organizations"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Router /auth/org/list [get]
+func (h *OrganizationHandler) GetOrganizations(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	members, orgs, err := h.orgService.GetOrganizations(c.Request.Context(), user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := make([]dto.OrganizationResponse, len(orgs))
+	for i, org := range orgs {
+		response[i] = dto.FromOrganization(org, members[i].Role)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateOrganization changes an organization
+// @Summary Update an organization
+// @Description Changes the name or billing email of an organization. Only its owners may. The plan and quotas are set by billing.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param org body dto.UpdateOrganizationRequest true "Fields to change"
+// @Success 200 {object} dto.OrganizationResponse "Organization updated"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Not an owner of the organization"
+// @Failure 404 {object} Problem "Organization not found"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/org [patch]
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	var req dto.UpdateOrganizationRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	org, err := h.orgService.UpdateOrganization(c.Request.Context(), req.OrgID, user.ID, req.Name, req.BillingEmail)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromOrganization(org, models.OrgRoleOwner))
+}
+
+// GetUsage returns an organization's usage of its quotas
+// @Summary Get organization usage
+// @Description Returns the organization's plan, its quotas and how much of each it uses. A null quota is unlimited.
+// @Tags organizations
+// @Produce json
+// @Security ApiKeyAuth
+// @Param org_id query int true "Organization ID"
+// @Success 200 {object} dto.OrgUsageResponse "Usage"
+// @Failure 400 {object} Problem "Invalid organization ID"
+// @Failure 404 {object} Problem "Organization not found"
+// @Router /auth/org/usage [get]
+func (h *OrganizationHandler) GetUsage(c *gin.Context) {
+	var query dto.OrgQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	org, usage, err := h.orgService.Usage(c.Request.Context(), query.OrgID, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromOrgUsage(org, usage))
+}
+
+// GetMembers lists an organization's members
+// @Summary List organization members
+// @Description Lists the members of an organization and their roles, to its members
+// @Tags organizations
+// @Produce json
+// @Security ApiKeyAuth
+// @Param org_id query int true "Organization ID"
+// @Success 200 {array} dto.OrgMemberResponse "Members"
+// @Failure 400 {object} Problem "Invalid organization ID"
+// @Failure 404 {object} Problem "Organization not found"
+// @Router /auth/org/member/list [get]
+func (h *OrganizationHandler) GetMembers(c *gin.Context) {
+	var query dto.OrgQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	members, err := h.orgService.GetMembers(c.Request.Context(), query.OrgID, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromOrgMembers(members))
+}
+
+// SetMember adds a member to an organization or changes their role
+// @Summary Set organization member
+// @Description Adds a user to an organization with a role, or changes their role. Owners and admins may; only owners may grant or revoke the owner role. Owners and admins inherit the Admin role's permissions in the organization's homes, viewers telemetry.read, and operators telemetry.read and device.command.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param member body dto.SetOrgMemberRequest true "Member and role"
+// @Success 200 {object} dto.MessageResponse "Member set"
+// @Failure 400 {object} Problem "Invalid request payload or unknown user"
+// @Failure 403 {object} Problem "Not allowed, or the members quota is reached"
+// @Failure 404 {object} Problem "Organization not found"
+// @Failure 409 {object} Problem "The organization would have no owner"
+// @Router /auth/org/member [post]
+func (h *OrganizationHandler) SetMember(c *gin.Context) {
+	var req dto.SetOrgMemberRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.orgService.SetMember(c.Request.Context(), req.OrgID, user.ID, req.UserID, req.Role); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Member set"})
+}
+
+// RemoveMember removes a member from an organization
+// @Summary Remove organization member
+// @Description Removes a user from an organization. Owners and admins may remove others, only owners may remove an owner, and any member may leave. The last owner cannot.
+// @Tags organizations
+// @Security ApiKeyAuth
+// @Param org_id query int true "Organization ID"
+// @Param user_id query int true "User ID"
+// @Success 204 "Member removed"
+// @Failure 400 {object} Problem "Invalid organization or user ID"
+// @Failure 403 {object} Problem "Not allowed to remove the member"
+// @Failure 404 {object} Problem "Organization or member not found"
+// @Failure 409 {object} Problem "The organization would have no owner"
+// @Router /auth/org/member [delete]
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	var query dto.OrgMemberQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.orgService.RemoveMember(c.Request.Context(), query.OrgID, user.ID, query.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetHomes lists an organization's homes
+// @Summary List organization homes
+// @Description Lists the homes of an organization, to its members
+// @Tags organizations
+// @Produce json
+// @Security ApiKeyAuth
+// @Param org_id query int true "Organization ID"
+// @Success 200 {array} dto.HomeResponse "Homes"
+// @Failure 400 {object} Problem "Invalid organization ID"
+// @Failure 404 {object} Problem "Organization not found"
+// @Router /auth/org/home/list [get]
+func (h *OrganizationHandler) GetHomes(c *gin.Context) {
+	var query dto.OrgQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	homes, err := h.homeService.GetHomesByOrgID(c.Request.Context(), query.OrgID, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	homes = slices.DeleteFunc(homes, func(home models.Home) bool { return !homeAllowed(c, &home.ID) })
+
+	c.JSON(http.StatusOK, dto.FromHomes(homes))
+}
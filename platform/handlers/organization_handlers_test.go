@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestOrganizationTenancy(t *testing.T) {
+	s := newTestServer(t)
+	ada := s.register(t, "ada")
+	bob := s.register(t, "bob")
+	s.register(t, "eve")
+
+	var org dto.OrganizationResponse
+	if code := s.do(t, http.MethodPost, "/auth/org", "ada", dto.CreateOrganizationRequest{Name: "Acme"}, &org); code != http.StatusCreated || org.Role != models.OrgRoleOwner {
+		t.Fatalf("create organization: status %d, %+v", code, org)
+	}
+	member := dto.SetOrgMemberRequest{OrgID: org.ID, UserID: bob.ID, Role: models.OrgRoleViewer}
+	if code := s.do(t, http.MethodPost, "/auth/org/member", "ada", member, nil); code != http.StatusOK {
+		t.Fatalf("add member: status %d", code)
+	}
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "ada", dto.AddHomeRequest{HomeName: "Plant", OrgID: &org.ID}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/home", "bob", dto.AddHomeRequest{HomeName: "Depot", OrgID: &org.ID}, nil); code != http.StatusForbidden {
+		t.Errorf("viewer adding a home: status %d", code)
+	}
+	device := dto.AddDeviceRequest{DeviceID: "d1", ChannelID: "c1", HomeID: &home.ID}
+	if code := s.do(t, http.MethodPost, "/auth/device", "ada", device, nil); code != http.StatusCreated {
+		t.Fatalf("add device: status %d", code)
+	}
+
+	// Members see the organization's homes and devices through their role.
+	homes := fmt.Sprintf("/auth/home/list?user_id=%d", ada.ID)
+	devices := fmt.Sprintf("/auth/device/list?user_id=%d", ada.ID)
+	var list []dto.HomeResponse
+	if code := s.do(t, http.MethodGet, homes, "bob", nil, &list); code != http.StatusOK || len(list) != 1 || list[0].OrgID == nil {
+		t.Errorf("member listing homes: status %d, %+v", code, list)
+	}
+	var deviceList []dto.DeviceResponse
+	if code := s.do(t, http.MethodGet, devices, "bob", nil, &deviceList); code != http.StatusOK || len(deviceList) != 1 {
+		t.Errorf("member listing devices: status %d, %+v", code, deviceList)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/command", "bob", dto.SendCommandRequest{DeviceID: "d1", Command: "reboot"}, nil); code != http.StatusForbidden {
+		t.Errorf("viewer sending a command: status %d", code)
+	}
+
+	// Another customer sees nothing of it.
+	if code := s.do(t, http.MethodGet, homes, "eve", nil, &list); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("outsider listing homes: status %d, %+v", code, list)
+	}
+	if code := s.do(t, http.MethodGet, devices, "eve", nil, &deviceList); code != http.StatusOK || len(deviceList) != 0 {
+		t.Errorf("outsider listing devices: status %d, %+v", code, deviceList)
+	}
+	for _, path := range []string{"/auth/org/usage", "/auth/org/member/list", "/auth/org/home/list"} {
+		if code := s.do(t, http.MethodGet, fmt.Sprintf("%s?org_id=%d", path, org.ID), "eve", nil, nil); code != http.StatusNotFound {
+			t.Errorf("outsider reading %s: status %d", path, code)
+		}
+	}
+	var bot dto.ServiceAccountResponse
+	if code := s.do(t, http.MethodPost, "/auth/service-account", "eve", dto.CreateServiceAccountRequest{Name: "eve-bot"}, &bot); code != http.StatusCreated {
+		t.Fatalf("create service account: status %d", code)
+	}
+	join := dto.AddUserToHomeRequest{HomeID: home.ID, UserID: bot.ID, Role: "Admin"}
+	if code := s.do(t, http.MethodPost, "/auth/home/add-user", "eve", join, nil); code != http.StatusForbidden {
+		t.Errorf("outsider adding a member: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/home/add-user", "ada", join, nil); code != http.StatusBadRequest {
+		t.Errorf("adding a user outside the organization: status %d", code)
+	}
+
+	var usage dto.OrgUsageResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/org/usage?org_id=%d", org.ID), "bob", nil, &usage); code != http.StatusOK {
+		t.Fatalf("usage: status %d", code)
+	}
+	if usage.Homes != 1 || usage.Devices != 1 || usage.Members != 2 || usage.Plan != "free" {
+		t.Errorf("usage %+v", usage)
+	}
+	if code := s.do(t, http.MethodDelete, fmt.Sprintf("/auth/org/member?org_id=%d&user_id=%d", org.ID, ada.ID), "ada", nil, nil); code != http.StatusConflict {
+		t.Errorf("last owner leaving: status %d", code)
+	}
+}
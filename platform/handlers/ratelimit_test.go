@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	s := newLimitedTestServer(t, RateLimits{
+		Store:   ratelimit.NewMemoryStore(),
+		Account: ratelimit.Limit{Rate: 1.0 / 60, Burst: 2},
+	})
+	login := dto.LoginRequest{Username: "alice", Password: "wrong"}
+
+	for i := 0; i < 2; i++ {
+		if code := s.do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != ProblemContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// Probes are not limited.
+	if code := s.do(t, http.MethodGet, "/healthz", "", nil, nil); code != http.StatusOK {
+		t.Errorf("/healthz: status %d", code)
+	}
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	s := newLimitedTestServer(t, RateLimits{
+		Store:   ratelimit.NewMemoryStore(),
+		Account: ratelimit.Limit{Rate: 1.0 / 60, Burst: 2},
+	})
+
+	// A client naming a new address each time still shares one bucket.
+	for i, want := range []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("attempt %d: status %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
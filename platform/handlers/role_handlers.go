@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// GetRoles lists the roles that can be held in a home
+// @Summary List home roles
+// @Description Lists the built-in roles followed by the home's custom roles, with their permissions, to those who can see the home
+// @Tags homes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Success 200 {array} dto.RoleResponse "Roles"
+// @Failure 400 {object} Problem "Invalid home ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Router /auth/home/role/list [get]
+func (h *HomeHandler) GetRoles(c *gin.Context) {
+	var query dto.HomeQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	roles, err := h.homeService.GetRoles(c.Request.Context(), query.HomeID, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromRoles(roles))
+}
+
+// CreateRole adds a custom role to a home
+// @Summary Create a home role
+// @Description Adds a custom role, a named set of permissions, that members of the home can be given. Requires the home.roles.manage permission, and the role may only grant permissions the caller holds. Its name may not be that of a built-in role.
+// @Tags homes
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param role body dto.CreateRoleRequest true "Role"
+// @Success 201 {object} dto.RoleResponse "Role created"
+// @Failure 400 {object} Problem "Invalid request payload or unknown permission"
+// @Failure 403 {object} Problem "Missing the permission, or granting one the caller does not hold"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/role [post]
+func (h *HomeHandler) CreateRole(c *gin.Context) {
+	var req dto.CreateRoleRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	role, err := h.homeService.CreateRole(c.Request.Context(), user.ID, req.HomeID, req.Name, req.Permissions)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromRole(role))
+}
+
+// UpdateRole changes a custom role of a home
+// @Summary Update a home role
+// @Description Renames a custom role and replaces its permissions, for every member holding it. Requires the home.roles.manage permission, and the caller must hold every permission the role grants before and after. Built-in roles cannot be changed.
+// @Tags homes
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param role body dto.UpdateRoleRequest true "Role"
+// @Success 200 {object} dto.RoleResponse "Role updated"
+// @Failure 400 {object} Problem "Invalid request payload or unknown permission"
+// @Failure 403 {object} Problem "Missing the permission, granting one the caller does not hold, or a built-in role"
+// @Failure 404 {object} Problem "Role not found"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/role [put]
+func (h *HomeHandler) UpdateRole(c *gin.Context) {
+	var req dto.UpdateRoleRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	role, err := h.homeService.UpdateRole(c.Request.Context(), user.ID, req.HomeID, req.RoleID, req.Name, req.Permissions)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromRole(role))
+}
+
+// DeleteRole deletes a custom role of a home
+// @Summary Delete a home role
+// @Description Deletes a custom role that no member holds. Requires the home.roles.manage permission. Built-in roles cannot be deleted.
+// @Tags homes
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param role_id query int true "Role ID"
+// @Success 204 "Role deleted"
+// @Failure 400 {object} Problem "Invalid home or role ID"
+// @Failure 403 {object} Problem "Missing the permission, or a built-in role"
+// @Failure 404 {object} Problem "Role not found"
+// @Failure 409 {object} Problem "Members still hold the role"
+// @Router /auth/home/role [delete]
+func (h *HomeHandler) DeleteRole(c *gin.Context) {
+	var query dto.RoleQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.homeService.DeleteRole(c.Request.Context(), user.ID, query.HomeID, query.RoleID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
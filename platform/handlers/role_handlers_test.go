@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestHomeRoles(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+	bob := s.register(t, "bob")
+	carol := s.register(t, "carol")
+
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	var role dto.RoleResponse
+	create := dto.CreateRoleRequest{HomeID: home.ID, Name: "Installer", Permissions: []string{models.PermDeviceAssign}}
+	if code := s.do(t, http.MethodPost, "/auth/home/role", "alice", create, &role); code != http.StatusCreated || role.BuiltIn || role.HomeID == nil {
+		t.Fatalf("create role: status %d, %+v", code, role)
+	}
+	// People join by invitation; only service accounts are added directly.
+	req := dto.AddUserToHomeRequest{HomeID: home.ID, UserID: bob.ID, Role: "Installer"}
+	if code := s.do(t, http.MethodPost, "/auth/home/add-user", "alice", req, nil); code != http.StatusBadRequest {
+		t.Errorf("adding a person directly: status %d", code)
+	}
+	for user, name := range map[int]string{bob.ID: "Installer", carol.ID: models.RoleView} {
+		if err := s.homes.AddUserToHome(context.Background(), home.ID, user, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var roles []dto.RoleResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/role/list?home_id=%d", home.ID), "carol", nil, &roles); code != http.StatusOK || len(roles) != 3 {
+		t.Fatalf("list roles: status %d, %+v", code, roles)
+	}
+
+	// The custom role lets its holders place devices in the home, and
+	// nothing else.
+	device := func(id string) dto.AddDeviceRequest {
+		return dto.AddDeviceRequest{DeviceID: id, ChannelID: "c-" + id, HomeID: &home.ID}
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device", "bob", device("d1"), nil); code != http.StatusCreated {
+		t.Errorf("installer adding a device: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device", "carol", device("d2"), nil); code != http.StatusForbidden {
+		t.Errorf("viewer adding a device: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/home/role", "bob", create, nil); code != http.StatusForbidden {
+		t.Errorf("installer creating a role: status %d", code)
+	}
+
+	update := dto.UpdateRoleRequest{HomeID: home.ID, RoleID: role.ID, Name: "Installer", Permissions: []string{"device.fly"}}
+	if code := s.do(t, http.MethodPut, "/auth/home/role", "alice", update, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown permission: status %d", code)
+	}
+	remove := fmt.Sprintf("/auth/home/role?home_id=%d&role_id=%d", home.ID, role.ID)
+	if code := s.do(t, http.MethodDelete, remove, "alice", nil, nil); code != http.StatusConflict {
+		t.Errorf("deleting a held role: status %d", code)
+	}
+	if code := s.do(t, http.MethodDelete, fmt.Sprintf("/auth/home/role?home_id=%d&role_id=%d", home.ID, roles[0].ID), "alice", nil, nil); code != http.StatusForbidden {
+		t.Errorf("deleting a built-in role: status %d", code)
+	}
+}
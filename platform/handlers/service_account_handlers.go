@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ServiceAccountHandler struct {
+	serviceAccountService *services.ServiceAccountService
+}
+
+func NewServiceAccountHandler(serviceAccountService *services.ServiceAccountService) *ServiceAccountHandler {
+	return &ServiceAccountHandler{serviceAccountService: serviceAccountService}
+}
+
+// CreateServiceAccount adds a service account
+// @Summary Create a service account
+// @Description Adds a service account owned by the authenticated user. Service accounts cannot log in; they authenticate with API keys in the X-API-Key header. Add them to homes like any user.
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param account body dto.CreateServiceAccountRequest true "Service account"
+// @Success 201 {object} dto.ServiceAccountResponse "Service account created"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/service-account [post]
+func (h *ServiceAccountHandler) CreateServiceAccount(c *gin.Context) {
+	var req dto.CreateServiceAccountRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	account, err := h.serviceAccountService.CreateServiceAccount(c.Request.Context(), user.ID, req.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromServiceAccount(account))
+}
+
+// GetServiceAccounts lists the user's service accounts
+// @Summary List service accounts
+// @Description Lists the service accounts owned by the authenticated user
+// @Tags service-accounts
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.ServiceAccountResponse "Service accounts"
+// @Failure 401 {object} Problem "Invalid username or password"
+// @Router /auth/service-account/list [get]
+func (h *ServiceAccountHandler) GetServiceAccounts(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	accounts, err := h.serviceAccountService.GetServiceAccounts(c.Request.Context(), user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromServiceAccounts(accounts))
+}
+
+// DeleteServiceAccount deletes a service account
+// @Summary Delete a service account
+// @Description Deletes one of the user's service accounts with its API keys, memberships and devices
+// @Tags service-accounts
+// @Security ApiKeyAuth
+// @Param id query int true "Service account ID"
+// @Success 204 "Service account deleted"
+// @Failure 404 {object} Problem "Service account not found"
+// @Router /auth/service-account [delete]
+func (h *ServiceAccountHandler) DeleteServiceAccount(c *gin.Context) {
+	var query dto.ServiceAccountQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.serviceAccountService.DeleteServiceAccount(c.Request.Context(), user.ID, query.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateAPIKey adds an API key to a service account
+// @Summary Create an API key
+// @Description Adds a key to one of the user's service accounts. The key is returned once and only its hash is stored. Scopes are homes:read, homes:write, devices:read, devices:write, commands:send, telemetry:read and audit:read. home_ids restricts the key to homes the user administers.
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param key body dto.CreateAPIKeyRequest true "API key"
+// @Success 201 {object} dto.CreatedAPIKeyResponse "API key created"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 404 {object} Problem "Service account not found"
+// @Router /auth/service-account/key [post]
+func (h *ServiceAccountHandler) CreateAPIKey(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	key, secret, err := h.serviceAccountService.CreateAPIKey(c.Request.Context(), user.ID, req.ServiceAccountID, req.Name, req.Scopes, req.HomeIDs, req.ExpiresAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreatedAPIKeyResponse{APIKeyResponse: dto.FromAPIKey(key), Key: secret})
+}
+
+// GetAPIKeys lists the API keys of a service account
+// @Summary List API keys
+// @Description Lists the keys of one of the user's service accounts, including revoked and expired ones
+// @Tags service-accounts
+// @Produce json
+// @Security ApiKeyAuth
+// @Param service_account_id query int true "Service account ID"
+// @Success 200 {array} dto.APIKeyResponse "API keys"
+// @Failure 404 {object} Problem "Service account not found"
+// @Router /auth/service-account/key/list [get]
+func (h *ServiceAccountHandler) GetAPIKeys(c *gin.Context) {
+	var query dto.APIKeyQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	keys, err := h.serviceAccountService.GetAPIKeys(c.Request.Context(), user.ID, query.ServiceAccountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromAPIKeys(keys))
+}
+
+// RevokeAPIKey revokes an API key
+// @Summary Revoke an API key
+// @Description Revokes a key of one of the user's service accounts. Requests with it are rejected from then on.
+// @Tags service-accounts
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param key body dto.RevokeAPIKeyRequest true "API key"
+// @Success 200 {object} dto.MessageResponse "API key revoked"
+// @Failure 404 {object} Problem "API key not found"
+// @Router /auth/service-account/key/revoke [post]
+func (h *ServiceAccountHandler) RevokeAPIKey(c *gin.Context) {
+	var req dto.RevokeAPIKeyRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.serviceAccountService.RevokeAPIKey(c.Request.Context(), user.ID, req.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "API key revoked"})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+// doKey sends a request authenticated with an API key and returns the
+// status.
+func (s *testServer) doKey(t *testing.T, method, path, key string, body interface{}) int {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+
+	var home, other dto.CreatedResponse
+	s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Home"}, &home)
+	s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Cabin"}, &other)
+
+	var bot dto.ServiceAccountResponse
+	if code := s.do(t, http.MethodPost, "/auth/service-account", "alice", dto.CreateServiceAccountRequest{Name: "alice-bot"}, &bot); code != http.StatusCreated {
+		t.Fatalf("create service account: status %d", code)
+	}
+	// Service accounts are given a role in a home directly.
+	if code := s.do(t, http.MethodPost, "/auth/home/add-user", "alice", dto.AddUserToHomeRequest{HomeID: home.ID, UserID: bot.ID, Role: "Admin"}, nil); code != http.StatusOK {
+		t.Fatalf("add service account to home: status %d", code)
+	}
+	req := dto.CreateAPIKeyRequest{
+		ServiceAccountID: bot.ID,
+		Name:             "ci",
+		Scopes:           []string{models.ScopeDevicesRead, models.ScopeAuditRead},
+		HomeIDs:          []int{home.ID},
+	}
+	var key dto.CreatedAPIKeyResponse
+	if code := s.do(t, http.MethodPost, "/auth/service-account/key", "alice", req, &key); code != http.StatusCreated {
+		t.Fatalf("create key: status %d", code)
+	}
+
+	devices := fmt.Sprintf("/auth/device/list?user_id=%d", bot.ID)
+	if code := s.doKey(t, http.MethodGet, devices, key.Key, nil); code != http.StatusOK {
+		t.Errorf("scoped request: status %d", code)
+	}
+	if code := s.doKey(t, http.MethodGet, fmt.Sprintf("/auth/audit?home_id=%d", home.ID), key.Key, nil); code != http.StatusOK {
+		t.Errorf("audit log of the key's home: status %d", code)
+	}
+	if code := s.doKey(t, http.MethodGet, fmt.Sprintf("/auth/audit?home_id=%d", other.ID), key.Key, nil); code != http.StatusForbidden {
+		t.Errorf("home outside the key's homes: status %d", code)
+	}
+	if code := s.doKey(t, http.MethodPost, "/auth/home", key.Key, dto.AddHomeRequest{HomeName: "Bot home"}); code != http.StatusForbidden {
+		t.Errorf("missing scope: status %d", code)
+	}
+	if code := s.doKey(t, http.MethodGet, "/auth/service-account/list", key.Key, nil); code != http.StatusForbidden {
+		t.Errorf("service account management with a key: status %d", code)
+	}
+
+	if code := s.do(t, http.MethodPost, "/auth/service-account/key/revoke", "alice", dto.RevokeAPIKeyRequest{ID: key.ID}, nil); code != http.StatusOK {
+		t.Fatalf("revoke: status %d", code)
+	}
+	if code := s.doKey(t, http.MethodGet, devices, key.Key, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/login", "", dto.LoginRequest{Username: "alice-bot", Password: "anything"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("service account login: status %d", code)
+	}
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SpaceHandler struct {
+	spaceService  *services.SpaceService
+	deviceService *services.DeviceService
+	homeService   *services.HomeService
+}
+
+func NewSpaceHandler(spaceService *services.SpaceService, deviceService *services.DeviceService, homeService *services.HomeService) *SpaceHandler {
+	return &SpaceHandler{spaceService: spaceService, deviceService: deviceService, homeService: homeService}
+}
+
+// GetSpaces lists the spaces of a home
+// @Summary List home spaces
+// @Description Lists the buildings, floors, rooms and zones of a home in the order they were added. Each space names its parent, from which clients build the tree. Open to those who can see the home.
+// @Tags spaces
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Success 200 {array} dto.SpaceResponse "Spaces"
+// @Failure 400 {object} Problem "Invalid home ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Router /auth/home/space/list [get]
+func (h *SpaceHandler) GetSpaces(c *gin.Context) {
+	var query dto.HomeQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.homeService.AuthorizeView(c.Request.Context(), query.HomeID, user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	spaces, err := h.spaceService.GetSpaces(c.Request.Context(), query.HomeID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromSpaces(spaces))
+}
+
+// CreateSpace adds a space to a home
+// @Summary Create a home space
+// @Description Adds a building, floor, room or zone to a home, directly or inside another of its spaces of an earlier kind, in the order building, floor, room, zone. Names are unique among the spaces of a parent. Requires the home.manage permission.
+// @Tags spaces
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param space body dto.CreateSpaceRequest true "Space"
+// @Success 201 {object} dto.SpaceResponse "Space created"
+// @Failure 400 {object} Problem "Invalid request payload, kind or parent"
+// @Failure 403 {object} Problem "Missing the home.manage permission"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/space [post]
+func (h *SpaceHandler) CreateSpace(c *gin.Context) {
+	var req dto.CreateSpaceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, models.PermHomeManage) {
+		return
+	}
+
+	space, err := h.spaceService.AddSpace(c.Request.Context(), models.Space{HomeID: req.HomeID, ParentID: req.ParentID, Name: req.Name, Kind: req.Kind})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.FromSpace(space))
+}
+
+// UpdateSpace changes a space of a home
+// @Summary Update a home space
+// @Description Replaces the parent, name and kind of a space. The kinds must stay in order along every branch, so a room with zones cannot become a zone. Requires the home.manage permission.
+// @Tags spaces
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param space body dto.UpdateSpaceRequest true "Space"
+// @Success 200 {object} dto.SpaceResponse "Space updated"
+// @Failure 400 {object} Problem "Invalid request payload, kind or parent"
+// @Failure 403 {object} Problem "Missing the home.manage permission"
+// @Failure 404 {object} Problem "Space not found"
+// @Failure 409 {object} Problem "Name already taken"
+// @Router /auth/home/space [put]
+func (h *SpaceHandler) UpdateSpace(c *gin.Context) {
+	var req dto.UpdateSpaceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, req.HomeID, models.PermHomeManage) {
+		return
+	}
+
+	space := models.Space{ID: req.SpaceID, HomeID: req.HomeID, ParentID: req.ParentID, Name: req.Name, Kind: req.Kind}
+	space, err := h.spaceService.UpdateSpace(c.Request.Context(), space)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromSpace(space))
+}
+
+// DeleteSpace deletes a space of a home
+// @Summary Delete a home space
+// @Description Deletes a space with no spaces inside it. Its devices stay in the home, in no space. Requires the home.manage permission.
+// @Tags spaces
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param space_id query int true "Space ID"
+// @Success 204 "Space deleted"
+// @Failure 400 {object} Problem "Invalid home or space ID"
+// @Failure 403 {object} Problem "Missing the home.manage permission"
+// @Failure 404 {object} Problem "Space not found"
+// @Failure 409 {object} Problem "The space contains other spaces"
+// @Router /auth/home/space [delete]
+func (h *SpaceHandler) DeleteSpace(c *gin.Context) {
+	var query dto.SpaceQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, models.PermHomeManage) {
+		return
+	}
+
+	if err := h.spaceService.DeleteSpace(c.Request.Context(), query.HomeID, query.SpaceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AssignDeviceToSpace places a device in a space of its home
+// @Summary Assign device to space
+// @Description Places a device in a space of the home it is in, or in no space if space_id is omitted. Requires the device.assign permission in the device's home; a device in no home can only be taken out of its space, by its owner. A device moved to another home leaves its space.
+// @Tags spaces
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body dto.AssignSpaceRequest true "Device and space IDs"
+// @Success 200 {object} dto.MessageResponse "Device assigned to space successfully"
+// @Failure 400 {object} Problem "Invalid request payload, or the space is not in the device's home"
+// @Failure 403 {object} Problem "Missing the device.assign permission in the device's home"
+// @Failure 404 {object} Problem "Device not found"
+// @Router /auth/device/assign-space [post]
+func (h *SpaceHandler) AssignDeviceToSpace(c *gin.Context) {
+	var req dto.AssignSpaceRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	device, err := h.deviceService.GetDeviceByID(c.Request.Context(), req.DeviceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, device.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if device.HomeID == nil {
+		if device.UserID != user.ID {
+			c.Error(apperrors.Forbidden("Not allowed to move this device"))
+			return
+		}
+	} else if err := h.homeService.Authorize(c.Request.Context(), *device.HomeID, user.ID, models.PermDeviceAssign); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.spaceService.AssignDevice(c.Request.Context(), req.DeviceID, req.SpaceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Device assigned to space successfully"})
+}
+
+// GetHomeDevices lists the devices of a home, optionally in a space
+// @Summary List home devices
+// @Description Lists the devices of a home, or with space_id those in the space and the spaces inside it, so that a floor lists the devices of its rooms and their zones. Open to those who can see the home.
+// @Tags spaces
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param space_id query int false "Space ID"
+// @Success 200 {array} dto.DeviceResponse "Devices"
+// @Failure 400 {object} Problem "Invalid home or space ID"
+// @Failure 403 {object} Problem "Not allowed to view this home"
+// @Failure 404 {object} Problem "Space not found"
+// @Router /auth/home/device/list [get]
+func (h *SpaceHandler) GetHomeDevices(c *gin.Context) {
+	var query dto.HomeDevicesQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &query.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.homeService.AuthorizeView(c.Request.Context(), query.HomeID, user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	devices, err := h.spaceService.GetDevices(c.Request.Context(), query.HomeID, query.SpaceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromDevices(devices))
+}
+
+// GetSpaceTelemetry retrieves raw telemetry of the devices in a space
+// @Summary Get space telemetry
+// @Description Retrieves the readings taken in a home by its devices, or with space_id by those in the space and the spaces inside it, newest first. Devices count in the space they are in now. Requires the telemetry.read permission in the home. Defaults to the last 24 hours.
+// @Tags spaces
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param space_id query int false "Space ID"
+// @Param from query string false "Start of the range, RFC 3339"
+// @Param to query string false "End of the range, RFC 3339"
+// @Param limit query int false "Maximum number of readings (default 1000)"
+// @Success 200 {array} dto.ReadingResponse "Readings"
+// @Failure 400 {object} Problem "Invalid request parameters"
+// @Failure 403 {object} Problem "Missing the telemetry.read permission in the home"
+// @Failure 404 {object} Problem "Space not found"
+// @Router /auth/home/space/telemetry [get]
+func (h *SpaceHandler) GetSpaceTelemetry(c *gin.Context) {
+	var query dto.SpaceTelemetryQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	from, to, err := parseTimeRange(c, 24*time.Hour)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, models.PermTelemetryRead) {
+		return
+	}
+
+	data, err := h.spaceService.GetTelemetry(c.Request.Context(), query.HomeID, query.SpaceID, from, to, query.Limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromReadings(data))
+}
+
+// GetSpaceAnalytics retrieves rollups combined per space
+// @Summary Get space analytics
+// @Description Combines the hourly or daily rollups of each numeric telemetry field per space: for every space of the kind, or of any kind, in the home or within space_id, itself included. A space's figures cover the devices in it and in the spaces inside it, as placed now; avg is the mean of all their readings. With kind=room and metric=temperature, for instance, it gives the average temperature per room. Requires the telemetry.read permission in the home. Defaults to the last 24 hours.
+// @Tags spaces
+// @Produce json
+// @Security ApiKeyAuth
+// @Param home_id query int true "Home ID"
+// @Param space_id query int false "Space within which to combine"
+// @Param kind query string false "Combine per space of this kind: building, floor, room or zone"
+// @Param metric query string false "Telemetry field; all numeric fields if omitted"
+// @Param granularity query string false "hour (default) or day"
+// @Param from query string false "Start of the range, RFC 3339"
+// @Param to query string false "End of the range, RFC 3339"
+// @Success 200 {array} dto.SpaceAnalyticsResponse "Rollups per space"
+// @Failure 400 {object} Problem "Invalid request parameters"
+// @Failure 403 {object} Problem "Missing the telemetry.read permission in the home"
+// @Failure 404 {object} Problem "Space not found"
+// @Router /auth/home/space/analytics [get]
+func (h *SpaceHandler) GetSpaceAnalytics(c *gin.Context) {
+	var query dto.SpaceAnalyticsQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	from, to, err := parseTimeRange(c, 24*time.Hour)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !authorizeHome(c, h.homeService, query.HomeID, models.PermTelemetryRead) {
+		return
+	}
+
+	analytics, err := h.spaceService.GetAnalytics(c.Request.Context(), query.HomeID, query.SpaceID, query.Kind, query.Metric, query.Granularity, from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromSpaceAnalyticsList(analytics))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+func TestSpaces(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.register(t, "alice")
+	bob := s.register(t, "bob")
+
+	var home dto.CreatedResponse
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Lab"}, &home); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	if err := s.homes.AddUserToHome(ctx, home.ID, bob.ID, models.RoleView); err != nil {
+		t.Fatal(err)
+	}
+
+	var floor, room dto.SpaceResponse
+	if code := s.do(t, http.MethodPost, "/auth/home/space", "bob", dto.CreateSpaceRequest{HomeID: home.ID, Name: "Ground", Kind: models.SpaceFloor}, nil); code != http.StatusForbidden {
+		t.Errorf("viewer adding a space: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/home/space", "alice", dto.CreateSpaceRequest{HomeID: home.ID, Name: "Ground", Kind: models.SpaceFloor}, &floor); code != http.StatusCreated {
+		t.Fatalf("add floor: status %d", code)
+	}
+	req := dto.CreateSpaceRequest{HomeID: home.ID, ParentID: &floor.ID, Name: "Office", Kind: models.SpaceRoom}
+	if code := s.do(t, http.MethodPost, "/auth/home/space", "alice", req, &room); code != http.StatusCreated || *room.ParentID != floor.ID {
+		t.Fatalf("add room: status %d, %+v", code, room)
+	}
+	req = dto.CreateSpaceRequest{HomeID: home.ID, ParentID: &room.ID, Name: "Upstairs", Kind: models.SpaceFloor}
+	if code := s.do(t, http.MethodPost, "/auth/home/space", "alice", req, nil); code != http.StatusBadRequest {
+		t.Errorf("floor inside a room: status %d", code)
+	}
+	var spaces []dto.SpaceResponse
+	if code := s.do(t, http.MethodGet, fmt.Sprintf("/auth/home/space/list?home_id=%d", home.ID), "bob", nil, &spaces); code != http.StatusOK || len(spaces) != 2 {
+		t.Errorf("list spaces: status %d, %+v", code, spaces)
+	}
+
+	for _, deviceID := range []string{"d1", "d2"} {
+		device := dto.AddDeviceRequest{DeviceID: deviceID, ChannelID: "c-" + deviceID, HomeID: &home.ID}
+		if code := s.do(t, http.MethodPost, "/auth/device", "alice", device, nil); code != http.StatusCreated {
+			t.Fatalf("add device: status %d", code)
+		}
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/assign-space", "bob", dto.AssignSpaceRequest{DeviceID: "d1", SpaceID: &room.ID}, nil); code != http.StatusForbidden {
+		t.Errorf("viewer placing a device: status %d", code)
+	}
+	if code := s.do(t, http.MethodPost, "/auth/device/assign-space", "alice", dto.AssignSpaceRequest{DeviceID: "d1", SpaceID: &room.ID}, nil); code != http.StatusOK {
+		t.Fatalf("assign space: status %d", code)
+	}
+	var devices []dto.DeviceResponse
+	path := fmt.Sprintf("/auth/home/device/list?home_id=%d&space_id=%d", home.ID, floor.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &devices); code != http.StatusOK || len(devices) != 1 || devices[0].DeviceID != "d1" || *devices[0].SpaceID != room.ID {
+		t.Errorf("devices on the floor: status %d, %+v", code, devices)
+	}
+
+	now := time.Now().UTC()
+	for deviceID, temp := range map[string]float64{"d1": 21, "d2": 30} {
+		reading := models.DeviceData{DeviceID: deviceID, HomeID: &home.ID, CreatedAt: now.Add(-time.Minute), Data: map[string]interface{}{"temp": temp}}
+		if err := s.devices.AddDeviceData(ctx, reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.store.Rollup(ctx, repositories.RollupHourly, now.Add(-time.Hour), now); err != nil {
+		t.Fatal(err)
+	}
+	var readings []dto.ReadingResponse
+	path = fmt.Sprintf("/auth/home/space/telemetry?home_id=%d&space_id=%d", home.ID, room.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &readings); code != http.StatusOK || len(readings) != 1 {
+		t.Errorf("room telemetry: status %d, %+v", code, readings)
+	}
+	var analytics []dto.SpaceAnalyticsResponse
+	path = fmt.Sprintf("/auth/home/space/analytics?home_id=%d&kind=room&metric=temp", home.ID)
+	if code := s.do(t, http.MethodGet, path, "bob", nil, &analytics); code != http.StatusOK || len(analytics) == 0 || analytics[0].SpaceID != room.ID || analytics[0].Avg != 21 {
+		t.Errorf("temperature per room: status %d, %+v", code, analytics)
+	}
+
+	del := fmt.Sprintf("/auth/home/space?home_id=%d&space_id=%d", home.ID, floor.ID)
+	if code := s.do(t, http.MethodDelete, del, "alice", nil, nil); code != http.StatusConflict {
+		t.Errorf("delete a floor with a room: status %d", code)
+	}
+	del = fmt.Sprintf("/auth/home/space?home_id=%d&space_id=%d", home.ID, room.ID)
+	if code := s.do(t, http.MethodDelete, del, "alice", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete the room: status %d", code)
+	}
+}
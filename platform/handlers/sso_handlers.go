@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/middleware"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SSOHandler struct {
+	ssoService *services.SSOService
+	mfaService *services.MFAService
+	tokens     *middleware.Tokens
+}
+
+func NewSSOHandler(ssoService *services.SSOService, mfaService *services.MFAService, tokens *middleware.Tokens) *SSOHandler {
+	return &SSOHandler{ssoService: ssoService, mfaService: mfaService, tokens: tokens}
+}
+
+// GetProviders lists the identity providers
+// @Summary List identity providers
+// @Description Lists the names of the OpenID Connect identity providers users can sign in with
+// @Tags sso
+// @Produce json
+// @Success 200 {array} string "Provider names"
+// @Router /oidc/providers [get]
+func (h *SSOHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ssoService.Providers())
+}
+
+// BeginLogin redirects to an identity provider
+// @Summary Start single sign-on
+// @Description Redirects the browser to the identity provider to sign in, using the authorization code flow with PKCE. The provider redirects back to /oidc/{provider}/callback.
+// @Tags sso
+// @Param provider path string true "Provider name"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} Problem "Identity provider not found"
+// @Failure 500 {object} Problem "Identity provider unreachable"
+// @Router /oidc/{provider}/login [get]
+func (h *SSOHandler) BeginLogin(c *gin.Context) {
+	url, err := h.ssoService.BeginLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// CompleteLogin finishes a login with an identity provider
+// @Summary Finish single sign-on
+// @Description The identity provider redirects here after the user signs in. Users signing in for the first time get an account, or are linked to the account with their verified email address, and are added to the homes their groups are mapped to. Returns a token, or an MFA challenge, as /login does.
+// @Tags sso
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param state query string true "State sent to the provider"
+// @Param code query string false "Authorization code"
+// @Param error query string false "Error from the provider"
+// @Success 200 {object} dto.LoginResponse "Login successful"
+// @Failure 400 {object} Problem "Invalid or expired state"
+// @Failure 401 {object} Problem "Sign-in refused or rejected"
+// @Failure 409 {object} Problem "An account with the email address exists"
+// @Router /oidc/{provider}/callback [get]
+func (h *SSOHandler) CompleteLogin(c *gin.Context) {
+	var query dto.SSOCallbackQuery
+	if err := bindQuery(c, &query); err != nil {
+		c.Error(err)
+		return
+	}
+	if query.Error != "" {
+		c.Error(apperrors.Unauthorized("The identity provider refused the login: %s", query.Error))
+		return
+	}
+
+	user, err := h.ssoService.CompleteLogin(c.Request.Context(), c.Param("provider"), query.State, query.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := loginResponse(c.Request.Context(), h.mfaService, h.tokens, user)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
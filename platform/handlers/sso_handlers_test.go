@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/oidc"
+	"PragatiIot/platform/oidc/oidctest"
+)
+
+func TestSSOLogin(t *testing.T) {
+	s := newTestServer(t)
+	idp := oidctest.NewServer("platform", "")
+	defer idp.Close()
+	s.providers["corp"] = oidc.NewProvider(oidc.Config{
+		Issuer:      idp.URL,
+		ClientID:    "platform",
+		RedirectURL: "https://api.example.com/oidc/corp/callback",
+	}, nil)
+
+	var providers []string
+	if code := s.do(t, http.MethodGet, "/oidc/providers", "", nil, &providers); code != http.StatusOK || len(providers) != 1 {
+		t.Fatalf("providers: status %d, %v", code, providers)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oidc/corp/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d", w.Code)
+	}
+	idp.SignIn(map[string]interface{}{"sub": "u-1", "email": "ada@corp.example", "email_verified": true, "preferred_username": "ada"})
+	back, err := idp.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var login dto.LoginResponse
+	if code := s.do(t, http.MethodGet, "/oidc/corp/callback?"+back.RawQuery, "", nil, &login); code != http.StatusOK || login.Token == "" {
+		t.Fatalf("callback: status %d, %+v", code, login)
+	}
+	// The platform's token works like one from /login.
+	req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("profile with the SSO token: status %d", w.Code)
+	}
+
+	if code := s.do(t, http.MethodGet, "/oidc/corp/callback?"+back.RawQuery, "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("replayed callback: status %d", code)
+	}
+	if code := s.do(t, http.MethodGet, "/oidc/corp/callback?state=x&error=access_denied", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("refused login: status %d", code)
+	}
+	if code := s.do(t, http.MethodGet, "/oidc/other/login", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown provider: status %d", code)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"PragatiIot/platform/services"
+	"github.com/gin-gonic/gin"
+)
+
+type TelemetryHandler struct {
+	telemetryService *services.TelemetryService
+	deviceService    *services.DeviceService
+	homeService      *services.HomeService
+	transferService  *services.DeviceTransferService
+}
+
+func NewTelemetryHandler(telemetryService *services.TelemetryService, deviceService *services.DeviceService, homeService *services.HomeService, transferService *services.DeviceTransferService) *TelemetryHandler {
+	return &TelemetryHandler{telemetryService: telemetryService, deviceService: deviceService, homeService: homeService, transferService: transferService}
+}
+
+// GetDeviceTelemetry retrieves raw telemetry for a device
+// @Summary Get device telemetry
+// @Description Retrieves stored readings for a device, newest first. The owner sees the readings taken since they received the device, and a previous owner who kept its telemetry those taken while they owned it; holders of the telemetry.read permission in its home see readings taken while the device was in that home. Defaults to the last 24 hours.
+// @Tags telemetry
+// @Produce json
+// @Security ApiKeyAuth
+// @Param device_id query string true "Device ID"
+// @Param from query string false "Start of the range, RFC 3339"
+// @Param to query string false "End of the range, RFC 3339"
+// @Param limit query int false "Maximum number of readings (default 1000)"
+// @Success 200 {array} dto.ReadingResponse "Readings"
+// @Failure 400 {object} Problem "Invalid request parameters"
+// @Failure 403 {object} Problem "Not allowed to read this device"
+// @Failure 404 {object} Problem "Device not found"
+// @Failure 500 {object} Problem "Failed to get telemetry"
+// @Router /auth/device/telemetry [get]
+func (h *TelemetryHandler) GetDeviceTelemetry(c *gin.Context) {
+	var params dto.TelemetryQuery
+	if err := bindQuery(c, &params); err != nil {
+		c.Error(err)
+		return
+	}
+
+	from, to, err := parseTimeRange(c, 24*time.Hour)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	device, err := h.deviceService.GetDeviceByID(c.Request.Context(), params.DeviceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !homeAllowed(c, device.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	query := repositories.TelemetryQuery{DeviceID: device.DeviceID, From: from, To: to, Limit: params.Limit}
+	if !homeAllowed(c, nil) {
+		// A key restricted to homes reads only what was taken in its home.
+		query.HomeID = device.HomeID
+	}
+	windows, err := h.transferService.TelemetryWindows(c.Request.Context(), device, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	switch {
+	case len(windows) > 0:
+		data, err := h.telemetryService.GetDeviceDataInWindows(c.Request.Context(), query, windows)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, dto.FromReadings(data))
+		return
+	case device.HomeID == nil:
+		c.Error(apperrors.Forbidden("Not allowed to read this device"))
+		return
+	default:
+		if err := h.homeService.Authorize(c.Request.Context(), *device.HomeID, user.ID, models.PermTelemetryRead); err != nil {
+			c.Error(err)
+			return
+		}
+		query.HomeID = device.HomeID
+	}
+
+	data, err := h.telemetryService.GetDeviceData(c.Request.Context(), query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FromReadings(data))
+}
+
+// SetRetentionPolicy sets how long a home's telemetry is kept
+// @Summary Set home retention policy
+// @Description Creates or replaces the telemetry retention policy of a home. Requires the home.manage permission. Device type policies are managed by operators.
+// @Tags telemetry
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param policy body dto.SetRetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} dto.MessageResponse "Retention policy set"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 403 {object} Problem "Not allowed to manage this home"
+// @Failure 500 {object} Problem "Failed to set retention policy"
+// @Router /auth/retention-policy [put]
+func (h *TelemetryHandler) SetRetentionPolicy(c *gin.Context) {
+	var req dto.SetRetentionPolicyRequest
+	if err := bindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !homeAllowed(c, &req.HomeID) {
+		c.Error(errHomeNotAllowed)
+		return
+	}
+	if err := h.homeService.Authorize(c.Request.Context(), req.HomeID, user.ID, models.PermHomeManage); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.telemetryService.SetRetentionPolicy(c.Request.Context(), req.RetentionPolicy()); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "Retention policy set"})
+}
+
+// GetRetentionPolicies lists the retention policies visible to the user
+// @Summary List retention policies
+// @Description Lists device type retention policies and the policies of homes the user belongs to
+// @Tags telemetry
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.RetentionPolicyResponse "Retention policies"
+// @Failure 401 {object} Problem "Invalid username or password"
+// @Failure 500 {object} Problem "Failed to get retention policies"
+// @Router /auth/retention-policy/list [get]
+func (h *TelemetryHandler) GetRetentionPolicies(c *gin.Context) {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	policies, err := h.telemetryService.GetRetentionPolicies(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	visible := []models.RetentionPolicy{}
+	for _, policy := range policies {
+		if policy.HomeID == nil || homeAllowed(c, policy.HomeID) && h.homeService.IsHomeMember(c.Request.Context(), *policy.HomeID, user.ID) {
+			visible = append(visible, policy)
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.FromRetentionPolicies(visible))
+}
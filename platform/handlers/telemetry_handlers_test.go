@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/dto"
+	"PragatiIot/platform/models"
+)
+
+func TestGetDeviceTelemetryAccess(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	alice := s.register(t, "alice")
+	bob := s.register(t, "bob")
+	s.register(t, "mallory")
+
+	if code := s.do(t, http.MethodPost, "/auth/home", "alice", dto.AddHomeRequest{HomeName: "Home"}, nil); code != http.StatusCreated {
+		t.Fatalf("add home: status %d", code)
+	}
+	homeID := 1
+	if err := s.homes.AddUserToHome(ctx, homeID, bob.ID, "View"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// One reading from before the device joined the home, one after.
+	now := time.Now().UTC()
+	readings := []models.DeviceData{
+		{DeviceID: "d1", CreatedAt: now.Add(-2 * time.Hour), Data: map[string]interface{}{"temp": 19}},
+		{DeviceID: "d1", HomeID: &homeID, CreatedAt: now.Add(-time.Hour), Data: map[string]interface{}{"temp": 21}},
+	}
+	if err := s.devices.AddDeviceDataBatch(ctx, readings); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AssignDeviceToHome(ctx, "d1", &homeID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		status   int
+		readings int
+	}{
+		{"alice", http.StatusOK, 2},
+		{"bob", http.StatusOK, 1},
+		{"mallory", http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		var data []models.DeviceData
+		var out interface{} = &data
+		if tt.status != http.StatusOK {
+			out = nil
+		}
+		code := s.do(t, http.MethodGet, "/auth/device/telemetry?device_id=d1", tt.username, nil, out)
+		if code != tt.status || len(data) != tt.readings {
+			t.Errorf("%s: status %d with %d readings, want %d with %d", tt.username, code, len(data), tt.status, tt.readings)
+		}
+	}
+
+	if code := s.do(t, http.MethodGet, "/auth/device/telemetry?device_id=d2", "alice", nil, nil); code != http.StatusNotFound {
+		t.Errorf("missing device: status %d", code)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"PragatiIot/platform/apperrors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// Report fields by the names clients use.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+}
+
+// bindJSON binds and validates the request body into obj.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		return bindError(err, "Invalid request payload")
+	}
+	return nil
+}
+
+// bindQuery binds and validates the query parameters into obj.
+func bindQuery(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindQuery(obj); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			return bindError(err, "Invalid query parameters")
+		}
+		// Parse errors do not name the parameter, so find the ones that
+		// do not parse.
+		return &apperrors.Error{Kind: apperrors.ErrValidation, Detail: "Invalid query parameters", Fields: unparsableParams(c, obj), Err: err}
+	}
+	return nil
+}
+
+func unparsableParams(c *gin.Context, obj interface{}) []apperrors.FieldError {
+	var fields []apperrors.FieldError
+	t := reflect.TypeOf(obj).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("form")
+		value, ok := c.GetQuery(name)
+		if !ok || value == "" {
+			continue
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int64:
+			if _, err := strconv.Atoi(value); err != nil {
+				fields = append(fields, apperrors.FieldError{Field: name, Message: "must be an integer"})
+			}
+		}
+	}
+	return fields
+}
+
+// bindError turns a binding error into a validation error listing every
+// failing field.
+func bindError(err error, detail string) error {
+	var fields []apperrors.FieldError
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			fields = append(fields, apperrors.FieldError{Field: fieldPath(fe), Message: ruleMessage(fe)})
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		fields = append(fields, apperrors.FieldError{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()})
+	}
+	return &apperrors.Error{Kind: apperrors.ErrValidation, Detail: detail, Fields: fields, Err: err}
+}
+
+// fieldPath is the field's path below the request struct, such as
+// "fields[0].type".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required without " + strings.ToLower(fe.Param())
+	case "excluded_with":
+		return "may not be given with " + strings.ToLower(fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "username":
+		return "may only contain letters, digits, '.', '_' and '-'"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "url":
+		return "must be a URL"
+	case "datetime":
+		return "must be an RFC 3339 time"
+	}
+	return fmt.Sprintf("failed the %s rule", fe.Tag())
+}
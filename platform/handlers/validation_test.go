@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidationListsEveryField(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "alice")
+
+	tests := []struct {
+		name   string
+		path   string
+		user   string
+		body   interface{}
+		fields []string
+	}{
+		{
+			name:   "register",
+			path:   "/register",
+			body:   map[string]string{"username": "a b", "email": "not-an-email"},
+			fields: []string{"email", "password", "username"},
+		},
+		{
+			name:   "home without name",
+			path:   "/auth/home",
+			user:   "alice",
+			body:   map[string]string{},
+			fields: []string{"home_name"},
+		},
+		{
+			name:   "device without channel",
+			path:   "/auth/device",
+			user:   "alice",
+			body:   map[string]interface{}{"device_id": "d1", "home_id": 0, "warranty": -1},
+			fields: []string{"channel_id", "home_id", "warranty"},
+		},
+		{
+			name:   "missing role",
+			path:   "/auth/home/add-user",
+			user:   "alice",
+			body:   map[string]interface{}{"home_id": 1, "user_id": 1, "role": ""},
+			fields: []string{"role"},
+		},
+		{
+			name: "device type field",
+			path: "/auth/device-type",
+			user: "alice",
+			body: map[string]interface{}{
+				"name":   "sensor",
+				"fields": []map[string]string{{"name": "temp", "type": "float"}},
+			},
+			fields: []string{"fields[0].type"},
+		},
+		{
+			name:   "wrong type",
+			path:   "/auth/home/add-user",
+			user:   "alice",
+			body:   map[string]interface{}{"home_id": "one", "user_id": 1, "role": "View"},
+			fields: []string{"home_id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var problem Problem
+			if code := s.do(t, http.MethodPost, tt.path, tt.user, tt.body, &problem); code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", code)
+			}
+			var fields []string
+			for _, fe := range problem.Errors {
+				fields = append(fields, fe.Field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("failing fields %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
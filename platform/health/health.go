@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Component statuses reported by Ready.
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDraining = "draining"
+)
+
+// Checker reports whether a dependency is usable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ComponentStatus is the result of one component's check.
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness of the service and each of its components.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Health runs the readiness checks of registered components. Any component,
+// registered or not, can mark the service as draining so orchestrators stop
+// routing to it before it shuts down.
+type Health struct {
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	checkers map[string]Checker
+	draining map[string]string
+}
+
+// New returns a Health whose checks each time out after timeout.
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Health{
+		timeout:  timeout,
+		checkers: make(map[string]Checker),
+		draining: make(map[string]string),
+	}
+}
+
+// Register adds a component checked by Ready.
+func (h *Health) Register(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checkers[name] = checker
+}
+
+// Drain marks the service not ready on behalf of component, e.g. while it
+// shuts down, until Resume is called for it.
+func (h *Health) Drain(component, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining[component] = reason
+}
+
+// Resume clears a mark set by Drain.
+func (h *Health) Resume(component string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.draining, component)
+}
+
+// Ready runs every check concurrently. The service is ready only when every
+// component is up and none is draining.
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.RLock()
+	checkers := make(map[string]Checker, len(h.checkers))
+	for name, checker := range h.checkers {
+		checkers[name] = checker
+	}
+	draining := make(map[string]string, len(h.draining))
+	for name, reason := range h.draining {
+		draining[name] = reason
+	}
+	h.mu.RUnlock()
+
+	names := make([]string, 0, len(checkers))
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]ComponentStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			results[i] = h.check(ctx, checker)
+		}(i, checkers[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: make(map[string]ComponentStatus, len(names)+len(draining))}
+	for i, name := range names {
+		report.Components[name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	for name, reason := range draining {
+		status := report.Components[name]
+		status.Status = StatusDraining
+		status.Error = reason
+		report.Components[name] = status
+		report.Status = StatusDown
+	}
+	return report
+}
+
+func (h *Health) check(ctx context.Context, checker Checker) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	status := ComponentStatus{
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,333 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"PragatiIot/platform/logging"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/tracing"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("ingest")
+
+// ErrBufferFull is returned by Enqueue when no space frees up in time.
+var ErrBufferFull = errors.New("telemetry buffer is full")
+
+// ErrBufferClosed is returned by Enqueue after Close has been called.
+var ErrBufferClosed = errors.New("telemetry buffer is closed")
+
+// errAbandoned is returned by retry once Close's deadline has passed.
+var errAbandoned = errors.New("gave up at shutdown")
+
+// BatchWriter stores a batch of readings in a single write.
+type BatchWriter interface {
+	AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error
+}
+
+// Publisher forwards a stored reading to downstream consumers.
+type Publisher interface {
+	Publish(ctx context.Context, message []byte) error
+}
+
+// queuedReading keeps the trace of the message a reading came from, so the
+// batch write can link to it and its publish can continue it.
+type queuedReading struct {
+	data models.DeviceData
+	span trace.SpanContext
+}
+
+// Config controls batching and backpressure.
+type Config struct {
+	// BatchSize flushes once this many readings are waiting.
+	BatchSize int
+	// FlushInterval flushes whatever is waiting at least this often.
+	FlushInterval time.Duration
+	// QueueSize is the number of readings held before Enqueue blocks.
+	QueueSize int
+	// EnqueueTimeout is how long Enqueue blocks before giving up.
+	EnqueueTimeout time.Duration
+}
+
+// Buffer queues readings and writes them in batches, publishing each reading
+// once its batch is stored. A write that fails because the database cannot be
+// reached is retried with the batch held, so the queue fills and Enqueue
+// blocks instead of readings being dropped. Readings the database rejects,
+// such as those of a home that was deleted, are split out of the batch and
+// dropped so the rest is stored.
+type Buffer struct {
+	writer    BatchWriter
+	publisher Publisher
+	cfg       Config
+	logger    *slog.Logger
+
+	queue   chan queuedReading
+	closing chan struct{}
+	stopped chan struct{}
+
+	mu          sync.RWMutex
+	closed      bool
+	abandonOnce sync.Once
+	// lost is the number of readings that were not stored because Close's
+	// deadline passed. It is set before stopped is closed.
+	lost int
+}
+
+// NewBuffer starts a buffer that writes to writer and publishes to publisher.
+func NewBuffer(writer BatchWriter, publisher Publisher, cfg Config, logger *slog.Logger) *Buffer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		cfg.QueueSize = cfg.BatchSize
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		cfg.EnqueueTimeout = 5 * time.Second
+	}
+
+	b := &Buffer{
+		writer:    writer,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+		queue:     make(chan queuedReading, cfg.QueueSize),
+		closing:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Enqueue adds a reading to the buffer. It blocks while the buffer is full,
+// for at most the configured timeout or until ctx is done.
+func (b *Buffer) Enqueue(ctx context.Context, data models.DeviceData) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBufferClosed
+	}
+
+	reading := queuedReading{data: data, span: trace.SpanContextFromContext(ctx)}
+	select {
+	case b.queue <- reading:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(b.cfg.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- reading:
+		return nil
+	case <-timer.C:
+		return ErrBufferFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting readings and flushes everything already queued. It
+// returns ctx's error if the flush does not finish before ctx is done, in
+// which case the unflushed readings are lost, logged and counted.
+func (b *Buffer) Close(ctx context.Context) error {
+	// Taking the write lock waits for in-flight Enqueue calls, so nothing is
+	// sent on the queue after it is closed.
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		b.abandonOnce.Do(func() { close(b.closing) })
+		<-b.stopped
+		if b.lost > 0 {
+			b.logger.Error("Dropped readings that were not stored before shutdown", "readings", b.lost)
+			droppedReadings.WithLabelValues(dropShutdown).Add(float64(b.lost))
+		}
+		return ctx.Err()
+	}
+}
+
+func (b *Buffer) run() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]queuedReading, 0, b.cfg.BatchSize)
+	for {
+		select {
+		case reading, ok := <-b.queue:
+			if !ok {
+				b.lost, _ = b.flush(batch)
+				return
+			}
+			batch = append(batch, reading)
+			if len(batch) < b.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if lost, ok := b.flush(batch); !ok {
+			b.lost = lost + len(b.queue)
+			return
+		}
+		batch = batch[:0]
+	}
+}
+
+// flush stores and publishes the batch. If it gives up because Close's
+// deadline passed, it returns false with the number of readings that were not
+// stored.
+func (b *Buffer) flush(batch []queuedReading) (int, bool) {
+	if len(batch) == 0 {
+		return 0, true
+	}
+
+	links := make([]trace.Link, 0, len(batch))
+	for _, reading := range batch {
+		if reading.span.IsValid() {
+			links = append(links, trace.Link{SpanContext: reading.span})
+		}
+	}
+
+	ctx, span := tracer.Start(context.Background(), "ingest flush",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("ingest.batch_size", len(batch))),
+	)
+	defer span.End()
+
+	stored, lost := b.store(ctx, batch)
+	if lost > 0 {
+		span.SetStatus(codes.Error, "batch not stored before shutdown")
+	}
+
+	// Readings are published only once stored, and a failed publish retries
+	// from the first unpublished reading so nothing is written twice.
+	next := 0
+	published := b.retry(ctx, func(error) bool { return true }, func() error {
+		for ; next < len(stored); next++ {
+			publishCtx := trace.ContextWithSpanContext(context.Background(), stored[next].span)
+			message, err := json.Marshal(stored[next].data)
+			if err != nil {
+				b.logger.ErrorContext(publishCtx, "Error marshalling device data for RabbitMQ", logging.DeviceIDKey, stored[next].data.DeviceID, "error", err)
+				continue
+			}
+			if err := b.publisher.Publish(publishCtx, message); err != nil {
+				return err
+			}
+			ingestLatency.Observe(time.Since(stored[next].data.CreatedAt).Seconds())
+		}
+		return nil
+	})
+	if published != nil {
+		b.logger.ErrorContext(ctx, "Dropped stored readings that could not be published before shutdown", "readings", len(stored)-next)
+	}
+	return lost, lost == 0 && published == nil
+}
+
+// store writes the batch and returns the readings it stored. Readings the
+// database rejects are dropped: the batch is halved until they are on their
+// own, and the rest is stored. If Close's deadline passes first, it also
+// returns the number of readings it did not get to.
+func (b *Buffer) store(ctx context.Context, batch []queuedReading) ([]queuedReading, int) {
+	readings := make([]models.DeviceData, len(batch))
+	for i, reading := range batch {
+		readings[i] = reading.data
+	}
+	err := b.retry(ctx, transient, func() error {
+		return b.writer.AddDeviceDataBatch(ctx, readings)
+	})
+	switch {
+	case err == nil:
+		return batch, 0
+	case errors.Is(err, errAbandoned):
+		return nil, len(batch)
+	case !rejected(err):
+		b.logger.ErrorContext(ctx, "Dropped readings that could not be stored", "readings", len(batch), "error", err)
+		droppedReadings.WithLabelValues(dropFailed).Add(float64(len(batch)))
+		return nil, 0
+	case len(batch) == 1:
+		b.logger.WarnContext(ctx, "Dropped a reading the database rejected", logging.DeviceIDKey, batch[0].data.DeviceID, "error", err)
+		droppedReadings.WithLabelValues(dropRejected).Inc()
+		return nil, 0
+	}
+
+	half := len(batch) / 2
+	first, lost := b.store(ctx, batch[:half])
+	if lost > 0 {
+		return first, lost + len(batch) - half
+	}
+	second, lost := b.store(ctx, batch[half:])
+	return slices.Concat(first, second), lost
+}
+
+// retry calls fn until it succeeds or fails with an error retryable does not
+// accept, and returns that error. It returns errAbandoned if Close's deadline
+// passes first.
+func (b *Buffer) retry(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	backoff := 100 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		b.logger.WarnContext(ctx, "Error flushing telemetry buffer, retrying", "retry_in", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-b.closing:
+			return errAbandoned
+		}
+		if backoff < 5*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// transient reports whether a failed write may succeed if retried: the
+// database could not be reached or dropped the connection (class 08), or
+// rolled the write back to resolve a serialization failure or deadlock
+// (class 40).
+func transient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "40")
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.Timeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// rejected reports whether the database refused a reading in the batch: it
+// broke a constraint (class 23), such as the foreign key to its home, or held
+// a value the column cannot take (class 22).
+func rejected(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
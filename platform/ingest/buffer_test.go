@@ -0,0 +1,308 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeStore records the batches written to it. Each write first takes an
+// error from errs, if one is queued, and waits on block, if set. A batch
+// holding a reading from a device in rejects fails as a foreign key violation.
+type fakeStore struct {
+	mu      sync.Mutex
+	batches [][]models.DeviceData
+	calls   int
+	errs    []error
+	// written receives each batch that is stored.
+	written chan []models.DeviceData
+	// entered is signalled as each write starts.
+	entered chan struct{}
+	block   chan struct{}
+	rejects map[string]bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{written: make(chan []models.DeviceData, 100), entered: make(chan struct{}, 100)}
+}
+
+func (s *fakeStore) AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error {
+	s.entered <- struct{}{}
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	for _, reading := range batch {
+		if s.rejects[reading.DeviceID] {
+			return &pgconn.PgError{Code: "23503", ConstraintName: "device_data_home_id_fkey"}
+		}
+	}
+	stored := append([]models.DeviceData(nil), batch...)
+	s.batches = append(s.batches, stored)
+	s.written <- stored
+	return nil
+}
+
+func (s *fakeStore) stored() (batches [][]models.DeviceData, calls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches, s.calls
+}
+
+type countingPublisher struct {
+	mu       sync.Mutex
+	messages int
+}
+
+func (p *countingPublisher) Publish(ctx context.Context, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages++
+	return nil
+}
+
+func (p *countingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.messages
+}
+
+func newTestBuffer(t *testing.T, store *fakeStore, cfg Config) (*Buffer, *countingPublisher) {
+	t.Helper()
+	publisher := &countingPublisher{}
+	b := NewBuffer(store, publisher, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		b.Close(ctx)
+	})
+	return b, publisher
+}
+
+func reading(deviceID string) models.DeviceData {
+	return models.DeviceData{DeviceID: deviceID, CreatedAt: time.Now(), Data: map[string]interface{}{"temp": 20.0}}
+}
+
+func enqueue(t *testing.T, b *Buffer, deviceIDs ...string) {
+	t.Helper()
+	for _, id := range deviceIDs {
+		if err := b.Enqueue(context.Background(), reading(id)); err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+	}
+}
+
+// nextBatch waits for the store's next batch.
+func nextBatch(t *testing.T, store *fakeStore) []models.DeviceData {
+	t.Helper()
+	select {
+	case batch := <-store.written:
+		return batch
+	case <-time.After(2 * time.Second):
+		t.Fatal("no batch was written")
+		return nil
+	}
+}
+
+func TestBufferFlush(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		devices []string
+	}{
+		// The interval is too long to matter, so a full batch flushes.
+		{"batch size", Config{BatchSize: 3, FlushInterval: time.Hour}, []string{"d1", "d2", "d3"}},
+		// The batch never fills, so the interval flushes.
+		{"interval", Config{BatchSize: 100, FlushInterval: 20 * time.Millisecond}, []string{"d1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			b, publisher := newTestBuffer(t, store, tt.cfg)
+			enqueue(t, b, tt.devices...)
+
+			batch := nextBatch(t, store)
+			if len(batch) != len(tt.devices) {
+				t.Fatalf("flushed %d readings, want %d", len(batch), len(tt.devices))
+			}
+			for i, id := range tt.devices {
+				if batch[i].DeviceID != id {
+					t.Errorf("reading %d from %s, want %s", i, batch[i].DeviceID, id)
+				}
+			}
+			if err := b.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := publisher.count(); n != len(tt.devices) {
+				t.Errorf("published %d readings, want %d", n, len(tt.devices))
+			}
+		})
+	}
+}
+
+func TestBufferRetriesFailedWrite(t *testing.T) {
+	store := newFakeStore()
+	store.errs = []error{&pgconn.PgError{Code: "08006"}}
+	b, publisher := newTestBuffer(t, store, Config{BatchSize: 1, FlushInterval: time.Hour})
+	enqueue(t, b, "d1")
+
+	if batch := nextBatch(t, store); len(batch) != 1 || batch[0].DeviceID != "d1" {
+		t.Fatalf("stored %+v after the retry", batch)
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches, calls := store.stored(); len(batches) != 1 || calls != 2 {
+		t.Errorf("%d batches stored in %d writes, want 1 in 2", len(batches), calls)
+	}
+	if n := publisher.count(); n != 1 {
+		t.Errorf("published %d readings, want 1", n)
+	}
+}
+
+func TestBufferDropsRejectedReadings(t *testing.T) {
+	store := newFakeStore()
+	store.rejects = map[string]bool{"d2": true, "d5": true}
+	b, publisher := newTestBuffer(t, store, Config{BatchSize: 6, FlushInterval: time.Hour})
+	dropped := testutil.ToFloat64(droppedReadings.WithLabelValues(dropRejected))
+	enqueue(t, b, "d1", "d2", "d3", "d4", "d5", "d6")
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	batches, _ := store.stored()
+	var stored []string
+	for _, batch := range batches {
+		for _, reading := range batch {
+			stored = append(stored, reading.DeviceID)
+		}
+	}
+	if want := []string{"d1", "d3", "d4", "d6"}; !slices.Equal(stored, want) {
+		t.Errorf("stored %v, want %v", stored, want)
+	}
+	if n := publisher.count(); n != 4 {
+		t.Errorf("published %d readings, want the 4 stored", n)
+	}
+	if n := testutil.ToFloat64(droppedReadings.WithLabelValues(dropRejected)) - dropped; n != 2 {
+		t.Errorf("counted %v rejected readings, want 2", n)
+	}
+}
+
+func TestBufferDoesNotRetryPermanentError(t *testing.T) {
+	store := newFakeStore()
+	store.errs = []error{&pgconn.PgError{Code: "42P01"}}
+	b, publisher := newTestBuffer(t, store, Config{BatchSize: 1, FlushInterval: time.Hour})
+	dropped := testutil.ToFloat64(droppedReadings.WithLabelValues(dropFailed))
+	enqueue(t, b, "d1")
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches, calls := store.stored(); len(batches) != 0 || calls != 1 {
+		t.Errorf("%d batches stored in %d writes, want none in 1", len(batches), calls)
+	}
+	if n := publisher.count(); n != 0 {
+		t.Errorf("published %d readings, want none", n)
+	}
+	if n := testutil.ToFloat64(droppedReadings.WithLabelValues(dropFailed)) - dropped; n != 1 {
+		t.Errorf("counted %v failed readings, want 1", n)
+	}
+}
+
+func TestBufferFull(t *testing.T) {
+	store := newFakeStore()
+	store.block = make(chan struct{})
+	b, _ := newTestBuffer(t, store, Config{BatchSize: 1, QueueSize: 1, FlushInterval: time.Hour, EnqueueTimeout: 20 * time.Millisecond})
+
+	// The first reading is being written and the second fills the queue.
+	enqueue(t, b, "d1")
+	<-store.entered
+	enqueue(t, b, "d2")
+
+	start := time.Now()
+	if err := b.Enqueue(context.Background(), reading("d3")); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("enqueue into a full buffer: got %v, want ErrBufferFull", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("gave up after %v, before the enqueue timeout", waited)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Enqueue(ctx, reading("d3")); !errors.Is(err, context.Canceled) {
+		t.Errorf("enqueue with a cancelled context: got %v, want context.Canceled", err)
+	}
+
+	close(store.block)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches, _ := store.stored(); len(batches) != 2 {
+		t.Errorf("stored %d batches, want the 2 that were queued", len(batches))
+	}
+}
+
+func TestBufferClose(t *testing.T) {
+	store := newFakeStore()
+	b, publisher := newTestBuffer(t, store, Config{BatchSize: 100, FlushInterval: time.Hour})
+	enqueue(t, b, "d1", "d2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if batches, _ := store.stored(); len(batches) != 1 || len(batches[0]) != 2 {
+		t.Errorf("stored %+v, want one batch of the 2 queued readings", batches)
+	}
+	if n := publisher.count(); n != 2 {
+		t.Errorf("published %d readings, want 2", n)
+	}
+	if err := b.Enqueue(context.Background(), reading("d3")); !errors.Is(err, ErrBufferClosed) {
+		t.Errorf("enqueue after close: got %v, want ErrBufferClosed", err)
+	}
+}
+
+func TestBufferCloseDeadline(t *testing.T) {
+	store := newFakeStore()
+	store.errs = make([]error, 100)
+	for i := range store.errs {
+		store.errs[i] = &pgconn.PgError{Code: "08006"}
+	}
+	b, publisher := newTestBuffer(t, store, Config{BatchSize: 100, FlushInterval: time.Hour})
+	enqueue(t, b, "d1")
+	dropped := testutil.ToFloat64(droppedReadings.WithLabelValues(dropShutdown))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("close with a failing store: got %v, want context.DeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("close took %v, well past its deadline", waited)
+	}
+	if batches, _ := store.stored(); len(batches) != 0 || publisher.count() != 0 {
+		t.Errorf("stored %d batches and published %d readings, want none", len(batches), publisher.count())
+	}
+	if n := testutil.ToFloat64(droppedReadings.WithLabelValues(dropShutdown)) - dropped; n != 1 {
+		t.Errorf("counted %v readings dropped at shutdown, want 1", n)
+	}
+}
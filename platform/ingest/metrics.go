@@ -0,0 +1,24 @@
+package ingest
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ingestLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "pragati_ingest_latency_seconds",
+	Help:    "Time from a reading being received over MQTT to it being stored and published.",
+	Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+})
+
+// Reasons readings are dropped.
+const (
+	dropRejected = "rejected"
+	dropFailed   = "failed"
+	dropShutdown = "shutdown"
+)
+
+var droppedReadings = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pragati_ingest_dropped_readings_total",
+	Help: "Readings dropped without being stored, by reason: rejected by the database, failed with an error retrying cannot fix, or not stored before shutdown.",
+}, []string{"reason"})
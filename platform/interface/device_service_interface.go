@@ -1,6 +1,8 @@
 package interfaces
 
+import "context"
+
 // DeviceService defines the interface for device operations
 type DeviceService interface {
-	SendCommand(deviceID string, command string) error
+	SendCommand(ctx context.Context, deviceID string, command string, params map[string]interface{}) error
 }
@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the correlation fields attached to log records.
+const (
+	ComponentKey = "component"
+	RequestIDKey = "request_id"
+	UsernameKey  = "username"
+	DeviceIDKey  = "device_id"
+	HomeIDKey    = "home_id"
+)
+
+// Output formats accepted by ParseConfig.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config selects the output format and the minimum level, both overall and
+// per component.
+type Config struct {
+	Format string
+	Level  slog.Level
+	Levels map[string]slog.Level
+}
+
+// ParseConfig reads a format ("text" or "json"), a default level and a list
+// of per-component levels such as "mqtt=debug,repositories=warn".
+func ParseConfig(format, level, levels string) (Config, error) {
+	cfg := Config{Format: format, Levels: map[string]slog.Level{}}
+	if cfg.Format == "" {
+		cfg.Format = FormatText
+	}
+	if cfg.Format != FormatText && cfg.Format != FormatJSON {
+		return cfg, fmt.Errorf("unsupported log format: %s", format)
+	}
+
+	if level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+			return cfg, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+
+	for _, entry := range strings.Split(levels, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		component, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid component level %q, want component=level", entry)
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(value)); err != nil {
+			return cfg, fmt.Errorf("invalid log level for %s: %w", component, err)
+		}
+		cfg.Levels[strings.TrimSpace(component)] = l
+	}
+	return cfg, nil
+}
+
+// New returns a logger writing to w. Loggers derived with Component use the
+// level configured for that component.
+func New(w io.Writer, cfg Config) *slog.Logger {
+	// The inner handler accepts everything the most verbose component needs;
+	// the wrapping handler applies each component's own level.
+	lowest := cfg.Level
+	for _, l := range cfg.Levels {
+		if l < lowest {
+			lowest = l
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lowest}
+
+	var inner slog.Handler
+	if cfg.Format == FormatJSON {
+		inner = slog.NewJSONHandler(w, opts)
+	} else {
+		inner = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(&handler{inner: inner, cfg: cfg, level: cfg.Level})
+}
+
+// Component returns a logger for the named component, e.g. "mqtt".
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	return logger.With(slog.String(ComponentKey, name))
+}
+
+type contextKey struct{}
+
+// WithAttrs returns a context whose log records carry attrs in addition to
+// any already attached to ctx.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, contextKey{}, merged)
+}
+
+// handler adds the fields attached to the context, and the trace and span
+// IDs of the current span, to every record it passes on.
+type handler struct {
+	inner slog.Handler
+	cfg   Config
+	level slog.Level
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.inner.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &handler{inner: h.inner.WithAttrs(attrs), cfg: h.cfg, level: h.level}
+	for _, attr := range attrs {
+		if attr.Key != ComponentKey {
+			continue
+		}
+		if l, ok := h.cfg.Levels[attr.Value.String()]; ok {
+			next.level = l
+		}
+	}
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{inner: h.inner.WithGroup(name), cfg: h.cfg, level: h.level}
+}
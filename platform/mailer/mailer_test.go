@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFileMailer(path, "PragatiIot <no-reply@example.com>")
+	msg := Message{To: "alice@example.com", Subject: "Réinitialiser", Body: "line one\nline two\n"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"From: PragatiIot <no-reply@example.com>\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message %q does not contain %q", got, want)
+		}
+	}
+}
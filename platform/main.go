@@ -2,27 +2,47 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/decoders"
 	"PragatiIot/platform/handlers"
+	"PragatiIot/platform/health"
+	"PragatiIot/platform/ingest"
+	"PragatiIot/platform/logging"
+	"PragatiIot/platform/mailer"
+	"PragatiIot/platform/middleware"
 	"PragatiIot/platform/mqtt"
+	"PragatiIot/platform/notify"
+	"PragatiIot/platform/oidc"
 	"PragatiIot/platform/rabbitmq"
+	"PragatiIot/platform/ratelimit"
 	"PragatiIot/platform/repositories"
 	"PragatiIot/platform/services"
+	"PragatiIot/platform/tracing"
+	"PragatiIot/platform/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type DeviceMessageHandler struct {
 	deviceService *services.DeviceService
+	logger        *slog.Logger
 }
 
-func (h *DeviceMessageHandler) HandleMessage(message []byte) error {
+func (h *DeviceMessageHandler) HandleMessage(ctx context.Context, message []byte) error {
 	// Example logic to handle a device message
-	log.Printf("Handling message: %s", message)
+	h.logger.DebugContext(ctx, "Handling message", "message", string(message))
 	return nil
 }
 
@@ -34,58 +54,243 @@ func (h *DeviceMessageHandler) HandleMessage(message []byte) error {
 // @schemes http
 func main() {
 	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	envErr := godotenv.Load()
+
+	logConfig, err := logging.ParseConfig(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"), os.Getenv("LOG_LEVELS"))
+	if err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+	logger := logging.New(os.Stderr, logConfig)
+	// Route the standard library logger, used by some dependencies, through
+	// the same handler.
+	slog.SetDefault(logger)
+	if envErr != nil {
+		logger.Info("No .env file found")
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		fatal("Unable to set up tracing", "error", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Error flushing traces", "error", err)
+		}
+	}()
+
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is not set")
+		fatal("DATABASE_URL environment variable is not set")
+	}
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		fatal("Invalid DATABASE_URL", "error", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.NewPgxTracer()
+	// statement_timeout is enforced by Postgres on every statement, as a
+	// backstop for queries whose context is never cancelled.
+	if statementTimeout := envDuration("DB_STATEMENT_TIMEOUT", 30*time.Second); statementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(statementTimeout.Milliseconds(), 10)
 	}
-	pool, err := pgxpool.New(context.Background(), dbURL)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		log.Fatalf("Unable to connect to the database: %v\n", err)
+		fatal("Unable to connect to the database", "error", err)
 	}
 	defer pool.Close()
+	prometheus.MustRegister(repositories.NewPoolCollector(pool))
+	db := repositories.NewDB(pool, envDuration("DB_QUERY_TIMEOUT", 5*time.Second))
 
-	userRepo := repositories.NewUserRepository(pool)
-	homeRepo := repositories.NewHomeRepository(pool)
-	deviceRepo := repositories.NewDeviceRepository(pool)
+	userRepo := repositories.NewUserRepository(db)
+	homeRepo := repositories.NewHomeRepository(db)
+	telemetryStore, err := repositories.NewPartitionedTelemetryStore(db, os.Getenv("TELEMETRY_PARTITION_INTERVAL"), envInt("TELEMETRY_PARTITIONS_AHEAD", 3), logging.Component(logger, "repositories"))
+	if err != nil {
+		fatal("Invalid telemetry storage configuration", "error", err)
+	}
+	deviceRepo := repositories.NewDeviceRepository(db, telemetryStore)
+	auditRepo := repositories.NewAuditRepository(db)
+	recorder := audit.NewRecorder(auditRepo, userRepo, logging.Component(logger, "audit"))
 
-	userService := services.NewUserService(userRepo)
-	roleRepo := repositories.NewRoleRepository(pool)
+	userService := services.NewUserService(userRepo, recorder)
+	roleRepo := repositories.NewRoleRepository(db)
 	roleService := services.NewRoleService(roleRepo)
-	homeService := services.NewHomeService(homeRepo, roleService)
-	deviceService := services.NewDeviceService(deviceRepo, homeService)
+	orgService := services.NewOrganizationService(repositories.NewOrganizationRepository(db), recorder, services.OrgConfig{
+		DefaultPlan: envString("ORG_DEFAULT_PLAN", "free"),
+		MaxHomes:    envQuota("ORG_MAX_HOMES"),
+		MaxDevices:  envQuota("ORG_MAX_DEVICES"),
+		MaxMembers:  envQuota("ORG_MAX_MEMBERS"),
+	})
+	homeService := services.NewHomeService(homeRepo, roleService, userService, orgService, recorder)
+	deviceTypeRepo := repositories.NewDeviceTypeRepository(db)
+	deviceTypeService, err := services.NewDeviceTypeService(deviceTypeRepo, os.Getenv("TELEMETRY_SCHEMA_MODE"), recorder)
+	if err != nil {
+		fatal("Invalid telemetry schema mode", "variable", "TELEMETRY_SCHEMA_MODE", "error", err)
+	}
+	deviceService := services.NewDeviceService(deviceRepo, homeService, deviceTypeService, recorder, logging.Component(logger, "services"))
+	retentionRepo := repositories.NewRetentionPolicyRepository(db)
+	telemetryService := services.NewTelemetryService(deviceRepo, retentionRepo, telemetryStore, envInt("TELEMETRY_RETENTION_DAYS", 0), recorder, logging.Component(logger, "services"))
+	auditService := services.NewAuditService(auditRepo, homeRepo)
+	transferService := services.NewDeviceTransferService(repositories.NewDeviceTransferRepository(db), deviceRepo, userRepo, recorder)
+	spaceRepo := repositories.NewSpaceRepository(db)
+	spaceService := services.NewSpaceService(spaceRepo, deviceRepo, recorder)
+	groupRepo := repositories.NewDeviceGroupRepository(db)
+	groupService := services.NewDeviceGroupService(groupRepo, groupRepo, deviceRepo, spaceRepo, recorder)
+	jobService := services.NewDeviceJobService(repositories.NewDeviceJobRepository(db), groupService, deviceService, homeService, userRepo, recorder, services.DeviceJobConfig{
+		Interval:     envDuration("DEVICE_JOB_INTERVAL", 10*time.Second),
+		LeaseTimeout: envDuration("DEVICE_JOB_LEASE_TIMEOUT", 5*time.Minute),
+	}, logging.Component(logger, "jobs"))
+	serviceAccountService := services.NewServiceAccountService(userRepo, repositories.NewAPIKeyRepository(db), homeRepo, recorder)
+	ssoProviders := make(map[string]*oidc.Provider)
+	if oidcConfig := os.Getenv("OIDC_CONFIG"); oidcConfig != "" {
+		configs, err := oidc.LoadFile(oidcConfig)
+		if err != nil {
+			fatal("Failed to load OIDC providers", "error", err)
+		}
+		for name, config := range configs {
+			ssoProviders[name] = oidc.NewProvider(config, nil)
+		}
+	}
+	ssoService := services.NewSSOService(ssoProviders, userRepo, repositories.NewSSORepository(db), homeService, recorder, logging.Component(logger, "sso"))
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	defer stopMaintenance()
+	go telemetryService.RunMaintenance(maintenanceCtx, envDuration("TELEMETRY_MAINTENANCE_INTERVAL", 15*time.Minute))
+
+	mail := newMailer(logging.Component(logger, "mailer"))
+	appBaseURL := envString("APP_BASE_URL", "http://localhost:3000")
+	accountService := services.NewAccountService(userRepo, userRepo, mail, recorder, services.AccountConfig{
+		BaseURL:          appBaseURL,
+		VerificationTTL:  envDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		ResetTTL:         envDuration("PASSWORD_RESET_TTL", time.Hour),
+		MaxLoginFailures: envInt("LOGIN_MAX_FAILURES", 5),
+		LockoutDuration:  envDuration("LOGIN_LOCKOUT", 15*time.Minute),
+	}, logging.Component(logger, "services"))
+
+	// Without keys to seal TOTP secrets, users cannot enroll in MFA; those
+	// who already did cannot complete a login until the keys are restored.
+	var mfaSealer *utils.Sealer
+	if keys := os.Getenv("MFA_ENCRYPTION_KEYS"); keys != "" {
+		if mfaSealer, err = utils.NewSealer(keys); err != nil {
+			fatal("Invalid MFA_ENCRYPTION_KEYS", "error", err)
+		}
+	} else {
+		logger.Warn("MFA_ENCRYPTION_KEYS is not set; multi-factor authentication is disabled")
+	}
+	mfaService := services.NewMFAService(userRepo, userRepo, repositories.NewMFARepository(db), mfaSealer, accountService, services.MFAConfig{
+		Issuer:       envString("MFA_ISSUER", "PragatiIot"),
+		ChallengeTTL: envDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+	})
 
-	userHandler := handlers.NewUserHandler(userService)
+	notifier := notify.Notifiers{notify.NewMailNotifier(mail)}
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifier = append(notifier, notify.NewWebhookNotifier(url, envDuration("NOTIFY_WEBHOOK_TIMEOUT", 5*time.Second)))
+	}
+	invitationService := services.NewInvitationService(repositories.NewInvitationRepository(db), userRepo, homeService, notifier, recorder, services.InvitationConfig{
+		BaseURL: appBaseURL,
+		TTL:     envDuration("HOME_INVITATION_TTL", 7*24*time.Hour),
+	}, logging.Component(logger, "services"))
+
+	rateLimits := handlers.RateLimits{
+		IP:      envLimit("RATE_LIMIT_IP", "600/m"),
+		Account: envLimit("RATE_LIMIT_ACCOUNT", "10/m"),
+		User:    envLimit("RATE_LIMIT_USER", "300/m"),
+		Logger:  logging.Component(logger, "http"),
+	}
+	switch store := envString("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		rateLimits.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimits.Store = repositories.NewRateLimitRepository(db)
+	default:
+		fatal("RATE_LIMIT_STORE must be memory or postgres", "value", store)
+	}
+	// Buckets idle for as long as the slowest takes to refill are full.
+	idle := max(rateLimits.IP.RefillTime(), rateLimits.Account.RefillTime(), rateLimits.User.RefillTime(), time.Minute)
+	go ratelimit.RunPruning(maintenanceCtx, rateLimits.Store, 10*time.Minute, idle, logging.Component(logger, "http"))
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		fatal("JWT_SECRET environment variable is not set")
+	}
+	tokens, err := middleware.NewTokens(middleware.TokenConfig{
+		Key: []byte(jwtSecret),
+		TTL: envDuration("JWT_TTL", time.Hour),
+	})
+	if err != nil {
+		fatal("Invalid token configuration", "error", err)
+	}
+
+	userHandler := handlers.NewUserHandler(userService, accountService, mfaService, tokens)
 	homeHandler := handlers.NewHomeHandler(homeService)
 	deviceHandler := handlers.NewDeviceHandler(deviceService, homeService)
-	analyticsHandler := handlers.NewAnalyticsHandler(deviceService, homeService)
+	deviceTypeHandler := handlers.NewDeviceTypeHandler(deviceTypeService)
+	analyticsHandler := handlers.NewAnalyticsHandler(deviceService, homeService, telemetryService)
+	telemetryHandler := handlers.NewTelemetryHandler(telemetryService, deviceService, homeService, transferService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	serviceAccountHandler := handlers.NewServiceAccountHandler(serviceAccountService)
+	ssoHandler := handlers.NewSSOHandler(ssoService, mfaService, tokens)
+	organizationHandler := handlers.NewOrganizationHandler(orgService, homeService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	transferHandler := handlers.NewDeviceTransferHandler(transferService)
+	spaceHandler := handlers.NewSpaceHandler(spaceService, deviceService, homeService)
+	groupHandler := handlers.NewDeviceGroupHandler(groupService, jobService, deviceService, homeService)
 
 	rabbitMQURL := os.Getenv("RABBITMQ_URL")
 	if rabbitMQURL == "" {
-		log.Fatal("RABBITMQ_URL environment variable is not set")
+		fatal("RABBITMQ_URL environment variable is not set")
 	}
 	producer, err := rabbitmq.NewProducer(rabbitMQURL, "device_data")
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ producer: %v", err)
+		fatal("Failed to initialize RabbitMQ producer", "error", err)
 	}
 	defer producer.Close()
 
-	mqttFactory := mqtt.NewProtocolFactory(deviceService, producer)
-	mqttClient := mqtt.NewMQTTClient(deviceService, producer, mqttFactory)
+	decoderRegistry := decoders.NewRegistry()
+	if decodersConfig := os.Getenv("DECODERS_CONFIG"); decodersConfig != "" {
+		if err := decoderRegistry.LoadFile(decodersConfig); err != nil {
+			fatal("Failed to load payload decoders", "error", err)
+		}
+	}
+
+	buffer := ingest.NewBuffer(deviceService, producer, ingest.Config{
+		BatchSize:      envInt("INGEST_BATCH_SIZE", 500),
+		FlushInterval:  envDuration("INGEST_FLUSH_INTERVAL", time.Second),
+		QueueSize:      envInt("INGEST_QUEUE_SIZE", 10000),
+		EnqueueTimeout: envDuration("INGEST_ENQUEUE_TIMEOUT", 5*time.Second),
+	}, logging.Component(logger, "ingest"))
 
-	deviceMessageHandler := &DeviceMessageHandler{deviceService: deviceService}
-	consumer, err := rabbitmq.NewConsumer(rabbitMQURL, "device_data", deviceMessageHandler)
+	mqttLogger := logging.Component(logger, "mqtt")
+	mqttFactory := mqtt.NewProtocolFactory(deviceService, deviceTypeService, buffer, decoderRegistry, mqttLogger)
+	mqttClient := mqtt.NewMQTTClient(deviceService, producer, mqttFactory, mqttLogger)
+	deviceService.SetCommandPublisher(mqttClient)
+	transferService.SetChannelListener(mqttClient)
+	// Jobs send commands, so the runner starts once they have a transport.
+	go jobService.Run(maintenanceCtx)
+
+	rabbitLogger := logging.Component(logger, "rabbitmq")
+	deviceMessageHandler := &DeviceMessageHandler{deviceService: deviceService, logger: rabbitLogger}
+	consumer, err := rabbitmq.NewConsumer(rabbitMQURL, "device_data", deviceMessageHandler, rabbitLogger)
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ consumer: %v", err)
+		fatal("Failed to initialize RabbitMQ consumer", "error", err)
 	}
 	consumer.StartConsuming()
 	defer consumer.Close()
 
-	router := gin.Default()
-	handlers.SetupRoutes(router, userHandler, homeHandler, deviceHandler, analyticsHandler)
+	healthChecks := health.New(envDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second))
+	healthChecks.Register("postgres", health.CheckerFunc(pool.Ping))
+	healthChecks.Register("mqtt", mqttClient)
+	healthChecks.Register("rabbitmq_producer", producer)
+	healthChecks.Register("rabbitmq_consumer", consumer)
+	healthHandler := handlers.NewHealthHandler(healthChecks)
+
+	// gin.Default's text logger is replaced by the structured request log.
+	router := gin.New()
+	// Without trusted proxies, X-Forwarded-For is ignored and the client IP
+	// used for rate limits, logs and the audit log is the socket address.
+	if err := router.SetTrustedProxies(envList("TRUSTED_PROXIES")); err != nil {
+		fatal("Invalid trusted proxies", "variable", "TRUSTED_PROXIES", "error", err)
+	}
+	router.Use(otelgin.Middleware(tracing.ServiceName), handlers.RequestLogger(logging.Component(logger, "http")), gin.Recovery(),
+		handlers.RequestTimeout(envDuration("HTTP_REQUEST_TIMEOUT", 30*time.Second)))
+	handlers.SetupRoutes(router, userHandler, homeHandler, deviceHandler, deviceTypeHandler, analyticsHandler, telemetryHandler, auditHandler, serviceAccountHandler, ssoHandler, organizationHandler, invitationHandler, transferHandler, spaceHandler, groupHandler, healthHandler, rateLimits)
 
 	// Adjust certificate paths as required
 	//caCert := "platform/mosquitto/certs/ca.crt"
@@ -96,6 +301,126 @@ func main() {
 
 	go mqttClient.StartMQTT(broker, clientID, "", "", "", true)
 
-	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		logger.Info("Server started", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("HTTP server error", "error", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	logger.Info("Shutting down")
+
+	// Fail readiness first and give the orchestrator time to stop routing
+	// traffic here before anything is closed.
+	healthChecks.Drain("server", "shutting down")
+	time.Sleep(envDuration("SHUTDOWN_DRAIN_DELAY", 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	stopMaintenance()
+
+	// Stop intake first so the buffer can flush everything it has accepted
+	// before the producer and the pool are closed by the deferred calls.
+	mqttClient.Stop()
+	if err := buffer.Close(ctx); err != nil {
+		logger.Error("Telemetry buffer did not flush before shutdown", "error", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("HTTP server shutdown error", "error", err)
+	}
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newMailer returns the mailer selected by MAIL_TRANSPORT: "smtp", "file" or
+// "log" (the default).
+func newMailer(logger *slog.Logger) mailer.Mailer {
+	from := envString("MAIL_FROM", "PragatiIot <no-reply@localhost>")
+	switch transport := envString("MAIL_TRANSPORT", "log"); transport {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			fatal("SMTP_ADDR environment variable is not set")
+		}
+		return mailer.NewSMTPMailer(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		return mailer.NewFileMailer(envString("MAIL_FILE", "mail.log"), from)
+	case "log":
+		return mailer.NewLogMailer(logger)
+	default:
+		fatal("MAIL_TRANSPORT must be smtp, file or log", "value", transport)
+		return nil
+	}
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envList returns the comma-separated values set in the environment, or nil.
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envLimit(name, fallback string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(envString(name, fallback))
+	if err != nil {
+		fatal("Invalid rate limit", "variable", name, "error", err)
+	}
+	return limit
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fatal("Environment variable must be an integer", "variable", name, "error", err)
+	}
+	return n
+}
+
+// envQuota returns the quota set in the environment, or nil, unlimited, if
+// it is not set.
+func envQuota(name string) *int {
+	if os.Getenv(name) == "" {
+		return nil
+	}
+	quota := envInt(name, 0)
+	if quota < 0 {
+		fatal("Quota must not be negative", "variable", name)
+	}
+	return &quota
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fatal("Environment variable must be a duration such as 15m", "variable", name, "error", err)
+	}
+	return d
 }
@@ -1,49 +1,189 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/logging"
+	"PragatiIot/platform/models"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-var jwtKey = []byte("your_secret_key")
+// TokenConfig configures the bearer tokens users log in with.
+type TokenConfig struct {
+	// Key signs and verifies tokens. It must be at least 32 bytes.
+	Key []byte
+	// TTL is how long a token is accepted after it is issued.
+	TTL time.Duration
+}
+
+// Tokens issues and verifies the bearer tokens users log in with.
+type Tokens struct {
+	config TokenConfig
+}
+
+// NewTokens returns Tokens signing with config.Key.
+func NewTokens(config TokenConfig) (*Tokens, error) {
+	if len(config.Key) < 32 {
+		return nil, errors.New("the token signing key must be at least 32 bytes")
+	}
+	if config.TTL <= 0 {
+		return nil, errors.New("the token lifetime must be positive")
+	}
+	return &Tokens{config: config}, nil
+}
 
-func CreateToken(username string) (string, error) {
-	claims := &jwt.StandardClaims{
-		Subject:  username,
-		Issuer:   "PragatiIot",
-		IssuedAt: jwt.TimeFunc().Unix(),
+// tokenClaims are the claims of a user's token. The subject is the user's ID.
+type tokenClaims struct {
+	jwt.StandardClaims
+	// Version is the user's token version when the token was issued. Bumping
+	// the user's version revokes every token issued before.
+	Version int `json:"ver"`
+}
+
+// CreateToken issues a token for the user.
+func (t *Tokens) CreateToken(user models.User) (string, error) {
+	now := jwt.TimeFunc()
+	claims := &tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(user.ID),
+			Issuer:    "PragatiIot",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(t.config.TTL).Unix(),
+		},
+		Version: user.TokenVersion,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return token.SignedString(t.config.Key)
+}
+
+// parse returns the claims of a token signed with the key that has not
+// expired.
+func (t *Tokens) parse(tokenString string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return t.config.Key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.ExpiresAt == 0 {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// UserLoader loads the user a token was issued to.
+type UserLoader interface {
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+}
+
+// APIKeyAuthenticator returns the service account an API key belongs to,
+// and the key.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (models.User, models.APIKey, error)
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// apiKeyContextKey is the gin context key of the API key a request was
+// authenticated with.
+const apiKeyContextKey = "api_key"
+
+// userContextKey is the gin context key of the user a request was
+// authenticated as.
+const userContextKey = "user"
+
+// UserFromContext returns the user the request was authenticated as.
+func UserFromContext(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(userContextKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// APIKeyFromContext returns the API key the request was authenticated with,
+// if it was not authenticated with a bearer token.
+func APIKeyFromContext(c *gin.Context) (models.APIKey, bool) {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return models.APIKey{}, false
+	}
+	key, ok := value.(models.APIKey)
+	return key, ok
+}
+
+// JWTAuthMiddleware authenticates a request with a bearer token or, for
+// service accounts, an X-API-Key header, and sets the user and their
+// username. A token is refused once it expires, once its user is deleted and
+// once the user's token version has moved past it, which happens when they
+// change or reset their password or turn MFA on or off.
+func JWTAuthMiddleware(tokens *Tokens, users UserLoader, keys APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			account, key, err := keys.AuthenticateAPIKey(c.Request.Context(), apiKey)
+			if err != nil {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+			c.Set(userContextKey, account)
+			c.Set("username", account.Username)
+			c.Set(apiKeyContextKey, key)
+			ctx := logging.WithAttrs(c.Request.Context(), slog.String(logging.UsernameKey, account.Username), slog.Int("api_key_id", key.ID))
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
+			c.Error(apperrors.Unauthorized("Authorization header is missing"))
 			c.Abort()
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims := &jwt.StandardClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		claims, err := tokens.parse(tokenString)
+		if err != nil {
+			c.Error(apperrors.Unauthorized("Invalid token"))
+			c.Abort()
+			return
+		}
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			c.Error(apperrors.Unauthorized("Invalid token"))
+			c.Abort()
+			return
+		}
+		user, err := users.GetUserByID(c.Request.Context(), userID)
+		if errors.Is(err, apperrors.ErrNotFound) || (err == nil && user.TokenVersion != claims.Version) {
+			c.Error(apperrors.Unauthorized("Invalid token"))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.Error(err)
 			c.Abort()
 			return
 		}
 
-		c.Set("username", claims.Subject)
+		c.Set(userContextKey, user)
+		c.Set("username", user.Username)
+		ctx := logging.WithAttrs(c.Request.Context(), slog.String(logging.UsernameKey, user.Username))
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
@@ -1,33 +1,278 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 // User model
-// User defines the structure for an API user.
+// User defines the structure for an API user. API responses use
+// dto.UserResponse; the hash is also kept out of any other encoding.
 // swagger:model User
 type User struct {
-	ID           int    `json:"id"`
-	Username     string `json:"username"`
-	PasswordHash string `json:"password_hash"`
-	Email        string `json:"email"`
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	PasswordHash  string    `json:"-"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	// FailedLogins counts failed logins since the last success or lockout.
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	// OwnerID is set for service accounts: users without a password or an
+	// email address that authenticate with API keys and are managed by
+	// their owner.
+	OwnerID *int `json:"owner_id,omitempty"`
+	// MFAEnabled is set once the user has confirmed a TOTP enrollment.
+	MFAEnabled bool `json:"mfa_enabled"`
+	// PlatformOperator is set in the database for the people who run the
+	// platform. Only they may add to the device type catalog.
+	PlatformOperator bool `json:"-"`
+	// TokenVersion is put in the user's login tokens, and bumped to revoke
+	// them when the password changes or MFA is turned on or off.
+	TokenVersion int `json:"-"`
 }
 
+// IsServiceAccount reports whether the user is a service account.
+func (u User) IsServiceAccount() bool {
+	return u.OwnerID != nil
+}
+
+// Purposes of a UserToken.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	// TokenMFALogin is handed out, not mailed, after a correct password
+	// when the user must also give a TOTP or recovery code.
+	TokenMFALogin = "mfa_login"
+)
+
+// UserToken model
+// UserToken is a single-use token mailed to a user to verify their email
+// address or reset their password. Only a hash of the token is stored.
+type UserToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// API key scopes. A key can only use the routes its scopes cover.
+const (
+	ScopeHomesRead     = "homes:read"
+	ScopeHomesWrite    = "homes:write"
+	ScopeDevicesRead   = "devices:read"
+	ScopeDevicesWrite  = "devices:write"
+	ScopeCommandsSend  = "commands:send"
+	ScopeTelemetryRead = "telemetry:read"
+	ScopeAuditRead     = "audit:read"
+)
+
+// Scopes lists every API key scope.
+var Scopes = []string{ScopeHomesRead, ScopeHomesWrite, ScopeDevicesRead, ScopeDevicesWrite, ScopeCommandsSend, ScopeTelemetryRead, ScopeAuditRead}
+
+// APIKey model
+// APIKey authenticates a service account. Only a hash of the key is stored;
+// Prefix, the start of the key, identifies it to people.
+type APIKey struct {
+	ID               int
+	ServiceAccountID int
+	Name             string
+	Prefix           string
+	KeyHash          string
+	Scopes           []string
+	// HomeIDs, if not empty, restrict the key to these homes.
+	HomeIDs    []int
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// UserMFA model
+// UserMFA is a user's TOTP enrollment. The secret is sealed with the
+// platform's MFA keys. EnabledAt is nil until the user confirms the
+// enrollment with a code.
+type UserMFA struct {
+	UserID       int
+	SealedSecret string
+	EnabledAt    *time.Time
+	// LastStep is the time step of the last code used, so codes cannot be
+	// replayed.
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// UserIdentity model
+// UserIdentity links a user to their account at an OpenID Connect identity
+// provider, which signs them in.
+type UserIdentity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	CreatedAt time.Time
+}
+
+// SSOLogin model
+// SSOLogin is a single sign-on login waiting for the identity provider to
+// redirect back. Only a hash of its state is stored; Verifier is the PKCE
+// code verifier.
+type SSOLogin struct {
+	ID        int
+	Provider  string
+	StateHash string
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// Permissions a role grants in a home.
+const (
+	// PermHomeManage allows changing the home's settings, such as its
+	// retention policy and MFA requirement.
+	PermHomeManage        = "home.manage"
+	PermHomeMembersManage = "home.members.manage"
+	PermHomeRolesManage   = "home.roles.manage"
+	// PermDeviceAssign allows moving devices into and out of the home.
+	PermDeviceAssign  = "device.assign"
+	PermDeviceCommand = "device.command"
+	PermTelemetryRead = "telemetry.read"
+	PermAuditRead     = "audit.read"
+)
+
+// Permissions lists every permission.
+var Permissions = []string{
+	PermHomeManage, PermHomeMembersManage, PermHomeRolesManage,
+	PermDeviceAssign, PermDeviceCommand, PermTelemetryRead, PermAuditRead,
+}
+
+// ReadPermissions are the permissions a home that requires MFA still grants
+// to members without it.
+var ReadPermissions = []string{PermTelemetryRead, PermAuditRead}
+
+// Built-in roles, available in every home.
+const (
+	RoleAdmin = "Admin"
+	RoleView  = "View"
+)
+
 // Role model
-// Role represents user roles within the system.
+// Role is a named set of permissions a user can hold in a home. The
+// built-in roles have no home; custom roles belong to the home that created
+// them.
 // swagger:model Role
 type Role struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	HomeID      *int     `json:"home_id,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Can reports whether the role grants the permission.
+func (r Role) Can(permission string) bool {
+	return slices.Contains(r.Permissions, permission)
+}
+
+// Organization roles, from most to least privileged. Each is inherited in
+// every home of the organization with the permissions of OrgRolePermissions.
+const (
+	OrgRoleOwner    = "owner"
+	OrgRoleAdmin    = "admin"
+	OrgRoleOperator = "operator"
+	OrgRoleViewer   = "viewer"
+)
+
+// OrgRoles lists the organization roles, most privileged first.
+var OrgRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleOperator, OrgRoleViewer}
+
+// OrgRoleAtLeast reports whether role is as privileged as min.
+func OrgRoleAtLeast(role, min string) bool {
+	for _, r := range OrgRoles {
+		if r == role {
+			return true
+		}
+		if r == min {
+			return false
+		}
+	}
+	return false
+}
+
+// OrgRolePermissions returns the permissions an organization role grants
+// in the organization's homes: owners and admins those of the Admin role,
+// operators and viewers those of the View role, with operators also allowed
+// to send commands.
+func OrgRolePermissions(role string) []string {
+	switch role {
+	case OrgRoleOwner, OrgRoleAdmin:
+		return Permissions
+	case OrgRoleOperator:
+		return []string{PermTelemetryRead, PermDeviceCommand}
+	case OrgRoleViewer:
+		return []string{PermTelemetryRead}
+	}
+	return nil
+}
+
+// OrgRolesWith returns the organization roles that grant the permission.
+func OrgRolesWith(permission string) []string {
+	var roles []string
+	for _, role := range OrgRoles {
+		if slices.Contains(OrgRolePermissions(role), permission) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Organization model
+// Organization is a customer, such as a company, that owns homes and sites.
+// Its quotas limit what its members can add to it; nil means unlimited.
+// swagger:model Organization
+type Organization struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Plan         string    `json:"plan"`
+	BillingEmail string    `json:"billing_email"`
+	MaxHomes     *int      `json:"max_homes"`
+	MaxDevices   *int      `json:"max_devices"`
+	MaxMembers   *int      `json:"max_members"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OrgMember model
+// OrgMember gives a user a role in an organization.
+type OrgMember struct {
+	OrgID     int       `json:"org_id"`
+	UserID    int       `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgUsage counts what an organization has, against its quotas.
+type OrgUsage struct {
+	Homes   int
+	Devices int
+	Members int
 }
 
 // Home model
 // Home represents a household or location managed by a user.
 // swagger:model Home
 type Home struct {
-	ID        int       `json:"id"`
-	HomeName  string    `json:"home_name"`
-	UserID    int       `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID       int    `json:"id"`
+	HomeName string `json:"home_name"`
+	UserID   int    `json:"user_id"`
+	// OrgID is set for homes owned by an organization, whose members inherit
+	// roles in them.
+	OrgID *int `json:"org_id,omitempty"`
+	// RequireMFA denies all but the read permissions in the home to members
+	// who have not enabled MFA.
+	RequireMFA bool      `json:"require_mfa"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // HomeUser model
@@ -39,54 +284,397 @@ type HomeUser struct {
 	RoleID int `json:"role_id"`
 }
 
+// Invitation statuses. Only pending invitations can be answered or revoked.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+// HomeInvitation model
+// HomeInvitation offers a role in a home to the user with an email address.
+// UserID is set when the invitation named a user, or the address was
+// already a user's when it was sent; otherwise whoever verifies the address
+// may answer it.
+type HomeInvitation struct {
+	ID     int
+	HomeID int
+	// HomeName and RoleName are read with the invitation, for showing it.
+	HomeName    string
+	Email       string
+	UserID      *int
+	RoleID      int
+	RoleName    string
+	InvitedBy   int
+	Status      string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	RespondedAt *time.Time
+}
+
+// Expired reports whether the invitation can no longer be answered at now.
+func (i HomeInvitation) Expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+// Device transfer statuses. Only pending transfers can be answered or
+// cancelled.
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+// DeviceTransfer model
+// DeviceTransfer hands a device from its owner to another user, who must
+// accept it. KeepTelemetry keeps what the device recorded for the previous
+// owner to read; otherwise it is purged on acceptance.
+type DeviceTransfer struct {
+	ID            int
+	DeviceID      string
+	FromUserID    int
+	ToUserID      int
+	KeepTelemetry bool
+	Status        string
+	CreatedAt     time.Time
+	RespondedAt   *time.Time
+}
+
+// Space kinds, outermost first. A space sits directly in its home or inside
+// a space of an earlier kind: a room may be on a floor or directly in a
+// building, but not inside a zone.
+const (
+	SpaceBuilding = "building"
+	SpaceFloor    = "floor"
+	SpaceRoom     = "room"
+	SpaceZone     = "zone"
+)
+
+// SpaceKinds lists the space kinds, outermost first.
+var SpaceKinds = []string{SpaceBuilding, SpaceFloor, SpaceRoom, SpaceZone}
+
+// Space model
+// Space is a building, floor, room or zone of a home. Spaces form a tree
+// through ParentID; top-level spaces have none.
+type Space struct {
+	ID        int
+	HomeID    int
+	ParentID  *int
+	Name      string
+	Kind      string
+	CreatedAt time.Time
+}
+
 // Device model
-// Device represents a physical or virtual device within the system.
+// Device represents a physical or virtual device within the system. Anyone
+// who knows its channel ID can reach it over MQTT, so the audit log records
+// only that the channel ID changed.
 // swagger:model Device
 type Device struct {
 	ID             int       `json:"id"`
 	DeviceID       string    `json:"device_id"`
-	ChannelID      string    `json:"channel_id"`
+	ChannelID      string    `json:"channel_id" audit:"redact"`
 	ProductionDate time.Time `json:"production_date"`
 	Warranty       int       `json:"warranty"`
 	Location       string    `json:"location"`
 	IsActive       bool      `json:"is_active"`
 	UserID         int       `json:"user_id"`
 	HomeID         *int      `json:"home_id,omitempty"`
+	SpaceID        *int      `json:"space_id,omitempty"`
+	DeviceTypeID   *int      `json:"device_type_id,omitempty"`
+	Decoder        string    `json:"decoder,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+// Device group kinds. A static group lists its devices; a dynamic group
+// holds whichever devices of its home its selector matches.
+const (
+	GroupStatic  = "static"
+	GroupDynamic = "dynamic"
+)
+
+// DeviceSelector picks devices of a home by their tags and attributes. Unset
+// fields match every device.
+type DeviceSelector struct {
+	// Tags must all be set on the device to the given values; the value "*"
+	// matches any value.
+	Tags map[string]string `json:"tags,omitempty"`
+	// SpaceID matches devices in the space or the spaces inside it.
+	SpaceID      *int  `json:"space_id,omitempty"`
+	DeviceTypeID *int  `json:"device_type_id,omitempty"`
+	IsActive     *bool `json:"is_active,omitempty"`
+}
+
+// DeviceGroup model
+// DeviceGroup is a named set of a home's devices that bulk jobs run on.
+// Selector is set for dynamic groups only.
+type DeviceGroup struct {
+	ID        int
+	HomeID    int
+	Name      string
+	Kind      string
+	Selector  *DeviceSelector
+	CreatedAt time.Time
+}
+
+// Device job actions.
+const (
+	JobCommand    = "command"
+	JobAssignHome = "assign_home"
+	JobSetActive  = "set_active"
+	JobFirmware   = "firmware"
+)
+
+// JobActions lists the device job actions.
+var JobActions = []string{JobCommand, JobAssignHome, JobSetActive, JobFirmware}
+
+// JobPermission returns the home permission the creator of a job with the
+// action needs, both to create it and while it runs.
+func JobPermission(action string) string {
+	if action == JobCommand || action == JobFirmware {
+		return PermDeviceCommand
+	}
+	return PermDeviceAssign
+}
+
+// FirmwareCommand is the command a firmware job sends each device, with the
+// version and URL of the image as its params. Device types that support
+// over-the-air updates declare it.
+const FirmwareCommand = "firmware_update"
+
+// Device job statuses. A job is completed once every device was tried,
+// whether or not it succeeded on each.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+)
+
+// Device job result statuses.
+const (
+	JobResultPending   = "pending"
+	JobResultSucceeded = "succeeded"
+	JobResultFailed    = "failed"
+)
+
+// JobParams are the arguments of a device job's action.
+type JobParams struct {
+	// Command and Params are the command job's command.
+	Command string                 `json:"command,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	// HomeID is the home an assign_home job moves devices to.
+	HomeID *int `json:"home_id,omitempty"`
+	// Active is what a set_active job sets is_active to.
+	Active *bool `json:"active,omitempty"`
+	// Version and URL describe the image of a firmware job.
+	Version string `json:"version,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// DeviceJob model
+// DeviceJob runs one action on every device a group held when the job was
+// created, in the background. The counts report its progress.
+type DeviceJob struct {
+	ID        int
+	HomeID    int
+	GroupID   *int
+	Action    string
+	Params    JobParams
+	Status    string
+	CreatedBy *int
+	CreatedAt time.Time
+	// StartedAt is when a worker first picked the job up.
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	Total      int
+	Succeeded  int
+	Failed     int
+}
+
+// DeviceJobResult is the outcome of a device job on one device.
+type DeviceJobResult struct {
+	JobID      int
+	DeviceID   string
+	Status     string
+	Error      string
+	FinishedAt *time.Time
+}
+
+// DeviceType model
+// DeviceType describes a product model: its telemetry schema, supported commands and default decoder.
+// swagger:model DeviceType
+type DeviceType struct {
+	ID             int              `json:"id"`
+	Name           string           `json:"name"`
+	Manufacturer   string           `json:"manufacturer"`
+	Model          string           `json:"model"`
+	Decoder        string           `json:"decoder,omitempty"`
+	ValidationMode string           `json:"validation_mode,omitempty"`
+	Fields         []TelemetryField `json:"fields"`
+	Commands       []DeviceCommand  `json:"commands"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+// TelemetryField model
+// TelemetryField declares one expected telemetry value: number, integer, boolean or string.
+// swagger:model TelemetryField
+type TelemetryField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Unit     string   `json:"unit,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Required bool     `json:"required,omitempty"`
+}
+
+// DeviceCommand model
+// DeviceCommand declares a command a device type accepts and its parameters.
+// swagger:model DeviceCommand
+type DeviceCommand struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Params      []TelemetryField `json:"params,omitempty"`
+}
+
 // DeviceData model
 // DeviceData represents data generated or consumed by a device.
 // swagger:model DeviceData
 type DeviceData struct {
-	DeviceID string                 `json:"device_id"`
-	HomeID   *int                   `json:"home_id"`
-	Data     map[string]interface{} `json:"data"`
-}
-
-// ApiResponse model
-// ApiResponse represents a standard response for API endpoints.
-// swagger:model ApiResponse
-type ApiResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	Error   string `json:"error,omitempty"`
-	token   string `json:"error,omitempty"`
-}
-
-// AddUserToHomeRequest model
-// AddUserToHomeRequest defines the required parameters to add a user to a home.
-// swagger:model AddUserToHomeRequest
-type AddUserToHomeRequest struct {
-	HomeID int    `json:"home_id"`
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
-}
-
-// AssignDeviceRequest model
-// AssignDeviceRequest defines the JSON structure for assigning a device to a home.
-// swagger: model AssignDeviceRequest
-type AssignDeviceRequest struct {
-	DeviceID string `json:"device_id"`
-	HomeID   *int   `json:"home_id"`
+	DeviceID         string                 `json:"device_id"`
+	HomeID           *int                   `json:"home_id"`
+	Data             map[string]interface{} `json:"data"`
+	SchemaViolations []string               `json:"schema_violations,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// DeviceAnalytics model
+// DeviceAnalytics is a downsampled rollup of one numeric telemetry field over an hour or a day.
+// swagger:model DeviceAnalytics
+type DeviceAnalytics struct {
+	DeviceID    string    `json:"device_id"`
+	HomeID      *int      `json:"home_id"`
+	Metric      string    `json:"metric"`
+	Granularity string    `json:"granularity"`
+	Period      time.Time `json:"period"`
+	Count       int       `json:"count"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	Sum         float64   `json:"sum"`
+}
+
+// SpaceAnalytics combines the rollups of one numeric field for the devices
+// in a space and the spaces inside it.
+type SpaceAnalytics struct {
+	SpaceID     int
+	Metric      string
+	Granularity string
+	Period      time.Time
+	// Devices is the number of devices whose rollups were combined.
+	Devices int
+	Count   int
+	Min     float64
+	Max     float64
+	Avg     float64
+	Sum     float64
+}
+
+// RetentionPolicy model
+// RetentionPolicy sets how long telemetry is kept for a home or a device type.
+// swagger:model RetentionPolicy
+type RetentionPolicy struct {
+	ID            int  `json:"id"`
+	HomeID        *int `json:"home_id,omitempty"`
+	DeviceTypeID  *int `json:"device_type_id,omitempty"`
+	RetentionDays int  `json:"retention_days"`
+}
+
+// Audit actions. An action is named after its target type.
+const (
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserVerifyEmail    = "user.verify_email"
+	AuditUserChangePassword = "user.change_password"
+	AuditUserResetPassword  = "user.reset_password"
+	AuditUserLock           = "user.lock"
+	AuditUserLinkIdentity   = "user.link_identity"
+	AuditUserEnableMFA      = "user.enable_mfa"
+	AuditUserDisableMFA     = "user.disable_mfa"
+	AuditUserRecoveryCodes  = "user.regenerate_recovery_codes"
+	AuditUserDelete         = "user.delete"
+	AuditHomeCreate         = "home.create"
+	AuditHomeUpdate         = "home.update"
+	AuditMembershipAdd      = "membership.add"
+	AuditDeviceCreate       = "device.create"
+	AuditDeviceUpdate       = "device.update"
+	AuditDeviceCommand      = "device.command"
+	AuditDeviceTransfer     = "device.transfer"
+	AuditDeviceAccept       = "device.accept_transfer"
+	AuditDeviceDecline      = "device.decline_transfer"
+	AuditDeviceCancel       = "device.cancel_transfer"
+	AuditDeviceTypeCreate   = "device_type.create"
+	AuditRetentionPolicySet = "retention_policy.set"
+	AuditAPIKeyCreate       = "api_key.create"
+	AuditAPIKeyRevoke       = "api_key.revoke"
+	AuditOrgCreate          = "organization.create"
+	AuditOrgUpdate          = "organization.update"
+	AuditOrgMemberSet       = "org_member.set"
+	AuditOrgMemberRemove    = "org_member.remove"
+	AuditRoleCreate         = "role.create"
+	AuditRoleUpdate         = "role.update"
+	AuditRoleDelete         = "role.delete"
+	AuditInvitationCreate   = "invitation.create"
+	AuditInvitationAccept   = "invitation.accept"
+	AuditInvitationDecline  = "invitation.decline"
+	AuditInvitationRevoke   = "invitation.revoke"
+	AuditSpaceCreate        = "space.create"
+	AuditSpaceUpdate        = "space.update"
+	AuditSpaceDelete        = "space.delete"
+	AuditDeviceTag          = "device.tag"
+	AuditGroupCreate        = "device_group.create"
+	AuditGroupUpdate        = "device_group.update"
+	AuditGroupDelete        = "device_group.delete"
+	AuditJobCreate          = "device_job.create"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser            = "user"
+	AuditTargetHome            = "home"
+	AuditTargetMembership      = "membership"
+	AuditTargetDevice          = "device"
+	AuditTargetDeviceType      = "device_type"
+	AuditTargetRetentionPolicy = "retention_policy"
+	AuditTargetAPIKey          = "api_key"
+	AuditTargetOrganization    = "organization"
+	AuditTargetOrgMember       = "org_member"
+	AuditTargetRole            = "role"
+	AuditTargetInvitation      = "invitation"
+	AuditTargetSpace           = "space"
+	AuditTargetDeviceGroup     = "device_group"
+	AuditTargetDeviceJob       = "device_job"
+)
+
+// AuditEntry model
+// AuditEntry records one change: who made it, from where, and the fields of
+// the target before and after that changed. Entries are never updated or
+// deleted.
+type AuditEntry struct {
+	ID int64
+	// ActorID is nil for changes made by the system, such as a lockout.
+	// ActorName keeps the username after the actor is deleted.
+	ActorID    *int
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   string
+	// HomeIDs are the homes the change concerns; their Admins can read the
+	// entry. A device moved between homes concerns both.
+	HomeIDs   []int
+	Before    map[string]interface{}
+	After     map[string]interface{}
+	IP        string
+	CreatedAt time.Time
 }
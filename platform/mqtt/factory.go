@@ -1,28 +1,34 @@
 package mqtt
 
 import (
-	"PragatiIot/platform/rabbitmq"
+	"PragatiIot/platform/decoders"
+	"PragatiIot/platform/ingest"
 	"PragatiIot/platform/services"
+	"context"
 	"fmt"
+	"log/slog"
 )
 
 type ProtocolHandler interface {
-	ProcessMessage(deviceID string, message []byte) error
+	ProcessMessage(ctx context.Context, deviceID string, message []byte) error
 }
 
 type ProtocolFactory struct {
-	deviceService *services.DeviceService
-	producer      *rabbitmq.Producer
+	deviceService     *services.DeviceService
+	deviceTypeService *services.DeviceTypeService
+	buffer            *ingest.Buffer
+	decoders          *decoders.Registry
+	logger            *slog.Logger
 }
 
-func NewProtocolFactory(deviceService *services.DeviceService, producer *rabbitmq.Producer) *ProtocolFactory {
-	return &ProtocolFactory{deviceService: deviceService, producer: producer}
+func NewProtocolFactory(deviceService *services.DeviceService, deviceTypeService *services.DeviceTypeService, buffer *ingest.Buffer, decoderRegistry *decoders.Registry, logger *slog.Logger) *ProtocolFactory {
+	return &ProtocolFactory{deviceService: deviceService, deviceTypeService: deviceTypeService, buffer: buffer, decoders: decoderRegistry, logger: logger}
 }
 
 func (f *ProtocolFactory) CreateHandler(protocol string) (ProtocolHandler, error) {
 	switch protocol {
 	case "mqtt":
-		return NewMQTTHandler(f.deviceService, f.producer), nil
+		return NewMQTTHandler(f.deviceService, f.deviceTypeService, f.buffer, f.decoders, f.logger), nil
 	default:
 		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
 	}
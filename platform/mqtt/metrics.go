@@ -0,0 +1,38 @@
+package mqtt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Failure reasons recorded on pragati_mqtt_messages_failed_total.
+const (
+	failureUnknownDevice = "unknown_device"
+	failureDeviceType    = "device_type"
+	failureDecoder       = "decoder"
+	failureSchema        = "schema"
+	failureBuffer        = "buffer"
+	failureHandler       = "handler"
+)
+
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pragati_mqtt_messages_received_total",
+		Help: "MQTT messages received from the broker.",
+	})
+
+	messagesProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pragati_mqtt_messages_processed_total",
+		Help: "MQTT messages decoded, validated and queued for storage.",
+	})
+
+	messagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pragati_mqtt_messages_failed_total",
+		Help: "MQTT messages that could not be processed, by reason.",
+	}, []string{"reason"})
+
+	activeSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pragati_mqtt_active_subscriptions",
+		Help: "Device topics the platform is subscribed to.",
+	})
+)
@@ -1,18 +1,28 @@
 package mqtt
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"os"
 	"sync"
 	"time"
 
+	"PragatiIot/platform/logging"
 	"PragatiIot/platform/rabbitmq"
 	"PragatiIot/platform/services"
+	"PragatiIot/platform/tracing"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("mqtt")
+
 type MQTTClient struct {
 	mu            sync.Mutex
 	deviceService *services.DeviceService
@@ -20,33 +30,66 @@ type MQTTClient struct {
 	factory       *ProtocolFactory
 	mqttClient    mqtt.Client
 	topics        map[string]struct{}
+	// wake makes subscribeTopics sync the topics without waiting for its
+	// next poll.
+	wake   chan struct{}
+	logger *slog.Logger
 }
 
-func NewMQTTClient(deviceService *services.DeviceService, producer *rabbitmq.Producer, factory *ProtocolFactory) *MQTTClient {
+func NewMQTTClient(deviceService *services.DeviceService, producer *rabbitmq.Producer, factory *ProtocolFactory, logger *slog.Logger) *MQTTClient {
 	return &MQTTClient{
 		deviceService: deviceService,
 		producer:      producer,
 		factory:       factory,
 		topics:        make(map[string]struct{}),
+		wake:          make(chan struct{}, 1),
+		logger:        logger,
 	}
 }
 
 func (c *MQTTClient) handleMessage(client mqtt.Client, msg mqtt.Message) {
-	device, err := c.deviceService.GetDeviceByChannel(msg.Topic())
+	messagesReceived.Inc()
+
+	// MQTT 3.1.1 has no message properties to carry a trace context, so each
+	// message starts a new trace.
+	ctx, span := tracer.Start(context.Background(), "mqtt receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("mqtt"),
+			semconv.MessagingDestinationName(msg.Topic()),
+		),
+	)
+	defer span.End()
+
+	device, err := c.deviceService.GetDeviceByChannel(ctx, msg.Topic())
 	if err != nil {
-		log.Printf("Error getting device for topic %s: %v", msg.Topic(), err)
+		messagesFailed.WithLabelValues(failureUnknownDevice).Inc()
+		span.SetStatus(codes.Error, "unknown device")
+		c.logger.WarnContext(ctx, "Message on topic without a device", "topic", msg.Topic(), "error", err)
 		return
 	}
+	logAttrs := []slog.Attr{slog.String(logging.DeviceIDKey, device.DeviceID)}
+	if device.HomeID != nil {
+		logAttrs = append(logAttrs, slog.Int(logging.HomeIDKey, *device.HomeID))
+	}
+	ctx = logging.WithAttrs(ctx, logAttrs...)
 
 	handler, err := c.factory.CreateHandler("mqtt")
 	if err != nil {
-		log.Printf("Error creating handler: %v", err)
+		messagesFailed.WithLabelValues(failureHandler).Inc()
+		span.SetStatus(codes.Error, err.Error())
+		c.logger.ErrorContext(ctx, "Error creating protocol handler", "error", err)
 		return
 	}
 
-	if err := handler.ProcessMessage(device.DeviceID, msg.Payload()); err != nil {
-		log.Printf("Error processing message: %v", err)
+	// ProcessMessage records its own failures by reason.
+	if err := handler.ProcessMessage(ctx, device.DeviceID, msg.Payload()); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.logger.ErrorContext(ctx, "Error processing MQTT message", "topic", msg.Topic(), "error", err)
+		return
 	}
+	messagesProcessed.Inc()
 }
 
 func (c *MQTTClient) StartMQTT(broker, clientID, caCert, clientCert, clientKey string, insecure bool) {
@@ -67,28 +110,60 @@ func (c *MQTTClient) StartMQTT(broker, clientID, caCert, clientCert, clientKey s
 		SetTLSConfig(tlsConfig).
 		SetDefaultPublishHandler(c.handleMessage)
 
-	c.mqttClient = mqtt.NewClient(opts)
-	if token := c.mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatalf("MQTT connection error: %v", token.Error())
+	client := mqtt.NewClient(opts)
+	c.mu.Lock()
+	c.mqttClient = client
+	c.mu.Unlock()
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		c.logger.Error("MQTT connection error", "broker", broker, "error", token.Error())
+		os.Exit(1)
 	}
 
 	go c.subscribeTopics()
 
-	log.Println("MQTT client connected and ready")
+	c.logger.Info("MQTT client connected and ready", "broker", broker)
 	select {}
 }
 
+// Stop disconnects from the broker so no further messages are handled.
+func (c *MQTTClient) Stop() {
+	if client := c.client(); client != nil {
+		client.Disconnect(250)
+	}
+}
+
+// Check reports whether the client is connected to the broker. It fails
+// while the client is reconnecting.
+func (c *MQTTClient) Check(ctx context.Context) error {
+	client := c.client()
+	if client == nil {
+		return fmt.Errorf("MQTT client is not started")
+	}
+	if !client.IsConnectionOpen() {
+		return fmt.Errorf("MQTT client is not connected")
+	}
+	return nil
+}
+
+func (c *MQTTClient) client() mqtt.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mqttClient
+}
+
 func (c *MQTTClient) newTLSConfig(caCert, clientCert, clientKey string) *tls.Config {
 	certpool := x509.NewCertPool()
 	ca, err := ioutil.ReadFile(caCert)
 	if err != nil {
-		log.Fatalf("Failed to read CA certificate: %v", err)
+		c.logger.Error("Failed to read CA certificate", "path", caCert, "error", err)
+		os.Exit(1)
 	}
 	certpool.AppendCertsFromPEM(ca)
 
 	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
 	if err != nil {
-		log.Fatalf("Failed to load client certificate/key pair: %v", err)
+		c.logger.Error("Failed to load client certificate/key pair", "error", err)
+		os.Exit(1)
 	}
 
 	return &tls.Config{
@@ -98,28 +173,77 @@ func (c *MQTTClient) newTLSConfig(caCert, clientCert, clientKey string) *tls.Con
 	}
 }
 
+// PublishCommand publishes a command payload on the device's command topic,
+// "<channel_id>/commands".
+func (c *MQTTClient) PublishCommand(channelID string, payload []byte) error {
+	client := c.client()
+	if client == nil || !client.IsConnected() {
+		return fmt.Errorf("MQTT client is not connected")
+	}
+	token := client.Publish(channelID+"/commands", 1, false, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// ChannelsChanged makes the client sync its subscriptions now rather than
+// at its next poll. The device transfer service calls it after rotating a
+// device's channel.
+func (c *MQTTClient) ChannelsChanged() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (c *MQTTClient) subscribeTopics() {
 	for {
-		devices, err := c.deviceService.GetDevicesByUserID(1) // or other userID if required
-		if err != nil {
-			log.Printf("Error getting devices: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
+		wait := 10 * time.Second
+		if err := c.syncTopics(context.Background()); err != nil {
+			c.logger.Error("Error getting channels to subscribe to", "error", err)
+			wait = 5 * time.Second
 		}
-
-		c.mu.Lock()
-		for _, device := range devices {
-			if _, ok := c.topics[device.ChannelID]; !ok {
-				if token := c.mqttClient.Subscribe(device.ChannelID, 0, nil); token.Wait() && token.Error() != nil {
-					log.Printf("Error subscribing to topic %s: %v", device.ChannelID, token.Error())
-					continue
-				}
-				c.topics[device.ChannelID] = struct{}{}
-				log.Printf("Subscribed to new topic: %s", device.ChannelID)
-			}
+		select {
+		case <-c.wake:
+		case <-time.After(wait):
 		}
-		c.mu.Unlock()
+	}
+}
 
-		time.Sleep(10 * time.Second)
+// syncTopics subscribes to the channels of the active devices and
+// unsubscribes from the others, such as a channel that was rotated away or
+// the channel of a device that was deactivated.
+func (c *MQTTClient) syncTopics(ctx context.Context) error {
+	channels, err := c.deviceService.GetActiveChannels(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := make(map[string]struct{}, len(channels))
+	for _, channel := range channels {
+		active[channel] = struct{}{}
+		if _, ok := c.topics[channel]; ok {
+			continue
+		}
+		if token := c.mqttClient.Subscribe(channel, 0, nil); token.Wait() && token.Error() != nil {
+			c.logger.Error("Error subscribing to topic", "topic", channel, "error", token.Error())
+			continue
+		}
+		c.topics[channel] = struct{}{}
+		c.logger.Info("Subscribed to new topic", "topic", channel)
+	}
+	for topic := range c.topics {
+		if _, ok := active[topic]; ok {
+			continue
+		}
+		if token := c.mqttClient.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+			c.logger.Error("Error unsubscribing from topic", "topic", topic, "error", token.Error())
+			continue
+		}
+		delete(c.topics, topic)
+		c.logger.Info("Unsubscribed from topic", "topic", topic)
 	}
+	activeSubscriptions.Set(float64(len(c.topics)))
+	return nil
 }
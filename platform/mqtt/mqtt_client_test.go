@@ -0,0 +1,143 @@
+package mqtt
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"PragatiIot/platform/decoders"
+	"PragatiIot/platform/ingest"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"PragatiIot/platform/repositories/memory"
+	"PragatiIot/platform/services"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeBroker is an mqtt.Client that delivers published messages to the
+// handler only on the topics it is subscribed to.
+type fakeBroker struct {
+	mqtt.Client
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func (b *fakeBroker) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics[topic] = true
+	return &mqtt.DummyToken{}
+}
+
+func (b *fakeBroker) Unsubscribe(topics ...string) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		delete(b.topics, topic)
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (b *fakeBroker) publish(handler mqtt.MessageHandler, topic string, payload []byte) bool {
+	b.mu.Lock()
+	subscribed := b.topics[topic]
+	b.mu.Unlock()
+	if subscribed {
+		handler(b, fakeMessage{topic: topic, payload: payload})
+	}
+	return subscribed
+}
+
+type fakeMessage struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Topic() string   { return m.topic }
+func (m fakeMessage) Payload() []byte { return m.payload }
+
+// TestTransferredDeviceIngested checks that after a transfer is accepted the
+// client moves to the device's new channel and ingests what it sends there.
+func TestTransferredDeviceIngested(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+
+	userService := services.NewUserService(store, nil)
+	homeService := services.NewHomeService(store, services.NewRoleService(store), userService, services.NewOrganizationService(store, nil, services.OrgConfig{}), nil)
+	deviceTypeService, err := services.NewDeviceTypeService(store, services.ValidationTag, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceService := services.NewDeviceService(store, homeService, deviceTypeService, nil, logger)
+	transferService := services.NewDeviceTransferService(store, store, store, nil)
+
+	for _, name := range []string{"alice", "bob"} {
+		if err := userService.AddUser(ctx, models.User{Username: name, Email: name + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bob, err := userService.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deviceService.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: 1, IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := deviceService.AddDevice(ctx, models.Device{DeviceID: "d2", ChannelID: "c2", UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := ingest.NewBuffer(deviceService, &recordingPublisher{}, ingest.Config{}, logger)
+	factory := NewProtocolFactory(deviceService, deviceTypeService, buffer, decoders.NewRegistry(), logger)
+	client := NewMQTTClient(deviceService, nil, factory, logger)
+	broker := &fakeBroker{topics: make(map[string]bool)}
+	client.mqttClient = broker
+	transferService.SetChannelListener(client)
+
+	if err := client.syncTopics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(broker.topics) != 1 || !broker.topics["c1"] {
+		t.Fatalf("subscribed to %v, want the active device's channel c1", broker.topics)
+	}
+
+	transfer, err := transferService.Offer(ctx, 1, "d1", "bob", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transferService.Accept(ctx, bob.ID, transfer.ID, "c1-new"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-client.wake:
+	default:
+		t.Fatal("accepting did not wake the subscriber")
+	}
+	if err := client.syncTopics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(broker.topics) != 1 || !broker.topics["c1-new"] {
+		t.Fatalf("subscribed to %v, want only the new channel", broker.topics)
+	}
+
+	if broker.publish(client.handleMessage, "c1", []byte(`{"temp": 1}`)) {
+		t.Error("delivered a message on the old channel")
+	}
+	if !broker.publish(client.handleMessage, "c1-new", []byte(`{"temp": 2}`)) {
+		t.Fatal("did not deliver a message on the new channel")
+	}
+	if err := buffer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Data["temp"] != 2.0 {
+		t.Errorf("stored %+v, want the reading sent on the new channel", stored)
+	}
+}
@@ -1,59 +1,93 @@
 package mqtt
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"PragatiIot/platform/decoders"
+	"PragatiIot/platform/ingest"
+	"PragatiIot/platform/logging"
 	"PragatiIot/platform/models"
-	"PragatiIot/platform/rabbitmq"
 	"PragatiIot/platform/services"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MQTTHandler struct {
-	deviceService *services.DeviceService
-	producer      *rabbitmq.Producer
+	deviceService     *services.DeviceService
+	deviceTypeService *services.DeviceTypeService
+	buffer            *ingest.Buffer
+	decoders          *decoders.Registry
+	logger            *slog.Logger
 }
 
-func NewMQTTHandler(deviceService *services.DeviceService, producer *rabbitmq.Producer) *MQTTHandler {
+func NewMQTTHandler(deviceService *services.DeviceService, deviceTypeService *services.DeviceTypeService, buffer *ingest.Buffer, decoderRegistry *decoders.Registry, logger *slog.Logger) *MQTTHandler {
 	return &MQTTHandler{
-		deviceService: deviceService,
-		producer:      producer,
+		deviceService:     deviceService,
+		deviceTypeService: deviceTypeService,
+		buffer:            buffer,
+		decoders:          decoderRegistry,
+		logger:            logger,
 	}
 }
 
-func (h *MQTTHandler) ProcessMessage(deviceID string, message []byte) error {
-	device, err := h.deviceService.GetDeviceByID(deviceID)
+func (h *MQTTHandler) ProcessMessage(ctx context.Context, deviceID string, message []byte) error {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("device.id", deviceID))
+	ctx = logging.WithAttrs(ctx, slog.String(logging.DeviceIDKey, deviceID))
+
+	device, err := h.deviceService.GetDeviceByID(ctx, deviceID)
 	if err != nil {
-		log.Printf("Error finding device %s: %v", deviceID, err)
+		messagesFailed.WithLabelValues(failureUnknownDevice).Inc()
 		return err
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		log.Printf("Error parsing MQTT message for device %s: %v", deviceID, err)
+	deviceType, err := h.deviceService.GetDeviceType(ctx, device)
+	if err != nil {
+		messagesFailed.WithLabelValues(failureDeviceType).Inc()
 		return err
 	}
 
-	deviceData := models.DeviceData{
-		DeviceID: device.DeviceID,
-		HomeID:   device.HomeID,
-		Data:     data,
+	var typeDecoder string
+	if deviceType != nil {
+		typeDecoder = deviceType.Decoder
 	}
-	if err := h.deviceService.AddDeviceData(deviceData); err != nil {
-		log.Printf("Error storing data for device %s: %v", device.DeviceID, err)
-		return err
+	decoder, err := h.decoders.Resolve(device.Decoder, typeDecoder)
+	if err != nil {
+		messagesFailed.WithLabelValues(failureDecoder).Inc()
+		return fmt.Errorf("error selecting decoder: %w", err)
 	}
 
-	// Publish to RabbitMQ
-	messageBytes, err := json.Marshal(deviceData)
+	data, err := decoder.Decode(message)
 	if err != nil {
-		log.Printf("Error marshalling device data for RabbitMQ: %v", err)
-		return err
+		messagesFailed.WithLabelValues(failureDecoder).Inc()
+		return fmt.Errorf("error decoding payload: %w", err)
 	}
 
-	if err := h.producer.Publish(messageBytes); err != nil {
-		log.Printf("Error publishing device data to RabbitMQ: %v", err)
-		return err
+	var violations []string
+	if deviceType != nil {
+		data, violations, err = h.deviceTypeService.ValidateTelemetry(*deviceType, data)
+		if err != nil {
+			messagesFailed.WithLabelValues(failureSchema).Inc()
+			return err
+		}
+		if len(violations) > 0 {
+			h.logger.DebugContext(ctx, "Reading does not match its device type", "violations", violations)
+		}
+	}
+
+	deviceData := models.DeviceData{
+		DeviceID:         device.DeviceID,
+		HomeID:           device.HomeID,
+		Data:             data,
+		SchemaViolations: violations,
+		CreatedAt:        time.Now().UTC(),
+	}
+	// The buffer stores the reading and then publishes it to RabbitMQ.
+	if err := h.buffer.Enqueue(ctx, deviceData); err != nil {
+		messagesFailed.WithLabelValues(failureBuffer).Inc()
+		return fmt.Errorf("error queueing reading: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,107 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"PragatiIot/platform/decoders"
+	"PragatiIot/platform/ingest"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"PragatiIot/platform/repositories/memory"
+	"PragatiIot/platform/services"
+	"github.com/jackc/pgx/v5"
+)
+
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages [][]byte
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// TestProcessMessage runs readings through the handler and the ingest buffer
+// into the in-memory store and out to the publisher.
+func TestProcessMessage(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+
+	userService := services.NewUserService(store, nil)
+	homeService := services.NewHomeService(store, services.NewRoleService(store), userService, services.NewOrganizationService(store, nil, services.OrgConfig{}), nil)
+	deviceTypeService, err := services.NewDeviceTypeService(store, services.ValidationTag, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceService := services.NewDeviceService(store, homeService, deviceTypeService, nil, logger)
+
+	if err := userService.AddUser(ctx, models.User{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	typeID, err := deviceTypeService.AddDeviceType(ctx, models.DeviceType{
+		Name:           "thermometer",
+		ValidationMode: services.ValidationReject,
+		Fields:         []models.TelemetryField{{Name: "temp", Type: services.FieldNumber, Required: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deviceService.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: 1, DeviceTypeID: &typeID}); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &recordingPublisher{}
+	buffer := ingest.NewBuffer(deviceService, publisher, ingest.Config{}, logger)
+	handler, err := NewProtocolFactory(deviceService, deviceTypeService, buffer, decoders.NewRegistry(), logger).CreateHandler("mqtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handler.ProcessMessage(ctx, "d1", []byte(`{"temp": 21.5}`)); err != nil {
+		t.Fatal(err)
+	}
+	var violation *services.SchemaViolationError
+	if err := handler.ProcessMessage(ctx, "d1", []byte(`{"humidity": 40}`)); !errors.As(err, &violation) {
+		t.Errorf("expected a schema violation, got %v", err)
+	}
+	if err := handler.ProcessMessage(ctx, "d1", []byte(`not json`)); err == nil {
+		t.Error("expected a decoding error")
+	}
+	if err := handler.ProcessMessage(ctx, "d2", []byte(`{"temp": 20}`)); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected pgx.ErrNoRows for an unknown device, got %v", err)
+	}
+
+	// Closing flushes the buffer.
+	if err := buffer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Data["temp"] != 21.5 {
+		t.Fatalf("stored %+v, want one reading with temp 21.5", stored)
+	}
+
+	if len(publisher.messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(publisher.messages))
+	}
+	var published models.DeviceData
+	if err := json.Unmarshal(publisher.messages[0], &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.DeviceID != "d1" {
+		t.Errorf("published reading for %q, want d1", published.DeviceID)
+	}
+}
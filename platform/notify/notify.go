@@ -0,0 +1,104 @@
+// Package notify tells users about events that concern them, such as an
+// invitation to a home. MailNotifier emails them, WebhookNotifier posts them
+// to an endpoint that delivers them some other way, and Notifiers sends each
+// to several.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"PragatiIot/platform/mailer"
+)
+
+// Events notified.
+const (
+	EventInvitationCreated  = "invitation.created"
+	EventInvitationAccepted = "invitation.accepted"
+	EventInvitationDeclined = "invitation.declined"
+)
+
+// Notification is an event told to one recipient, by email address and,
+// if they have an account, user ID.
+type Notification struct {
+	Event   string            `json:"event"`
+	UserID  *int              `json:"user_id,omitempty"`
+	Email   string            `json:"email"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notifiers sends each notification to every notifier, returning their
+// errors joined.
+type Notifiers []Notifier
+
+func (ns Notifiers) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range ns {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MailNotifier emails notifications to their recipient.
+type MailNotifier struct {
+	mailer mailer.Mailer
+}
+
+// NewMailNotifier returns a notifier sending through m.
+func NewMailNotifier(m mailer.Mailer) *MailNotifier {
+	return &MailNotifier{mailer: m}
+}
+
+func (m *MailNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Email == "" {
+		return nil
+	}
+	return m.mailer.Send(ctx, mailer.Message{To: n.Email, Subject: n.Subject, Body: n.Body})
+}
+
+// WebhookNotifier posts each notification as JSON to a URL, for delivery
+// by push, chat or SMS.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting to url.
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting notification: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error posting notification: webhook returned %s", resp.Status)
+	}
+	return nil
+}
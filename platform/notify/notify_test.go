@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- n
+		if n.Event == EventInvitationDeclined {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	userID := 7
+	n := Notification{Event: EventInvitationCreated, UserID: &userID, Email: "bob@example.com", Subject: "Invited", Data: map[string]string{"home_id": "3"}}
+	notifiers := Notifiers{NewWebhookNotifier(server.URL, time.Second)}
+	if err := notifiers.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got.Email != n.Email || got.UserID == nil || *got.UserID != userID || got.Data["home_id"] != "3" {
+		t.Errorf("received %+v", got)
+	}
+
+	n.Event = EventInvitationDeclined
+	if err := notifiers.Notify(context.Background(), n); err == nil {
+		t.Error("a failing webhook returned no error")
+	}
+}
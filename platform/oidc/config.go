@@ -0,0 +1,99 @@
+// Package oidc signs users in with OpenID Connect identity providers using
+// the authorization code flow with PKCE. It discovers each provider from its
+// issuer and verifies the RS256 ID tokens it returns against the provider's
+// published keys.
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Config configures one identity provider. The providers are read from the
+// JSON file named by the OIDC_CONFIG environment variable, keyed by the name
+// used in the login URLs.
+type Config struct {
+	// Issuer is the provider's issuer URL. Its discovery document is at
+	// Issuer + "/.well-known/openid-configuration".
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+	// ClientSecret is expanded from environment variables, so the file
+	// can hold "${CORP_OIDC_CLIENT_SECRET}" rather than the secret. It is
+	// empty for public clients.
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL is the platform's callback URL registered with the
+	// provider, ending in /oidc/<name>/callback.
+	RedirectURL string `json:"redirect_url"`
+	// Scopes are requested in addition to openid. They default to email
+	// and profile.
+	Scopes []string `json:"scopes"`
+	// UsernameClaim names the claim new users' usernames are derived from.
+	// It defaults to preferred_username; the email address is used if the
+	// claim is missing.
+	UsernameClaim string `json:"username_claim"`
+	// GroupsClaim names the claim listing the user's groups. It defaults to
+	// groups.
+	GroupsClaim string `json:"groups_claim"`
+	// GroupRoles grant home roles to members of the provider's groups.
+	GroupRoles []GroupRole `json:"group_roles"`
+}
+
+// GroupRole makes the members of an identity provider group members of a
+// home with a role.
+type GroupRole struct {
+	Group  string `json:"group"`
+	HomeID int    `json:"home_id"`
+	Role   string `json:"role"`
+}
+
+// FileConfig is the content of the OIDC_CONFIG file.
+type FileConfig struct {
+	Providers map[string]Config `json:"providers"`
+}
+
+// LoadFile reads the providers from the config file at path.
+func LoadFile(path string) (map[string]Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading OIDC config %s: %w", path, err)
+	}
+
+	var cfg FileConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing OIDC config %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		provider := cfg.Providers[name]
+		provider.ClientSecret = os.ExpandEnv(provider.ClientSecret)
+		if err := provider.validate(); err != nil {
+			return nil, fmt.Errorf("error loading OIDC provider %s: %w", name, err)
+		}
+		cfg.Providers[name] = provider
+	}
+	return cfg.Providers, nil
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Issuer == "":
+		return fmt.Errorf("issuer is required")
+	case c.ClientID == "":
+		return fmt.Errorf("client_id is required")
+	case c.RedirectURL == "":
+		return fmt.Errorf("redirect_url is required")
+	}
+	for _, gr := range c.GroupRoles {
+		if gr.Group == "" || gr.HomeID <= 0 || gr.Role == "" {
+			return fmt.Errorf("group_roles entries need a group, home_id and role")
+		}
+	}
+	return nil
+}
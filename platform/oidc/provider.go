@@ -0,0 +1,324 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrRejected wraps the errors of logins the provider or the platform
+// rejected, as opposed to failures to reach the provider.
+var ErrRejected = errors.New("login rejected")
+
+// keyRefreshInterval limits how often the provider's keys are fetched again
+// when a token is signed with an unknown key.
+const keyRefreshInterval = time.Minute
+
+// Claims are what the platform uses of a verified ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Username is the value of the configured username claim.
+	Username string
+	Groups   []string
+}
+
+// Provider signs users in with one identity provider. Its discovery
+// document and keys are fetched on first use, so the platform starts while
+// the provider is unreachable.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// metadata is the part of the discovery document the platform uses.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"email", "profile"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	return &Provider{config: config, client: client}
+}
+
+// Config returns the provider's configuration with its defaults applied.
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+// NewVerifier returns a random PKCE code verifier. It is also used for
+// states and nonces.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider's URL to send the user to. The provider
+// redirects back to the configured redirect URL with the state and a code.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange trades the code for an ID token, verifies it and returns its
+// claims. nonce is the one sent with AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error reading token response: %w", err)
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Claims{}, fmt.Errorf("error parsing token response (status %d): %w", resp.StatusCode, err)
+	}
+	if token.Error != "" {
+		return Claims{}, fmt.Errorf("%w: token request failed: %s %s", ErrRejected, token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return Claims{}, fmt.Errorf("token request returned status %d without an ID token", resp.StatusCode)
+	}
+	return p.verify(ctx, token.IDToken, nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and
+// nonce, and returns its claims.
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	parser := &jwt.Parser{ValidMethods: []string{"RS256"}}
+	mc := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(idToken, mc, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: invalid ID token: %w", ErrRejected, err)
+	}
+
+	if iss, _ := mc["iss"].(string); iss != p.config.Issuer {
+		return Claims{}, fmt.Errorf("%w: ID token issued by %q", ErrRejected, iss)
+	}
+	if !slices.Contains(stringList(mc["aud"]), p.config.ClientID) {
+		return Claims{}, fmt.Errorf("%w: ID token not issued to this client", ErrRejected)
+	}
+	if _, ok := mc["exp"]; !ok {
+		return Claims{}, fmt.Errorf("%w: ID token has no expiry", ErrRejected)
+	}
+	if got, _ := mc["nonce"].(string); got != nonce {
+		return Claims{}, fmt.Errorf("%w: ID token nonce does not match", ErrRejected)
+	}
+
+	claims := Claims{Groups: stringList(mc[p.config.GroupsClaim])}
+	claims.Subject, _ = mc["sub"].(string)
+	claims.Email, _ = mc["email"].(string)
+	claims.Name, _ = mc["name"].(string)
+	claims.Username, _ = mc[p.config.UsernameClaim].(string)
+	// Some providers send the flag as a string.
+	switch v := mc["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = v
+	case string:
+		claims.EmailVerified = v == "true"
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: ID token has no subject", ErrRejected)
+	}
+	return claims, nil
+}
+
+// stringList reads a claim that holds a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &md); err != nil {
+		return nil, fmt.Errorf("error discovering OIDC provider %s: %w", p.config.Issuer, err)
+	}
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC provider %s reports issuer %s", p.config.Issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider %s does not support the authorization code flow", p.config.Issuer)
+	}
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// key returns the provider's signing key with the ID, fetching the keys
+// again if it is not known.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, md.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("error fetching signing keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
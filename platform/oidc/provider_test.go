@@ -0,0 +1,85 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+
+	"PragatiIot/platform/oidc"
+	"PragatiIot/platform/oidc/oidctest"
+)
+
+// authorize starts a login and returns the code the provider redirects back
+// with.
+func authorize(t *testing.T, idp *oidctest.Server, p *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := back.Query()
+	if q.Get("state") != state || q.Get("code") == "" {
+		t.Fatalf("redirected back with %s, want the state and a code", back)
+	}
+	return q.Get("code")
+}
+
+func TestProviderExchange(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("platform", "s3cret&")
+	defer idp.Close()
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "platform",
+		ClientSecret: "s3cret&",
+		RedirectURL:  "https://app.example.com/oidc/corp/callback",
+		GroupsClaim:  "roles",
+	}, nil)
+	idp.SignIn(map[string]interface{}{
+		"sub":                "u-1",
+		"email":              "ada@example.com",
+		"email_verified":     true,
+		"preferred_username": "ada",
+		"roles":              []string{"ops", "dev"},
+	})
+
+	authURL, _ := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := parsed.Query(); q.Get("code_challenge") != oidc.Challenge("verifier") || q.Get("scope") != "openid email profile" {
+		t.Errorf("authorization URL %s lacks the PKCE challenge or default scopes", authURL)
+	}
+
+	code := authorize(t, idp, p, "state", "nonce", "verifier")
+	claims, err := p.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u-1" || claims.Email != "ada@example.com" || !claims.EmailVerified || claims.Username != "ada" ||
+		!slices.Equal(claims.Groups, []string{"ops", "dev"}) {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Codes are single use.
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("reused code: got %v, want rejected", err)
+	}
+
+	code = authorize(t, idp, p, "state", "nonce", "verifier")
+	if _, err := p.Exchange(ctx, code, "other-verifier", "nonce"); !errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("wrong verifier: got %v, want rejected", err)
+	}
+
+	code = authorize(t, idp, p, "state", "nonce", "verifier")
+	if _, err := p.Exchange(ctx, code, "verifier", "other-nonce"); !errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("wrong nonce: got %v, want rejected", err)
+	}
+}
@@ -1,13 +1,21 @@
 package rabbitmq
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
 
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MessageHandler interface {
-	HandleMessage(message []byte) error
+	HandleMessage(ctx context.Context, message []byte) error
 }
 
 type Consumer struct {
@@ -15,9 +23,12 @@ type Consumer struct {
 	channel        *amqp.Channel
 	queueName      string
 	messageHandler MessageHandler
+	logger         *slog.Logger
+	watch          *channelWatch
+	consuming      atomic.Bool
 }
 
-func NewConsumer(rabbitMQURL, queueName string, messageHandler MessageHandler) (*Consumer, error) {
+func NewConsumer(rabbitMQURL, queueName string, messageHandler MessageHandler, logger *slog.Logger) (*Consumer, error) {
 	conn, err := amqp.Dial(rabbitMQURL)
 	if err != nil {
 		return nil, err
@@ -45,6 +56,8 @@ func NewConsumer(rabbitMQURL, queueName string, messageHandler MessageHandler) (
 		channel:        ch,
 		queueName:      queueName,
 		messageHandler: messageHandler,
+		logger:         logger,
+		watch:          watchChannel(ch),
 	}, nil
 }
 
@@ -59,19 +72,51 @@ func (c *Consumer) StartConsuming() {
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Error starting consumer: %v", err)
+		c.logger.Error("Error starting consumer", "queue", c.queueName, "error", err)
+		os.Exit(1)
 	}
 
+	c.consuming.Store(true)
 	go func() {
+		defer c.consuming.Store(false)
 		for d := range msgs {
-			err := c.messageHandler.HandleMessage(d.Body)
-			if err != nil {
-				log.Printf("Error handling message: %v", err)
-			}
+			c.handle(d)
 		}
 	}()
 }
 
+func (c *Consumer) handle(d amqp.Delivery) {
+	// Continue the trace started by the publisher, if the headers carry one.
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(d.Headers))
+	ctx, span := tracer.Start(ctx, "process "+c.queueName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingDestinationName(c.queueName),
+		),
+	)
+	defer span.End()
+
+	messagesConsumed.WithLabelValues(c.queueName).Inc()
+	if err := c.messageHandler.HandleMessage(ctx, d.Body); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		consumeErrors.WithLabelValues(c.queueName).Inc()
+		c.logger.ErrorContext(ctx, "Error handling message", "queue", c.queueName, "error", err)
+	}
+}
+
+// Check reports whether the consumer's channel is open and delivering.
+func (c *Consumer) Check(ctx context.Context) error {
+	if err := c.watch.check(c.connection); err != nil {
+		return err
+	}
+	if !c.consuming.Load() {
+		return errors.New("not consuming")
+	}
+	return nil
+}
+
 func (c *Consumer) Close() {
 	c.channel.Close()
 	c.connection.Close()
@@ -0,0 +1,41 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// channelWatch records the closing of a channel, whether by the broker, the
+// connection dropping or Close, so health checks can report it.
+type channelWatch struct {
+	mu  sync.Mutex
+	err error
+}
+
+func watchChannel(ch *amqp.Channel) *channelWatch {
+	w := &channelWatch{}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		amqpErr, ok := <-closed
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if ok && amqpErr != nil {
+			w.err = fmt.Errorf("channel closed: %w", amqpErr)
+		} else {
+			w.err = errors.New("channel closed")
+		}
+	}()
+	return w
+}
+
+func (w *channelWatch) check(conn *amqp.Connection) error {
+	if conn.IsClosed() {
+		return errors.New("connection closed")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
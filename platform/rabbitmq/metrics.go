@@ -0,0 +1,28 @@
+package rabbitmq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pragati_rabbitmq_published_total",
+		Help: "Messages published to RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	publishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pragati_rabbitmq_publish_errors_total",
+		Help: "Failed RabbitMQ publishes, by queue.",
+	}, []string{"queue"})
+
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pragati_rabbitmq_consumed_total",
+		Help: "Messages consumed from RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	consumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pragati_rabbitmq_consume_errors_total",
+		Help: "Consumed messages the handler failed to process, by queue.",
+	}, []string{"queue"})
+)
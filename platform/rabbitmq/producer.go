@@ -1,15 +1,20 @@
 package rabbitmq
 
 import (
-	"log"
+	"context"
 
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Producer struct {
 	connection *amqp.Connection
 	channel    *amqp.Channel
 	queueName  string
+	watch      *channelWatch
 }
 
 func NewProducer(rabbitMQURL, queueName string) (*Producer, error) {
@@ -39,10 +44,25 @@ func NewProducer(rabbitMQURL, queueName string) (*Producer, error) {
 		connection: conn,
 		channel:    ch,
 		queueName:  queueName,
+		watch:      watchChannel(ch),
 	}, nil
 }
 
-func (p *Producer) Publish(message []byte) error {
+// Publish sends message to the queue, carrying the trace context of ctx in
+// the message headers.
+func (p *Producer) Publish(ctx context.Context, message []byte) error {
+	ctx, span := tracer.Start(ctx, "publish "+p.queueName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingDestinationName(p.queueName),
+		),
+	)
+	defer span.End()
+
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
 	err := p.channel.Publish(
 		"",
 		p.queueName,
@@ -50,13 +70,23 @@ func (p *Producer) Publish(message []byte) error {
 		false,
 		amqp.Publishing{
 			ContentType: "application/json",
+			Headers:     headers,
 			Body:        message,
 		},
 	)
 	if err != nil {
-		log.Printf("Error publishing message to RabbitMQ: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		publishErrors.WithLabelValues(p.queueName).Inc()
+		return err
 	}
-	return err
+	messagesPublished.WithLabelValues(p.queueName).Inc()
+	return nil
+}
+
+// Check reports whether the producer's connection and channel are open.
+func (p *Producer) Check(ctx context.Context) error {
+	return p.watch.check(p.connection)
 }
 
 func (p *Producer) Close() {
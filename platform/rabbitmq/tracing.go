@@ -0,0 +1,29 @@
+package rabbitmq
+
+import (
+	"PragatiIot/platform/tracing"
+	"github.com/streadway/amqp"
+)
+
+var tracer = tracing.Tracer("rabbitmq")
+
+// headerCarrier lets the OpenTelemetry propagator read and write trace
+// context in AMQP message headers.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
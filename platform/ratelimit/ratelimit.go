@@ -0,0 +1,136 @@
+// Package ratelimit throttles requests with token buckets. A bucket holds up
+// to Burst tokens and refills at Rate tokens per second; each request takes
+// one. Buckets live in a Store: MemoryStore for a single replica, or the
+// Postgres store in the repositories package to share them across replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is the refill rate and capacity of a bucket. The zero Limit is
+// unlimited.
+type Limit struct {
+	// Rate is in tokens per second.
+	Rate  float64
+	Burst int
+}
+
+// Unlimited reports whether the limit lets every request through.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// RefillTime is how long an empty bucket takes to fill.
+func (l Limit) RefillTime() time.Duration {
+	if l.Unlimited() {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// ParseLimit reads a limit such as "100/m": up to 100 requests at once,
+// refilling at 100 a minute. The unit is s, m or h. "off", "0" and "" are
+// unlimited.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+	count, unit, ok := strings.Cut(s, "/")
+	per, known := units[unit]
+	n, err := strconv.Atoi(count)
+	if !ok || !known || err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want a count and a unit such as 100/m", s)
+	}
+	return Limit{Rate: float64(n) / per.Seconds(), Burst: n}, nil
+}
+
+// Bucket is the state of one token bucket.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket up to now and takes a token if there is one. It
+// returns the new state, whether a token was taken and, if not, how long
+// until one will be available. A zero Bucket is full.
+func (b Bucket) Take(l Limit, now time.Time) (Bucket, bool, time.Duration) {
+	tokens := float64(l.Burst)
+	if !b.Updated.IsZero() {
+		elapsed := now.Sub(b.Updated).Seconds()
+		tokens = math.Min(tokens, b.Tokens+math.Max(elapsed, 0)*l.Rate)
+	}
+	if tokens < 1 {
+		wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+		return Bucket{Tokens: tokens, Updated: now}, false, wait
+	}
+	return Bucket{Tokens: tokens - 1, Updated: now}, true, 0
+}
+
+// Store keeps buckets by key.
+type Store interface {
+	// Take takes a token from the bucket with the key, as Bucket.Take.
+	Take(ctx context.Context, key string, l Limit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+	// Prune deletes the buckets last used before the time. Buckets idle for
+	// longer than their refill time are full, the same as missing ones.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// MemoryStore keeps buckets in memory, for a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]Bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, l Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, allowed, retryAfter := s.buckets[key].Take(l, now)
+	s.buckets[key] = bucket
+	return allowed, retryAfter, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.Updated.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
+
+// RunPruning prunes buckets idle for longer than idle every interval until
+// ctx is done. idle should be at least the longest refill time of the limits
+// in use.
+func RunPruning(ctx context.Context, store Store, interval, idle time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := store.Prune(ctx, now.Add(-idle)); err != nil {
+				logger.ErrorContext(ctx, "Failed to prune rate limit buckets", "error", err)
+			}
+		}
+	}
+}
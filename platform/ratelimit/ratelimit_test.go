@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+		err  bool
+	}{
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{"120/m", Limit{Rate: 2, Burst: 120}, false},
+		{"off", Limit{}, false},
+		{"", Limit{}, false},
+		{"10", Limit{}, true},
+		{"10/d", Limit{}, true},
+		{"x/m", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take(ctx, "a", limit, now); !ok {
+			t.Fatalf("request %d within the burst was rejected", i+1)
+		}
+	}
+	ok, retryAfter, _ := store.Take(ctx, "a", limit, now)
+	if ok || retryAfter != time.Second {
+		t.Errorf("over the burst: allowed %v, retry after %v; want rejected, 1s", ok, retryAfter)
+	}
+	if ok, _, _ := store.Take(ctx, "b", limit, now); !ok {
+		t.Error("another key shares the bucket")
+	}
+	if ok, _, _ := store.Take(ctx, "a", limit, now.Add(time.Second)); !ok {
+		t.Error("bucket did not refill")
+	}
+
+	if err := store.Prune(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.buckets) != 0 {
+		t.Errorf("%d buckets left after pruning", len(store.buckets))
+	}
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// APIKeyRepository keeps the API keys of service accounts in Postgres.
+type APIKeyRepository struct {
+	db *DB
+}
+
+func NewAPIKeyRepository(db *DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, service_account_id, name, prefix, key_hash, scopes, home_ids, expires_at, revoked_at, last_used_at, created_at`
+
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.ServiceAccountID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes, &key.HomeIDs,
+		&key.ExpiresAt, &key.RevokedAt, &key.LastUsedAt, &key.CreatedAt)
+	return key, err
+}
+
+func (r *APIKeyRepository) AddAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	homeIDs := key.HomeIDs
+	if homeIDs == nil {
+		homeIDs = []int{}
+	}
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO api_keys (service_account_id, name, prefix, key_hash, scopes, home_ids, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		key.ServiceAccountID, key.Name, key.Prefix, key.KeyHash, key.Scopes, homeIDs, key.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding API key %s: %w", key.Name, DBError(err, "API key"))
+	}
+	return id, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByID(ctx context.Context, id int) (models.APIKey, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanAPIKey(r.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+	if err != nil {
+		return key, fmt.Errorf("error finding API key %d: %w", id, DBError(err, "API key"))
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanAPIKey(r.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash))
+	if err != nil {
+		return key, fmt.Errorf("error finding API key by hash: %w", DBError(err, "API key"))
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeys(ctx context.Context, serviceAccountID int) ([]models.APIKey, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE service_account_id = $1 ORDER BY id`, serviceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding API keys of service account %d: %w", serviceAccountID, err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, now)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error revoking API key %d: %w", id, DBError(err, "API key"))
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, now); err != nil {
+		return fmt.Errorf("error recording use of API key %d: %w", id, err)
+	}
+	return nil
+}
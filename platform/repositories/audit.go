@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"PragatiIot/platform/models"
+)
+
+// AuditRepository keeps the audit log in Postgres. A trigger in db_init.sql
+// rejects updates and deletes, so entries can only be added.
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) AddAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	homeIDs := entry.HomeIDs
+	if homeIDs == nil {
+		homeIDs = []int{}
+	}
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, home_ids, before, after, ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.ActorID, entry.ActorName, entry.Action, entry.TargetType, entry.TargetID, homeIDs, entry.Before, entry.After, entry.IP, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding audit entry %s: %w", entry.Action, err)
+	}
+	return nil
+}
+
+func (r *AuditRepository) GetAuditEntries(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.VisibleTo != nil {
+		homeIDs := query.AdminHomeIDs
+		if homeIDs == nil {
+			homeIDs = []int{}
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"(home_ids && %s::integer[] OR actor_id = %s OR (target_type = '%s' AND target_id = %s))",
+			arg(homeIDs), arg(*query.VisibleTo), models.AuditTargetUser, arg(strconv.Itoa(*query.VisibleTo))))
+	}
+	if query.ActorID != nil {
+		conditions = append(conditions, "actor_id = "+arg(*query.ActorID))
+	}
+	if query.HomeID != nil {
+		conditions = append(conditions, arg(*query.HomeID)+" = ANY(home_ids)")
+	}
+	if query.Action != "" {
+		conditions = append(conditions, "action = "+arg(query.Action))
+	}
+	if query.TargetType != "" {
+		conditions = append(conditions, "target_type = "+arg(query.TargetType))
+	}
+	if query.TargetID != "" {
+		conditions = append(conditions, "target_id = "+arg(query.TargetID))
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(query.From))
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(query.To))
+	}
+	if query.BeforeID > 0 {
+		conditions = append(conditions, "id < "+arg(query.BeforeID))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT id, actor_id, actor_name, action, target_type, target_id, home_ids, before, after, ip, created_at
+		FROM audit_log `+where+` ORDER BY id DESC LIMIT `+arg(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID, &e.HomeIDs, &e.Before, &e.After, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
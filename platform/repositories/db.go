@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DB is the connection pool shared by the repositories. Each query runs with
+// the caller's context, bounded by the query timeout so a slow query cannot
+// hold a request or a connection indefinitely.
+type DB struct {
+	*pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewDB wraps pool. A zero queryTimeout leaves queries bounded only by the
+// caller's context and the server's statement_timeout.
+func NewDB(pool *pgxpool.Pool, queryTimeout time.Duration) *DB {
+	return &DB{Pool: pool, queryTimeout: queryTimeout}
+}
+
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeviceGroupRepository keeps device tags and device groups in Postgres.
+type DeviceGroupRepository struct {
+	db *DB
+}
+
+func NewDeviceGroupRepository(db *DB) *DeviceGroupRepository {
+	return &DeviceGroupRepository{db: db}
+}
+
+func (r *DeviceGroupRepository) SetDeviceTags(ctx context.Context, deviceID string, tags map[string]string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM device_tags WHERE device_id = $1`, deviceID); err != nil {
+			return err
+		}
+		for key, value := range tags {
+			if _, err := tx.Exec(ctx, `INSERT INTO device_tags (device_id, key, value) VALUES ($1, $2, $3)`, deviceID, key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error setting tags of device %s: %w", deviceID, DBError(err, "device"))
+	}
+	return nil
+}
+
+func (r *DeviceGroupRepository) GetDeviceTags(ctx context.Context, deviceID string) (map[string]string, error) {
+	tags, err := r.queryTags(ctx, `WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding tags of device %s: %w", deviceID, err)
+	}
+	return tags[deviceID], nil
+}
+
+func (r *DeviceGroupRepository) GetHomeDeviceTags(ctx context.Context, homeID int) (map[string]map[string]string, error) {
+	tags, err := r.queryTags(ctx, `WHERE device_id IN (SELECT device_id FROM devices WHERE home_id = $1)`, homeID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding device tags of home %d: %w", homeID, err)
+	}
+	return tags, nil
+}
+
+func (r *DeviceGroupRepository) queryTags(ctx context.Context, where string, args ...any) (map[string]map[string]string, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT device_id, key, value FROM device_tags `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]map[string]string)
+	for rows.Next() {
+		var deviceID, key, value string
+		if err := rows.Scan(&deviceID, &key, &value); err != nil {
+			return nil, err
+		}
+		if tags[deviceID] == nil {
+			tags[deviceID] = make(map[string]string)
+		}
+		tags[deviceID][key] = value
+	}
+	return tags, rows.Err()
+}
+
+const deviceGroupColumns = `id, home_id, name, kind, selector, created_at`
+
+func scanDeviceGroup(row pgx.Row) (models.DeviceGroup, error) {
+	var g models.DeviceGroup
+	err := row.Scan(&g.ID, &g.HomeID, &g.Name, &g.Kind, &g.Selector, &g.CreatedAt)
+	return g, err
+}
+
+func (r *DeviceGroupRepository) AddDeviceGroup(ctx context.Context, group models.DeviceGroup) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO device_groups (home_id, name, kind, selector) VALUES ($1, $2, $3, $4) RETURNING id`,
+		group.HomeID, group.Name, group.Kind, group.Selector,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding device group %s to home %d: %w", group.Name, group.HomeID, DBError(err, "device group"))
+	}
+	return id, nil
+}
+
+func (r *DeviceGroupRepository) GetDeviceGroupByID(ctx context.Context, id int) (models.DeviceGroup, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	group, err := scanDeviceGroup(r.db.QueryRow(ctx, `SELECT `+deviceGroupColumns+` FROM device_groups WHERE id = $1`, id))
+	if err != nil {
+		return group, fmt.Errorf("error finding device group %d: %w", id, DBError(err, "device group"))
+	}
+	return group, nil
+}
+
+func (r *DeviceGroupRepository) GetHomeDeviceGroups(ctx context.Context, homeID int) ([]models.DeviceGroup, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+deviceGroupColumns+` FROM device_groups WHERE home_id = $1 ORDER BY id`, homeID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding device groups of home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var groups []models.DeviceGroup
+	for rows.Next() {
+		group, err := scanDeviceGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (r *DeviceGroupRepository) UpdateDeviceGroup(ctx context.Context, group models.DeviceGroup) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE device_groups SET name = $2, selector = $3 WHERE id = $1`, group.ID, group.Name, group.Selector)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating device group %d: %w", group.ID, DBError(err, "device group"))
+	}
+	return nil
+}
+
+func (r *DeviceGroupRepository) DeleteDeviceGroup(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM device_groups WHERE id = $1`, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting device group %d: %w", id, DBError(err, "device group"))
+	}
+	return nil
+}
+
+func (r *DeviceGroupRepository) AddGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO device_group_members (group_id, device_id) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+		groupID, deviceIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding devices to group %d: %w", groupID, DBError(err, "device group member"))
+	}
+	return nil
+}
+
+func (r *DeviceGroupRepository) RemoveGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, `DELETE FROM device_group_members WHERE group_id = $1 AND device_id = ANY($2)`, groupID, deviceIDs)
+	if err != nil {
+		return fmt.Errorf("error removing devices from group %d: %w", groupID, err)
+	}
+	return nil
+}
+
+func (r *DeviceGroupRepository) GetGroupMembers(ctx context.Context, groupID int) ([]string, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT device_id FROM device_group_members WHERE group_id = $1 ORDER BY device_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding devices of group %d: %w", groupID, err)
+	}
+	defer rows.Close()
+
+	var deviceIDs []string
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, rows.Err()
+}
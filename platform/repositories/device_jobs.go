@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeviceJobRepository keeps device jobs and their results per device in
+// Postgres.
+type DeviceJobRepository struct {
+	db *DB
+}
+
+func NewDeviceJobRepository(db *DB) *DeviceJobRepository {
+	return &DeviceJobRepository{db: db}
+}
+
+// deviceJobColumns counts the results of each job alongside its columns.
+const deviceJobColumns = `j.id, j.home_id, j.group_id, j.action, j.params, j.status, j.created_by, j.created_at, j.started_at, j.finished_at,
+	(SELECT count(*) FROM device_job_results r WHERE r.job_id = j.id),
+	(SELECT count(*) FROM device_job_results r WHERE r.job_id = j.id AND r.status = 'succeeded'),
+	(SELECT count(*) FROM device_job_results r WHERE r.job_id = j.id AND r.status = 'failed')`
+
+func scanDeviceJob(row pgx.Row) (models.DeviceJob, error) {
+	var j models.DeviceJob
+	err := row.Scan(&j.ID, &j.HomeID, &j.GroupID, &j.Action, &j.Params, &j.Status, &j.CreatedBy, &j.CreatedAt, &j.StartedAt, &j.FinishedAt,
+		&j.Total, &j.Succeeded, &j.Failed)
+	return j, err
+}
+
+func (r *DeviceJobRepository) AddDeviceJob(ctx context.Context, job models.DeviceJob, deviceIDs []string) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(
+			ctx,
+			`INSERT INTO device_jobs (home_id, group_id, action, params, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			job.HomeID, job.GroupID, job.Action, job.Params, job.CreatedBy,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO device_job_results (job_id, device_id) SELECT $1, unnest($2::text[])`, id, deviceIDs)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error adding %s job to home %d: %w", job.Action, job.HomeID, DBError(err, "device job"))
+	}
+	return id, nil
+}
+
+func (r *DeviceJobRepository) GetDeviceJobByID(ctx context.Context, id int) (models.DeviceJob, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	job, err := scanDeviceJob(r.db.QueryRow(ctx, `SELECT `+deviceJobColumns+` FROM device_jobs j WHERE j.id = $1`, id))
+	if err != nil {
+		return job, fmt.Errorf("error finding device job %d: %w", id, DBError(err, "device job"))
+	}
+	return job, nil
+}
+
+func (r *DeviceJobRepository) GetHomeDeviceJobs(ctx context.Context, homeID, limit int) ([]models.DeviceJob, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+deviceJobColumns+` FROM device_jobs j WHERE j.home_id = $1 ORDER BY j.id DESC LIMIT $2`, homeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error finding device jobs of home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var jobs []models.DeviceJob
+	for rows.Next() {
+		job, err := scanDeviceJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *DeviceJobRepository) GetDeviceJobResults(ctx context.Context, jobID int) ([]models.DeviceJobResult, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT job_id, device_id, status, error, finished_at FROM device_job_results WHERE job_id = $1 ORDER BY device_id`,
+		jobID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding results of device job %d: %w", jobID, err)
+	}
+	defer rows.Close()
+
+	var results []models.DeviceJobResult
+	for rows.Next() {
+		var res models.DeviceJobResult
+		if err := rows.Scan(&res.JobID, &res.DeviceID, &res.Status, &res.Error, &res.FinishedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (r *DeviceJobRepository) ClaimDeviceJob(ctx context.Context, now, staleBefore time.Time) (models.DeviceJob, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`UPDATE device_jobs SET status = 'running', started_at = COALESCE(started_at, $1), claimed_at = $1
+		WHERE id = (
+			SELECT id FROM device_jobs
+			WHERE status = 'queued' OR status = 'running' AND claimed_at < $2
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`,
+		now, staleBefore,
+	).Scan(&id)
+	if err != nil {
+		return models.DeviceJob{}, fmt.Errorf("error claiming a device job: %w", DBError(err, "device job"))
+	}
+	return r.GetDeviceJobByID(ctx, id)
+}
+
+func (r *DeviceJobRepository) SetDeviceJobResult(ctx context.Context, result models.DeviceJobResult) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE device_job_results SET status = $3, error = $4, finished_at = $5 WHERE job_id = $1 AND device_id = $2`,
+			result.JobID, result.DeviceID, result.Status, result.Error, result.FinishedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		_, err = tx.Exec(ctx, `UPDATE device_jobs SET claimed_at = $2 WHERE id = $1`, result.JobID, result.FinishedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error saving result of device job %d on device %s: %w", result.JobID, result.DeviceID, DBError(err, "device job result"))
+	}
+	return nil
+}
+
+func (r *DeviceJobRepository) FinishDeviceJob(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE device_jobs SET status = 'completed', finished_at = $2, claimed_at = NULL WHERE id = $1`, id, now)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error finishing device job %d: %w", id, DBError(err, "device job"))
+	}
+	return nil
+}
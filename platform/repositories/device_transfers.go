@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeviceTransferRepository keeps device transfers in Postgres.
+type DeviceTransferRepository struct {
+	db *DB
+}
+
+func NewDeviceTransferRepository(db *DB) *DeviceTransferRepository {
+	return &DeviceTransferRepository{db: db}
+}
+
+const deviceTransferColumns = `id, device_id, from_user_id, to_user_id, keep_telemetry, status, created_at, responded_at`
+
+func scanDeviceTransfer(row pgx.Row) (models.DeviceTransfer, error) {
+	var t models.DeviceTransfer
+	err := row.Scan(&t.ID, &t.DeviceID, &t.FromUserID, &t.ToUserID, &t.KeepTelemetry, &t.Status, &t.CreatedAt, &t.RespondedAt)
+	return t, err
+}
+
+func (r *DeviceTransferRepository) AddDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO device_transfers (device_id, from_user_id, to_user_id, keep_telemetry) VALUES ($1, $2, $3, $4) RETURNING id`,
+		transfer.DeviceID, transfer.FromUserID, transfer.ToUserID, transfer.KeepTelemetry,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding transfer of device %s: %w", transfer.DeviceID, DBError(err, "device transfer"))
+	}
+	return id, nil
+}
+
+func (r *DeviceTransferRepository) GetDeviceTransferByID(ctx context.Context, id int) (models.DeviceTransfer, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	t, err := scanDeviceTransfer(r.db.QueryRow(ctx, `SELECT `+deviceTransferColumns+` FROM device_transfers WHERE id = $1`, id))
+	if err != nil {
+		return t, fmt.Errorf("error finding device transfer %d: %w", id, DBError(err, "device transfer"))
+	}
+	return t, nil
+}
+
+func (r *DeviceTransferRepository) GetPendingUserTransfers(ctx context.Context, userID int) ([]models.DeviceTransfer, error) {
+	return r.queryDeviceTransfers(ctx, `WHERE status = 'pending' AND (from_user_id = $1 OR to_user_id = $1) ORDER BY id`, userID)
+}
+
+func (r *DeviceTransferRepository) GetAcceptedDeviceTransfers(ctx context.Context, deviceID string) ([]models.DeviceTransfer, error) {
+	return r.queryDeviceTransfers(ctx, `WHERE device_id = $1 AND status = 'accepted' ORDER BY responded_at, id`, deviceID)
+}
+
+func (r *DeviceTransferRepository) queryDeviceTransfers(ctx context.Context, where string, args ...any) ([]models.DeviceTransfer, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+deviceTransferColumns+` FROM device_transfers `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error finding device transfers: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []models.DeviceTransfer
+	for rows.Next() {
+		t, err := scanDeviceTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+func (r *DeviceTransferRepository) RespondToDeviceTransfer(ctx context.Context, id int, status string, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE device_transfers SET status = $2, responded_at = $3 WHERE id = $1 AND status = 'pending'`,
+		id, status, now,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error answering device transfer %d: %w", id, DBError(err, "device transfer"))
+	}
+	return nil
+}
+
+func (r *DeviceTransferRepository) AcceptDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer, channelID string, since, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE device_transfers SET status = 'accepted', responded_at = $2 WHERE id = $1 AND status = 'pending'`,
+			transfer.ID, now,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		tag, err = tx.Exec(
+			ctx,
+			`UPDATE devices SET user_id = $3, home_id = NULL, space_id = NULL, channel_id = $4 WHERE device_id = $1 AND user_id = $2`,
+			transfer.DeviceID, transfer.FromUserID, transfer.ToUserID, channelID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		if transfer.KeepTelemetry {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM device_data WHERE device_id = $1 AND created_at >= $2`, transfer.DeviceID, since); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM device_analytics WHERE device_id = $1 AND aggregation_period >= $2`, transfer.DeviceID, since)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error accepting device transfer %d: %w", transfer.ID, DBError(err, "device transfer"))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"PragatiIot/platform/apperrors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes mapped by DBError.
+const (
+	codeInvalidText         = "22P02"
+	codeForeignKeyViolation = "23503"
+	codeUniqueViolation     = "23505"
+	codeCheckViolation      = "23514"
+)
+
+// DBError translates a database error on resource, such as "device", into an
+// apperrors error: a missing row is ErrNotFound, a unique violation
+// ErrConflict, and a foreign key or check violation ErrValidation. The
+// original error stays in the chain. Other errors are returned unchanged.
+func DBError(err error, resource string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &apperrors.Error{Kind: apperrors.ErrNotFound, Detail: resource + " not found", Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	field := constraintField(pgErr)
+	switch pgErr.Code {
+	case codeUniqueViolation:
+		return &apperrors.Error{
+			Kind:   apperrors.ErrConflict,
+			Detail: fmt.Sprintf("A %s with this %s already exists", resource, field),
+			Fields: []apperrors.FieldError{{Field: field, Message: "already exists"}},
+			Err:    err,
+		}
+	case codeForeignKeyViolation:
+		return &apperrors.Error{
+			Kind:   apperrors.ErrValidation,
+			Detail: fmt.Sprintf("Invalid %s", resource),
+			Fields: []apperrors.FieldError{{Field: field, Message: "does not exist"}},
+			Err:    err,
+		}
+	case codeCheckViolation, codeInvalidText:
+		return &apperrors.Error{
+			Kind:   apperrors.ErrValidation,
+			Detail: fmt.Sprintf("Invalid %s", resource),
+			Fields: []apperrors.FieldError{{Field: field, Message: "is invalid"}},
+			Err:    err,
+		}
+	}
+	return err
+}
+
+// Changed is the error of an update guarded on the values it was based on
+// that matched no row: another request changed or deleted the resource, such
+// as "device", in between.
+func Changed(resource string) error {
+	return apperrors.Conflict("The %s was changed by another request; try again", resource)
+}
+
+// constraintField derives the column from a constraint named by Postgres'
+// convention, <table>_<column>_key or <table>_<column>_fkey.
+func constraintField(pgErr *pgconn.PgError) string {
+	if pgErr.ColumnName != "" {
+		return pgErr.ColumnName
+	}
+	name := strings.TrimPrefix(pgErr.ConstraintName, pgErr.TableName+"_")
+	for _, suffix := range []string{"_fkey", "_key", "_check"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if name == "" {
+		return "value"
+	}
+	return name
+}
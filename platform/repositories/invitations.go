@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// InvitationRepository keeps home invitations in Postgres.
+type InvitationRepository struct {
+	db *DB
+}
+
+func NewInvitationRepository(db *DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+// selectInvitations reads invitations with the names of their home and role.
+const selectInvitations = `SELECT i.id, i.home_id, h.home_name, i.email, i.user_id, i.role_id, r.name, i.invited_by, i.status, i.expires_at, i.created_at, i.responded_at
+	FROM home_invitations i JOIN homes h ON h.id = i.home_id JOIN roles r ON r.id = i.role_id `
+
+func scanInvitation(row pgx.Row) (models.HomeInvitation, error) {
+	var inv models.HomeInvitation
+	err := row.Scan(&inv.ID, &inv.HomeID, &inv.HomeName, &inv.Email, &inv.UserID, &inv.RoleID, &inv.RoleName, &inv.InvitedBy, &inv.Status, &inv.ExpiresAt, &inv.CreatedAt, &inv.RespondedAt)
+	return inv, err
+}
+
+func (r *InvitationRepository) AddInvitation(ctx context.Context, inv models.HomeInvitation) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO home_invitations (home_id, email, user_id, role_id, invited_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		inv.HomeID, inv.Email, inv.UserID, inv.RoleID, inv.InvitedBy, inv.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding invitation to home %d: %w", inv.HomeID, DBError(err, "home invitation"))
+	}
+	return id, nil
+}
+
+func (r *InvitationRepository) GetInvitationByID(ctx context.Context, id int) (models.HomeInvitation, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	inv, err := scanInvitation(r.db.QueryRow(ctx, selectInvitations+`WHERE i.id = $1`, id))
+	if err != nil {
+		return inv, fmt.Errorf("error finding invitation %d: %w", id, DBError(err, "invitation"))
+	}
+	return inv, nil
+}
+
+func (r *InvitationRepository) GetPendingHomeInvitations(ctx context.Context, homeID int) ([]models.HomeInvitation, error) {
+	return r.queryInvitations(ctx, `WHERE i.home_id = $1 AND i.status = 'pending' ORDER BY i.id`, homeID)
+}
+
+func (r *InvitationRepository) GetPendingUserInvitations(ctx context.Context, userID int, email string) ([]models.HomeInvitation, error) {
+	return r.queryInvitations(
+		ctx,
+		`WHERE i.status = 'pending' AND (i.user_id = $1 OR i.user_id IS NULL AND $2 <> '' AND lower(i.email) = lower($2)) ORDER BY i.id`,
+		userID, email,
+	)
+}
+
+func (r *InvitationRepository) queryInvitations(ctx context.Context, where string, args ...any) ([]models.HomeInvitation, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, selectInvitations+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error finding invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []models.HomeInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *InvitationRepository) RespondToInvitation(ctx context.Context, id int, status string, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE home_invitations SET status = $2, responded_at = $3 WHERE id = $1 AND status = 'pending'`,
+		id, status, now,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error answering invitation %d: %w", id, DBError(err, "invitation"))
+	}
+	return nil
+}
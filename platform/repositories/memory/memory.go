@@ -0,0 +1,2459 @@
+// Package memory implements the repository interfaces in memory, for tests
+// and local development without Postgres. It enforces the unique, foreign key
+// and check constraints of db_init.sql and reports errors the way the
+// Postgres repositories do: the *pgconn.PgError or pgx.ErrNoRows Postgres
+// would return, translated by repositories.DBError.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes returned for constraint violations.
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeCheckViolation      = "23514"
+)
+
+// Store holds every table in memory. It implements all of the repository
+// interfaces, and TelemetryMaintainer, so services can share one instance as
+// they would share one database.
+type Store struct {
+	mu sync.Mutex
+
+	users       []models.User
+	tokens      []models.UserToken
+	apiKeys     []models.APIKey
+	identities  []models.UserIdentity
+	ssoLogins   []models.SSOLogin
+	mfa         []models.UserMFA
+	codes       []recoveryCode
+	roles       []models.Role
+	orgs        []models.Organization
+	orgMembers  []models.OrgMember
+	homes       []models.Home
+	homeUsers   []models.HomeUser
+	invitations []models.HomeInvitation
+	spaces      []models.Space
+	devices     []models.Device
+	transfers   []models.DeviceTransfer
+	tags        []deviceTag
+	groups      []models.DeviceGroup
+	members     []groupMember
+	jobs        []deviceJob
+	results     []models.DeviceJobResult
+	deviceTypes []models.DeviceType
+	policies    []models.RetentionPolicy
+	readings    []models.DeviceData
+	analytics   []models.DeviceAnalytics
+	auditLog    []models.AuditEntry
+
+	// lastID holds the last ID given out per table, like a SERIAL sequence,
+	// so IDs are not reused after a delete.
+	lastID map[string]int
+
+	// Now returns the current time. Tests may replace it.
+	Now func() time.Time
+}
+
+var (
+	_ repositories.UserStore            = (*Store)(nil)
+	_ repositories.UserTokenStore       = (*Store)(nil)
+	_ repositories.APIKeyStore          = (*Store)(nil)
+	_ repositories.SSOStore             = (*Store)(nil)
+	_ repositories.MFAStore             = (*Store)(nil)
+	_ repositories.RoleStore            = (*Store)(nil)
+	_ repositories.InvitationStore      = (*Store)(nil)
+	_ repositories.HomeStore            = (*Store)(nil)
+	_ repositories.OrganizationStore    = (*Store)(nil)
+	_ repositories.SpaceStore           = (*Store)(nil)
+	_ repositories.DeviceStore          = (*Store)(nil)
+	_ repositories.DeviceTransferStore  = (*Store)(nil)
+	_ repositories.DeviceTagStore       = (*Store)(nil)
+	_ repositories.DeviceGroupStore     = (*Store)(nil)
+	_ repositories.DeviceJobStore       = (*Store)(nil)
+	_ repositories.DeviceTypeStore      = (*Store)(nil)
+	_ repositories.RetentionPolicyStore = (*Store)(nil)
+	_ repositories.TelemetryMaintainer  = (*Store)(nil)
+	_ repositories.AuditStore           = (*Store)(nil)
+)
+
+// deviceTag is a row of device_tags.
+type deviceTag struct {
+	deviceID, key, value string
+}
+
+// groupMember is a row of device_group_members.
+type groupMember struct {
+	groupID  int
+	deviceID string
+}
+
+// deviceJob is a row of device_jobs, with the claim kept by the repository
+// only.
+type deviceJob struct {
+	models.DeviceJob
+	claimedAt *time.Time
+}
+
+// New returns an empty store seeded with the default roles, Admin and View.
+func New() *Store {
+	return &Store{
+		roles: []models.Role{
+			{ID: 1, Name: models.RoleAdmin, Permissions: slices.Clone(models.Permissions)},
+			{ID: 2, Name: models.RoleView, Permissions: []string{models.PermTelemetryRead}},
+		},
+		lastID: map[string]int{"roles": 2},
+		Now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *Store) AddUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case user.Email == "" && user.OwnerID == nil:
+		err = violation(codeCheckViolation, "users", "users_email_check")
+	case user.OwnerID != nil && !s.userExists(*user.OwnerID):
+		err = violation(codeForeignKeyViolation, "users", "users_owner_id_fkey")
+	}
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			err = violation(codeUniqueViolation, "users", "users_username_key")
+		}
+		if user.Email != "" && u.Email == user.Email {
+			err = violation(codeUniqueViolation, "users", "users_email_key")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error adding user %s: %w", user.Username, repositories.DBError(err, "user"))
+	}
+	user.ID = s.nextID("users")
+	user.CreatedAt = s.Now()
+	s.users = append(s.users, user)
+	return nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("error finding user by ID %d: %w", id, repositories.DBError(pgx.ErrNoRows, "user"))
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("error finding user by username %s: %w", username, repositories.DBError(pgx.ErrNoRows, "user"))
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if email != "" && u.Email == email {
+			return u, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("error finding user by email: %w", repositories.DBError(pgx.ErrNoRows, "user"))
+}
+
+// UpdateUser saves the email, password hash and verification state of the
+// user with user.ID. A new password hash bumps the token version.
+func (s *Store) UpdateUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.ID != user.ID && user.Email != "" && u.Email == user.Email {
+			return fmt.Errorf("error updating user %d: %w", user.ID, repositories.DBError(violation(codeUniqueViolation, "users", "users_email_key"), "user"))
+		}
+	}
+	for i, u := range s.users {
+		if u.ID == user.ID {
+			if s.users[i].PasswordHash != user.PasswordHash {
+				s.users[i].TokenVersion++
+			}
+			s.users[i].Email = user.Email
+			s.users[i].PasswordHash = user.PasswordHash
+			s.users[i].EmailVerified = user.EmailVerified
+			return nil
+		}
+	}
+	return fmt.Errorf("error updating user %d: %w", user.ID, repositories.DBError(pgx.ErrNoRows, "user"))
+}
+
+func (s *Store) RecordLoginFailure(ctx context.Context, id, maxFailures int, lockout time.Duration, now time.Time) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.users {
+		u := &s.users[i]
+		if u.ID != id {
+			continue
+		}
+		u.FailedLogins++
+		if u.FailedLogins >= maxFailures {
+			until := now.Add(lockout)
+			u.FailedLogins = 0
+			u.LockedUntil = &until
+		}
+		if u.LockedUntil != nil && u.LockedUntil.After(now) {
+			until := *u.LockedUntil
+			return &until, nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("error recording failed login of user %d: %w", id, repositories.DBError(pgx.ErrNoRows, "user"))
+}
+
+func (s *Store) ResetLoginFailures(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.users {
+		if s.users[i].ID == id {
+			s.users[i].FailedLogins = 0
+			s.users[i].LockedUntil = nil
+		}
+	}
+	return nil
+}
+
+// DeleteUser deletes the user as the Postgres repository does: owned homes
+// pass to their earliest other Admin member, or their organization's earliest
+// other owner or admin, or are deleted, and the user's memberships, tokens, API keys and devices are deleted, after those of the
+// service accounts they own.
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userExists(id) {
+		return fmt.Errorf("error deleting user %d: %w", id, repositories.DBError(pgx.ErrNoRows, "user"))
+	}
+	for _, u := range s.users {
+		if u.OwnerID != nil && *u.OwnerID == id {
+			s.deleteUser(u.ID)
+		}
+	}
+	s.deleteUser(id)
+	return nil
+}
+
+func (s *Store) deleteUser(id int) {
+	deletedHomes := make(map[int]bool)
+	for i, h := range s.homes {
+		if h.UserID != id {
+			continue
+		}
+		if heir, ok := s.homeHeir(h.ID, id); ok {
+			s.homes[i].UserID = heir
+		} else {
+			deletedHomes[h.ID] = true
+		}
+	}
+	ownedDevices := make(map[string]bool)
+	for _, d := range s.devices {
+		if d.UserID == id {
+			ownedDevices[d.DeviceID] = true
+		}
+	}
+	inDeletedHome := func(homeID *int) bool { return homeID != nil && deletedHomes[*homeID] }
+
+	s.homes = filter(s.homes, func(h models.Home) bool { return !deletedHomes[h.ID] })
+	s.homeUsers = filter(s.homeUsers, func(hu models.HomeUser) bool { return hu.UserID != id && !deletedHomes[hu.HomeID] })
+	s.roles = filter(s.roles, func(r models.Role) bool { return !inDeletedHome(r.HomeID) })
+	s.spaces = filter(s.spaces, func(sp models.Space) bool { return !deletedHomes[sp.HomeID] })
+	s.invitations = filter(s.invitations, func(inv models.HomeInvitation) bool {
+		return !deletedHomes[inv.HomeID] && inv.InvitedBy != id && (inv.UserID == nil || *inv.UserID != id) && s.roleExists(inv.RoleID)
+	})
+	s.orgMembers = filter(s.orgMembers, func(m models.OrgMember) bool { return m.UserID != id })
+	s.policies = filter(s.policies, func(p models.RetentionPolicy) bool { return !inDeletedHome(p.HomeID) })
+	s.analytics = filter(s.analytics, func(a models.DeviceAnalytics) bool {
+		return !inDeletedHome(a.HomeID) && !ownedDevices[a.DeviceID]
+	})
+	s.readings = filter(s.readings, func(r models.DeviceData) bool { return !ownedDevices[r.DeviceID] })
+	for i, r := range s.readings {
+		if inDeletedHome(r.HomeID) {
+			s.readings[i].HomeID = nil
+		}
+	}
+	s.transfers = filter(s.transfers, func(t models.DeviceTransfer) bool {
+		return t.FromUserID != id && t.ToUserID != id && !ownedDevices[t.DeviceID]
+	})
+	s.tags = filter(s.tags, func(t deviceTag) bool { return !ownedDevices[t.deviceID] })
+	deletedGroups := make(map[int]bool)
+	for _, g := range s.groups {
+		if deletedHomes[g.HomeID] {
+			deletedGroups[g.ID] = true
+		}
+	}
+	s.groups = filter(s.groups, func(g models.DeviceGroup) bool { return !deletedGroups[g.ID] })
+	s.members = filter(s.members, func(m groupMember) bool { return !deletedGroups[m.groupID] && !ownedDevices[m.deviceID] })
+	deletedJobs := make(map[int]bool)
+	for _, j := range s.jobs {
+		if deletedHomes[j.HomeID] {
+			deletedJobs[j.ID] = true
+		}
+	}
+	s.jobs = filter(s.jobs, func(j deviceJob) bool { return !deletedJobs[j.ID] })
+	s.results = filter(s.results, func(r models.DeviceJobResult) bool { return !deletedJobs[r.JobID] })
+	for i, j := range s.jobs {
+		if j.CreatedBy != nil && *j.CreatedBy == id {
+			s.jobs[i].CreatedBy = nil
+		}
+		if j.GroupID != nil && deletedGroups[*j.GroupID] {
+			s.jobs[i].GroupID = nil
+		}
+	}
+	s.devices = filter(s.devices, func(d models.Device) bool { return d.UserID != id })
+	for i, d := range s.devices {
+		if inDeletedHome(d.HomeID) {
+			s.devices[i].HomeID = nil
+			s.devices[i].SpaceID = nil
+		}
+	}
+	s.tokens = filter(s.tokens, func(t models.UserToken) bool { return t.UserID != id })
+	s.apiKeys = filter(s.apiKeys, func(k models.APIKey) bool { return k.ServiceAccountID != id })
+	s.identities = filter(s.identities, func(i models.UserIdentity) bool { return i.UserID != id })
+	s.mfa = filter(s.mfa, func(m models.UserMFA) bool { return m.UserID != id })
+	s.codes = filter(s.codes, func(c recoveryCode) bool { return c.userID != id })
+	s.users = filter(s.users, func(u models.User) bool { return u.ID != id })
+}
+
+func (s *Store) GetServiceAccounts(ctx context.Context, ownerID int) ([]models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accounts []models.User
+	for _, u := range s.users {
+		if u.OwnerID != nil && *u.OwnerID == ownerID {
+			accounts = append(accounts, u)
+		}
+	}
+	return accounts, nil
+}
+
+func (s *Store) AddAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if !s.userExists(key.ServiceAccountID) {
+		err = violation(codeForeignKeyViolation, "api_keys", "api_keys_service_account_id_fkey")
+	}
+	for _, k := range s.apiKeys {
+		if k.KeyHash == key.KeyHash {
+			err = violation(codeUniqueViolation, "api_keys", "api_keys_key_hash_key")
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding API key %s: %w", key.Name, repositories.DBError(err, "API key"))
+	}
+	key.ID = s.nextID("api_keys")
+	key.CreatedAt = s.Now()
+	s.apiKeys = append(s.apiKeys, key)
+	return key.ID, nil
+}
+
+func (s *Store) GetAPIKeyByID(ctx context.Context, id int) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return models.APIKey{}, fmt.Errorf("error finding API key %d: %w", id, repositories.DBError(pgx.ErrNoRows, "API key"))
+}
+
+func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.KeyHash == keyHash {
+			return k, nil
+		}
+	}
+	return models.APIKey{}, fmt.Errorf("error finding API key by hash: %w", repositories.DBError(pgx.ErrNoRows, "API key"))
+}
+
+func (s *Store) GetAPIKeys(ctx context.Context, serviceAccountID int) ([]models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []models.APIKey
+	for _, k := range s.apiKeys {
+		if k.ServiceAccountID == serviceAccountID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		if s.apiKeys[i].ID != id {
+			continue
+		}
+		if s.apiKeys[i].RevokedAt == nil {
+			s.apiKeys[i].RevokedAt = &now
+		}
+		return nil
+	}
+	return fmt.Errorf("error revoking API key %d: %w", id, repositories.DBError(pgx.ErrNoRows, "API key"))
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, id int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		if s.apiKeys[i].ID == id {
+			s.apiKeys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddSSOLogin(ctx context.Context, login models.SSOLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	s.ssoLogins = filter(s.ssoLogins, func(l models.SSOLogin) bool { return !l.ExpiresAt.Before(now) })
+	for _, l := range s.ssoLogins {
+		if l.StateHash == login.StateHash {
+			return fmt.Errorf("error adding SSO login with %s: %w", login.Provider, repositories.DBError(violation(codeUniqueViolation, "sso_logins", "sso_logins_state_hash_key"), "login"))
+		}
+	}
+	login.ID = s.nextID("sso_logins")
+	s.ssoLogins = append(s.ssoLogins, login)
+	return nil
+}
+
+func (s *Store) ConsumeSSOLogin(ctx context.Context, stateHash string, now time.Time) (models.SSOLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, l := range s.ssoLogins {
+		if l.StateHash == stateHash && l.ExpiresAt.After(now) {
+			s.ssoLogins = append(s.ssoLogins[:i], s.ssoLogins[i+1:]...)
+			return l, nil
+		}
+	}
+	return models.SSOLogin{}, fmt.Errorf("error consuming SSO login: %w", repositories.DBError(pgx.ErrNoRows, "login"))
+}
+
+func (s *Store) AddUserIdentity(ctx context.Context, identity models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if !s.userExists(identity.UserID) {
+		err = violation(codeForeignKeyViolation, "user_identities", "user_identities_user_id_fkey")
+	}
+	for _, i := range s.identities {
+		if i.Provider == identity.Provider && i.Subject == identity.Subject {
+			err = violation(codeUniqueViolation, "user_identities", "user_identities_provider_subject_key")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error adding %s identity of user %d: %w", identity.Provider, identity.UserID, repositories.DBError(err, "identity"))
+	}
+	identity.ID = s.nextID("user_identities")
+	identity.CreatedAt = s.Now()
+	s.identities = append(s.identities, identity)
+	return nil
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, provider, subject string) (models.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, i := range s.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return models.UserIdentity{}, fmt.Errorf("error finding %s identity: %w", provider, repositories.DBError(pgx.ErrNoRows, "identity"))
+}
+
+// recoveryCode is a row of mfa_recovery_codes, which has no model because
+// the codes never leave the MFA store.
+type recoveryCode struct {
+	userID   int
+	codeHash string
+	usedAt   *time.Time
+}
+
+func (s *Store) SetMFASecret(ctx context.Context, userID int, sealedSecret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userExists(userID) {
+		return fmt.Errorf("error saving MFA secret of user %d: %w", userID, repositories.DBError(violation(codeForeignKeyViolation, "user_mfa", "user_mfa_user_id_fkey"), "MFA enrollment"))
+	}
+	for i, m := range s.mfa {
+		if m.UserID != userID {
+			continue
+		}
+		if m.EnabledAt == nil {
+			s.mfa[i] = models.UserMFA{UserID: userID, SealedSecret: sealedSecret, CreatedAt: s.Now()}
+		}
+		return nil
+	}
+	s.mfa = append(s.mfa, models.UserMFA{UserID: userID, SealedSecret: sealedSecret, CreatedAt: s.Now()})
+	return nil
+}
+
+func (s *Store) GetMFA(ctx context.Context, userID int) (models.UserMFA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.mfa {
+		if m.UserID == userID {
+			return m, nil
+		}
+	}
+	return models.UserMFA{}, fmt.Errorf("error finding MFA enrollment of user %d: %w", userID, repositories.DBError(pgx.ErrNoRows, "MFA enrollment"))
+}
+
+func (s *Store) EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.mfa {
+		m := &s.mfa[i]
+		if m.UserID != userID || m.EnabledAt != nil {
+			continue
+		}
+		enabledAt := now
+		m.EnabledAt = &enabledAt
+		m.LastStep = step
+		for j := range s.users {
+			if s.users[j].ID == userID {
+				s.users[j].MFAEnabled = true
+				s.users[j].TokenVersion++
+			}
+		}
+		s.replaceRecoveryCodes(userID, codeHashes)
+		return nil
+	}
+	return fmt.Errorf("error enabling MFA for user %d: %w", userID, repositories.DBError(pgx.ErrNoRows, "MFA enrollment"))
+}
+
+func (s *Store) DisableMFA(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mfa = filter(s.mfa, func(m models.UserMFA) bool { return m.UserID != userID })
+	s.codes = filter(s.codes, func(c recoveryCode) bool { return c.userID != userID })
+	for i := range s.users {
+		if s.users[i].ID == userID && s.users[i].MFAEnabled {
+			s.users[i].MFAEnabled = false
+			s.users[i].TokenVersion++
+		}
+	}
+	return nil
+}
+
+func (s *Store) UseMFAStep(ctx context.Context, userID int, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.mfa {
+		if s.mfa[i].UserID == userID && s.mfa[i].LastStep < step {
+			s.mfa[i].LastStep = step
+			return nil
+		}
+	}
+	return fmt.Errorf("error using MFA code of user %d: %w", userID, repositories.DBError(pgx.ErrNoRows, "MFA code"))
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userID int, codeHash string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, c := range s.codes {
+		if c.userID == userID && c.codeHash == codeHash && c.usedAt == nil {
+			usedAt := now
+			s.codes[i].usedAt = &usedAt
+			return nil
+		}
+	}
+	return fmt.Errorf("error using recovery code of user %d: %w", userID, repositories.DBError(pgx.ErrNoRows, "recovery code"))
+}
+
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userExists(userID) {
+		return fmt.Errorf("error replacing recovery codes of user %d: %w", userID, repositories.DBError(violation(codeForeignKeyViolation, "mfa_recovery_codes", "mfa_recovery_codes_user_id_fkey"), "recovery code"))
+	}
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (s *Store) replaceRecoveryCodes(userID int, codeHashes []string) {
+	s.codes = filter(s.codes, func(c recoveryCode) bool { return c.userID != userID })
+	for _, hash := range codeHashes {
+		s.codes = append(s.codes, recoveryCode{userID: userID, codeHash: hash})
+	}
+}
+
+// homeHeir returns the earliest member of the home other than userID whose
+// role may manage it,
+// or else the earliest other owner, then admin, of the home's organization.
+func (s *Store) homeHeir(homeID, userID int) (int, bool) {
+	for _, hu := range s.homeUsers {
+		if hu.HomeID != homeID || hu.UserID == userID {
+			continue
+		}
+		if s.role(hu.RoleID).Can(models.PermHomeManage) {
+			return hu.UserID, true
+		}
+	}
+	var orgID *int
+	for _, h := range s.homes {
+		if h.ID == homeID {
+			orgID = h.OrgID
+		}
+	}
+	if orgID == nil {
+		return 0, false
+	}
+	for _, role := range []string{models.OrgRoleOwner, models.OrgRoleAdmin} {
+		for _, m := range s.orgMembers {
+			if m.OrgID == *orgID && m.UserID != userID && m.Role == role {
+				return m.UserID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (s *Store) AddUserToken(ctx context.Context, token models.UserToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userExists(token.UserID) {
+		return fmt.Errorf("error adding %s token for user %d: %w", token.Purpose, token.UserID, repositories.DBError(violation(codeForeignKeyViolation, "user_tokens", "user_tokens_user_id_fkey"), "token"))
+	}
+	for _, t := range s.tokens {
+		if t.TokenHash == token.TokenHash {
+			return fmt.Errorf("error adding %s token for user %d: %w", token.Purpose, token.UserID, repositories.DBError(violation(codeUniqueViolation, "user_tokens", "user_tokens_token_hash_key"), "token"))
+		}
+	}
+	token.ID = s.nextID("user_tokens")
+	token.UsedAt = nil
+	s.tokens = append(s.tokens, token)
+	return nil
+}
+
+func (s *Store) ConsumeUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.tokens {
+		if t.Purpose != purpose || t.TokenHash != tokenHash || t.UsedAt != nil || !t.ExpiresAt.After(now) {
+			continue
+		}
+		usedAt := now
+		s.tokens[i].UsedAt = &usedAt
+		return s.tokens[i], nil
+	}
+	return models.UserToken{}, fmt.Errorf("error consuming %s token: %w", purpose, repositories.DBError(pgx.ErrNoRows, "token"))
+}
+
+func (s *Store) GetUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.Purpose == purpose && t.TokenHash == tokenHash && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			return t, nil
+		}
+	}
+	return models.UserToken{}, fmt.Errorf("error finding %s token: %w", purpose, repositories.DBError(pgx.ErrNoRows, "token"))
+}
+
+func (s *Store) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = filter(s.tokens, func(t models.UserToken) bool { return t.UserID != userID || t.Purpose != purpose })
+	return nil
+}
+
+func (s *Store) GetRoleByName(ctx context.Context, roleName string) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.roles {
+		if r.Name == roleName && r.HomeID == nil {
+			return cloneRole(r), nil
+		}
+	}
+	return models.Role{}, fmt.Errorf("error finding role by name %s: %w", roleName, repositories.DBError(pgx.ErrNoRows, "role"))
+}
+
+func (s *Store) GetRoleByID(ctx context.Context, id int) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.roleExists(id) {
+		return models.Role{}, fmt.Errorf("error finding role %d: %w", id, repositories.DBError(pgx.ErrNoRows, "role"))
+	}
+	return cloneRole(s.role(id)), nil
+}
+
+func (s *Store) GetHomeRole(ctx context.Context, homeID int, roleName string) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.roles {
+		if r.Name == roleName && (r.HomeID == nil || *r.HomeID == homeID) {
+			return cloneRole(r), nil
+		}
+	}
+	return models.Role{}, fmt.Errorf("error finding role %s of home %d: %w", roleName, homeID, repositories.DBError(pgx.ErrNoRows, "role"))
+}
+
+func (s *Store) GetHomeRoles(ctx context.Context, homeID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var builtIn, custom []models.Role
+	for _, r := range s.roles {
+		switch {
+		case r.HomeID == nil:
+			builtIn = append(builtIn, cloneRole(r))
+		case *r.HomeID == homeID:
+			custom = append(custom, cloneRole(r))
+		}
+	}
+	return append(builtIn, custom...), nil
+}
+
+func (s *Store) AddRole(ctx context.Context, role models.Role) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case role.HomeID != nil && !s.homeExists(*role.HomeID):
+		err = violation(codeForeignKeyViolation, "roles", "roles_home_id_fkey")
+	case s.roleNameTaken(role):
+		err = violation(codeUniqueViolation, "roles", "roles_name_key")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding role %s: %w", role.Name, repositories.DBError(err, "role"))
+	}
+	role = cloneRole(role)
+	role.ID = s.nextID("roles")
+	s.roles = append(s.roles, role)
+	return role.ID, nil
+}
+
+func (s *Store) UpdateRole(ctx context.Context, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.roles {
+		if r.ID != role.ID || r.HomeID == nil {
+			continue
+		}
+		role.HomeID = r.HomeID
+		if s.roleNameTaken(role) {
+			err := violation(codeUniqueViolation, "roles", "roles_name_key")
+			return fmt.Errorf("error updating role %d: %w", role.ID, repositories.DBError(err, "role"))
+		}
+		s.roles[i].Name = role.Name
+		s.roles[i].Permissions = slices.Clone(role.Permissions)
+		return nil
+	}
+	return fmt.Errorf("error updating role %d: %w", role.ID, repositories.DBError(pgx.ErrNoRows, "role"))
+}
+
+func (s *Store) DeleteRole(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.roles, func(r models.Role) bool { return r.ID == id && r.HomeID != nil })
+	if i < 0 {
+		return fmt.Errorf("error deleting role %d: %w", id, repositories.DBError(pgx.ErrNoRows, "role"))
+	}
+	if slices.ContainsFunc(s.homeUsers, func(hu models.HomeUser) bool { return hu.RoleID == id }) {
+		err := violation(codeForeignKeyViolation, "home_users", "home_users_role_id_fkey")
+		return fmt.Errorf("error deleting role %d: %w", id, repositories.DBError(err, "role"))
+	}
+	s.roles = slices.Delete(s.roles, i, i+1)
+	s.invitations = filter(s.invitations, func(inv models.HomeInvitation) bool { return inv.RoleID != id })
+	return nil
+}
+
+func (s *Store) CountRoleMembers(ctx context.Context, id int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, hu := range s.homeUsers {
+		if hu.RoleID == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) AddInvitation(ctx context.Context, inv models.HomeInvitation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case !s.homeExists(inv.HomeID):
+		err = violation(codeForeignKeyViolation, "home_invitations", "home_invitations_home_id_fkey")
+	case inv.UserID != nil && !s.userExists(*inv.UserID):
+		err = violation(codeForeignKeyViolation, "home_invitations", "home_invitations_user_id_fkey")
+	case !s.roleExists(inv.RoleID):
+		err = violation(codeForeignKeyViolation, "home_invitations", "home_invitations_role_id_fkey")
+	case !s.userExists(inv.InvitedBy):
+		err = violation(codeForeignKeyViolation, "home_invitations", "home_invitations_invited_by_fkey")
+	case slices.ContainsFunc(s.invitations, func(i models.HomeInvitation) bool {
+		return i.HomeID == inv.HomeID && strings.EqualFold(i.Email, inv.Email) && i.Status == models.InvitationPending
+	}):
+		err = violation(codeUniqueViolation, "home_invitations", "home_invitations_email_key")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding invitation to home %d: %w", inv.HomeID, repositories.DBError(err, "home invitation"))
+	}
+	inv.ID = s.nextID("home_invitations")
+	inv.Status = models.InvitationPending
+	inv.CreatedAt = s.Now()
+	inv.RespondedAt = nil
+	s.invitations = append(s.invitations, inv)
+	return inv.ID, nil
+}
+
+func (s *Store) GetInvitationByID(ctx context.Context, id int) (models.HomeInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, inv := range s.invitations {
+		if inv.ID == id {
+			return s.withNames(inv), nil
+		}
+	}
+	return models.HomeInvitation{}, fmt.Errorf("error finding invitation %d: %w", id, repositories.DBError(pgx.ErrNoRows, "invitation"))
+}
+
+func (s *Store) GetPendingHomeInvitations(ctx context.Context, homeID int) ([]models.HomeInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var invitations []models.HomeInvitation
+	for _, inv := range s.invitations {
+		if inv.HomeID == homeID && inv.Status == models.InvitationPending {
+			invitations = append(invitations, s.withNames(inv))
+		}
+	}
+	return invitations, nil
+}
+
+func (s *Store) GetPendingUserInvitations(ctx context.Context, userID int, email string) ([]models.HomeInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var invitations []models.HomeInvitation
+	for _, inv := range s.invitations {
+		if inv.Status != models.InvitationPending {
+			continue
+		}
+		if inv.UserID != nil && *inv.UserID == userID || inv.UserID == nil && email != "" && strings.EqualFold(inv.Email, email) {
+			invitations = append(invitations, s.withNames(inv))
+		}
+	}
+	return invitations, nil
+}
+
+func (s *Store) RespondToInvitation(ctx context.Context, id int, status string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, inv := range s.invitations {
+		if inv.ID == id && inv.Status == models.InvitationPending {
+			s.invitations[i].Status = status
+			s.invitations[i].RespondedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("error answering invitation %d: %w", id, repositories.DBError(pgx.ErrNoRows, "invitation"))
+}
+
+func (s *Store) AddOrganization(ctx context.Context, org models.Organization, ownerID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case !s.userExists(ownerID):
+		err = violation(codeForeignKeyViolation, "organization_members", "organization_members_user_id_fkey")
+	case slices.ContainsFunc(s.orgs, func(o models.Organization) bool { return o.Name == org.Name }):
+		err = violation(codeUniqueViolation, "organizations", "organizations_name_key")
+	case quotaNegative(org.MaxHomes):
+		err = violation(codeCheckViolation, "organizations", "organizations_max_homes_check")
+	case quotaNegative(org.MaxDevices):
+		err = violation(codeCheckViolation, "organizations", "organizations_max_devices_check")
+	case quotaNegative(org.MaxMembers):
+		err = violation(codeCheckViolation, "organizations", "organizations_max_members_check")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding organization %s: %w", org.Name, repositories.DBError(err, "organization"))
+	}
+	if org.Plan == "" {
+		org.Plan = "free"
+	}
+	org.ID = s.nextID("organizations")
+	org.CreatedAt = s.Now()
+	s.orgs = append(s.orgs, org)
+	s.orgMembers = append(s.orgMembers, models.OrgMember{OrgID: org.ID, UserID: ownerID, Role: models.OrgRoleOwner, CreatedAt: org.CreatedAt})
+	return org.ID, nil
+}
+
+func (s *Store) GetOrganizationByID(ctx context.Context, id int) (models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.orgs {
+		if o.ID == id {
+			return o, nil
+		}
+	}
+	return models.Organization{}, fmt.Errorf("error finding organization %d: %w", id, repositories.DBError(pgx.ErrNoRows, "organization"))
+}
+
+func (s *Store) UpdateOrganization(ctx context.Context, org models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.orgs, func(o models.Organization) bool { return o.Name == org.Name && o.ID != org.ID }) {
+		err := violation(codeUniqueViolation, "organizations", "organizations_name_key")
+		return fmt.Errorf("error updating organization %d: %w", org.ID, repositories.DBError(err, "organization"))
+	}
+	for i := range s.orgs {
+		if s.orgs[i].ID == org.ID {
+			s.orgs[i].Name = org.Name
+			s.orgs[i].BillingEmail = org.BillingEmail
+			return nil
+		}
+	}
+	return fmt.Errorf("error updating organization %d: %w", org.ID, repositories.DBError(pgx.ErrNoRows, "organization"))
+}
+
+func (s *Store) GetOrgMember(ctx context.Context, orgID, userID int) (models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.orgMembers {
+		if m.OrgID == orgID && m.UserID == userID {
+			return m, nil
+		}
+	}
+	return models.OrgMember{}, fmt.Errorf("error finding member %d of organization %d: %w", userID, orgID, repositories.DBError(pgx.ErrNoRows, "organization member"))
+}
+
+func (s *Store) GetOrgMembers(ctx context.Context, orgID int) ([]models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []models.OrgMember
+	for _, m := range s.orgMembers {
+		if m.OrgID == orgID {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+func (s *Store) GetUserOrgMembers(ctx context.Context, userID int) ([]models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []models.OrgMember
+	for _, m := range s.orgMembers {
+		if m.UserID == userID {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].OrgID < members[j].OrgID })
+	return members, nil
+}
+
+func (s *Store) SetOrgMember(ctx context.Context, member models.OrgMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case !s.orgExists(member.OrgID):
+		err = violation(codeForeignKeyViolation, "organization_members", "organization_members_org_id_fkey")
+	case !s.userExists(member.UserID):
+		err = violation(codeForeignKeyViolation, "organization_members", "organization_members_user_id_fkey")
+	case !slices.Contains(models.OrgRoles, member.Role):
+		err = violation(codeCheckViolation, "organization_members", "organization_members_role_check")
+	}
+	if err != nil {
+		return fmt.Errorf("error setting member %d of organization %d: %w", member.UserID, member.OrgID, repositories.DBError(err, "organization member"))
+	}
+	for i, m := range s.orgMembers {
+		if m.OrgID == member.OrgID && m.UserID == member.UserID {
+			s.orgMembers[i].Role = member.Role
+			return nil
+		}
+	}
+	member.CreatedAt = s.Now()
+	s.orgMembers = append(s.orgMembers, member)
+	return nil
+}
+
+func (s *Store) RemoveOrgMember(ctx context.Context, orgID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.orgMembers)
+	s.orgMembers = filter(s.orgMembers, func(m models.OrgMember) bool { return m.OrgID != orgID || m.UserID != userID })
+	if len(s.orgMembers) == n {
+		return fmt.Errorf("error removing member %d of organization %d: %w", userID, orgID, repositories.DBError(pgx.ErrNoRows, "organization member"))
+	}
+	return nil
+}
+
+func (s *Store) GetOrgUsage(ctx context.Context, orgID int) (models.OrgUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usage models.OrgUsage
+	homes := make(map[int]bool)
+	for _, h := range s.homes {
+		if h.OrgID != nil && *h.OrgID == orgID {
+			homes[h.ID] = true
+			usage.Homes++
+		}
+	}
+	for _, d := range s.devices {
+		if d.HomeID != nil && homes[*d.HomeID] {
+			usage.Devices++
+		}
+	}
+	for _, m := range s.orgMembers {
+		if m.OrgID == orgID {
+			usage.Members++
+		}
+	}
+	return usage, nil
+}
+
+func (s *Store) AddHome(ctx context.Context, home models.Home) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userExists(home.UserID) {
+		return 0, fmt.Errorf("error adding home %s: %w", home.HomeName, repositories.DBError(violation(codeForeignKeyViolation, "homes", "homes_user_id_fkey"), "home"))
+	}
+	if home.OrgID != nil && !s.orgExists(*home.OrgID) {
+		return 0, fmt.Errorf("error adding home %s: %w", home.HomeName, repositories.DBError(violation(codeForeignKeyViolation, "homes", "homes_org_id_fkey"), "home"))
+	}
+	home.ID = s.nextID("homes")
+	home.CreatedAt = s.Now()
+	s.homes = append(s.homes, home)
+	return home.ID, nil
+}
+
+func (s *Store) GetHomeByID(ctx context.Context, id int) (models.Home, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.homes {
+		if h.ID == id {
+			return h, nil
+		}
+	}
+	return models.Home{}, fmt.Errorf("error finding home %d: %w", id, repositories.DBError(pgx.ErrNoRows, "home"))
+}
+
+func (s *Store) SetHomeRequireMFA(ctx context.Context, id int, require bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.homes {
+		if s.homes[i].ID == id {
+			s.homes[i].RequireMFA = require
+			return nil
+		}
+	}
+	return fmt.Errorf("error updating home %d: %w", id, repositories.DBError(pgx.ErrNoRows, "home"))
+}
+
+func (s *Store) GetHomesByUserID(ctx context.Context, userID int) ([]models.Home, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var homes []models.Home
+	for _, h := range s.homes {
+		if h.UserID == userID {
+			homes = append(homes, h)
+		}
+	}
+	return homes, nil
+}
+
+func (s *Store) GetHomesByOrgID(ctx context.Context, orgID int) ([]models.Home, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var homes []models.Home
+	for _, h := range s.homes {
+		if h.OrgID != nil && *h.OrgID == orgID {
+			homes = append(homes, h)
+		}
+	}
+	return homes, nil
+}
+
+func (s *Store) AddUserToHome(ctx context.Context, homeUser models.HomeUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var constraint string
+	switch {
+	case !s.homeExists(homeUser.HomeID):
+		constraint = "home_users_home_id_fkey"
+	case !s.userExists(homeUser.UserID):
+		constraint = "home_users_user_id_fkey"
+	case !s.roleExists(homeUser.RoleID):
+		constraint = "home_users_role_id_fkey"
+	}
+	if constraint != "" {
+		err := violation(codeForeignKeyViolation, "home_users", constraint)
+		return fmt.Errorf("error adding user %d to home %d: %w", homeUser.UserID, homeUser.HomeID, repositories.DBError(err, "home member"))
+	}
+	s.homeUsers = append(s.homeUsers, homeUser)
+	return nil
+}
+
+func (s *Store) GetHomeUserRole(ctx context.Context, homeID, userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, hu := range s.homeUsers {
+		if hu.HomeID == homeID && hu.UserID == userID {
+			return hu.RoleID, nil
+		}
+	}
+	return 0, fmt.Errorf("error finding role for user %d in home %d: %w", userID, homeID, repositories.DBError(pgx.ErrNoRows, "home member"))
+}
+
+func (s *Store) AddDevice(ctx context.Context, device models.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkDevice(device, -1); err != nil {
+		return fmt.Errorf("error adding device %s: %w", device.DeviceID, err)
+	}
+	device.ID = s.nextID("devices")
+	s.devices = append(s.devices, device)
+	return nil
+}
+
+func (s *Store) SetDeviceActive(ctx context.Context, deviceID string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.devices, func(d models.Device) bool { return d.DeviceID == deviceID && d.IsActive != active })
+	if i < 0 {
+		return fmt.Errorf("error updating device %s: %w", deviceID, repositories.Changed("device"))
+	}
+	s.devices[i].IsActive = active
+	return nil
+}
+
+func (s *Store) SetDeviceHome(ctx context.Context, deviceID string, ownerID int, from, to *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.devices, func(d models.Device) bool {
+		return d.DeviceID == deviceID && d.UserID == ownerID && sameID(d.HomeID, from)
+	})
+	if i < 0 {
+		return fmt.Errorf("error moving device %s: %w", deviceID, repositories.Changed("device"))
+	}
+	device := s.devices[i]
+	if !sameID(device.HomeID, to) {
+		device.SpaceID = nil
+	}
+	device.HomeID = to
+	if err := s.checkDevice(device, i); err != nil {
+		return fmt.Errorf("error moving device %s: %w", deviceID, err)
+	}
+	s.devices[i] = device
+	return nil
+}
+
+func (s *Store) SetDeviceSpace(ctx context.Context, deviceID string, homeID int, spaceID *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.devices, func(d models.Device) bool {
+		return d.DeviceID == deviceID && d.HomeID != nil && *d.HomeID == homeID
+	})
+	if i < 0 {
+		return fmt.Errorf("error placing device %s: %w", deviceID, repositories.Changed("device"))
+	}
+	device := s.devices[i]
+	device.SpaceID = spaceID
+	if err := s.checkDevice(device, i); err != nil {
+		return fmt.Errorf("error placing device %s: %w", deviceID, err)
+	}
+	s.devices[i] = device
+	return nil
+}
+
+func (s *Store) GetDeviceByID(ctx context.Context, deviceID string) (models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.devices {
+		if d.DeviceID == deviceID {
+			return d, nil
+		}
+	}
+	return models.Device{}, fmt.Errorf("error finding device by ID %s: %w", deviceID, repositories.DBError(pgx.ErrNoRows, "device"))
+}
+
+func (s *Store) GetDeviceByChannel(ctx context.Context, channelID string) (models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.devices {
+		if d.ChannelID == channelID {
+			return d, nil
+		}
+	}
+	return models.Device{}, fmt.Errorf("error finding device by channel ID %s: %w", channelID, repositories.DBError(pgx.ErrNoRows, "device"))
+}
+
+func (s *Store) GetDevicesByUserID(ctx context.Context, userID int) ([]models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var devices []models.Device
+	for _, d := range s.devices {
+		if d.UserID == userID {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (s *Store) GetActiveChannels(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var channels []string
+	for _, d := range s.devices {
+		if d.IsActive {
+			channels = append(channels, d.ChannelID)
+		}
+	}
+	return channels, nil
+}
+
+func (s *Store) GetDevicesByHomeID(ctx context.Context, homeID int) ([]models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var devices []models.Device
+	for _, d := range s.devices {
+		if d.HomeID != nil && *d.HomeID == homeID {
+			devices = append(devices, d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	return devices, nil
+}
+
+func (s *Store) AddSpace(ctx context.Context, space models.Space) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkSpace(space); err != nil {
+		return 0, fmt.Errorf("error adding space %s to home %d: %w", space.Name, space.HomeID, repositories.DBError(err, "space"))
+	}
+	space.ID = s.nextID("spaces")
+	space.CreatedAt = s.Now()
+	s.spaces = append(s.spaces, space)
+	return space.ID, nil
+}
+
+func (s *Store) GetSpaceByID(ctx context.Context, id int) (models.Space, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sp := range s.spaces {
+		if sp.ID == id {
+			return sp, nil
+		}
+	}
+	return models.Space{}, fmt.Errorf("error finding space %d: %w", id, repositories.DBError(pgx.ErrNoRows, "space"))
+}
+
+func (s *Store) GetHomeSpaces(ctx context.Context, homeID int) ([]models.Space, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var spaces []models.Space
+	for _, sp := range s.spaces {
+		if sp.HomeID == homeID {
+			spaces = append(spaces, sp)
+		}
+	}
+	return spaces, nil
+}
+
+func (s *Store) UpdateSpace(ctx context.Context, space models.Space) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.spaces, func(sp models.Space) bool { return sp.ID == space.ID })
+	if i < 0 {
+		return fmt.Errorf("error updating space %d: %w", space.ID, repositories.DBError(pgx.ErrNoRows, "space"))
+	}
+	updated := s.spaces[i]
+	updated.ParentID, updated.Name, updated.Kind = space.ParentID, space.Name, space.Kind
+	if err := s.checkSpace(updated); err != nil {
+		return fmt.Errorf("error updating space %d: %w", space.ID, repositories.DBError(err, "space"))
+	}
+	s.spaces[i] = updated
+	return nil
+}
+
+func (s *Store) DeleteSpace(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.spaces, func(sp models.Space) bool { return sp.ID == id })
+	if i < 0 {
+		return fmt.Errorf("error deleting space %d: %w", id, repositories.DBError(pgx.ErrNoRows, "space"))
+	}
+	if slices.ContainsFunc(s.spaces, func(sp models.Space) bool { return sp.ParentID != nil && *sp.ParentID == id }) {
+		err := violation(codeForeignKeyViolation, "spaces", "spaces_parent_id_fkey")
+		return fmt.Errorf("error deleting space %d: %w", id, repositories.DBError(err, "space"))
+	}
+	s.spaces = slices.Delete(s.spaces, i, i+1)
+	for i, d := range s.devices {
+		if d.SpaceID != nil && *d.SpaceID == id {
+			s.devices[i].SpaceID = nil
+		}
+	}
+	return nil
+}
+
+// checkSpace enforces the constraints on spaces.
+func (s *Store) checkSpace(space models.Space) error {
+	switch {
+	case !s.homeExists(space.HomeID):
+		return violation(codeForeignKeyViolation, "spaces", "spaces_home_id_fkey")
+	case space.ParentID != nil && !s.spaceExists(*space.ParentID):
+		return violation(codeForeignKeyViolation, "spaces", "spaces_parent_id_fkey")
+	case !slices.Contains(models.SpaceKinds, space.Kind):
+		return violation(codeCheckViolation, "spaces", "spaces_kind_check")
+	}
+	taken := slices.ContainsFunc(s.spaces, func(sp models.Space) bool {
+		return sp.ID != space.ID && sp.HomeID == space.HomeID && sp.Name == space.Name &&
+			(sp.ParentID == nil && space.ParentID == nil || sp.ParentID != nil && space.ParentID != nil && *sp.ParentID == *space.ParentID)
+	})
+	if taken {
+		return violation(codeUniqueViolation, "spaces", "spaces_name_key")
+	}
+	return nil
+}
+
+func (s *Store) AddDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case !slices.ContainsFunc(s.devices, func(d models.Device) bool { return d.DeviceID == transfer.DeviceID }):
+		err = violation(codeForeignKeyViolation, "device_transfers", "device_transfers_device_id_fkey")
+	case !s.userExists(transfer.FromUserID):
+		err = violation(codeForeignKeyViolation, "device_transfers", "device_transfers_from_user_id_fkey")
+	case !s.userExists(transfer.ToUserID):
+		err = violation(codeForeignKeyViolation, "device_transfers", "device_transfers_to_user_id_fkey")
+	case transfer.FromUserID == transfer.ToUserID:
+		err = violation(codeCheckViolation, "device_transfers", "device_transfers_check")
+	case slices.ContainsFunc(s.transfers, func(t models.DeviceTransfer) bool {
+		return t.DeviceID == transfer.DeviceID && t.Status == models.TransferPending
+	}):
+		err = violation(codeUniqueViolation, "device_transfers", "device_transfers_device_id_key")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding transfer of device %s: %w", transfer.DeviceID, repositories.DBError(err, "device transfer"))
+	}
+	transfer.ID = s.nextID("device_transfers")
+	transfer.Status = models.TransferPending
+	transfer.CreatedAt = s.Now()
+	transfer.RespondedAt = nil
+	s.transfers = append(s.transfers, transfer)
+	return transfer.ID, nil
+}
+
+func (s *Store) GetDeviceTransferByID(ctx context.Context, id int) (models.DeviceTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.transfers {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return models.DeviceTransfer{}, fmt.Errorf("error finding device transfer %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device transfer"))
+}
+
+func (s *Store) GetPendingUserTransfers(ctx context.Context, userID int) ([]models.DeviceTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transfers []models.DeviceTransfer
+	for _, t := range s.transfers {
+		if t.Status == models.TransferPending && (t.FromUserID == userID || t.ToUserID == userID) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+
+func (s *Store) GetAcceptedDeviceTransfers(ctx context.Context, deviceID string) ([]models.DeviceTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transfers []models.DeviceTransfer
+	for _, t := range s.transfers {
+		if t.DeviceID == deviceID && t.Status == models.TransferAccepted {
+			transfers = append(transfers, t)
+		}
+	}
+	sort.SliceStable(transfers, func(i, j int) bool { return transfers[i].RespondedAt.Before(*transfers[j].RespondedAt) })
+	return transfers, nil
+}
+
+func (s *Store) RespondToDeviceTransfer(ctx context.Context, id int, status string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.transfers {
+		if t.ID == id && t.Status == models.TransferPending {
+			s.transfers[i].Status = status
+			s.transfers[i].RespondedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("error answering device transfer %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device transfer"))
+}
+
+func (s *Store) AcceptDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer, channelID string, since, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fail := func(err error) error {
+		return fmt.Errorf("error accepting device transfer %d: %w", transfer.ID, repositories.DBError(err, "device transfer"))
+	}
+	t := slices.IndexFunc(s.transfers, func(t models.DeviceTransfer) bool {
+		return t.ID == transfer.ID && t.Status == models.TransferPending
+	})
+	d := slices.IndexFunc(s.devices, func(d models.Device) bool {
+		return d.DeviceID == transfer.DeviceID && d.UserID == transfer.FromUserID
+	})
+	if t < 0 || d < 0 {
+		return fail(pgx.ErrNoRows)
+	}
+	device := s.devices[d]
+	device.UserID = transfer.ToUserID
+	device.HomeID = nil
+	device.SpaceID = nil
+	device.ChannelID = channelID
+	if err := s.checkDevice(device, d); err != nil {
+		return fail(err)
+	}
+
+	s.transfers[t].Status = models.TransferAccepted
+	s.transfers[t].RespondedAt = &now
+	s.devices[d] = device
+	if !transfer.KeepTelemetry {
+		s.readings = filter(s.readings, func(r models.DeviceData) bool {
+			return r.DeviceID != transfer.DeviceID || r.CreatedAt.Before(since)
+		})
+		s.analytics = filter(s.analytics, func(a models.DeviceAnalytics) bool {
+			return a.DeviceID != transfer.DeviceID || a.Period.Before(since)
+		})
+	}
+	return nil
+}
+
+func (s *Store) SetDeviceTags(ctx context.Context, deviceID string, tags map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(tags) > 0 && !s.deviceExists(deviceID) {
+		err := violation(codeForeignKeyViolation, "device_tags", "device_tags_device_id_fkey")
+		return fmt.Errorf("error setting tags of device %s: %w", deviceID, repositories.DBError(err, "device"))
+	}
+	s.tags = filter(s.tags, func(t deviceTag) bool { return t.deviceID != deviceID })
+	for key, value := range tags {
+		s.tags = append(s.tags, deviceTag{deviceID: deviceID, key: key, value: value})
+	}
+	return nil
+}
+
+func (s *Store) GetDeviceTags(ctx context.Context, deviceID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tags map[string]string
+	for _, t := range s.tags {
+		if t.deviceID == deviceID {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[t.key] = t.value
+		}
+	}
+	return tags, nil
+}
+
+func (s *Store) GetHomeDeviceTags(ctx context.Context, homeID int) (map[string]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inHome := make(map[string]bool)
+	for _, d := range s.devices {
+		if d.HomeID != nil && *d.HomeID == homeID {
+			inHome[d.DeviceID] = true
+		}
+	}
+	tags := make(map[string]map[string]string)
+	for _, t := range s.tags {
+		if !inHome[t.deviceID] {
+			continue
+		}
+		if tags[t.deviceID] == nil {
+			tags[t.deviceID] = make(map[string]string)
+		}
+		tags[t.deviceID][t.key] = t.value
+	}
+	return tags, nil
+}
+
+func (s *Store) AddDeviceGroup(ctx context.Context, group models.DeviceGroup) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkDeviceGroup(group); err != nil {
+		return 0, fmt.Errorf("error adding device group %s to home %d: %w", group.Name, group.HomeID, repositories.DBError(err, "device group"))
+	}
+	group.ID = s.nextID("device_groups")
+	group.Selector = cloneSelector(group.Selector)
+	group.CreatedAt = s.Now()
+	s.groups = append(s.groups, group)
+	return group.ID, nil
+}
+
+func (s *Store) GetDeviceGroupByID(ctx context.Context, id int) (models.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, g := range s.groups {
+		if g.ID == id {
+			g.Selector = cloneSelector(g.Selector)
+			return g, nil
+		}
+	}
+	return models.DeviceGroup{}, fmt.Errorf("error finding device group %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device group"))
+}
+
+func (s *Store) GetHomeDeviceGroups(ctx context.Context, homeID int) ([]models.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []models.DeviceGroup
+	for _, g := range s.groups {
+		if g.HomeID == homeID {
+			g.Selector = cloneSelector(g.Selector)
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func (s *Store) UpdateDeviceGroup(ctx context.Context, group models.DeviceGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.groups, func(g models.DeviceGroup) bool { return g.ID == group.ID })
+	if i < 0 {
+		return fmt.Errorf("error updating device group %d: %w", group.ID, repositories.DBError(pgx.ErrNoRows, "device group"))
+	}
+	updated := s.groups[i]
+	updated.Name, updated.Selector = group.Name, cloneSelector(group.Selector)
+	if err := s.checkDeviceGroup(updated); err != nil {
+		return fmt.Errorf("error updating device group %d: %w", group.ID, repositories.DBError(err, "device group"))
+	}
+	s.groups[i] = updated
+	return nil
+}
+
+func (s *Store) DeleteDeviceGroup(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.groups, func(g models.DeviceGroup) bool { return g.ID == id })
+	if i < 0 {
+		return fmt.Errorf("error deleting device group %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device group"))
+	}
+	s.groups = slices.Delete(s.groups, i, i+1)
+	s.members = filter(s.members, func(m groupMember) bool { return m.groupID != id })
+	for i, j := range s.jobs {
+		if j.GroupID != nil && *j.GroupID == id {
+			s.jobs[i].GroupID = nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if !slices.ContainsFunc(s.groups, func(g models.DeviceGroup) bool { return g.ID == groupID }) {
+		err = violation(codeForeignKeyViolation, "device_group_members", "device_group_members_group_id_fkey")
+	}
+	for _, deviceID := range deviceIDs {
+		if err == nil && !s.deviceExists(deviceID) {
+			err = violation(codeForeignKeyViolation, "device_group_members", "device_group_members_device_id_fkey")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error adding devices to group %d: %w", groupID, repositories.DBError(err, "device group member"))
+	}
+	for _, deviceID := range deviceIDs {
+		member := groupMember{groupID: groupID, deviceID: deviceID}
+		if !slices.Contains(s.members, member) {
+			s.members = append(s.members, member)
+		}
+	}
+	return nil
+}
+
+func (s *Store) RemoveGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members = filter(s.members, func(m groupMember) bool {
+		return m.groupID != groupID || !slices.Contains(deviceIDs, m.deviceID)
+	})
+	return nil
+}
+
+func (s *Store) GetGroupMembers(ctx context.Context, groupID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deviceIDs []string
+	for _, m := range s.members {
+		if m.groupID == groupID {
+			deviceIDs = append(deviceIDs, m.deviceID)
+		}
+	}
+	slices.Sort(deviceIDs)
+	return deviceIDs, nil
+}
+
+// checkDeviceGroup enforces the constraints on device groups.
+func (s *Store) checkDeviceGroup(group models.DeviceGroup) error {
+	switch {
+	case !s.homeExists(group.HomeID):
+		return violation(codeForeignKeyViolation, "device_groups", "device_groups_home_id_fkey")
+	case group.Kind != models.GroupStatic && group.Kind != models.GroupDynamic:
+		return violation(codeCheckViolation, "device_groups", "device_groups_kind_check")
+	case (group.Kind == models.GroupDynamic) != (group.Selector != nil):
+		return violation(codeCheckViolation, "device_groups", "device_groups_selector_check")
+	case slices.ContainsFunc(s.groups, func(g models.DeviceGroup) bool {
+		return g.ID != group.ID && g.HomeID == group.HomeID && g.Name == group.Name
+	}):
+		return violation(codeUniqueViolation, "device_groups", "device_groups_name_key")
+	}
+	return nil
+}
+
+func (s *Store) AddDeviceJob(ctx context.Context, job models.DeviceJob, deviceIDs []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case !s.homeExists(job.HomeID):
+		err = violation(codeForeignKeyViolation, "device_jobs", "device_jobs_home_id_fkey")
+	case job.GroupID != nil && !slices.ContainsFunc(s.groups, func(g models.DeviceGroup) bool { return g.ID == *job.GroupID }):
+		err = violation(codeForeignKeyViolation, "device_jobs", "device_jobs_group_id_fkey")
+	case !slices.Contains(models.JobActions, job.Action):
+		err = violation(codeCheckViolation, "device_jobs", "device_jobs_action_check")
+	case job.CreatedBy != nil && !s.userExists(*job.CreatedBy):
+		err = violation(codeForeignKeyViolation, "device_jobs", "device_jobs_created_by_fkey")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error adding %s job to home %d: %w", job.Action, job.HomeID, repositories.DBError(err, "device job"))
+	}
+	job.ID = s.nextID("device_jobs")
+	job.Params.Params = maps.Clone(job.Params.Params)
+	job.Status = models.JobQueued
+	job.CreatedAt = s.Now()
+	job.StartedAt, job.FinishedAt = nil, nil
+	s.jobs = append(s.jobs, deviceJob{DeviceJob: job})
+	for _, deviceID := range deviceIDs {
+		s.results = append(s.results, models.DeviceJobResult{JobID: job.ID, DeviceID: deviceID, Status: models.JobResultPending})
+	}
+	return job.ID, nil
+}
+
+func (s *Store) GetDeviceJobByID(ctx context.Context, id int) (models.DeviceJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return s.withCounts(j.DeviceJob), nil
+		}
+	}
+	return models.DeviceJob{}, fmt.Errorf("error finding device job %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device job"))
+}
+
+func (s *Store) GetHomeDeviceJobs(ctx context.Context, homeID, limit int) ([]models.DeviceJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []models.DeviceJob
+	for i := len(s.jobs) - 1; i >= 0 && len(jobs) < limit; i-- {
+		if s.jobs[i].HomeID == homeID {
+			jobs = append(jobs, s.withCounts(s.jobs[i].DeviceJob))
+		}
+	}
+	return jobs, nil
+}
+
+func (s *Store) GetDeviceJobResults(ctx context.Context, jobID int) ([]models.DeviceJobResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []models.DeviceJobResult
+	for _, r := range s.results {
+		if r.JobID == jobID {
+			results = append(results, r)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].DeviceID < results[j].DeviceID })
+	return results, nil
+}
+
+func (s *Store) ClaimDeviceJob(ctx context.Context, now, staleBefore time.Time) (models.DeviceJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, j := range s.jobs {
+		if j.Status != models.JobQueued && (j.Status != models.JobRunning || j.claimedAt == nil || !j.claimedAt.Before(staleBefore)) {
+			continue
+		}
+		s.jobs[i].Status = models.JobRunning
+		if j.StartedAt == nil {
+			s.jobs[i].StartedAt = &now
+		}
+		s.jobs[i].claimedAt = &now
+		return s.withCounts(s.jobs[i].DeviceJob), nil
+	}
+	return models.DeviceJob{}, fmt.Errorf("error claiming a device job: %w", repositories.DBError(pgx.ErrNoRows, "device job"))
+}
+
+func (s *Store) SetDeviceJobResult(ctx context.Context, result models.DeviceJobResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := slices.IndexFunc(s.results, func(r models.DeviceJobResult) bool {
+		return r.JobID == result.JobID && r.DeviceID == result.DeviceID
+	})
+	if r < 0 {
+		return fmt.Errorf("error saving result of device job %d on device %s: %w", result.JobID, result.DeviceID,
+			repositories.DBError(pgx.ErrNoRows, "device job result"))
+	}
+	s.results[r] = result
+	for i, j := range s.jobs {
+		if j.ID == result.JobID {
+			s.jobs[i].claimedAt = result.FinishedAt
+		}
+	}
+	return nil
+}
+
+func (s *Store) FinishDeviceJob(ctx context.Context, id int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, j := range s.jobs {
+		if j.ID == id {
+			s.jobs[i].Status = models.JobCompleted
+			s.jobs[i].FinishedAt = &now
+			s.jobs[i].claimedAt = nil
+			return nil
+		}
+	}
+	return fmt.Errorf("error finishing device job %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device job"))
+}
+
+// withCounts returns the job with its counts of results.
+func (s *Store) withCounts(job models.DeviceJob) models.DeviceJob {
+	job.Total, job.Succeeded, job.Failed = 0, 0, 0
+	for _, r := range s.results {
+		if r.JobID != job.ID {
+			continue
+		}
+		job.Total++
+		switch r.Status {
+		case models.JobResultSucceeded:
+			job.Succeeded++
+		case models.JobResultFailed:
+			job.Failed++
+		}
+	}
+	return job
+}
+
+func (s *Store) AddDeviceData(ctx context.Context, deviceData models.DeviceData) error {
+	return s.AddDeviceDataBatch(ctx, []models.DeviceData{deviceData})
+}
+
+// AddDeviceDataBatch stores the batch atomically: if any reading violates a
+// constraint, none are stored.
+func (s *Store) AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make([]models.DeviceData, len(batch))
+	for i, data := range batch {
+		if data.HomeID != nil && !s.homeExists(*data.HomeID) {
+			return fmt.Errorf("error adding batch of %d readings: %w", len(batch), repositories.DBError(violation(codeForeignKeyViolation, "device_data", "device_data_home_id_fkey"), "reading"))
+		}
+		if data.CreatedAt.IsZero() {
+			data.CreatedAt = s.Now()
+		}
+		// Round-trip through JSON as a JSONB column would, so numbers read
+		// back as float64.
+		copied, err := roundTrip(data.Data)
+		if err != nil {
+			return fmt.Errorf("error adding data for device %s: %w", data.DeviceID, err)
+		}
+		data.Data = copied
+		stored[i] = data
+	}
+	s.readings = append(s.readings, stored...)
+	return nil
+}
+
+func (s *Store) GetDeviceData(ctx context.Context, query repositories.TelemetryQuery) ([]models.DeviceData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var readings []models.DeviceData
+	for _, r := range s.readings {
+		if query.DeviceIDs == nil && r.DeviceID != query.DeviceID || query.DeviceIDs != nil && !slices.Contains(query.DeviceIDs, r.DeviceID) {
+			continue
+		}
+		if query.HomeID != nil && (r.HomeID == nil || *r.HomeID != *query.HomeID) {
+			continue
+		}
+		if !query.From.IsZero() && r.CreatedAt.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !r.CreatedAt.Before(query.To) {
+			continue
+		}
+		readings = append(readings, r)
+	}
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].CreatedAt.After(readings[j].CreatedAt) })
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = repositories.DefaultTelemetryLimit
+	}
+	if len(readings) > limit {
+		readings = readings[:limit]
+	}
+	return readings, nil
+}
+
+func (s *Store) GetDeviceAnalytics(ctx context.Context, deviceID string, homeID int, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var analytics []models.DeviceAnalytics
+	for _, a := range s.analytics {
+		if a.DeviceID != deviceID || a.HomeID == nil || *a.HomeID != homeID || a.Granularity != granularity {
+			continue
+		}
+		if a.Period.Before(from) || !a.Period.Before(to) {
+			continue
+		}
+		analytics = append(analytics, a)
+	}
+	sort.Slice(analytics, func(i, j int) bool {
+		if !analytics[i].Period.Equal(analytics[j].Period) {
+			return analytics[i].Period.Before(analytics[j].Period)
+		}
+		return analytics[i].Metric < analytics[j].Metric
+	})
+	return analytics, nil
+}
+
+func (s *Store) GetHomeAnalytics(ctx context.Context, homeID int, deviceIDs []string, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var analytics []models.DeviceAnalytics
+	for _, a := range s.analytics {
+		if !slices.Contains(deviceIDs, a.DeviceID) || a.HomeID == nil || *a.HomeID != homeID || a.Granularity != granularity {
+			continue
+		}
+		if a.Period.Before(from) || !a.Period.Before(to) {
+			continue
+		}
+		analytics = append(analytics, a)
+	}
+	sort.Slice(analytics, func(i, j int) bool {
+		if !analytics[i].Period.Equal(analytics[j].Period) {
+			return analytics[i].Period.Before(analytics[j].Period)
+		}
+		if analytics[i].Metric != analytics[j].Metric {
+			return analytics[i].Metric < analytics[j].Metric
+		}
+		return analytics[i].DeviceID < analytics[j].DeviceID
+	})
+	return analytics, nil
+}
+
+func (s *Store) AddDeviceType(ctx context.Context, deviceType models.DeviceType) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.deviceTypes {
+		if t.Name == deviceType.Name {
+			return 0, fmt.Errorf("error adding device type %s: %w", deviceType.Name, repositories.DBError(violation(codeUniqueViolation, "device_types", "device_types_name_key"), "device type"))
+		}
+	}
+	deviceType.ID = s.nextID("device_types")
+	deviceType.CreatedAt = s.Now()
+	s.deviceTypes = append(s.deviceTypes, deviceType)
+	return deviceType.ID, nil
+}
+
+func (s *Store) GetDeviceTypeByID(ctx context.Context, id int) (models.DeviceType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.deviceTypes {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return models.DeviceType{}, fmt.Errorf("error finding device type by ID %d: %w", id, repositories.DBError(pgx.ErrNoRows, "device type"))
+}
+
+func (s *Store) GetDeviceTypes(ctx context.Context) ([]models.DeviceType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deviceTypes := append([]models.DeviceType(nil), s.deviceTypes...)
+	sort.Slice(deviceTypes, func(i, j int) bool { return deviceTypes[i].Name < deviceTypes[j].Name })
+	return deviceTypes, nil
+}
+
+// SetRetentionPolicy creates or replaces the policy for the policy's home or
+// device type.
+func (s *Store) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case policy.RetentionDays <= 0:
+		return fmt.Errorf("error setting retention policy: %w", repositories.DBError(violation(codeCheckViolation, "retention_policies", "retention_policies_retention_days_check"), "retention policy"))
+	case (policy.HomeID == nil) == (policy.DeviceTypeID == nil):
+		return fmt.Errorf("error setting retention policy: %w", repositories.DBError(violation(codeCheckViolation, "retention_policies", "retention_policies_check"), "retention policy"))
+	case policy.HomeID != nil && !s.homeExists(*policy.HomeID):
+		return fmt.Errorf("error setting retention policy: %w", repositories.DBError(violation(codeForeignKeyViolation, "retention_policies", "retention_policies_home_id_fkey"), "retention policy"))
+	case policy.DeviceTypeID != nil && !s.deviceTypeExists(*policy.DeviceTypeID):
+		return fmt.Errorf("error setting retention policy: %w", repositories.DBError(violation(codeForeignKeyViolation, "retention_policies", "retention_policies_device_type_id_fkey"), "retention policy"))
+	}
+
+	for i, p := range s.policies {
+		if sameTarget(p, policy) {
+			s.policies[i].RetentionDays = policy.RetentionDays
+			return nil
+		}
+	}
+	policy.ID = s.nextID("retention_policies")
+	s.policies = append(s.policies, policy)
+	return nil
+}
+
+func (s *Store) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.RetentionPolicy(nil), s.policies...), nil
+}
+
+// EnsurePartitions does nothing; the store is not partitioned.
+func (s *Store) EnsurePartitions(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+// ApplyRetention deletes readings older than the retention period of their
+// home, else of their device's type, else defaultDays. Zero defaultDays keeps
+// readings without a policy.
+func (s *Store) ApplyRetention(ctx context.Context, now time.Time, defaultDays int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.readings[:0]
+	for _, r := range s.readings {
+		days := s.retentionDays(r, defaultDays)
+		if days > 0 && r.CreatedAt.Before(now.AddDate(0, 0, -days)) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.readings = kept
+	return nil
+}
+
+// Rollup aggregates numeric readings between from and to into analytics
+// buckets, replacing buckets already rolled up.
+func (s *Store) Rollup(ctx context.Context, granularity string, from, to time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := func(t time.Time) time.Time {
+		t = t.UTC()
+		if granularity == repositories.RollupHourly {
+			return t.Truncate(time.Hour)
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if granularity != repositories.RollupHourly && granularity != repositories.RollupDaily {
+		return fmt.Errorf("unsupported rollup granularity: %s", granularity)
+	}
+	from = bucket(from)
+
+	type key struct {
+		deviceID string
+		homeID   int
+		metric   string
+		period   time.Time
+	}
+	aggregates := make(map[key]*models.DeviceAnalytics)
+	var order []key
+	for _, r := range s.readings {
+		if r.CreatedAt.Before(from) || !r.CreatedAt.Before(to) {
+			continue
+		}
+		for metric, value := range r.Data {
+			v, ok := value.(float64)
+			if !ok {
+				continue
+			}
+			k := key{deviceID: r.DeviceID, metric: metric, period: bucket(r.CreatedAt)}
+			if r.HomeID != nil {
+				k.homeID = *r.HomeID
+			}
+			a, ok := aggregates[k]
+			if !ok {
+				a = &models.DeviceAnalytics{DeviceID: r.DeviceID, HomeID: r.HomeID, Metric: metric, Granularity: granularity, Period: k.period, Min: v, Max: v}
+				aggregates[k] = a
+				order = append(order, k)
+			}
+			a.Count++
+			a.Sum += v
+			if v < a.Min {
+				a.Min = v
+			}
+			if v > a.Max {
+				a.Max = v
+			}
+			a.Avg = a.Sum / float64(a.Count)
+		}
+	}
+
+	for _, k := range order {
+		a := *aggregates[k]
+		replaced := false
+		for i, existing := range s.analytics {
+			if existing.DeviceID == a.DeviceID && intValue(existing.HomeID) == k.homeID && existing.Metric == a.Metric &&
+				existing.Granularity == a.Granularity && existing.Period.Equal(a.Period) {
+				s.analytics[i] = a
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.analytics = append(s.analytics, a)
+		}
+	}
+	return nil
+}
+
+// checkDevice enforces the constraints on devices, ignoring the device at
+// index skip when checking uniqueness.
+func (s *Store) checkDevice(device models.Device, skip int) error {
+	for i, d := range s.devices {
+		if i == skip {
+			continue
+		}
+		if d.DeviceID == device.DeviceID {
+			return repositories.DBError(violation(codeUniqueViolation, "devices", "devices_device_id_key"), "device")
+		}
+		if d.ChannelID == device.ChannelID {
+			return repositories.DBError(violation(codeUniqueViolation, "devices", "devices_channel_id_key"), "device")
+		}
+	}
+	switch {
+	case !s.userExists(device.UserID):
+		return repositories.DBError(violation(codeForeignKeyViolation, "devices", "devices_user_id_fkey"), "device")
+	case device.HomeID != nil && !s.homeExists(*device.HomeID):
+		return repositories.DBError(violation(codeForeignKeyViolation, "devices", "devices_home_id_fkey"), "device")
+	case device.SpaceID != nil && !s.spaceExists(*device.SpaceID):
+		return repositories.DBError(violation(codeForeignKeyViolation, "devices", "devices_space_id_fkey"), "device")
+	case device.DeviceTypeID != nil && !s.deviceTypeExists(*device.DeviceTypeID):
+		return repositories.DBError(violation(codeForeignKeyViolation, "devices", "devices_device_type_id_fkey"), "device")
+	}
+	return nil
+}
+
+func (s *Store) retentionDays(r models.DeviceData, defaultDays int) int {
+	for _, p := range s.policies {
+		if p.HomeID != nil && r.HomeID != nil && *p.HomeID == *r.HomeID {
+			return p.RetentionDays
+		}
+	}
+	for _, d := range s.devices {
+		if d.DeviceID != r.DeviceID || d.DeviceTypeID == nil {
+			continue
+		}
+		for _, p := range s.policies {
+			if p.DeviceTypeID != nil && *p.DeviceTypeID == *d.DeviceTypeID {
+				return p.RetentionDays
+			}
+		}
+	}
+	return defaultDays
+}
+
+func (s *Store) GetPermittedHomeIDs(ctx context.Context, userID int, permission string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permitted := make(map[int]bool)
+	for _, h := range s.homes {
+		if h.UserID == userID {
+			permitted[h.ID] = true
+		}
+	}
+	for _, hu := range s.homeUsers {
+		if hu.UserID == userID && s.role(hu.RoleID).Can(permission) {
+			permitted[hu.HomeID] = true
+		}
+	}
+	orgRoles := models.OrgRolesWith(permission)
+	for _, m := range s.orgMembers {
+		if m.UserID != userID || !slices.Contains(orgRoles, m.Role) {
+			continue
+		}
+		for _, h := range s.homes {
+			if h.OrgID != nil && *h.OrgID == m.OrgID {
+				permitted[h.ID] = true
+			}
+		}
+	}
+	homeIDs := make([]int, 0, len(permitted))
+	for id := range permitted {
+		homeIDs = append(homeIDs, id)
+	}
+	sort.Ints(homeIDs)
+	return homeIDs, nil
+}
+
+func (s *Store) AddAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = int64(s.nextID("audit_log"))
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = s.Now()
+	}
+	s.auditLog = append(s.auditLog, entry)
+	return nil
+}
+
+func (s *Store) GetAuditEntries(ctx context.Context, query repositories.AuditQuery) ([]models.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var entries []models.AuditEntry
+	for i := len(s.auditLog) - 1; i >= 0 && len(entries) < limit; i-- {
+		if e := s.auditLog[i]; auditMatches(e, query) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func auditMatches(e models.AuditEntry, q repositories.AuditQuery) bool {
+	if q.VisibleTo != nil {
+		own := e.ActorID != nil && *e.ActorID == *q.VisibleTo ||
+			e.TargetType == models.AuditTargetUser && e.TargetID == strconv.Itoa(*q.VisibleTo)
+		if !own && !overlaps(e.HomeIDs, q.AdminHomeIDs) {
+			return false
+		}
+	}
+	switch {
+	case q.ActorID != nil && (e.ActorID == nil || *e.ActorID != *q.ActorID),
+		q.HomeID != nil && !slices.Contains(e.HomeIDs, *q.HomeID),
+		q.Action != "" && e.Action != q.Action,
+		q.TargetType != "" && e.TargetType != q.TargetType,
+		q.TargetID != "" && e.TargetID != q.TargetID,
+		!q.From.IsZero() && e.CreatedAt.Before(q.From),
+		!q.To.IsZero() && !e.CreatedAt.Before(q.To),
+		q.BeforeID > 0 && e.ID >= q.BeforeID:
+		return false
+	}
+	return true
+}
+
+func overlaps(a, b []int) bool {
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) nextID(table string) int {
+	if s.lastID == nil {
+		s.lastID = make(map[string]int)
+	}
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+func (s *Store) userExists(id int) bool {
+	for _, u := range s.users {
+		if u.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) deviceExists(deviceID string) bool {
+	return slices.ContainsFunc(s.devices, func(d models.Device) bool { return d.DeviceID == deviceID })
+}
+
+func (s *Store) spaceExists(id int) bool {
+	return slices.ContainsFunc(s.spaces, func(sp models.Space) bool { return sp.ID == id })
+}
+
+func (s *Store) homeExists(id int) bool {
+	for _, h := range s.homes {
+		if h.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// withNames fills in the names of the invitation's home and role, as the
+// Postgres repository joins them.
+func (s *Store) withNames(inv models.HomeInvitation) models.HomeInvitation {
+	for _, h := range s.homes {
+		if h.ID == inv.HomeID {
+			inv.HomeName = h.HomeName
+		}
+	}
+	inv.RoleName = s.role(inv.RoleID).Name
+	return inv
+}
+
+func (s *Store) orgExists(id int) bool {
+	for _, o := range s.orgs {
+		if o.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) roleExists(id int) bool {
+	for _, r := range s.roles {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) role(id int) models.Role {
+	for _, r := range s.roles {
+		if r.ID == id {
+			return r
+		}
+	}
+	return models.Role{}
+}
+
+// roleNameTaken mirrors roles_name_key: names are unique among the built-in
+// roles and among each home's custom roles.
+func (s *Store) roleNameTaken(role models.Role) bool {
+	return slices.ContainsFunc(s.roles, func(r models.Role) bool {
+		return r.ID != role.ID && r.Name == role.Name && (r.HomeID == nil && role.HomeID == nil || r.HomeID != nil && role.HomeID != nil && *r.HomeID == *role.HomeID)
+	})
+}
+
+func cloneSelector(selector *models.DeviceSelector) *models.DeviceSelector {
+	if selector == nil {
+		return nil
+	}
+	copied := *selector
+	copied.Tags = maps.Clone(selector.Tags)
+	return &copied
+}
+
+func cloneRole(r models.Role) models.Role {
+	r.Permissions = slices.Clone(r.Permissions)
+	return r
+}
+
+func (s *Store) deviceTypeExists(id int) bool {
+	return id >= 1 && id <= len(s.deviceTypes)
+}
+
+// filter returns the rows for which keep is true, reusing rows' array.
+func filter[T any](rows []T, keep func(T) bool) []T {
+	kept := rows[:0]
+	for _, row := range rows {
+		if keep(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func sameTarget(a, b models.RetentionPolicy) bool {
+	if a.HomeID != nil && b.HomeID != nil {
+		return *a.HomeID == *b.HomeID
+	}
+	if a.DeviceTypeID != nil && b.DeviceTypeID != nil {
+		return *a.DeviceTypeID == *b.DeviceTypeID
+	}
+	return false
+}
+
+// sameID compares nullable IDs like IS NOT DISTINCT FROM.
+func sameID(a, b *int) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// quotaNegative reports whether a quota breaks its >= 0 check.
+func quotaNegative(quota *int) bool {
+	return quota != nil && *quota < 0
+}
+
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func roundTrip(data map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+func violation(code, table, constraint string) *pgconn.PgError {
+	messages := map[string]string{
+		codeUniqueViolation:     "duplicate key value violates unique constraint",
+		codeForeignKeyViolation: "insert or update violates foreign key constraint",
+		codeCheckViolation:      "new row violates check constraint",
+	}
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        fmt.Sprintf("%s %q", messages[code], constraint),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
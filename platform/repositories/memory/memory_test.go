@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func constraint(t *testing.T, err error) (string, string) {
+	t.Helper()
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		t.Fatalf("expected a *pgconn.PgError, got %v", err)
+	}
+	return pgErr.Code, pgErr.ConstraintName
+}
+
+func TestUniqueConstraints(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	if err := s.AddUser(ctx, models.User{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	code, name := constraint(t, s.AddUser(ctx, models.User{Username: "alice", Email: "other@example.com"}))
+	if code != "23505" || name != "users_username_key" {
+		t.Errorf("duplicate username: got %s %s", code, name)
+	}
+	_, name = constraint(t, s.AddUser(ctx, models.User{Username: "bob", Email: "alice@example.com"}))
+	if name != "users_email_key" {
+		t.Errorf("duplicate email: got %s", name)
+	}
+
+	if err := s.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, name = constraint(t, s.AddDevice(ctx, models.Device{DeviceID: "d2", ChannelID: "c1", UserID: 1}))
+	if name != "devices_channel_id_key" {
+		t.Errorf("duplicate channel: got %s", name)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	_, err := s.AddHome(ctx, models.Home{HomeName: "Home", UserID: 7})
+	code, name := constraint(t, err)
+	if code != "23503" || name != "homes_user_id_fkey" {
+		t.Errorf("home without user: got %s %s", code, name)
+	}
+
+	if err := s.AddUser(ctx, models.User{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	homeID := 3
+	_, name = constraint(t, s.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: 1, HomeID: &homeID}))
+	if name != "devices_home_id_fkey" {
+		t.Errorf("device in missing home: got %s", name)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	if _, err := s.GetUserByUsername(ctx, "nobody"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetUserByUsername: expected pgx.ErrNoRows, got %v", err)
+	}
+	if _, err := s.GetDeviceByID(ctx, "missing"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetDeviceByID: expected pgx.ErrNoRows, got %v", err)
+	}
+	if _, err := s.GetHomeUserRole(ctx, 1, 1); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetHomeUserRole: expected pgx.ErrNoRows, got %v", err)
+	}
+	if _, err := s.GetRoleByName(ctx, "Admin"); err != nil {
+		t.Errorf("GetRoleByName: default role missing: %v", err)
+	}
+}
+
+func TestBatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	missingHome := 9
+	batch := []models.DeviceData{
+		{DeviceID: "d1", Data: map[string]interface{}{"temp": 20}},
+		{DeviceID: "d1", HomeID: &missingHome, Data: map[string]interface{}{"temp": 21}},
+	}
+	if err := s.AddDeviceDataBatch(ctx, batch); err == nil {
+		t.Fatal("expected a foreign key violation")
+	}
+	data, err := s.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected no readings stored, got %d", len(data))
+	}
+}
+
+func TestRollupAndRetention(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if err := s.AddUser(ctx, models.User{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddHome(ctx, models.Home{HomeName: "Home", UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	homeID := 1
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	batch := []models.DeviceData{
+		{DeviceID: "d1", HomeID: &homeID, CreatedAt: hour.Add(5 * time.Minute), Data: map[string]interface{}{"temp": 20, "mode": "eco"}},
+		{DeviceID: "d1", HomeID: &homeID, CreatedAt: hour.Add(35 * time.Minute), Data: map[string]interface{}{"temp": 24}},
+	}
+	if err := s.AddDeviceDataBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Rollup(ctx, repositories.RollupHourly, hour, hour.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	analytics, err := s.GetDeviceAnalytics(ctx, "d1", homeID, repositories.RollupHourly, hour, hour.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analytics) != 1 {
+		t.Fatalf("expected one rollup for the numeric field, got %d", len(analytics))
+	}
+	if a := analytics[0]; a.Count != 2 || a.Min != 20 || a.Max != 24 || a.Avg != 22 {
+		t.Errorf("unexpected rollup: %+v", a)
+	}
+
+	if err := s.SetRetentionPolicy(ctx, models.RetentionPolicy{HomeID: &homeID, RetentionDays: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ApplyRetention(ctx, hour.Add(36*time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected readings past retention to be deleted, got %d", len(data))
+	}
+}
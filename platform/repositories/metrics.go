@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector exports pgxpool statistics to Prometheus.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	totalConns        *prometheus.Desc
+	maxConns          *prometheus.Desc
+	acquireCount      *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	emptyAcquireCount *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	return &PoolCollector{
+		pool:              pool,
+		acquiredConns:     prometheus.NewDesc("pragati_db_pool_acquired_connections", "Connections currently in use.", nil, nil),
+		idleConns:         prometheus.NewDesc("pragati_db_pool_idle_connections", "Idle connections in the pool.", nil, nil),
+		totalConns:        prometheus.NewDesc("pragati_db_pool_total_connections", "Connections open in the pool.", nil, nil),
+		maxConns:          prometheus.NewDesc("pragati_db_pool_max_connections", "Maximum size of the pool.", nil, nil),
+		acquireCount:      prometheus.NewDesc("pragati_db_pool_acquires_total", "Successful connection acquires.", nil, nil),
+		acquireDuration:   prometheus.NewDesc("pragati_db_pool_acquire_seconds_total", "Time spent waiting to acquire connections.", nil, nil),
+		emptyAcquireCount: prometheus.NewDesc("pragati_db_pool_empty_acquires_total", "Acquires that had to wait because the pool was empty.", nil, nil),
+		canceledAcquires:  prometheus.NewDesc("pragati_db_pool_canceled_acquires_total", "Acquires cancelled by their context.", nil, nil),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquires
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
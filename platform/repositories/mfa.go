@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// MFARepository keeps TOTP enrollments and recovery codes in Postgres.
+type MFARepository struct {
+	db *DB
+}
+
+func NewMFARepository(db *DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+func (r *MFARepository) SetMFASecret(ctx context.Context, userID int, sealedSecret string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO user_mfa (user_id, sealed_secret) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET sealed_secret = EXCLUDED.sealed_secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		 WHERE user_mfa.enabled_at IS NULL`,
+		userID, sealedSecret,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving MFA secret of user %d: %w", userID, DBError(err, "MFA enrollment"))
+	}
+	return nil
+}
+
+func (r *MFARepository) GetMFA(ctx context.Context, userID int) (models.UserMFA, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var mfa models.UserMFA
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT user_id, sealed_secret, enabled_at, last_step, created_at FROM user_mfa WHERE user_id = $1`,
+		userID,
+	).Scan(&mfa.UserID, &mfa.SealedSecret, &mfa.EnabledAt, &mfa.LastStep, &mfa.CreatedAt)
+	if err != nil {
+		return mfa, fmt.Errorf("error finding MFA enrollment of user %d: %w", userID, DBError(err, "MFA enrollment"))
+	}
+	return mfa, nil
+}
+
+func (r *MFARepository) EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE user_mfa SET enabled_at = $2, last_step = $3 WHERE user_id = $1 AND enabled_at IS NULL`,
+			userID, now, step,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = TRUE, token_version = token_version + 1 WHERE id = $1`, userID); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("error enabling MFA for user %d: %w", userID, DBError(err, "MFA enrollment"))
+	}
+	return nil
+}
+
+func (r *MFARepository) DisableMFA(ctx context.Context, userID int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		for _, sql := range []string{
+			`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+			`DELETE FROM user_mfa WHERE user_id = $1`,
+			`UPDATE users SET mfa_enabled = FALSE, token_version = token_version + 1 WHERE id = $1 AND mfa_enabled`,
+		} {
+			if _, err := tx.Exec(ctx, sql, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error disabling MFA for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (r *MFARepository) UseMFAStep(ctx context.Context, userID int, step int64) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE user_mfa SET last_step = $2 WHERE user_id = $1 AND last_step < $2`, userID, step)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error using MFA code of user %d: %w", userID, DBError(err, "MFA code"))
+	}
+	return nil
+}
+
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string, now time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE mfa_recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash, now,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error using recovery code of user %d: %w", userID, DBError(err, "recovery code"))
+	}
+	return nil
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("error replacing recovery codes of user %d: %w", userID, DBError(err, "recovery code"))
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
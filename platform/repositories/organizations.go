@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// OrganizationRepository keeps organizations and their members in Postgres.
+type OrganizationRepository struct {
+	db *DB
+}
+
+func NewOrganizationRepository(db *DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+const organizationColumns = `id, name, plan, billing_email, max_homes, max_devices, max_members, created_at`
+
+func scanOrganization(row pgx.Row) (models.Organization, error) {
+	var org models.Organization
+	err := row.Scan(&org.ID, &org.Name, &org.Plan, &org.BillingEmail, &org.MaxHomes, &org.MaxDevices, &org.MaxMembers, &org.CreatedAt)
+	return org, err
+}
+
+func (r *OrganizationRepository) AddOrganization(ctx context.Context, org models.Organization, ownerID int) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(
+			ctx,
+			`INSERT INTO organizations (name, plan, billing_email, max_homes, max_devices, max_members)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			org.Name, org.Plan, org.BillingEmail, org.MaxHomes, org.MaxDevices, org.MaxMembers,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)`,
+			id, ownerID, models.OrgRoleOwner,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error adding organization %s: %w", org.Name, DBError(err, "organization"))
+	}
+	return id, nil
+}
+
+func (r *OrganizationRepository) GetOrganizationByID(ctx context.Context, id int) (models.Organization, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	org, err := scanOrganization(r.db.QueryRow(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, id))
+	if err != nil {
+		return org, fmt.Errorf("error finding organization %d: %w", id, DBError(err, "organization"))
+	}
+	return org, nil
+}
+
+func (r *OrganizationRepository) UpdateOrganization(ctx context.Context, org models.Organization) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE organizations SET name = $2, billing_email = $3 WHERE id = $1`,
+		org.ID, org.Name, org.BillingEmail,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating organization %d: %w", org.ID, DBError(err, "organization"))
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) GetOrgMember(ctx context.Context, orgID, userID int) (models.OrgMember, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var member models.OrgMember
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT org_id, user_id, role, created_at FROM organization_members WHERE org_id = $1 AND user_id = $2`,
+		orgID, userID,
+	).Scan(&member.OrgID, &member.UserID, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return member, fmt.Errorf("error finding member %d of organization %d: %w", userID, orgID, DBError(err, "organization member"))
+	}
+	return member, nil
+}
+
+func (r *OrganizationRepository) GetOrgMembers(ctx context.Context, orgID int) ([]models.OrgMember, error) {
+	return r.queryMembers(ctx, `WHERE org_id = $1 ORDER BY created_at, user_id`, orgID)
+}
+
+func (r *OrganizationRepository) GetUserOrgMembers(ctx context.Context, userID int) ([]models.OrgMember, error) {
+	return r.queryMembers(ctx, `WHERE user_id = $1 ORDER BY org_id`, userID)
+}
+
+func (r *OrganizationRepository) queryMembers(ctx context.Context, where string, arg int) ([]models.OrgMember, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT org_id, user_id, role, created_at FROM organization_members `+where, arg)
+	if err != nil {
+		return nil, fmt.Errorf("error finding organization members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.OrgMember
+	for rows.Next() {
+		var member models.OrgMember
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *OrganizationRepository) SetOrgMember(ctx context.Context, member models.OrgMember) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)
+		 ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		member.OrgID, member.UserID, member.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("error setting member %d of organization %d: %w", member.UserID, member.OrgID, DBError(err, "organization member"))
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) RemoveOrgMember(ctx context.Context, orgID, userID int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error removing member %d of organization %d: %w", userID, orgID, DBError(err, "organization member"))
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) GetOrgUsage(ctx context.Context, orgID int) (models.OrgUsage, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var usage models.OrgUsage
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT (SELECT count(*) FROM homes WHERE org_id = $1),
+		        (SELECT count(*) FROM devices d JOIN homes h ON h.id = d.home_id WHERE h.org_id = $1),
+		        (SELECT count(*) FROM organization_members WHERE org_id = $1)`,
+		orgID,
+	).Scan(&usage.Homes, &usage.Devices, &usage.Members)
+	if err != nil {
+		return usage, fmt.Errorf("error counting usage of organization %d: %w", orgID, err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/ratelimit"
+	"github.com/jackc/pgx/v5"
+)
+
+// RateLimitRepository keeps rate limit buckets in Postgres, so that replicas
+// share them.
+type RateLimitRepository struct {
+	db *DB
+}
+
+var _ ratelimit.Store = (*RateLimitRepository)(nil)
+
+func NewRateLimitRepository(db *DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// Take takes a token from the bucket with the key, locking its row so that
+// concurrent requests on any replica take tokens one at a time.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, l ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var allowed bool
+	var retryAfter time.Duration
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		// A new bucket starts full.
+		_, err := tx.Exec(ctx,
+			`INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING`,
+			key, float64(l.Burst), now)
+		if err != nil {
+			return err
+		}
+		var bucket ratelimit.Bucket
+		err = tx.QueryRow(ctx, `SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE`, key).
+			Scan(&bucket.Tokens, &bucket.Updated)
+		if err != nil {
+			return err
+		}
+		bucket, allowed, retryAfter = bucket.Take(l, now)
+		_, err = tx.Exec(ctx, `UPDATE rate_limits SET tokens = $2, updated_at = $3 WHERE key = $1`, key, bucket.Tokens, bucket.Updated)
+		return err
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("error taking rate limit token for %s: %w", key, err)
+	}
+	return allowed, retryAfter, nil
+}
+
+func (r *RateLimitRepository) Prune(ctx context.Context, before time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM rate_limits WHERE updated_at < $1`, before); err != nil {
+		return fmt.Errorf("error pruning rate limit buckets: %w", err)
+	}
+	return nil
+}
@@ -3,61 +3,222 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"PragatiIot/platform/models"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
 type DeviceRepository struct {
-	pool *pgxpool.Pool
+	db        *DB
+	telemetry TelemetryStore
 }
 
 type HomeRepository struct {
-	pool *pgxpool.Pool
+	db *DB
 }
 
 type RoleRepository struct {
-	pool *pgxpool.Pool
+	db *DB
 }
 
 type UserRepository struct {
-	pool *pgxpool.Pool
+	db *DB
 }
 
-func NewRoleRepository(pool *pgxpool.Pool) *RoleRepository {
-	return &RoleRepository{pool: pool}
+func NewRoleRepository(db *DB) *RoleRepository {
+	return &RoleRepository{db: db}
 }
 
-func (r *RoleRepository) GetRoleByName(roleName string) (models.Role, error) {
+const roleColumns = `id, name, home_id, permissions`
+
+func scanRole(row pgx.Row) (models.Role, error) {
 	var role models.Role
-	err := r.pool.QueryRow(
-		context.Background(),
-		`SELECT id, name FROM roles WHERE name = $1`,
-		roleName,
-	).Scan(&role.ID, &role.Name)
+	err := row.Scan(&role.ID, &role.Name, &role.HomeID, &role.Permissions)
+	return role, err
+}
+
+func (r *RoleRepository) GetRoleByName(ctx context.Context, roleName string) (models.Role, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	role, err := scanRole(r.db.QueryRow(ctx, `SELECT `+roleColumns+` FROM roles WHERE name = $1 AND home_id IS NULL`, roleName))
 	if err != nil {
-		return role, fmt.Errorf("error finding role by name %s: %w", roleName, err)
+		return role, fmt.Errorf("error finding role by name %s: %w", roleName, DBError(err, "role"))
 	}
 	return role, nil
 }
 
-func NewHomeRepository(pool *pgxpool.Pool) *HomeRepository {
-	return &HomeRepository{pool: pool}
+func (r *RoleRepository) GetRoleByID(ctx context.Context, id int) (models.Role, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	role, err := scanRole(r.db.QueryRow(ctx, `SELECT `+roleColumns+` FROM roles WHERE id = $1`, id))
+	if err != nil {
+		return role, fmt.Errorf("error finding role %d: %w", id, DBError(err, "role"))
+	}
+	return role, nil
 }
 
-func (r *HomeRepository) AddHome(home models.Home) error {
-	_, err := r.pool.Exec(
-		context.Background(),
-		`INSERT INTO homes (home_name, user_id) VALUES ($1, $2)`,
-		home.HomeName, home.UserID,
+func (r *RoleRepository) GetHomeRole(ctx context.Context, homeID int, roleName string) (models.Role, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	role, err := scanRole(r.db.QueryRow(
+		ctx,
+		`SELECT `+roleColumns+` FROM roles WHERE name = $2 AND (home_id IS NULL OR home_id = $1)`,
+		homeID, roleName,
+	))
+	if err != nil {
+		return role, fmt.Errorf("error finding role %s of home %d: %w", roleName, homeID, DBError(err, "role"))
+	}
+	return role, nil
+}
+
+func (r *RoleRepository) GetHomeRoles(ctx context.Context, homeID int) ([]models.Role, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+roleColumns+` FROM roles WHERE home_id IS NULL OR home_id = $1 ORDER BY home_id NULLS FIRST, id`,
+		homeID,
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("error finding roles of home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
 }
 
-func (r *HomeRepository) GetHomesByUserID(userID int) ([]models.Home, error) {
-	rows, err := r.pool.Query(
-		context.Background(),
-		`SELECT id, home_name, user_id, created_at FROM homes WHERE user_id = $1`,
+func (r *RoleRepository) AddRole(ctx context.Context, role models.Role) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO roles (name, home_id, permissions) VALUES ($1, $2, $3) RETURNING id`,
+		role.Name, role.HomeID, role.Permissions,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding role %s: %w", role.Name, DBError(err, "role"))
+	}
+	return id, nil
+}
+
+func (r *RoleRepository) UpdateRole(ctx context.Context, role models.Role) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE roles SET name = $2, permissions = $3 WHERE id = $1 AND home_id IS NOT NULL`,
+		role.ID, role.Name, role.Permissions,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating role %d: %w", role.ID, DBError(err, "role"))
+	}
+	return nil
+}
+
+func (r *RoleRepository) DeleteRole(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM roles WHERE id = $1 AND home_id IS NOT NULL`, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting role %d: %w", id, DBError(err, "role"))
+	}
+	return nil
+}
+
+func (r *RoleRepository) CountRoleMembers(ctx context.Context, id int) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM home_users WHERE role_id = $1`, id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting members with role %d: %w", id, err)
+	}
+	return count, nil
+}
+
+func NewHomeRepository(db *DB) *HomeRepository {
+	return &HomeRepository{db: db}
+}
+
+func (r *HomeRepository) AddHome(ctx context.Context, home models.Home) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO homes (home_name, user_id, org_id) VALUES ($1, $2, $3) RETURNING id`,
+		home.HomeName, home.UserID, home.OrgID,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding home %s: %w", home.HomeName, DBError(err, "home"))
+	}
+	return id, nil
+}
+
+const homeColumns = `id, home_name, user_id, org_id, require_mfa, created_at`
+
+func scanHome(row pgx.Row) (models.Home, error) {
+	var home models.Home
+	err := row.Scan(&home.ID, &home.HomeName, &home.UserID, &home.OrgID, &home.RequireMFA, &home.CreatedAt)
+	return home, err
+}
+
+func (r *HomeRepository) GetHomeByID(ctx context.Context, id int) (models.Home, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	home, err := scanHome(r.db.QueryRow(ctx, `SELECT `+homeColumns+` FROM homes WHERE id = $1`, id))
+	if err != nil {
+		return home, fmt.Errorf("error finding home %d: %w", id, DBError(err, "home"))
+	}
+	return home, nil
+}
+
+func (r *HomeRepository) SetHomeRequireMFA(ctx context.Context, id int, require bool) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE homes SET require_mfa = $2 WHERE id = $1`, id, require)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating home %d: %w", id, DBError(err, "home"))
+	}
+	return nil
+}
+
+func (r *HomeRepository) GetHomesByUserID(ctx context.Context, userID int) ([]models.Home, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+homeColumns+` FROM homes WHERE user_id = $1`,
 		userID,
 	)
 	if err != nil {
@@ -67,8 +228,8 @@ func (r *HomeRepository) GetHomesByUserID(userID int) ([]models.Home, error) {
 
 	var homes []models.Home
 	for rows.Next() {
-		var home models.Home
-		if err := rows.Scan(&home.ID, &home.HomeName, &home.UserID, &home.CreatedAt); err != nil {
+		home, err := scanHome(rows)
+		if err != nil {
 			return nil, err
 		}
 		homes = append(homes, home)
@@ -76,66 +237,222 @@ func (r *HomeRepository) GetHomesByUserID(userID int) ([]models.Home, error) {
 	return homes, nil
 }
 
-func (r *HomeRepository) AddUserToHome(homeUser models.HomeUser) error {
-	_, err := r.pool.Exec(
-		context.Background(),
+func (r *HomeRepository) GetHomesByOrgID(ctx context.Context, orgID int) ([]models.Home, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+homeColumns+` FROM homes WHERE org_id = $1 ORDER BY id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding homes of organization %d: %w", orgID, err)
+	}
+	defer rows.Close()
+
+	var homes []models.Home
+	for rows.Next() {
+		home, err := scanHome(rows)
+		if err != nil {
+			return nil, err
+		}
+		homes = append(homes, home)
+	}
+	return homes, rows.Err()
+}
+
+func (r *HomeRepository) AddUserToHome(ctx context.Context, homeUser models.HomeUser) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
 		`INSERT INTO home_users (home_id, user_id, role_id) VALUES ($1, $2, $3)`,
 		homeUser.HomeID, homeUser.UserID, homeUser.RoleID,
 	)
-	return err
+	if err != nil {
+		return fmt.Errorf("error adding user %d to home %d: %w", homeUser.UserID, homeUser.HomeID, DBError(err, "home member"))
+	}
+	return nil
 }
 
-func (r *HomeRepository) GetHomeUserRole(homeID, userID int) (int, error) {
+func (r *HomeRepository) GetHomeUserRole(ctx context.Context, homeID, userID int) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
 	var roleID int
-	err := r.pool.QueryRow(
-		context.Background(),
+	err := r.db.QueryRow(
+		ctx,
 		`SELECT role_id FROM home_users WHERE home_id = $1 AND user_id = $2`,
 		homeID, userID,
 	).Scan(&roleID)
 	if err != nil {
-		return 0, fmt.Errorf("error finding role for user %d in home %d: %w", userID, homeID, err)
+		return 0, fmt.Errorf("error finding role for user %d in home %d: %w", userID, homeID, DBError(err, "home member"))
 	}
 	return roleID, nil
 }
 
-func NewDeviceRepository(pool *pgxpool.Pool) *DeviceRepository {
-	return &DeviceRepository{pool: pool}
+func (r *HomeRepository) GetPermittedHomeIDs(ctx context.Context, userID int, permission string) ([]int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
 
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT id FROM homes WHERE user_id = $1
+		UNION
+		SELECT hu.home_id FROM home_users hu JOIN roles r ON r.id = hu.role_id
+		WHERE hu.user_id = $1 AND $2 = ANY(r.permissions)
+		UNION
+		SELECT h.id FROM homes h JOIN organization_members om ON om.org_id = h.org_id
+		WHERE om.user_id = $1 AND om.role = ANY($3)
+		ORDER BY 1`,
+		userID, permission, models.OrgRolesWith(permission),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding homes where user %d has %s: %w", userID, permission, err)
+	}
+	defer rows.Close()
+
+	var homeIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		homeIDs = append(homeIDs, id)
+	}
+	return homeIDs, rows.Err()
 }
 
-func (r *DeviceRepository) GetDeviceByID(deviceID string) (models.Device, error) {
+func NewDeviceRepository(db *DB, telemetry TelemetryStore) *DeviceRepository {
+	return &DeviceRepository{db: db, telemetry: telemetry}
+}
+
+const deviceColumns = `id, device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, space_id, device_type_id, decoder, created_at`
+
+func scanDevice(row pgx.Row) (models.Device, error) {
 	var device models.Device
-	err := r.pool.QueryRow(
-		context.Background(),
-		`SELECT id, device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, created_at
-		 FROM devices
-		 WHERE device_id = $1`,
-		deviceID,
-	).Scan(
+	err := row.Scan(
 		&device.ID, &device.DeviceID, &device.ChannelID, &device.ProductionDate, &device.Warranty,
-		&device.Location, &device.IsActive, &device.UserID, &device.HomeID, &device.CreatedAt,
+		&device.Location, &device.IsActive, &device.UserID, &device.HomeID, &device.SpaceID, &device.DeviceTypeID, &device.Decoder, &device.CreatedAt,
 	)
+	return device, err
+}
+
+func (r *DeviceRepository) GetDeviceByID(ctx context.Context, deviceID string) (models.Device, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	device, err := scanDevice(r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceColumns+` FROM devices WHERE device_id = $1`,
+		deviceID,
+	))
 	if err != nil {
-		return device, fmt.Errorf("error finding device by ID %s: %w", deviceID, err)
+		return device, fmt.Errorf("error finding device by ID %s: %w", deviceID, DBError(err, "device"))
 	}
 	return device, nil
 }
 
-func (r *DeviceRepository) AddDeviceData(deviceData models.DeviceData) error {
-	_, err := r.pool.Exec(
-		context.Background(),
-		`INSERT INTO device_data (device_id, home_id, data) VALUES ($1, $2, $3)`,
-		deviceData.DeviceID, deviceData.HomeID, deviceData.Data,
+func (r *DeviceRepository) AddDeviceData(ctx context.Context, deviceData models.DeviceData) error {
+	return r.telemetry.Insert(ctx, deviceData)
+}
+
+func (r *DeviceRepository) AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error {
+	return r.telemetry.InsertBatch(ctx, batch)
+}
+
+func (r *DeviceRepository) GetDeviceData(ctx context.Context, query TelemetryQuery) ([]models.DeviceData, error) {
+	return r.telemetry.Query(ctx, query)
+}
+
+func (r *DeviceRepository) GetDeviceAnalytics(ctx context.Context, deviceID string, homeID int, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT device_id, home_id, metric, granularity, aggregation_period, count, min_value, max_value, avg_value, sum_value
+		FROM device_analytics
+		WHERE device_id = $1 AND home_id = $2 AND granularity = $3 AND aggregation_period >= $4 AND aggregation_period < $5
+		ORDER BY aggregation_period, metric`,
+		deviceID, homeID, granularity, from.UTC(), to.UTC(),
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("error finding analytics for device %s: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var analytics []models.DeviceAnalytics
+	for rows.Next() {
+		var a models.DeviceAnalytics
+		if err := rows.Scan(&a.DeviceID, &a.HomeID, &a.Metric, &a.Granularity, &a.Period, &a.Count, &a.Min, &a.Max, &a.Avg, &a.Sum); err != nil {
+			return nil, err
+		}
+		analytics = append(analytics, a)
+	}
+	return analytics, rows.Err()
+}
+
+// GetHomeAnalytics returns the devices' rollups of readings taken in the
+// home.
+func (r *DeviceRepository) GetHomeAnalytics(ctx context.Context, homeID int, deviceIDs []string, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT device_id, home_id, metric, granularity, aggregation_period, count, min_value, max_value, avg_value, sum_value
+		FROM device_analytics
+		WHERE device_id = ANY($1) AND home_id = $2 AND granularity = $3 AND aggregation_period >= $4 AND aggregation_period < $5
+		ORDER BY aggregation_period, metric, device_id`,
+		deviceIDs, homeID, granularity, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding analytics for home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var analytics []models.DeviceAnalytics
+	for rows.Next() {
+		var a models.DeviceAnalytics
+		if err := rows.Scan(&a.DeviceID, &a.HomeID, &a.Metric, &a.Granularity, &a.Period, &a.Count, &a.Min, &a.Max, &a.Avg, &a.Sum); err != nil {
+			return nil, err
+		}
+		analytics = append(analytics, a)
+	}
+	return analytics, rows.Err()
 }
 
-func (r *DeviceRepository) GetDevicesByUserID(userID int) ([]models.Device, error) {
-	rows, err := r.pool.Query(
-		context.Background(),
-		`SELECT id, device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, created_at
-		 FROM devices
-		 WHERE user_id = $1`,
+func (r *DeviceRepository) GetDevicesByHomeID(ctx context.Context, homeID int) ([]models.Device, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+deviceColumns+` FROM devices WHERE home_id = $1 ORDER BY device_id`,
+		homeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding devices of home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var devices []models.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r *DeviceRepository) GetDevicesByUserID(ctx context.Context, userID int) ([]models.Device, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+deviceColumns+` FROM devices WHERE user_id = $1`,
 		userID,
 	)
 	if err != nil {
@@ -145,11 +462,8 @@ func (r *DeviceRepository) GetDevicesByUserID(userID int) ([]models.Device, erro
 
 	var devices []models.Device
 	for rows.Next() {
-		var device models.Device
-		if err := rows.Scan(
-			&device.ID, &device.DeviceID, &device.ChannelID, &device.ProductionDate, &device.Warranty,
-			&device.Location, &device.IsActive, &device.UserID, &device.HomeID, &device.CreatedAt,
-		); err != nil {
+		device, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, device)
@@ -157,68 +471,511 @@ func (r *DeviceRepository) GetDevicesByUserID(userID int) ([]models.Device, erro
 	return devices, nil
 }
 
-func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
-	return &UserRepository{pool: pool}
+func (r *DeviceRepository) GetActiveChannels(ctx context.Context) ([]string, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT channel_id FROM devices WHERE is_active`)
+	if err != nil {
+		return nil, fmt.Errorf("error finding active channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []string
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) AddUser(user models.User) error {
-	_, err := r.pool.Exec(
-		context.Background(),
-		`INSERT INTO users (username, password_hash, email) VALUES ($1, $2, $3)`,
-		user.Username, user.PasswordHash, user.Email,
+func (r *UserRepository) AddUser(ctx context.Context, user models.User) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO users (username, password_hash, email, owner_id) VALUES ($1, $2, NULLIF($3, ''), $4)`,
+		user.Username, user.PasswordHash, user.Email, user.OwnerID,
 	)
 	if err != nil {
-		return fmt.Errorf("error adding user %s: %w", user.Username, err)
+		return fmt.Errorf("error adding user %s: %w", user.Username, DBError(err, "user"))
 	}
 	return nil
 }
 
-func (r *UserRepository) GetUserByUsername(username string) (models.User, error) {
+// Service accounts have no email address; it is NULL in the table and empty
+// in models.User.
+const userColumns = `id, username, password_hash, COALESCE(email, ''), email_verified, created_at, failed_logins, locked_until, owner_id, mfa_enabled, platform_operator, token_version`
+
+func scanUser(row pgx.Row) (models.User, error) {
 	var user models.User
-	err := r.pool.QueryRow(
-		context.Background(),
-		`SELECT id, username, password_hash, email FROM users WHERE username = $1`,
-		username,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email)
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.CreatedAt,
+		&user.FailedLogins, &user.LockedUntil, &user.OwnerID, &user.MFAEnabled, &user.PlatformOperator, &user.TokenVersion)
+	return user, err
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
 	if err != nil {
-		return user, fmt.Errorf("error finding user by username %s: %w", username, err)
+		return user, fmt.Errorf("error finding user by ID %d: %w", id, DBError(err, "user"))
 	}
 	return user, nil
 }
-func (r *DeviceRepository) AddDevice(device models.Device) error {
-	_, err := r.pool.Exec(
-		context.Background(),
-		`INSERT INTO devices (device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		device.DeviceID, device.ChannelID, device.ProductionDate, device.Warranty, device.Location,
-		device.IsActive, device.UserID, device.HomeID, device.CreatedAt,
+
+func (r *UserRepository) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+	if err != nil {
+		return user, fmt.Errorf("error finding user by username %s: %w", username, DBError(err, "user"))
+	}
+	return user, nil
+}
+
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+	if err != nil {
+		return user, fmt.Errorf("error finding user by email: %w", DBError(err, "user"))
+	}
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user models.User) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE users SET email = NULLIF($2, ''), password_hash = $3, email_verified = $4,
+			token_version = token_version + CASE WHEN password_hash = $3 THEN 0 ELSE 1 END
+		 WHERE id = $1`,
+		user.ID, user.Email, user.PasswordHash, user.EmailVerified,
 	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating user %d: %w", user.ID, DBError(err, "user"))
+	}
+	return nil
+}
+
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id, maxFailures int, lockout time.Duration, now time.Time) (*time.Time, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var lockedUntil *time.Time
+	err := r.db.QueryRow(
+		ctx,
+		`UPDATE users SET
+		     failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END,
+		     locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3::timestamptz + make_interval(secs => $4) ELSE locked_until END
+		 WHERE id = $1
+		 RETURNING locked_until`,
+		id, maxFailures, now, lockout.Seconds(),
+	).Scan(&lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("error recording failed login of user %d: %w", id, DBError(err, "user"))
+	}
+	if lockedUntil != nil && !lockedUntil.After(now) {
+		return nil, nil
+	}
+	return lockedUntil, nil
+}
+
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error resetting failed logins of user %d: %w", id, err)
+	}
+	return nil
+}
+
+// deleteUserStatements run in order, in one transaction, before the user row
+// is deleted. $1 is the user's ID.
+var deleteUserStatements = []string{
+	// Hand each owned home to its earliest other member who may manage it.
+	`UPDATE homes h SET user_id = heir.user_id
+	 FROM (SELECT DISTINCT ON (hu.home_id) hu.home_id, hu.user_id
+	       FROM home_users hu
+	       JOIN homes ho ON ho.id = hu.home_id
+	       JOIN roles ro ON ro.id = hu.role_id
+	       WHERE ho.user_id = $1 AND hu.user_id <> $1 AND 'home.manage' = ANY(ro.permissions)
+	       ORDER BY hu.home_id, hu.id) heir
+	 WHERE h.id = heir.home_id`,
+	// Hand the organizations' homes left to their earliest other owner, or
+	// else admin.
+	`UPDATE homes h SET user_id = heir.user_id
+	 FROM (SELECT DISTINCT ON (ho.id) ho.id AS home_id, om.user_id
+	       FROM homes ho
+	       JOIN organization_members om ON om.org_id = ho.org_id
+	       WHERE ho.user_id = $1 AND om.user_id <> $1 AND om.role IN ('owner', 'admin')
+	       ORDER BY ho.id, om.role = 'admin', om.created_at, om.user_id) heir
+	 WHERE h.id = heir.home_id`,
+	// Delete the homes left, keeping their devices and readings.
+	`UPDATE devices SET home_id = NULL, space_id = NULL WHERE home_id IN (SELECT id FROM homes WHERE user_id = $1)`,
+	`UPDATE device_data SET home_id = NULL WHERE home_id IN (SELECT id FROM homes WHERE user_id = $1)`,
+	`DELETE FROM device_analytics WHERE home_id IN (SELECT id FROM homes WHERE user_id = $1)`,
+	`DELETE FROM retention_policies WHERE home_id IN (SELECT id FROM homes WHERE user_id = $1)`,
+	`DELETE FROM home_users WHERE user_id = $1 OR home_id IN (SELECT id FROM homes WHERE user_id = $1)`,
+	`DELETE FROM homes WHERE user_id = $1`,
+	// Delete the user's devices with their readings and rollups.
+	`DELETE FROM device_data WHERE device_id IN (SELECT device_id FROM devices WHERE user_id = $1)`,
+	`DELETE FROM device_analytics WHERE device_id IN (SELECT device_id FROM devices WHERE user_id = $1)`,
+	`DELETE FROM devices WHERE user_id = $1`,
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT id FROM users WHERE owner_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		var accounts []int
+		for rows.Next() {
+			var account int
+			if err := rows.Scan(&account); err != nil {
+				rows.Close()
+				return err
+			}
+			accounts = append(accounts, account)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, account := range append(accounts, id) {
+			if err := deleteUser(ctx, tx, account); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting user %d: %w", id, DBError(err, "user"))
+	}
+	return nil
+}
+
+func deleteUser(ctx context.Context, tx pgx.Tx, id int) error {
+	for _, sql := range deleteUserStatements {
+		if _, err := tx.Exec(ctx, sql, id); err != nil {
+			return err
+		}
+	}
+	// Tokens, API keys, identities, MFA enrollments, organization
+	// memberships and invitations are deleted by ON DELETE CASCADE.
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
 	return err
 }
 
-func (r *DeviceRepository) UpdateDevice(device models.Device) error {
-	_, err := r.pool.Exec(
-		context.Background(),
-		`UPDATE devices SET channel_id = $2, production_date = $3, warranty = $4, location = $5, is_active = $6, user_id = $7, home_id = $8, created_at = $9
-		WHERE device_id = $1`,
+func (r *UserRepository) GetServiceAccounts(ctx context.Context, ownerID int) ([]models.User, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+userColumns+` FROM users WHERE owner_id = $1 ORDER BY id`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding service accounts of user %d: %w", ownerID, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.User
+	for rows.Next() {
+		account, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (r *UserRepository) AddUserToken(ctx context.Context, token models.UserToken) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding %s token for user %d: %w", token.Purpose, token.UserID, DBError(err, "token"))
+	}
+	return nil
+}
+
+func (r *UserRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var token models.UserToken
+	err := r.db.QueryRow(
+		ctx,
+		`UPDATE user_tokens SET used_at = $3
+		 WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > $3
+		 RETURNING id, user_id, purpose, token_hash, expires_at, used_at`,
+		purpose, tokenHash, now,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.UsedAt)
+	if err != nil {
+		return token, fmt.Errorf("error consuming %s token: %w", purpose, DBError(err, "token"))
+	}
+	return token, nil
+}
+
+func (r *UserRepository) GetUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var token models.UserToken
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT id, user_id, purpose, token_hash, expires_at, used_at FROM user_tokens
+		 WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > $3`,
+		purpose, tokenHash, now,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.UsedAt)
+	if err != nil {
+		return token, fmt.Errorf("error finding %s token: %w", purpose, DBError(err, "token"))
+	}
+	return token, nil
+}
+
+func (r *UserRepository) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	if err != nil {
+		return fmt.Errorf("error deleting %s tokens of user %d: %w", purpose, userID, err)
+	}
+	return nil
+}
+
+func (r *DeviceRepository) AddDevice(ctx context.Context, device models.Device) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO devices (device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, space_id, device_type_id, decoder, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
 		device.DeviceID, device.ChannelID, device.ProductionDate, device.Warranty, device.Location,
-		device.IsActive, device.UserID, device.HomeID, device.CreatedAt,
+		device.IsActive, device.UserID, device.HomeID, device.SpaceID, device.DeviceTypeID, device.Decoder, device.CreatedAt,
 	)
-	return err
+	if err != nil {
+		return fmt.Errorf("error adding device %s: %w", device.DeviceID, DBError(err, "device"))
+	}
+	return nil
 }
 
-func (r *DeviceRepository) GetDeviceByChannel(channelID string) (models.Device, error) {
-	var device models.Device
-	err := r.pool.QueryRow(
-		context.Background(),
-		`SELECT id, device_id, channel_id, production_date, warranty, location, is_active, user_id, home_id, created_at
-		FROM devices
-		WHERE channel_id = $1`,
+func (r *DeviceRepository) SetDeviceActive(ctx context.Context, deviceID string, active bool) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE devices SET is_active = $2 WHERE device_id = $1 AND is_active <> $2`, deviceID, active)
+	if err != nil {
+		return fmt.Errorf("error updating device %s: %w", deviceID, DBError(err, "device"))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error updating device %s: %w", deviceID, Changed("device"))
+	}
+	return nil
+}
+
+func (r *DeviceRepository) SetDeviceHome(ctx context.Context, deviceID string, ownerID int, from, to *int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE devices SET home_id = $4, space_id = CASE WHEN home_id IS NOT DISTINCT FROM $4 THEN space_id END
+		WHERE device_id = $1 AND user_id = $2 AND home_id IS NOT DISTINCT FROM $3`,
+		deviceID, ownerID, from, to,
+	)
+	if err != nil {
+		return fmt.Errorf("error moving device %s: %w", deviceID, DBError(err, "device"))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error moving device %s: %w", deviceID, Changed("device"))
+	}
+	return nil
+}
+
+func (r *DeviceRepository) SetDeviceSpace(ctx context.Context, deviceID string, homeID int, spaceID *int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE devices SET space_id = $3 WHERE device_id = $1 AND home_id = $2`, deviceID, homeID, spaceID)
+	if err != nil {
+		return fmt.Errorf("error placing device %s: %w", deviceID, DBError(err, "device"))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error placing device %s: %w", deviceID, Changed("device"))
+	}
+	return nil
+}
+
+func (r *DeviceRepository) GetDeviceByChannel(ctx context.Context, channelID string) (models.Device, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	device, err := scanDevice(r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceColumns+` FROM devices WHERE channel_id = $1`,
 		channelID,
-	).Scan(&device.ID, &device.DeviceID, &device.ChannelID, &device.ProductionDate, &device.Warranty,
-		&device.Location, &device.IsActive, &device.UserID, &device.HomeID, &device.CreatedAt)
+	))
 	if err != nil {
-		return device, fmt.Errorf("error finding device by channel ID %s: %w", channelID, err)
+		return device, fmt.Errorf("error finding device by channel ID %s: %w", channelID, DBError(err, "device"))
 	}
 	return device, nil
 }
+
+type DeviceTypeRepository struct {
+	db *DB
+}
+
+func NewDeviceTypeRepository(db *DB) *DeviceTypeRepository {
+	return &DeviceTypeRepository{db: db}
+}
+
+const deviceTypeColumns = `id, name, manufacturer, model, decoder, validation_mode, fields, commands, created_at`
+
+func scanDeviceType(row pgx.Row) (models.DeviceType, error) {
+	var deviceType models.DeviceType
+	err := row.Scan(
+		&deviceType.ID, &deviceType.Name, &deviceType.Manufacturer, &deviceType.Model, &deviceType.Decoder,
+		&deviceType.ValidationMode, &deviceType.Fields, &deviceType.Commands, &deviceType.CreatedAt,
+	)
+	return deviceType, err
+}
+
+func (r *DeviceTypeRepository) AddDeviceType(ctx context.Context, deviceType models.DeviceType) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO device_types (name, manufacturer, model, decoder, validation_mode, fields, commands)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		deviceType.Name, deviceType.Manufacturer, deviceType.Model, deviceType.Decoder,
+		deviceType.ValidationMode, deviceType.Fields, deviceType.Commands,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding device type %s: %w", deviceType.Name, DBError(err, "device type"))
+	}
+	return id, nil
+}
+
+func (r *DeviceTypeRepository) GetDeviceTypeByID(ctx context.Context, id int) (models.DeviceType, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	deviceType, err := scanDeviceType(r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceTypeColumns+` FROM device_types WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		return deviceType, fmt.Errorf("error finding device type by ID %d: %w", id, DBError(err, "device type"))
+	}
+	return deviceType, nil
+}
+
+func (r *DeviceTypeRepository) GetDeviceTypes(ctx context.Context) ([]models.DeviceType, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+deviceTypeColumns+` FROM device_types ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing device types: %w", err)
+	}
+	defer rows.Close()
+
+	var deviceTypes []models.DeviceType
+	for rows.Next() {
+		deviceType, err := scanDeviceType(rows)
+		if err != nil {
+			return nil, err
+		}
+		deviceTypes = append(deviceTypes, deviceType)
+	}
+	return deviceTypes, nil
+}
+
+type RetentionPolicyRepository struct {
+	db *DB
+}
+
+func NewRetentionPolicyRepository(db *DB) *RetentionPolicyRepository {
+	return &RetentionPolicyRepository{db: db}
+}
+
+// SetRetentionPolicy creates or replaces the policy for the policy's home or device type.
+func (r *RetentionPolicyRepository) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO retention_policies (home_id, device_type_id, retention_days) VALUES ($1, $2, $3)
+		ON CONFLICT (home_id) WHERE home_id IS NOT NULL DO UPDATE SET retention_days = EXCLUDED.retention_days`
+	if policy.HomeID == nil {
+		query = `INSERT INTO retention_policies (home_id, device_type_id, retention_days) VALUES ($1, $2, $3)
+		ON CONFLICT (device_type_id) WHERE device_type_id IS NOT NULL DO UPDATE SET retention_days = EXCLUDED.retention_days`
+	}
+	_, err := r.db.Exec(ctx, query, policy.HomeID, policy.DeviceTypeID, policy.RetentionDays)
+	if err != nil {
+		return fmt.Errorf("error setting retention policy: %w", DBError(err, "retention policy"))
+	}
+	return nil
+}
+
+func (r *RetentionPolicyRepository) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT id, home_id, device_type_id, retention_days FROM retention_policies ORDER BY id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []models.RetentionPolicy
+	for rows.Next() {
+		var policy models.RetentionPolicy
+		if err := rows.Scan(&policy.ID, &policy.HomeID, &policy.DeviceTypeID, &policy.RetentionDays); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
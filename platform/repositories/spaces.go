@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SpaceRepository keeps the spaces of homes in Postgres.
+type SpaceRepository struct {
+	db *DB
+}
+
+func NewSpaceRepository(db *DB) *SpaceRepository {
+	return &SpaceRepository{db: db}
+}
+
+const spaceColumns = `id, home_id, parent_id, name, kind, created_at`
+
+func scanSpace(row pgx.Row) (models.Space, error) {
+	var space models.Space
+	err := row.Scan(&space.ID, &space.HomeID, &space.ParentID, &space.Name, &space.Kind, &space.CreatedAt)
+	return space, err
+}
+
+func (r *SpaceRepository) AddSpace(ctx context.Context, space models.Space) (int, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		`INSERT INTO spaces (home_id, parent_id, name, kind) VALUES ($1, $2, $3, $4) RETURNING id`,
+		space.HomeID, space.ParentID, space.Name, space.Kind,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error adding space %s to home %d: %w", space.Name, space.HomeID, DBError(err, "space"))
+	}
+	return id, nil
+}
+
+func (r *SpaceRepository) GetSpaceByID(ctx context.Context, id int) (models.Space, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	space, err := scanSpace(r.db.QueryRow(ctx, `SELECT `+spaceColumns+` FROM spaces WHERE id = $1`, id))
+	if err != nil {
+		return space, fmt.Errorf("error finding space %d: %w", id, DBError(err, "space"))
+	}
+	return space, nil
+}
+
+func (r *SpaceRepository) GetHomeSpaces(ctx context.Context, homeID int) ([]models.Space, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+spaceColumns+` FROM spaces WHERE home_id = $1 ORDER BY id`, homeID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding spaces of home %d: %w", homeID, err)
+	}
+	defer rows.Close()
+
+	var spaces []models.Space
+	for rows.Next() {
+		space, err := scanSpace(rows)
+		if err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, space)
+	}
+	return spaces, rows.Err()
+}
+
+func (r *SpaceRepository) UpdateSpace(ctx context.Context, space models.Space) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE spaces SET parent_id = $2, name = $3, kind = $4 WHERE id = $1`,
+		space.ID, space.ParentID, space.Name, space.Kind,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error updating space %d: %w", space.ID, DBError(err, "space"))
+	}
+	return nil
+}
+
+func (r *SpaceRepository) DeleteSpace(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM spaces WHERE id = $1`, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting space %d: %w", id, DBError(err, "space"))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/models"
+)
+
+// SSORepository keeps single sign-on logins and user identities in
+// Postgres.
+type SSORepository struct {
+	db *DB
+}
+
+func NewSSORepository(db *DB) *SSORepository {
+	return &SSORepository{db: db}
+}
+
+func (r *SSORepository) AddSSOLogin(ctx context.Context, login models.SSOLogin) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM sso_logins WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("error deleting expired SSO logins: %w", err)
+	}
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO sso_logins (provider, state_hash, nonce, verifier, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		login.Provider, login.StateHash, login.Nonce, login.Verifier, login.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding SSO login with %s: %w", login.Provider, DBError(err, "login"))
+	}
+	return nil
+}
+
+func (r *SSORepository) ConsumeSSOLogin(ctx context.Context, stateHash string, now time.Time) (models.SSOLogin, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var login models.SSOLogin
+	err := r.db.QueryRow(
+		ctx,
+		`DELETE FROM sso_logins WHERE state_hash = $1 AND expires_at > $2
+		 RETURNING id, provider, state_hash, nonce, verifier, expires_at`,
+		stateHash, now,
+	).Scan(&login.ID, &login.Provider, &login.StateHash, &login.Nonce, &login.Verifier, &login.ExpiresAt)
+	if err != nil {
+		return login, fmt.Errorf("error consuming SSO login: %w", DBError(err, "login"))
+	}
+	return login, nil
+}
+
+func (r *SSORepository) AddUserIdentity(ctx context.Context, identity models.UserIdentity) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Exec(
+		ctx,
+		`INSERT INTO user_identities (user_id, provider, subject) VALUES ($1, $2, $3)`,
+		identity.UserID, identity.Provider, identity.Subject,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding %s identity of user %d: %w", identity.Provider, identity.UserID, DBError(err, "identity"))
+	}
+	return nil
+}
+
+func (r *SSORepository) GetUserIdentity(ctx context.Context, provider, subject string) (models.UserIdentity, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	var identity models.UserIdentity
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT id, user_id, provider, subject, created_at FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.CreatedAt)
+	if err != nil {
+		return identity, fmt.Errorf("error finding %s identity: %w", provider, DBError(err, "identity"))
+	}
+	return identity, nil
+}
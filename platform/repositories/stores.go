@@ -0,0 +1,341 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"PragatiIot/platform/models"
+)
+
+// The services depend on these interfaces rather than on the Postgres
+// repositories, so they can run against the in-memory implementations in
+// the memory package. Implementations translate a missing row or a
+// constraint violation with DBError, so callers can test for the apperrors
+// kinds while pgx.ErrNoRows or the *pgconn.PgError stays in the chain.
+
+// UserStore persists users.
+type UserStore interface {
+	AddUser(ctx context.Context, user models.User) error
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// UpdateUser saves the email, password hash and verification state of
+	// the user with user.ID. A new password hash bumps the token version.
+	UpdateUser(ctx context.Context, user models.User) error
+	// RecordLoginFailure counts a failed login. The maxFailures-th failure in
+	// a row locks the user until now plus lockout and restarts the count. It
+	// returns the time the user is locked until, if locked.
+	RecordLoginFailure(ctx context.Context, id, maxFailures int, lockout time.Duration, now time.Time) (*time.Time, error)
+	// ResetLoginFailures clears the failed login count and any lock.
+	ResetLoginFailures(ctx context.Context, id int) error
+	// DeleteUser deletes a user and everything that cannot outlive them.
+	// Each home they own passes to the earliest other member whose role has
+	// home.manage, or, for an organization's home, to its earliest other
+	// owner or admin, or is deleted with its memberships, roles,
+	// invitations, policy and rollups if there is none; its devices and
+	// readings are kept without a home. The user's memberships, tokens,
+	// identities, API keys, invitations and devices are deleted, with the
+	// devices' readings and rollups. Service accounts the user owns are
+	// deleted the same way first.
+	DeleteUser(ctx context.Context, id int) error
+	// GetServiceAccounts returns the service accounts the user owns.
+	GetServiceAccounts(ctx context.Context, ownerID int) ([]models.User, error)
+}
+
+// APIKeyStore persists the API keys of service accounts.
+type APIKeyStore interface {
+	AddAPIKey(ctx context.Context, key models.APIKey) (int, error)
+	GetAPIKeyByID(ctx context.Context, id int) (models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	GetAPIKeys(ctx context.Context, serviceAccountID int) ([]models.APIKey, error)
+	// RevokeAPIKey marks the key revoked at now, unless it already is.
+	RevokeAPIKey(ctx context.Context, id int, now time.Time) error
+	// TouchAPIKey records that the key was used at now.
+	TouchAPIKey(ctx context.Context, id int, now time.Time) error
+}
+
+// SSOStore persists the logins in progress with identity providers and the
+// identities users sign in with.
+type SSOStore interface {
+	// AddSSOLogin saves a login in progress and deletes those that expired.
+	AddSSOLogin(ctx context.Context, login models.SSOLogin) error
+	// ConsumeSSOLogin deletes the login with the state hash and returns it
+	// if it had not expired at now, or returns a not found error.
+	ConsumeSSOLogin(ctx context.Context, stateHash string, now time.Time) (models.SSOLogin, error)
+	AddUserIdentity(ctx context.Context, identity models.UserIdentity) error
+	GetUserIdentity(ctx context.Context, provider, subject string) (models.UserIdentity, error)
+}
+
+// UserTokenStore persists the single-use tokens mailed to users.
+type UserTokenStore interface {
+	AddUserToken(ctx context.Context, token models.UserToken) error
+	// ConsumeUserToken marks the unused, unexpired token with the hash and
+	// purpose used at now and returns it, or returns a not found error.
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error)
+	// GetUserToken returns the unused, unexpired token with the hash and
+	// purpose without using it, or returns a not found error.
+	GetUserToken(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error)
+	// DeleteUserTokens deletes the user's tokens for purpose, used or not.
+	DeleteUserTokens(ctx context.Context, userID int, purpose string) error
+}
+
+// MFAStore persists TOTP enrollments and recovery codes.
+type MFAStore interface {
+	// SetMFASecret starts an enrollment with the sealed secret, replacing an
+	// unconfirmed one. It does not change a confirmed enrollment.
+	SetMFASecret(ctx context.Context, userID int, sealedSecret string) error
+	GetMFA(ctx context.Context, userID int) (models.UserMFA, error)
+	// EnableMFA confirms the user's enrollment at now with a code of the
+	// step, sets the user's MFAEnabled, bumps their token version and
+	// replaces their recovery codes with the hashes.
+	EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string, now time.Time) error
+	// DisableMFA deletes the user's enrollment and recovery codes, and bumps
+	// their token version if MFA was enabled.
+	DisableMFA(ctx context.Context, userID int) error
+	// UseMFAStep records that a code of the step was used, or returns a not
+	// found error if one of the step or a later one already was.
+	UseMFAStep(ctx context.Context, userID int, step int64) error
+	// UseRecoveryCode marks the user's unused recovery code with the hash
+	// used at now, or returns a not found error.
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string, now time.Time) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+}
+
+// RoleStore persists the roles a user can hold in a home: the built-in
+// roles, which have no home, and each home's custom roles.
+type RoleStore interface {
+	// GetRoleByName returns the built-in role with the name.
+	GetRoleByName(ctx context.Context, roleName string) (models.Role, error)
+	GetRoleByID(ctx context.Context, id int) (models.Role, error)
+	// GetHomeRole returns the built-in or the home's custom role with the
+	// name.
+	GetHomeRole(ctx context.Context, homeID int, roleName string) (models.Role, error)
+	// GetHomeRoles returns the built-in roles followed by the home's custom
+	// roles.
+	GetHomeRoles(ctx context.Context, homeID int) ([]models.Role, error)
+	AddRole(ctx context.Context, role models.Role) (int, error)
+	// UpdateRole saves the name and permissions of a custom role.
+	UpdateRole(ctx context.Context, role models.Role) error
+	// DeleteRole deletes a custom role.
+	DeleteRole(ctx context.Context, id int) error
+	// CountRoleMembers counts the home members holding the role.
+	CountRoleMembers(ctx context.Context, id int) (int, error)
+}
+
+// OrganizationStore persists organizations and their members.
+type OrganizationStore interface {
+	// AddOrganization adds the organization with ownerID as its owner and
+	// returns its ID.
+	AddOrganization(ctx context.Context, org models.Organization, ownerID int) (int, error)
+	GetOrganizationByID(ctx context.Context, id int) (models.Organization, error)
+	// UpdateOrganization saves the name and billing email. The plan and
+	// quotas are left to billing.
+	UpdateOrganization(ctx context.Context, org models.Organization) error
+	GetOrgMember(ctx context.Context, orgID, userID int) (models.OrgMember, error)
+	GetOrgMembers(ctx context.Context, orgID int) ([]models.OrgMember, error)
+	// GetUserOrgMembers returns the user's memberships of organizations.
+	GetUserOrgMembers(ctx context.Context, userID int) ([]models.OrgMember, error)
+	// SetOrgMember adds the member, or changes their role if they are one.
+	SetOrgMember(ctx context.Context, member models.OrgMember) error
+	RemoveOrgMember(ctx context.Context, orgID, userID int) error
+	// GetOrgUsage counts the organization's homes, the devices in them and
+	// its members.
+	GetOrgUsage(ctx context.Context, orgID int) (models.OrgUsage, error)
+}
+
+// HomeStore persists homes and their members.
+type HomeStore interface {
+	AddHome(ctx context.Context, home models.Home) (int, error)
+	GetHomeByID(ctx context.Context, id int) (models.Home, error)
+	SetHomeRequireMFA(ctx context.Context, id int, require bool) error
+	GetHomesByUserID(ctx context.Context, userID int) ([]models.Home, error)
+	GetHomesByOrgID(ctx context.Context, orgID int) ([]models.Home, error)
+	AddUserToHome(ctx context.Context, homeUser models.HomeUser) error
+	GetHomeUserRole(ctx context.Context, homeID, userID int) (int, error)
+	// GetPermittedHomeIDs returns the homes the user owns or holds the
+	// permission in, through their role in the home or in its organization.
+	GetPermittedHomeIDs(ctx context.Context, userID int, permission string) ([]int, error)
+}
+
+// InvitationStore persists invitations to homes.
+type InvitationStore interface {
+	AddInvitation(ctx context.Context, inv models.HomeInvitation) (int, error)
+	GetInvitationByID(ctx context.Context, id int) (models.HomeInvitation, error)
+	GetPendingHomeInvitations(ctx context.Context, homeID int) ([]models.HomeInvitation, error)
+	// GetPendingUserInvitations returns the pending invitations to the
+	// user, and those to email that name no user. An empty email matches
+	// none.
+	GetPendingUserInvitations(ctx context.Context, userID int, email string) ([]models.HomeInvitation, error)
+	// RespondToInvitation sets the status of a pending invitation, or
+	// returns a not found error if it is not pending.
+	RespondToInvitation(ctx context.Context, id int, status string, now time.Time) error
+}
+
+// DeviceTransferStore persists transfers of devices between owners.
+type DeviceTransferStore interface {
+	AddDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer) (int, error)
+	GetDeviceTransferByID(ctx context.Context, id int) (models.DeviceTransfer, error)
+	// GetPendingUserTransfers returns the pending transfers from or to the
+	// user.
+	GetPendingUserTransfers(ctx context.Context, userID int) ([]models.DeviceTransfer, error)
+	// GetAcceptedDeviceTransfers returns the device's accepted transfers,
+	// oldest first.
+	GetAcceptedDeviceTransfers(ctx context.Context, deviceID string) ([]models.DeviceTransfer, error)
+	// RespondToDeviceTransfer sets the status of a pending transfer, or
+	// returns a not found error if it is not pending.
+	RespondToDeviceTransfer(ctx context.Context, id int, status string, now time.Time) error
+	// AcceptDeviceTransfer accepts the pending transfer and, in the same
+	// transaction, gives the device to the recipient, out of any home and
+	// on channelID. Unless the transfer keeps telemetry, the readings and
+	// rollups from since on are purged. It returns a not found error if the
+	// transfer is no longer pending or the device changed hands.
+	AcceptDeviceTransfer(ctx context.Context, transfer models.DeviceTransfer, channelID string, since, now time.Time) error
+}
+
+// SpaceStore persists the spaces of homes.
+type SpaceStore interface {
+	AddSpace(ctx context.Context, space models.Space) (int, error)
+	GetSpaceByID(ctx context.Context, id int) (models.Space, error)
+	// GetHomeSpaces returns the home's spaces in the order they were added.
+	GetHomeSpaces(ctx context.Context, homeID int) ([]models.Space, error)
+	// UpdateSpace saves the space's parent, name and kind.
+	UpdateSpace(ctx context.Context, space models.Space) error
+	// DeleteSpace deletes a space without child spaces. Its devices are
+	// left in no space.
+	DeleteSpace(ctx context.Context, id int) error
+}
+
+// DeviceStore persists devices, their telemetry and its rollups.
+// DeviceTagStore persists the key/value tags of devices.
+type DeviceTagStore interface {
+	// SetDeviceTags replaces the device's tags.
+	SetDeviceTags(ctx context.Context, deviceID string, tags map[string]string) error
+	GetDeviceTags(ctx context.Context, deviceID string) (map[string]string, error)
+	// GetHomeDeviceTags returns the tags of the home's devices by device ID.
+	GetHomeDeviceTags(ctx context.Context, homeID int) (map[string]map[string]string, error)
+}
+
+// DeviceGroupStore persists device groups and the members of static groups.
+type DeviceGroupStore interface {
+	AddDeviceGroup(ctx context.Context, group models.DeviceGroup) (int, error)
+	GetDeviceGroupByID(ctx context.Context, id int) (models.DeviceGroup, error)
+	// GetHomeDeviceGroups returns the home's groups in the order they were
+	// added.
+	GetHomeDeviceGroups(ctx context.Context, homeID int) ([]models.DeviceGroup, error)
+	// UpdateDeviceGroup saves the group's name and selector.
+	UpdateDeviceGroup(ctx context.Context, group models.DeviceGroup) error
+	DeleteDeviceGroup(ctx context.Context, id int) error
+	// AddGroupMembers adds the devices to the group, skipping members.
+	AddGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error
+	RemoveGroupMembers(ctx context.Context, groupID int, deviceIDs []string) error
+	// GetGroupMembers returns the IDs of the group's devices in order.
+	GetGroupMembers(ctx context.Context, groupID int) ([]string, error)
+}
+
+// DeviceJobStore persists device jobs and their results per device. Jobs
+// read back with their counts of results.
+type DeviceJobStore interface {
+	// AddDeviceJob adds the job with a pending result for each device.
+	AddDeviceJob(ctx context.Context, job models.DeviceJob, deviceIDs []string) (int, error)
+	GetDeviceJobByID(ctx context.Context, id int) (models.DeviceJob, error)
+	// GetHomeDeviceJobs returns the home's latest jobs, newest first.
+	GetHomeDeviceJobs(ctx context.Context, homeID, limit int) ([]models.DeviceJob, error)
+	GetDeviceJobResults(ctx context.Context, jobID int) ([]models.DeviceJobResult, error)
+	// ClaimDeviceJob marks the oldest queued job, or running job last
+	// claimed before staleBefore, as running and claimed now and returns it.
+	// It is not found if there is none.
+	ClaimDeviceJob(ctx context.Context, now, staleBefore time.Time) (models.DeviceJob, error)
+	// SetDeviceJobResult saves the job's result on a device and renews the
+	// job's claim as of the result's FinishedAt.
+	SetDeviceJobResult(ctx context.Context, result models.DeviceJobResult) error
+	FinishDeviceJob(ctx context.Context, id int, now time.Time) error
+}
+
+type DeviceStore interface {
+	AddDevice(ctx context.Context, device models.Device) error
+	// SetDeviceActive activates or deactivates the device. It fails with a
+	// conflict if the device is gone or already in that state.
+	SetDeviceActive(ctx context.Context, deviceID string, active bool) error
+	// SetDeviceHome moves the device from the home from to the home to, or
+	// out of any home if to is nil, and out of its space if the home changes.
+	// It fails with a conflict unless the device still has this owner and is
+	// still in from.
+	SetDeviceHome(ctx context.Context, deviceID string, ownerID int, from, to *int) error
+	// SetDeviceSpace places the device in the space, or in no space if
+	// spaceID is nil. It fails with a conflict unless the device is still in
+	// the home.
+	SetDeviceSpace(ctx context.Context, deviceID string, homeID int, spaceID *int) error
+	GetDeviceByID(ctx context.Context, deviceID string) (models.Device, error)
+	GetDeviceByChannel(ctx context.Context, channelID string) (models.Device, error)
+	GetDevicesByUserID(ctx context.Context, userID int) ([]models.Device, error)
+	GetDevicesByHomeID(ctx context.Context, homeID int) ([]models.Device, error)
+	// GetActiveChannels returns the channel IDs of the active devices.
+	GetActiveChannels(ctx context.Context) ([]string, error)
+	AddDeviceData(ctx context.Context, deviceData models.DeviceData) error
+	AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error
+	GetDeviceData(ctx context.Context, query TelemetryQuery) ([]models.DeviceData, error)
+	GetDeviceAnalytics(ctx context.Context, deviceID string, homeID int, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error)
+	// GetHomeAnalytics returns the devices' rollups of readings taken in the
+	// home, by period.
+	GetHomeAnalytics(ctx context.Context, homeID int, deviceIDs []string, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error)
+}
+
+// DeviceTypeStore persists the device type catalog.
+type DeviceTypeStore interface {
+	AddDeviceType(ctx context.Context, deviceType models.DeviceType) (int, error)
+	GetDeviceTypeByID(ctx context.Context, id int) (models.DeviceType, error)
+	GetDeviceTypes(ctx context.Context) ([]models.DeviceType, error)
+}
+
+// RetentionPolicyStore persists telemetry retention policies.
+type RetentionPolicyStore interface {
+	SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error
+	GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error)
+}
+
+// AuditQuery selects audit entries, newest first. Zero fields do not filter.
+type AuditQuery struct {
+	// VisibleTo, if set, restricts the entries to those the user may read:
+	// entries on the homes in AdminHomeIDs, and entries the user made or
+	// that target the user.
+	VisibleTo    *int
+	AdminHomeIDs []int
+
+	ActorID    *int
+	HomeID     *int
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	// BeforeID pages backwards: only entries with a smaller ID are returned.
+	BeforeID int64
+	Limit    int
+}
+
+// AuditStore persists the append-only audit log.
+type AuditStore interface {
+	AddAuditEntry(ctx context.Context, entry models.AuditEntry) error
+	GetAuditEntries(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error)
+}
+
+var (
+	_ UserStore            = (*UserRepository)(nil)
+	_ UserTokenStore       = (*UserRepository)(nil)
+	_ APIKeyStore          = (*APIKeyRepository)(nil)
+	_ SSOStore             = (*SSORepository)(nil)
+	_ MFAStore             = (*MFARepository)(nil)
+	_ RoleStore            = (*RoleRepository)(nil)
+	_ InvitationStore      = (*InvitationRepository)(nil)
+	_ HomeStore            = (*HomeRepository)(nil)
+	_ OrganizationStore    = (*OrganizationRepository)(nil)
+	_ SpaceStore           = (*SpaceRepository)(nil)
+	_ DeviceStore          = (*DeviceRepository)(nil)
+	_ DeviceTagStore       = (*DeviceGroupRepository)(nil)
+	_ DeviceGroupStore     = (*DeviceGroupRepository)(nil)
+	_ DeviceJobStore       = (*DeviceJobRepository)(nil)
+	_ DeviceTransferStore  = (*DeviceTransferRepository)(nil)
+	_ DeviceTypeStore      = (*DeviceTypeRepository)(nil)
+	_ RetentionPolicyStore = (*RetentionPolicyRepository)(nil)
+	_ AuditStore           = (*AuditRepository)(nil)
+)
@@ -0,0 +1,431 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Partition intervals supported by PartitionedTelemetryStore.
+const (
+	PartitionDaily   = "day"
+	PartitionMonthly = "month"
+)
+
+// Rollup granularities written to device_analytics.
+const (
+	RollupHourly = "hour"
+	RollupDaily  = "day"
+)
+
+// TelemetryQuery selects stored readings. Zero times leave the range open.
+// DefaultTelemetryLimit is the most readings a query without a Limit
+// returns.
+const DefaultTelemetryLimit = 1000
+
+type TelemetryQuery struct {
+	DeviceID string
+	// DeviceIDs, if set, selects the readings of any of these devices
+	// instead of DeviceID's.
+	DeviceIDs []string
+	HomeID    *int
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// TelemetryStore persists device telemetry. DeviceRepository delegates to it
+// so the table layout can change without touching its callers.
+type TelemetryStore interface {
+	Insert(ctx context.Context, data models.DeviceData) error
+	InsertBatch(ctx context.Context, batch []models.DeviceData) error
+	Query(ctx context.Context, query TelemetryQuery) ([]models.DeviceData, error)
+}
+
+// TelemetryMaintainer is implemented by stores that manage partitions,
+// retention and downsampled rollups themselves.
+type TelemetryMaintainer interface {
+	EnsurePartitions(ctx context.Context, now time.Time) error
+	ApplyRetention(ctx context.Context, now time.Time, defaultDays int) error
+	Rollup(ctx context.Context, granularity string, from, to time.Time) error
+}
+
+// PartitionedTelemetryStore keeps telemetry in device_data, a table
+// range-partitioned on created_at with one partition per day or month.
+type PartitionedTelemetryStore struct {
+	db       *DB
+	interval string
+	premake  int
+	logger   *slog.Logger
+}
+
+// NewPartitionedTelemetryStore returns a store that creates partitions of the
+// given interval and keeps premake future partitions ready.
+func NewPartitionedTelemetryStore(db *DB, interval string, premake int, logger *slog.Logger) (*PartitionedTelemetryStore, error) {
+	if interval == "" {
+		interval = PartitionDaily
+	}
+	if interval != PartitionDaily && interval != PartitionMonthly {
+		return nil, fmt.Errorf("unsupported partition interval: %s", interval)
+	}
+	if premake < 1 {
+		premake = 1
+	}
+	return &PartitionedTelemetryStore{db: db, interval: interval, premake: premake, logger: logger}, nil
+}
+
+func (s *PartitionedTelemetryStore) Insert(ctx context.Context, data models.DeviceData) error {
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = time.Now().UTC()
+	}
+
+	err := s.insert(ctx, data)
+	if isMissingPartition(err) {
+		if err := s.createPartition(ctx, s.bucketStart(data.CreatedAt)); err != nil {
+			return err
+		}
+		err = s.insert(ctx, data)
+	}
+	if err != nil {
+		return fmt.Errorf("error adding data for device %s: %w", data.DeviceID, DBError(err, "reading"))
+	}
+	return nil
+}
+
+func (s *PartitionedTelemetryStore) insert(ctx context.Context, data models.DeviceData) error {
+	ctx, cancel := s.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(
+		ctx,
+		`INSERT INTO device_data (device_id, home_id, data, schema_violations, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		data.DeviceID, data.HomeID, data.Data, data.SchemaViolations, data.CreatedAt,
+	)
+	return err
+}
+
+// InsertBatch writes readings with COPY. The batch is written atomically.
+func (s *PartitionedTelemetryStore) InsertBatch(ctx context.Context, batch []models.DeviceData) error {
+	rows := make([][]interface{}, len(batch))
+	buckets := make(map[time.Time]struct{})
+	for i, data := range batch {
+		if data.CreatedAt.IsZero() {
+			data.CreatedAt = time.Now().UTC()
+		}
+		rows[i] = []interface{}{data.DeviceID, data.HomeID, data.Data, data.SchemaViolations, data.CreatedAt}
+		buckets[s.bucketStart(data.CreatedAt)] = struct{}{}
+	}
+
+	err := s.copy(ctx, rows)
+	if isMissingPartition(err) {
+		for start := range buckets {
+			if err := s.createPartition(ctx, start); err != nil {
+				return err
+			}
+		}
+		err = s.copy(ctx, rows)
+	}
+	if err != nil {
+		return fmt.Errorf("error adding batch of %d readings: %w", len(batch), DBError(err, "reading"))
+	}
+	return nil
+}
+
+func (s *PartitionedTelemetryStore) copy(ctx context.Context, rows [][]interface{}) error {
+	ctx, cancel := s.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.CopyFrom(
+		ctx,
+		pgx.Identifier{"device_data"},
+		[]string{"device_id", "home_id", "data", "schema_violations", "created_at"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+func (s *PartitionedTelemetryStore) Query(ctx context.Context, query TelemetryQuery) ([]models.DeviceData, error) {
+	conditions := []string{"device_id = $1"}
+	args := []interface{}{query.DeviceID}
+	if query.DeviceIDs != nil {
+		conditions[0] = "device_id = ANY($1)"
+		args[0] = query.DeviceIDs
+	}
+	if query.HomeID != nil {
+		args = append(args, *query.HomeID)
+		conditions = append(conditions, fmt.Sprintf("home_id = $%d", len(args)))
+	}
+	if !query.From.IsZero() {
+		args = append(args, query.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !query.To.IsZero() {
+		args = append(args, query.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultTelemetryLimit
+	}
+	args = append(args, limit)
+
+	ctx, cancel := s.db.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.Query(
+		ctx,
+		`SELECT device_id, home_id, data, schema_violations, created_at FROM device_data
+		WHERE `+strings.Join(conditions, " AND ")+fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying data for device %s: %w", query.DeviceID, err)
+	}
+	defer rows.Close()
+
+	var readings []models.DeviceData
+	for rows.Next() {
+		var reading models.DeviceData
+		if err := rows.Scan(&reading.DeviceID, &reading.HomeID, &reading.Data, &reading.SchemaViolations, &reading.CreatedAt); err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
+
+// EnsurePartitions creates the partition holding now and the configured number
+// of partitions after it.
+func (s *PartitionedTelemetryStore) EnsurePartitions(ctx context.Context, now time.Time) error {
+	start := s.bucketStart(now)
+	for i := 0; i <= s.premake; i++ {
+		if err := s.createPartition(ctx, start); err != nil {
+			return err
+		}
+		start = s.bucketEnd(start)
+	}
+	return nil
+}
+
+// ApplyRetention removes telemetry older than its retention period. A home's
+// policy takes precedence over its device type's, which takes precedence over
+// defaultDays; zero defaultDays keeps data without a policy forever. Whole
+// partitions are dropped once every policy has expired them, and older rows
+// in the remaining partitions are deleted per policy.
+func (s *PartitionedTelemetryStore) ApplyRetention(ctx context.Context, now time.Time, defaultDays int) error {
+	var longest int
+	err := s.db.QueryRow(ctx, `SELECT COALESCE(MAX(retention_days), 0) FROM retention_policies`).Scan(&longest)
+	if err != nil {
+		return fmt.Errorf("error reading retention policies: %w", err)
+	}
+
+	if defaultDays > 0 {
+		if defaultDays > longest {
+			longest = defaultDays
+		}
+		partitions, err := s.partitions(ctx)
+		if err != nil {
+			return err
+		}
+		cutoff := now.AddDate(0, 0, -longest)
+		for _, p := range partitions {
+			if p.end.After(cutoff) {
+				continue
+			}
+			if _, err := s.db.Exec(ctx, `DROP TABLE IF EXISTS `+p.name); err != nil {
+				return fmt.Errorf("error dropping partition %s: %w", p.name, err)
+			}
+			s.logger.InfoContext(ctx, "Dropped expired telemetry partition", "partition", p.name)
+		}
+	}
+
+	err = s.execMaintenance(
+		ctx,
+		`DELETE FROM device_data d
+		WHERE d.created_at < $1::timestamptz - make_interval(days => COALESCE(
+			(SELECT p.retention_days FROM retention_policies p WHERE p.home_id = d.home_id),
+			(SELECT p.retention_days FROM retention_policies p JOIN devices dev ON dev.device_type_id = p.device_type_id
+			 WHERE dev.device_id = d.device_id),
+			NULLIF($2, 0)
+		))`,
+		now, defaultDays,
+	)
+	if err != nil {
+		return fmt.Errorf("error applying retention policies: %w", err)
+	}
+	return nil
+}
+
+// Rollup aggregates every numeric telemetry field between from and to into
+// device_analytics buckets of the given granularity. Re-running a window
+// replaces its buckets, so the current, still-open bucket can be refreshed.
+// The end of the window should be now or a bucket boundary.
+func (s *PartitionedTelemetryStore) Rollup(ctx context.Context, granularity string, from, to time.Time) error {
+	// Widen the window to whole buckets so an upsert never replaces a bucket
+	// with a partial aggregate.
+	from = from.UTC()
+	switch granularity {
+	case RollupHourly:
+		from = from.Truncate(time.Hour)
+	case RollupDaily:
+		from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return fmt.Errorf("unsupported rollup granularity: %s", granularity)
+	}
+
+	err := s.execMaintenance(
+		ctx,
+		`INSERT INTO device_analytics (device_id, home_id, metric, value, count, min_value, max_value, avg_value, sum_value, aggregation_period, granularity)
+		SELECT d.device_id, d.home_id, kv.key, AVG(n.v), COUNT(*), MIN(n.v), MAX(n.v), AVG(n.v), SUM(n.v),
+			date_trunc($1, d.created_at AT TIME ZONE 'UTC'), $1
+		FROM device_data d
+		CROSS JOIN LATERAL jsonb_each(d.data) kv
+		CROSS JOIN LATERAL (SELECT CASE WHEN jsonb_typeof(kv.value) = 'number' THEN (kv.value #>> '{}')::numeric END AS v) n
+		WHERE n.v IS NOT NULL AND d.created_at >= $2 AND d.created_at < $3
+		GROUP BY 1, 2, 3, 10
+		ON CONFLICT (device_id, COALESCE(home_id, 0), metric, granularity, aggregation_period) DO UPDATE SET
+			value = EXCLUDED.value, count = EXCLUDED.count, min_value = EXCLUDED.min_value, max_value = EXCLUDED.max_value,
+			avg_value = EXCLUDED.avg_value, sum_value = EXCLUDED.sum_value, created_at = CURRENT_TIMESTAMP`,
+		granularity, from, to,
+	)
+	if err != nil {
+		return fmt.Errorf("error rolling up %s telemetry: %w", granularity, err)
+	}
+	return nil
+}
+
+// execMaintenance runs a statement that may outlast the pool's
+// statement_timeout. It is bounded by ctx instead.
+func (s *PartitionedTelemetryStore) execMaintenance(ctx context.Context, sql string, args ...interface{}) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql, args...)
+		return err
+	})
+}
+
+type telemetryPartition struct {
+	name       string
+	start, end time.Time
+}
+
+func (s *PartitionedTelemetryStore) partitions(ctx context.Context) ([]telemetryPartition, error) {
+	rows, err := s.db.Query(
+		ctx,
+		`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'device_data'`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing telemetry partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []telemetryPartition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if p, ok := parsePartitionName(name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].start.Before(partitions[j].start) })
+	return partitions, rows.Err()
+}
+
+func (s *PartitionedTelemetryStore) createPartition(ctx context.Context, start time.Time) error {
+	// Skip ranges already covered, e.g. by monthly partitions created before
+	// the interval was switched to daily.
+	existing, err := s.partitions(ctx)
+	if err != nil {
+		return err
+	}
+	end := s.bucketEnd(start)
+	for _, p := range existing {
+		if p.start.Before(end) && start.Before(p.end) {
+			return nil
+		}
+	}
+
+	name := partitionName(start, s.interval)
+	_, err = s.db.Exec(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF device_data FOR VALUES FROM ('%s') TO ('%s')`,
+		name, start.Format(time.RFC3339), end.Format(time.RFC3339),
+	))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P17" {
+		// Another replica created an overlapping partition first.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating telemetry partition for %s: %w", start.Format("2006-01-02"), err)
+	}
+	s.logger.DebugContext(ctx, "Ensured telemetry partition", "partition", name)
+	return nil
+}
+
+func (s *PartitionedTelemetryStore) bucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	if s.interval == PartitionMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (s *PartitionedTelemetryStore) bucketEnd(start time.Time) time.Time {
+	if s.interval == PartitionMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Partitions are named device_data_pYYYYMMDD (daily) or device_data_pYYYYMM
+// (monthly), so their range can be recovered from the name.
+func partitionName(start time.Time, interval string) string {
+	if interval == PartitionMonthly {
+		return "device_data_p" + start.Format("200601")
+	}
+	return "device_data_p" + start.Format("20060102")
+}
+
+func parsePartitionName(name string) (telemetryPartition, bool) {
+	suffix, ok := strings.CutPrefix(name, "device_data_p")
+	if !ok {
+		return telemetryPartition{}, false
+	}
+	switch len(suffix) {
+	case 8:
+		start, err := time.Parse("20060102", suffix)
+		if err != nil {
+			return telemetryPartition{}, false
+		}
+		return telemetryPartition{name: name, start: start, end: start.AddDate(0, 0, 1)}, true
+	case 6:
+		start, err := time.Parse("200601", suffix)
+		if err != nil {
+			return telemetryPartition{}, false
+		}
+		return telemetryPartition{name: name, start: start, end: start.AddDate(0, 1, 0)}, true
+	default:
+		return telemetryPartition{}, false
+	}
+}
+
+// isMissingPartition reports whether err is Postgres refusing a row because no
+// partition covers its created_at.
+func isMissingPartition(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == codeCheckViolation && strings.Contains(pgErr.Message, "no partition")
+}
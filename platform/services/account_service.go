@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/mailer"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountConfig configures the tokens mailed to users.
+type AccountConfig struct {
+	// BaseURL is the address of the client app. Emails link to its
+	// /verify-email and /reset-password pages, which post the token back to
+	// the API.
+	BaseURL         string
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+	// MaxLoginFailures failed logins in a row lock an account for
+	// LockoutDuration. Zero disables lockout.
+	MaxLoginFailures int
+	LockoutDuration  time.Duration
+}
+
+// AccountService manages users' own accounts: registration, email
+// verification, passwords, profile and deletion.
+type AccountService struct {
+	users  repositories.UserStore
+	tokens repositories.UserTokenStore
+	mailer mailer.Mailer
+	audit  *audit.Recorder
+	config AccountConfig
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func NewAccountService(users repositories.UserStore, tokens repositories.UserTokenStore, mailer mailer.Mailer, recorder *audit.Recorder, config AccountConfig, logger *slog.Logger) *AccountService {
+	if config.VerificationTTL <= 0 {
+		config.VerificationTTL = 48 * time.Hour
+	}
+	if config.ResetTTL <= 0 {
+		config.ResetTTL = time.Hour
+	}
+	if config.LockoutDuration <= 0 {
+		config.LockoutDuration = 15 * time.Minute
+	}
+	return &AccountService{users: users, tokens: tokens, mailer: mailer, audit: recorder, config: config, logger: logger, now: time.Now}
+}
+
+// ErrInvalidCredentials does not say whether the username or the password
+// was wrong.
+var ErrInvalidCredentials = apperrors.Unauthorized("Invalid username or password")
+
+// errInvalidToken does not say whether the token is unknown, used or expired.
+var errInvalidToken = apperrors.Invalid("token", "is invalid or has expired")
+
+// Register adds a user with the password and mails them a verification link.
+// A failure to send the email is logged; the user can ask for another.
+func (s *AccountService) Register(ctx context.Context, user models.User, password string) (models.User, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return user, err
+	}
+	user.PasswordHash = hash
+	user.EmailVerified = false
+	if err := s.users.AddUser(ctx, user); err != nil {
+		return user, err
+	}
+	user, err = s.users.GetUserByUsername(ctx, user.Username)
+	if err != nil {
+		return user, err
+	}
+	s.record(ctx, models.AuditUserCreate, user, nil, user)
+	if err := s.sendVerification(ctx, user); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send verification email", "user_id", user.ID, "error", err)
+	}
+	return user, nil
+}
+
+// Login returns the user with the username and password. Failed logins are
+// counted, and too many in a row lock the account; a locked account cannot
+// log in, even with the right password, until the lock expires. A user with
+// MFA enabled must then complete the login with MFAService.
+func (s *AccountService) Login(ctx context.Context, username, password string) (models.User, error) {
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return user, ErrInvalidCredentials
+	}
+	if err != nil {
+		return user, err
+	}
+	// Service accounts have no password; they use API keys.
+	if user.IsServiceAccount() {
+		return user, ErrInvalidCredentials
+	}
+
+	now := s.now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user, errLocked(user.LockedUntil.Sub(now))
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		if err := s.failLogin(ctx, user, now); err != nil {
+			return user, err
+		}
+		return user, ErrInvalidCredentials
+	}
+
+	// A user with MFA has not logged in until they give a code, so their
+	// failures are reset by MFAService.CompleteLogin. Resetting them here
+	// would let whoever knows the password guess codes without a lock.
+	if !user.MFAEnabled && (user.FailedLogins > 0 || user.LockedUntil != nil) {
+		if err := s.users.ResetLoginFailures(ctx, user.ID); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// failLogin counts a failed login of the user. If it locks the user, the
+// lock is audited and returned as an error.
+func (s *AccountService) failLogin(ctx context.Context, user models.User, now time.Time) error {
+	if s.config.MaxLoginFailures <= 0 {
+		return nil
+	}
+	lockedUntil, err := s.users.RecordLoginFailure(ctx, user.ID, s.config.MaxLoginFailures, s.config.LockoutDuration, now)
+	if err != nil {
+		return err
+	}
+	if lockedUntil == nil {
+		return nil
+	}
+	// The lock is the system's doing, not the caller's, so the entry has no
+	// actor; it keeps the caller's IP.
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditUserLock,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		After:      map[string]interface{}{"locked_until": *lockedUntil},
+	})
+	return errLocked(lockedUntil.Sub(now))
+}
+
+func errLocked(retryAfter time.Duration) error {
+	return apperrors.RateLimited(retryAfter, "Too many failed logins; the account is temporarily locked")
+}
+
+func (s *AccountService) GetUser(ctx context.Context, userID int) (models.User, error) {
+	return s.users.GetUserByID(ctx, userID)
+}
+
+// ResendVerification replaces the user's verification link with a new one.
+func (s *AccountService) ResendVerification(ctx context.Context, userID int) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return apperrors.Conflict("The email address is already verified")
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email address of the token's user as verified.
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	t, err := s.consume(ctx, models.TokenVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	previous := user
+	user.EmailVerified = true
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditUserVerifyEmail, user, previous, user)
+	return nil
+}
+
+// ForgotPassword mails a password reset link if a user has the email
+// address. It succeeds either way, so it cannot be used to find out which
+// addresses are registered.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issue(ctx, user.ID, models.TokenResetPassword, s.config.ResetTTL)
+	if err != nil {
+		return err
+	}
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nReset your password by opening this link within %s:\n\n%s\n\nIf you did not ask to reset your password, ignore this email.\n",
+			user.Username, s.config.ResetTTL, s.link("/reset-password", token)),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send password reset email", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+// ResetPassword sets the password of the token's user. Every reset token of
+// the user is spent.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	t, err := s.consume(ctx, models.TokenResetPassword, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditUserResetPassword, user, nil, nil)
+	// Whoever reset the password has the user's mailbox, so a lock from
+	// failed guesses no longer protects anything.
+	return s.users.ResetLoginFailures(ctx, user.ID)
+}
+
+// ChangePassword sets the user's password after checking the current one.
+func (s *AccountService) ChangePassword(ctx context.Context, userID int, current, password string) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)) != nil {
+		return apperrors.Invalid("current_password", "is incorrect")
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditUserChangePassword, user, nil, nil)
+	return nil
+}
+
+// UpdateProfile changes the user's email address, if email is set. A new
+// address is unverified until the user follows the link mailed to it.
+func (s *AccountService) UpdateProfile(ctx context.Context, userID int, email *string) (models.User, error) {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return user, err
+	}
+	if email == nil || *email == user.Email {
+		return user, nil
+	}
+
+	previous := user
+	user.Email = *email
+	user.EmailVerified = false
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return user, err
+	}
+	s.record(ctx, models.AuditUserUpdate, user, previous, user)
+	if err := s.sendVerification(ctx, user); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send verification email", "user_id", user.ID, "error", err)
+	}
+	return user, nil
+}
+
+// DeleteAccount deletes the user after checking their password. See
+// repositories.UserStore.DeleteUser for what happens to their homes and
+// devices.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID int, password string) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return apperrors.Invalid("password", "is incorrect")
+	}
+	if err := s.users.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditUserDelete, user, user, nil)
+	return nil
+}
+
+// record audits a change the user made to their own account. before and
+// after are diffed; nil for both records only that the action happened.
+func (s *AccountService) record(ctx context.Context, action string, user models.User, before, after interface{}) {
+	b, a := audit.Diff(before, after)
+	s.audit.Record(ctx, audit.By(models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Before:     b,
+		After:      a,
+	}, user))
+}
+
+func (s *AccountService) setPassword(ctx context.Context, user models.User, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	return s.tokens.DeleteUserTokens(ctx, user.ID, models.TokenResetPassword)
+}
+
+func (s *AccountService) sendVerification(ctx context.Context, user models.User) error {
+	token, err := s.issue(ctx, user.ID, models.TokenVerifyEmail, s.config.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link within %s:\n\n%s\n\nIf you did not create an account, ignore this email.\n",
+			user.Username, s.config.VerificationTTL, s.link("/verify-email", token)),
+	})
+}
+
+// issue replaces the user's tokens for purpose with a new one and returns
+// it. Only its hash is stored.
+func (s *AccountService) issue(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := s.tokens.DeleteUserTokens(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+	err := s.tokens.AddUserToken(ctx, models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: s.now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *AccountService) consume(ctx context.Context, purpose, token string) (models.UserToken, error) {
+	t, err := s.tokens.ConsumeUserToken(ctx, purpose, hashToken(token), s.now())
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return t, errInvalidToken
+	}
+	return t, err
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.config.BaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func register(t *testing.T, s *testServices, username string) models.User {
+	t.Helper()
+	user, err := s.accounts.Register(context.Background(), models.User{Username: username, Email: username + "@example.com"}, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+	if alice.EmailVerified {
+		t.Fatal("new user is verified")
+	}
+
+	token := s.mail.lastToken(t, "alice@example.com")
+	if err := s.accounts.VerifyEmail(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.accounts.GetUser(ctx, alice.ID); !user.EmailVerified {
+		t.Error("email not verified")
+	}
+	if err := s.accounts.VerifyEmail(ctx, token); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("reusing the token: got %v, want a validation error", err)
+	}
+
+	// A new address must be verified again.
+	email := "alice@example.org"
+	user, err := s.accounts.UpdateProfile(ctx, alice.ID, &email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.EmailVerified {
+		t.Error("changed address is still verified")
+	}
+	if err := s.accounts.VerifyEmail(ctx, s.mail.lastToken(t, email)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+
+	if err := s.accounts.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+
+	if err := s.accounts.ForgotPassword(ctx, alice.Email); err != nil {
+		t.Fatal(err)
+	}
+	stale := s.mail.lastToken(t, alice.Email)
+	if err := s.accounts.ForgotPassword(ctx, alice.Email); err != nil {
+		t.Fatal(err)
+	}
+	token := s.mail.lastToken(t, alice.Email)
+	if err := s.accounts.ResetPassword(ctx, stale, "battery staple"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("replaced token: got %v, want a validation error", err)
+	}
+
+	if err := s.accounts.ResetPassword(ctx, token, "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.accounts.GetUser(ctx, alice.ID)
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("battery staple")) != nil {
+		t.Error("password not changed")
+	}
+	if err := s.accounts.ResetPassword(ctx, token, "another one"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("reusing the token: got %v, want a validation error", err)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+
+	now := time.Now()
+	s.accounts.now = func() time.Time { return now }
+	if err := s.accounts.ForgotPassword(ctx, alice.Email); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	err := s.accounts.ResetPassword(ctx, s.mail.lastToken(t, alice.Email), "battery staple")
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("expired token: got %v, want a validation error", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+
+	err := s.accounts.ChangePassword(ctx, alice.ID, "wrong", "battery staple")
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) || len(appErr.Fields) != 1 || appErr.Fields[0].Field != "current_password" {
+		t.Errorf("wrong current password: got %v", err)
+	}
+	if err := s.accounts.ChangePassword(ctx, alice.ID, "correct horse", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+	bob := register(t, s, "bob")
+	carol := register(t, s, "carol")
+
+	// Bob administers the first home and takes it over; the second has only
+	// a viewer and is deleted.
+	shared := s.addHome(t, alice)
+	if err := s.homes.AddUserToHome(ctx, shared, bob.ID, "Admin"); err != nil {
+		t.Fatal(err)
+	}
+	solo := s.addHome(t, alice)
+	if err := s.homes.AddUserToHome(ctx, solo, carol.ID, "View"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "alice-1", ChannelID: "ch-alice-1", UserID: alice.ID, HomeID: &shared}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "carol-1", ChannelID: "ch-carol-1", UserID: carol.ID, HomeID: &solo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDeviceData(ctx, models.DeviceData{DeviceID: "alice-1", HomeID: &shared, Data: map[string]interface{}{"t": 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.accounts.DeleteAccount(ctx, alice.ID, "wrong"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("wrong password: got %v, want a validation error", err)
+	}
+	if err := s.accounts.DeleteAccount(ctx, alice.ID, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.accounts.GetUser(ctx, alice.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("deleted user: got %v, want not found", err)
+	}
+	if homes, _ := s.homes.GetHomesByUserID(ctx, bob.ID); len(homes) != 1 || homes[0].ID != shared {
+		t.Errorf("bob's homes = %+v, want the shared home", homes)
+	}
+	if s.homes.IsHomeMember(ctx, solo, carol.ID) {
+		t.Error("carol is still a member of the deleted home")
+	}
+	if _, err := s.devices.GetDeviceByID(ctx, "alice-1"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("alice's device: got %v, want not found", err)
+	}
+	if data, _ := s.telemetry.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "alice-1"}); len(data) != 0 {
+		t.Errorf("alice's device still has %d readings", len(data))
+	}
+	if device, err := s.devices.GetDeviceByID(ctx, "carol-1"); err != nil || device.HomeID != nil {
+		t.Errorf("carol's device = %+v, %v; want it kept without a home", device, err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.accounts.config.MaxLoginFailures = 3
+	s.accounts.config.LockoutDuration = time.Minute
+	register(t, s, "alice")
+
+	now := time.Now()
+	s.accounts.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if _, err := s.accounts.Login(ctx, "alice", "wrong"); !errors.Is(err, apperrors.ErrUnauthorized) {
+			t.Fatalf("failure %d: got %v, want unauthorized", i+1, err)
+		}
+	}
+	_, err := s.accounts.Login(ctx, "alice", "wrong")
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) || !errors.Is(err, apperrors.ErrRateLimited) || appErr.RetryAfter != time.Minute {
+		t.Fatalf("third failure: got %v, want a lock for a minute", err)
+	}
+	if _, err := s.accounts.Login(ctx, "alice", "correct horse"); !errors.Is(err, apperrors.ErrRateLimited) {
+		t.Errorf("right password while locked: got %v, want rate limited", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.accounts.Login(ctx, "alice", "correct horse"); err != nil {
+		t.Errorf("after the lock: %v", err)
+	}
+	if _, err := s.accounts.Login(ctx, "alice", "wrong"); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("the count did not restart: got %v", err)
+	}
+}
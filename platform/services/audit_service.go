@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"slices"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// AuditService reads the audit log on behalf of users. Entries are written
+// by the other services through an audit.Recorder.
+type AuditService struct {
+	auditRepo repositories.AuditStore
+	homeRepo  repositories.HomeStore
+}
+
+func NewAuditService(auditRepo repositories.AuditStore, homeRepo repositories.HomeStore) *AuditService {
+	return &AuditService{auditRepo: auditRepo, homeRepo: homeRepo}
+}
+
+// GetEntries returns the entries matching query that the user may read:
+// those on homes the user owns or holds audit.read in, and those the user
+// made or that target the user. Filtering on any other home is forbidden.
+func (s *AuditService) GetEntries(ctx context.Context, userID int, query repositories.AuditQuery) ([]models.AuditEntry, error) {
+	homeIDs, err := s.homeRepo.GetPermittedHomeIDs(ctx, userID, models.PermAuditRead)
+	if err != nil {
+		return nil, err
+	}
+	if query.HomeID != nil && !slices.Contains(homeIDs, *query.HomeID) {
+		return nil, apperrors.Forbidden("Not allowed to read the audit log of this home")
+	}
+	query.VisibleTo = &userID
+	query.AdminHomeIDs = homeIDs
+	return s.auditRepo.GetAuditEntries(ctx, query)
+}
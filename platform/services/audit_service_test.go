@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+	bob := register(t, s, "bob")
+	carol := register(t, s, "carol")
+
+	aliceCtx := audit.WithActor(ctx, audit.Actor{Username: "alice", IP: "203.0.113.5"})
+	home, err := s.homes.AddHome(aliceCtx, models.Home{HomeName: "Home", UserID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.AddUserToHome(aliceCtx, home, carol.ID, "View"); err != nil {
+		t.Fatal(err)
+	}
+	bobCtx := audit.WithActor(ctx, audit.Actor{Username: "bob"})
+	cabin, err := s.homes.AddHome(bobCtx, models.Home{HomeName: "Cabin", UserID: bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(aliceCtx, models.Device{DeviceID: "d1", ChannelID: "ch-1", UserID: alice.ID, HomeID: &home}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AssignDeviceToHome(aliceCtx, "d1", &cabin); err != nil {
+		t.Fatal(err)
+	}
+
+	moves, err := s.audit.GetEntries(ctx, alice.ID, repositories.AuditQuery{Action: models.AuditDeviceUpdate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 1 {
+		t.Fatalf("alice sees %d device updates, want 1", len(moves))
+	}
+	move := moves[0]
+	if move.ActorID == nil || *move.ActorID != alice.ID || move.ActorName != "alice" || move.IP != "203.0.113.5" {
+		t.Errorf("actor = %v %q from %q, want alice from 203.0.113.5", move.ActorID, move.ActorName, move.IP)
+	}
+	// The diff is decoded JSON, so IDs are floats.
+	if move.Before["home_id"] != float64(home) || move.After["home_id"] != float64(cabin) {
+		t.Errorf("diff = %v -> %v, want the home change", move.Before, move.After)
+	}
+
+	// Bob administers the cabin, so he sees the device arrive there but not
+	// alice's membership changes.
+	entries, err := s.audit.GetEntries(ctx, bob.ID, repositories.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	want := []string{models.AuditDeviceUpdate, models.AuditHomeCreate, models.AuditUserCreate}
+	if !slices.Equal(actions, want) {
+		t.Errorf("bob sees %v, want %v", actions, want)
+	}
+
+	// Carol is only a viewer: she sees her own account, not the home.
+	if _, err := s.audit.GetEntries(ctx, carol.ID, repositories.AuditQuery{HomeID: &home}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("viewer filtering on the home: got %v, want forbidden", err)
+	}
+	entries, err = s.audit.GetEntries(ctx, carol.ID, repositories.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != models.AuditUserCreate {
+		t.Errorf("carol sees %+v, want only her registration", entries)
+	}
+}
+
+func TestAuditLockout(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), audit.Actor{IP: "198.51.100.7"})
+	s := newTestServices(t)
+	s.accounts.config.MaxLoginFailures = 1
+	alice := register(t, s, "alice")
+
+	if _, err := s.accounts.Login(ctx, "alice", "wrong"); !errors.Is(err, apperrors.ErrRateLimited) {
+		t.Fatalf("got %v, want a lock", err)
+	}
+	entries, err := s.audit.GetEntries(ctx, alice.ID, repositories.AuditQuery{Action: models.AuditUserLock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != nil || entries[0].IP != "198.51.100.7" {
+		t.Errorf("lock entries = %+v, want one without an actor from the caller's IP", entries)
+	}
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// errGroupNotFound is returned for device groups that do not exist in the
+// home.
+var errGroupNotFound = apperrors.NotFound("Device group not found")
+
+// DeviceGroupService manages the tags of devices and the groups of a home's
+// devices that bulk jobs run on. Groups only ever hold devices in their home:
+// a member of a static group that moves to another home drops out of it until
+// it comes back.
+type DeviceGroupService struct {
+	tags    repositories.DeviceTagStore
+	groups  repositories.DeviceGroupStore
+	devices repositories.DeviceStore
+	spaces  repositories.SpaceStore
+	audit   *audit.Recorder
+}
+
+func NewDeviceGroupService(tags repositories.DeviceTagStore, groups repositories.DeviceGroupStore, devices repositories.DeviceStore, spaces repositories.SpaceStore, recorder *audit.Recorder) *DeviceGroupService {
+	return &DeviceGroupService{tags: tags, groups: groups, devices: devices, spaces: spaces, audit: recorder}
+}
+
+// GetTags returns the device's tags.
+func (s *DeviceGroupService) GetTags(ctx context.Context, deviceID string) (map[string]string, error) {
+	if _, err := s.devices.GetDeviceByID(ctx, deviceID); err != nil {
+		return nil, err
+	}
+	return s.tags.GetDeviceTags(ctx, deviceID)
+}
+
+// SetTags replaces the device's tags.
+func (s *DeviceGroupService) SetTags(ctx context.Context, deviceID string, tags map[string]string) error {
+	device, err := s.devices.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	previous, err := s.tags.GetDeviceTags(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if err := s.tags.SetDeviceTags(ctx, deviceID, tags); err != nil {
+		return err
+	}
+	before, after := audit.Diff(map[string]interface{}{"tags": previous}, map[string]interface{}{"tags": tags})
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceTag,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   deviceID,
+		HomeIDs:    audit.Homes(device.HomeID),
+		Before:     before,
+		After:      after,
+	})
+	return nil
+}
+
+// GetGroups returns the home's groups in the order they were added.
+func (s *DeviceGroupService) GetGroups(ctx context.Context, homeID int) ([]models.DeviceGroup, error) {
+	return s.groups.GetHomeDeviceGroups(ctx, homeID)
+}
+
+// GetGroup returns the home's group with the ID. Other homes' groups are not
+// found.
+func (s *DeviceGroupService) GetGroup(ctx context.Context, homeID, id int) (models.DeviceGroup, error) {
+	group, err := s.groups.GetDeviceGroupByID(ctx, id)
+	if errors.Is(err, apperrors.ErrNotFound) || err == nil && group.HomeID != homeID {
+		return group, errGroupNotFound
+	}
+	return group, err
+}
+
+// AddGroup adds the group and returns it with its ID. Dynamic groups need a
+// selector and static groups have none.
+func (s *DeviceGroupService) AddGroup(ctx context.Context, group models.DeviceGroup) (models.DeviceGroup, error) {
+	if err := s.checkSelector(ctx, group); err != nil {
+		return group, err
+	}
+	id, err := s.groups.AddDeviceGroup(ctx, group)
+	if err != nil {
+		return group, err
+	}
+	if group, err = s.groups.GetDeviceGroupByID(ctx, id); err != nil {
+		return group, err
+	}
+	_, after := audit.Diff(nil, groupFields(group))
+	s.record(ctx, models.AuditGroupCreate, group, nil, after)
+	return group, nil
+}
+
+// UpdateGroup renames the home's group and, for a dynamic group, replaces
+// its selector. A group's kind does not change.
+func (s *DeviceGroupService) UpdateGroup(ctx context.Context, group models.DeviceGroup) (models.DeviceGroup, error) {
+	previous, err := s.GetGroup(ctx, group.HomeID, group.ID)
+	if err != nil {
+		return group, err
+	}
+	group.Kind, group.CreatedAt = previous.Kind, previous.CreatedAt
+	if err := s.checkSelector(ctx, group); err != nil {
+		return group, err
+	}
+	if err := s.groups.UpdateDeviceGroup(ctx, group); err != nil {
+		return group, err
+	}
+	before, after := audit.Diff(groupFields(previous), groupFields(group))
+	s.record(ctx, models.AuditGroupUpdate, group, before, after)
+	return group, nil
+}
+
+// DeleteGroup deletes the home's group. Jobs run on it are kept.
+func (s *DeviceGroupService) DeleteGroup(ctx context.Context, homeID, id int) error {
+	group, err := s.GetGroup(ctx, homeID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.groups.DeleteDeviceGroup(ctx, id); err != nil {
+		return err
+	}
+	before, _ := audit.Diff(groupFields(group), nil)
+	s.record(ctx, models.AuditGroupDelete, group, before, nil)
+	return nil
+}
+
+// AddMembers adds devices of the home to its static group.
+func (s *DeviceGroupService) AddMembers(ctx context.Context, homeID, groupID int, deviceIDs []string) error {
+	group, err := s.staticGroup(ctx, homeID, groupID)
+	if err != nil {
+		return err
+	}
+	for _, deviceID := range deviceIDs {
+		device, err := s.devices.GetDeviceByID(ctx, deviceID)
+		if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			return err
+		}
+		if err != nil || device.HomeID == nil || *device.HomeID != homeID {
+			return apperrors.Invalid("device_ids", "device %s is not in the home", deviceID)
+		}
+	}
+	if err := s.groups.AddGroupMembers(ctx, groupID, deviceIDs); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditGroupUpdate, group, nil, map[string]interface{}{"added_devices": deviceIDs})
+	return nil
+}
+
+// RemoveMembers removes devices from the home's static group.
+func (s *DeviceGroupService) RemoveMembers(ctx context.Context, homeID, groupID int, deviceIDs []string) error {
+	group, err := s.staticGroup(ctx, homeID, groupID)
+	if err != nil {
+		return err
+	}
+	if err := s.groups.RemoveGroupMembers(ctx, groupID, deviceIDs); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditGroupUpdate, group, map[string]interface{}{"removed_devices": deviceIDs}, nil)
+	return nil
+}
+
+// GetDevices returns the devices the home's group holds now, in order.
+func (s *DeviceGroupService) GetDevices(ctx context.Context, homeID, groupID int) ([]models.Device, error) {
+	group, err := s.GetGroup(ctx, homeID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Resolve(ctx, group)
+}
+
+// Resolve returns the devices of the group's home that are members of a
+// static group or that a dynamic group's selector matches, in order.
+func (s *DeviceGroupService) Resolve(ctx context.Context, group models.DeviceGroup) ([]models.Device, error) {
+	devices, err := s.devices.GetDevicesByHomeID(ctx, group.HomeID)
+	if err != nil {
+		return nil, err
+	}
+	if group.Selector == nil {
+		members, err := s.groups.GetGroupMembers(ctx, group.ID)
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(devices, func(d models.Device) bool { return !slices.Contains(members, d.DeviceID) }), nil
+	}
+
+	selector := group.Selector
+	var within map[int]bool
+	if selector.SpaceID != nil {
+		spaces, err := s.spaces.GetHomeSpaces(ctx, group.HomeID)
+		if err != nil {
+			return nil, err
+		}
+		within = subtree(spaces, *selector.SpaceID)
+	}
+	var tags map[string]map[string]string
+	if len(selector.Tags) > 0 {
+		if tags, err = s.tags.GetHomeDeviceTags(ctx, group.HomeID); err != nil {
+			return nil, err
+		}
+	}
+	return slices.DeleteFunc(devices, func(d models.Device) bool {
+		return !matches(selector, d, tags[d.DeviceID], within)
+	}), nil
+}
+
+// checkSelector refuses a dynamic group without a selector, a static group
+// with one, and a selector naming a space outside the group's home.
+func (s *DeviceGroupService) checkSelector(ctx context.Context, group models.DeviceGroup) error {
+	switch {
+	case group.Kind == models.GroupDynamic && group.Selector == nil:
+		return apperrors.Invalid("selector", "is required for dynamic groups")
+	case group.Kind == models.GroupStatic && group.Selector != nil:
+		return apperrors.Invalid("selector", "static groups list their devices instead")
+	case group.Selector == nil || group.Selector.SpaceID == nil:
+		return nil
+	}
+	space, err := s.spaces.GetSpaceByID(ctx, *group.Selector.SpaceID)
+	if errors.Is(err, apperrors.ErrNotFound) || err == nil && space.HomeID != group.HomeID {
+		return apperrors.Invalid("selector.space_id", "is not a space of the home")
+	}
+	return err
+}
+
+// staticGroup returns the home's group with the ID if it is static.
+func (s *DeviceGroupService) staticGroup(ctx context.Context, homeID, id int) (models.DeviceGroup, error) {
+	group, err := s.GetGroup(ctx, homeID, id)
+	if err == nil && group.Kind != models.GroupStatic {
+		err = apperrors.Invalid("group_id", "is a dynamic group; its selector decides its devices")
+	}
+	return group, err
+}
+
+func (s *DeviceGroupService) record(ctx context.Context, action string, group models.DeviceGroup, before, after map[string]interface{}) {
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetDeviceGroup,
+		TargetID:   strconv.Itoa(group.ID),
+		HomeIDs:    []int{group.HomeID},
+		Before:     before,
+		After:      after,
+	})
+}
+
+// groupFields returns the audited fields of the group.
+func groupFields(group models.DeviceGroup) map[string]interface{} {
+	return map[string]interface{}{"home_id": group.HomeID, "name": group.Name, "kind": group.Kind, "selector": group.Selector}
+}
+
+// matches reports whether the device, with its tags, is selected. within
+// holds the spaces the selector's space covers.
+func matches(selector *models.DeviceSelector, device models.Device, tags map[string]string, within map[int]bool) bool {
+	switch {
+	case selector.DeviceTypeID != nil && (device.DeviceTypeID == nil || *device.DeviceTypeID != *selector.DeviceTypeID):
+		return false
+	case selector.IsActive != nil && device.IsActive != *selector.IsActive:
+		return false
+	case selector.SpaceID != nil && (device.SpaceID == nil || !within[*device.SpaceID]):
+		return false
+	}
+	for key, want := range selector.Tags {
+		value, ok := tags[key]
+		if !ok || want != "*" && value != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// errJobNotFound is returned for device jobs that do not exist in the home.
+var errJobNotFound = apperrors.NotFound("Device job not found")
+
+type DeviceJobConfig struct {
+	// Interval is how often the runner looks for queued jobs. Jobs created
+	// through the service start right away.
+	Interval time.Duration
+	// LeaseTimeout is how long a running job may go without progress before
+	// another runner takes it over, after a crash or restart.
+	LeaseTimeout time.Duration
+}
+
+// DeviceJobService runs bulk jobs: one action applied to every device a
+// group held when the job was created, in the background, recording the
+// outcome per device. A device that failed does not stop the others.
+type DeviceJobService struct {
+	jobs    repositories.DeviceJobStore
+	groups  *DeviceGroupService
+	devices *DeviceService
+	homes   *HomeService
+	users   repositories.UserStore
+	audit   *audit.Recorder
+	config  DeviceJobConfig
+	logger  *slog.Logger
+	now     func() time.Time
+	// wake nudges the runner when a job is queued.
+	wake chan struct{}
+}
+
+func NewDeviceJobService(jobs repositories.DeviceJobStore, groups *DeviceGroupService, devices *DeviceService, homes *HomeService, users repositories.UserStore, recorder *audit.Recorder, config DeviceJobConfig, logger *slog.Logger) *DeviceJobService {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.LeaseTimeout <= 0 {
+		config.LeaseTimeout = 5 * time.Minute
+	}
+	return &DeviceJobService{
+		jobs: jobs, groups: groups, devices: devices, homes: homes, users: users, audit: recorder, config: config, logger: logger,
+		now:  func() time.Time { return time.Now().UTC() },
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// CreateJob queues the job on the devices its group in its home holds now
+// and returns it.
+func (s *DeviceJobService) CreateJob(ctx context.Context, job models.DeviceJob) (models.DeviceJob, error) {
+	if err := checkJobParams(job); err != nil {
+		return job, err
+	}
+	group, err := s.groups.GetGroup(ctx, job.HomeID, *job.GroupID)
+	if err != nil {
+		return job, err
+	}
+	devices, err := s.groups.Resolve(ctx, group)
+	if err != nil {
+		return job, err
+	}
+	if len(devices) == 0 {
+		return job, apperrors.Invalid("group_id", "the group holds no devices")
+	}
+	deviceIDs := make([]string, len(devices))
+	for i, d := range devices {
+		deviceIDs[i] = d.DeviceID
+	}
+
+	id, err := s.jobs.AddDeviceJob(ctx, job, deviceIDs)
+	if err != nil {
+		return job, err
+	}
+	if job, err = s.jobs.GetDeviceJobByID(ctx, id); err != nil {
+		return job, err
+	}
+	homeIDs := []int{job.HomeID}
+	if job.Params.HomeID != nil && *job.Params.HomeID != job.HomeID {
+		homeIDs = append(homeIDs, *job.Params.HomeID)
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditJobCreate,
+		TargetType: models.AuditTargetDeviceJob,
+		TargetID:   strconv.Itoa(job.ID),
+		HomeIDs:    homeIDs,
+		After:      map[string]interface{}{"group_id": job.GroupID, "action": job.Action, "params": job.Params, "devices": deviceIDs},
+	})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetJob returns the home's job with the ID, with its progress. Other homes'
+// jobs are not found.
+func (s *DeviceJobService) GetJob(ctx context.Context, homeID, id int) (models.DeviceJob, error) {
+	job, err := s.jobs.GetDeviceJobByID(ctx, id)
+	if errors.Is(err, apperrors.ErrNotFound) || err == nil && job.HomeID != homeID {
+		return job, errJobNotFound
+	}
+	return job, err
+}
+
+// GetJobs returns the home's latest jobs, newest first.
+func (s *DeviceJobService) GetJobs(ctx context.Context, homeID, limit int) ([]models.DeviceJob, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.jobs.GetHomeDeviceJobs(ctx, homeID, limit)
+}
+
+// GetResults returns the outcome of the home's job on each of its devices.
+func (s *DeviceJobService) GetResults(ctx context.Context, homeID, id int) ([]models.DeviceJobResult, error) {
+	if _, err := s.GetJob(ctx, homeID, id); err != nil {
+		return nil, err
+	}
+	return s.jobs.GetDeviceJobResults(ctx, id)
+}
+
+// Run runs queued jobs as they are created, and every interval, until ctx is
+// cancelled. Jobs left running by a runner that stopped are taken over once
+// their lease times out.
+func (s *DeviceJobService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		s.RunPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// RunPending runs jobs until none is waiting.
+func (s *DeviceJobService) RunPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := s.now()
+		job, err := s.jobs.ClaimDeviceJob(ctx, now, now.Add(-s.config.LeaseTimeout))
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Error claiming device job", "error", err)
+			return
+		}
+		s.run(ctx, job)
+	}
+}
+
+// run applies the job to each of its devices still pending, as the user who
+// created it, and completes it.
+func (s *DeviceJobService) run(ctx context.Context, job models.DeviceJob) {
+	if job.CreatedBy != nil {
+		if user, err := s.users.GetUserByID(ctx, *job.CreatedBy); err == nil {
+			ctx = audit.WithActor(ctx, audit.Actor{Username: user.Username})
+		}
+	}
+	results, err := s.jobs.GetDeviceJobResults(ctx, job.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Error reading device job", "job_id", job.ID, "error", err)
+		return
+	}
+	for _, result := range results {
+		if result.Status != models.JobResultPending {
+			continue
+		}
+		result.Status = models.JobResultSucceeded
+		if err := s.apply(ctx, job, result.DeviceID); err != nil {
+			result.Status, result.Error = models.JobResultFailed, err.Error()
+		}
+		now := s.now()
+		result.FinishedAt = &now
+		if err := s.jobs.SetDeviceJobResult(ctx, result); err != nil {
+			// The device stays pending and is retried when the lease runs
+			// out.
+			s.logger.ErrorContext(ctx, "Error saving device job result", "job_id", job.ID, "device_id", result.DeviceID, "error", err)
+			return
+		}
+	}
+	if err := s.jobs.FinishDeviceJob(ctx, job.ID, s.now()); err != nil {
+		s.logger.ErrorContext(ctx, "Error completing device job", "job_id", job.ID, "error", err)
+		return
+	}
+	s.logger.InfoContext(ctx, "Completed device job", "job_id", job.ID, "action", job.Action)
+}
+
+// apply applies the job's action to the device if it is still in the job's
+// home and the job's creator still holds the permissions the action needs
+// there, and in the target home of an assign_home job.
+func (s *DeviceJobService) apply(ctx context.Context, job models.DeviceJob, deviceID string) error {
+	device, err := s.devices.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if device.HomeID == nil || *device.HomeID != job.HomeID {
+		return fmt.Errorf("the device is no longer in home %d", job.HomeID)
+	}
+	if job.CreatedBy == nil {
+		return errors.New("the user who created the job no longer exists")
+	}
+	if err := s.homes.Authorize(ctx, job.HomeID, *job.CreatedBy, models.JobPermission(job.Action)); err != nil {
+		return err
+	}
+	if job.Action == models.JobAssignHome && job.Params.HomeID != nil {
+		if err := s.homes.Authorize(ctx, *job.Params.HomeID, *job.CreatedBy, models.PermDeviceAssign); err != nil {
+			return err
+		}
+	}
+	p := job.Params
+	switch job.Action {
+	case models.JobCommand:
+		return s.devices.SendCommand(ctx, deviceID, p.Command, p.Params)
+	case models.JobFirmware:
+		return s.devices.SendCommand(ctx, deviceID, models.FirmwareCommand, map[string]interface{}{"version": p.Version, "url": p.URL})
+	case models.JobAssignHome:
+		return s.devices.AssignDeviceToHome(ctx, deviceID, p.HomeID)
+	case models.JobSetActive:
+		return s.devices.SetActive(ctx, deviceID, *p.Active)
+	}
+	return fmt.Errorf("unknown action %s", job.Action)
+}
+
+// checkJobParams refuses a job without a group or without the params its
+// action needs.
+func checkJobParams(job models.DeviceJob) error {
+	p := job.Params
+	switch {
+	case job.GroupID == nil:
+		return apperrors.Invalid("group_id", "is required")
+	case job.Action == models.JobCommand && p.Command == "":
+		return apperrors.Invalid("command", "is required for command jobs")
+	case job.Action == models.JobAssignHome && p.HomeID == nil:
+		return apperrors.Invalid("target_home_id", "is required for assign_home jobs")
+	case job.Action == models.JobSetActive && p.Active == nil:
+		return apperrors.Invalid("active", "is required for set_active jobs")
+	case job.Action == models.JobFirmware && (p.Version == "" || p.URL == ""):
+		return apperrors.Invalid("firmware_version", "and firmware_url are required for firmware jobs")
+	case !slices.Contains(models.JobActions, job.Action):
+		return apperrors.Invalid("action", "unknown action %s", job.Action)
+	}
+	return nil
+}
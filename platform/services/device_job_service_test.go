@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestDeviceGroupsAndJobs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	homeID := s.addHome(t, alice)
+	otherHomeID := s.addHome(t, alice)
+
+	typeID, err := s.deviceType.AddDeviceType(ctx, models.DeviceType{
+		Name:     "lamp",
+		Commands: []models.DeviceCommand{{Name: "toggle"}, {Name: models.FirmwareCommand}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := map[string]map[string]string{
+		"d1": {"floor": "1", "vendor": "acme"},
+		"d2": {"floor": "2", "vendor": "acme"},
+		"d3": {"floor": "1"},
+	}
+	for _, deviceID := range []string{"d1", "d2", "d3"} {
+		device := models.Device{DeviceID: deviceID, ChannelID: "c-" + deviceID, UserID: alice.ID, HomeID: &homeID, IsActive: true}
+		if deviceID != "d3" {
+			device.DeviceTypeID = &typeID
+		}
+		if err := s.devices.AddDevice(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.groups.SetTags(ctx, deviceID, tags[deviceID]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.groups.AddGroup(ctx, models.DeviceGroup{HomeID: homeID, Name: "acme", Kind: models.GroupDynamic}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("dynamic group without a selector: got %v, want a validation error", err)
+	}
+	acme, err := s.groups.AddGroup(ctx, models.DeviceGroup{
+		HomeID: homeID, Name: "acme", Kind: models.GroupDynamic,
+		Selector: &models.DeviceSelector{Tags: map[string]string{"vendor": "acme", "floor": "*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devices, err := s.groups.GetDevices(ctx, homeID, acme.ID); err != nil || len(devices) != 2 {
+		t.Errorf("acme devices %+v, %v", devices, err)
+	}
+	firstFloor, err := s.groups.AddGroup(ctx, models.DeviceGroup{HomeID: homeID, Name: "first floor", Kind: models.GroupStatic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.groups.AddMembers(ctx, homeID, firstFloor.ID, []string{"d1", "d3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.groups.AddMembers(ctx, homeID, acme.ID, []string{"d3"}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("members of a dynamic group: got %v, want a validation error", err)
+	}
+	if _, err := s.groups.GetGroup(ctx, otherHomeID, acme.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("group through another home: got %v, want not found", err)
+	}
+
+	// d3 has no device type, so it supports no commands; the job carries on
+	// with d1.
+	s.devices.SetCommandPublisher(&recordingPublisher{})
+	job, err := s.jobs.CreateJob(ctx, models.DeviceJob{
+		HomeID: homeID, GroupID: &firstFloor.ID, Action: models.JobCommand, Params: models.JobParams{Command: "toggle"}, CreatedBy: &alice.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.JobQueued || job.Total != 2 {
+		t.Errorf("queued job %+v", job)
+	}
+	s.jobs.RunPending(ctx)
+	if job, err = s.jobs.GetJob(ctx, homeID, job.ID); err != nil || job.Status != models.JobCompleted || job.Succeeded != 1 || job.Failed != 1 {
+		t.Errorf("command job %+v, %v", job, err)
+	}
+	results, err := s.jobs.GetResults(ctx, homeID, job.ID)
+	if err != nil || len(results) != 2 || results[1].DeviceID != "d3" || results[1].Status != models.JobResultFailed || results[1].Error == "" {
+		t.Errorf("command job results %+v, %v", results, err)
+	}
+
+	// A job only acts while its creator holds the permission it needs.
+	bob := s.addUser(t, "bob")
+	operator, err := s.homes.CreateRole(ctx, alice.ID, homeID, "operator", []string{models.PermDeviceAssign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.AddUserToHome(ctx, homeID, bob.ID, "operator"); err != nil {
+		t.Fatal(err)
+	}
+	inactive := false
+	job, err = s.jobs.CreateJob(ctx, models.DeviceJob{HomeID: homeID, GroupID: &firstFloor.ID, Action: models.JobSetActive, Params: models.JobParams{Active: &inactive}, CreatedBy: &bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.homes.UpdateRole(ctx, alice.ID, homeID, operator.ID, "operator", []string{models.PermTelemetryRead}); err != nil {
+		t.Fatal(err)
+	}
+	s.jobs.RunPending(ctx)
+	if job, err = s.jobs.GetJob(ctx, homeID, job.ID); err != nil || job.Failed != 2 {
+		t.Errorf("job of a user who lost the permission %+v, %v", job, err)
+	}
+	if device, _ := s.devices.GetDeviceByID(ctx, "d1"); !device.IsActive {
+		t.Error("d1 deactivated by a user who lost the permission")
+	}
+
+	job, err = s.jobs.CreateJob(ctx, models.DeviceJob{HomeID: homeID, GroupID: &acme.ID, Action: models.JobSetActive, Params: models.JobParams{Active: &inactive}, CreatedBy: &alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs.RunPending(ctx)
+	for _, deviceID := range []string{"d1", "d2"} {
+		if device, _ := s.devices.GetDeviceByID(ctx, deviceID); device.IsActive {
+			t.Errorf("%s still active after the job", deviceID)
+		}
+	}
+
+	if _, err := s.jobs.CreateJob(ctx, models.DeviceJob{HomeID: homeID, GroupID: &acme.ID, Action: models.JobAssignHome}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("assign_home job without a home: got %v, want a validation error", err)
+	}
+	job, err = s.jobs.CreateJob(ctx, models.DeviceJob{HomeID: homeID, GroupID: &acme.ID, Action: models.JobAssignHome, Params: models.JobParams{HomeID: &otherHomeID}, CreatedBy: &alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs.RunPending(ctx)
+	if devices, _ := s.groups.GetDevices(ctx, homeID, acme.ID); len(devices) != 0 {
+		t.Errorf("devices moved out of the home still in its group: %+v", devices)
+	}
+	if _, err := s.jobs.CreateJob(ctx, models.DeviceJob{HomeID: homeID, GroupID: &acme.ID, Action: models.JobFirmware, Params: models.JobParams{Version: "2.0", URL: "https://fw.example.com/2.0.bin"}}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("job on an empty group: got %v, want a validation error", err)
+	}
+	if jobs, err := s.jobs.GetJobs(ctx, homeID, 0); err != nil || len(jobs) != 4 || jobs[0].ID != job.ID {
+		t.Errorf("jobs of the home %+v, %v", jobs, err)
+	}
+}
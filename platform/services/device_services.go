@@ -1,82 +1,220 @@
 package services
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/logging"
 	"PragatiIot/platform/models"
 	"PragatiIot/platform/repositories"
 )
 
+// CommandPublisher delivers command payloads to a device's channel.
+type CommandPublisher interface {
+	PublishCommand(channelID string, payload []byte) error
+}
+
 type DeviceService struct {
-	deviceRepo  *repositories.DeviceRepository
-	homeService *HomeService
+	deviceRepo        repositories.DeviceStore
+	homeService       *HomeService
+	deviceTypeService *DeviceTypeService
+	commandPublisher  CommandPublisher
+	audit             *audit.Recorder
+	logger            *slog.Logger
+}
+
+func NewDeviceService(deviceRepo repositories.DeviceStore, homeService *HomeService, deviceTypeService *DeviceTypeService, recorder *audit.Recorder, logger *slog.Logger) *DeviceService {
+	return &DeviceService{deviceRepo: deviceRepo, homeService: homeService, deviceTypeService: deviceTypeService, audit: recorder, logger: logger}
 }
 
-func NewDeviceService(deviceRepo *repositories.DeviceRepository, homeService *HomeService) *DeviceService {
-	return &DeviceService{deviceRepo: deviceRepo, homeService: homeService}
+// SetCommandPublisher sets the transport used by SendCommand. The MQTT client
+// depends on the device service, so it is wired in after construction.
+func (s *DeviceService) SetCommandPublisher(publisher CommandPublisher) {
+	s.commandPublisher = publisher
 }
 
-func (s *DeviceService) AddDevice(device models.Device) error {
-	if err := s.deviceRepo.AddDevice(device); err != nil {
-		log.Printf("Error adding device: %v", err)
+// AddDevice adds the device, within the devices quota of its home's
+// organization.
+func (s *DeviceService) AddDevice(ctx context.Context, device models.Device) error {
+	if err := s.homeService.CheckDeviceQuota(ctx, device.HomeID); err != nil {
 		return err
 	}
+	if err := s.deviceRepo.AddDevice(ctx, device); err != nil {
+		return err
+	}
+	_, after := audit.Diff(nil, device)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceCreate,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   device.DeviceID,
+		HomeIDs:    audit.Homes(device.HomeID),
+		After:      after,
+	})
 	return nil
 }
 
-func (s *DeviceService) AssignDeviceToHome(deviceID string, homeID *int) error {
-	device, err := s.deviceRepo.GetDeviceByID(deviceID)
+// AssignDeviceToHome moves the device to the home, or out of any home if
+// homeID is nil, within the devices quota of the home's organization. A
+// device leaving its home leaves its space too.
+func (s *DeviceService) AssignDeviceToHome(ctx context.Context, deviceID string, homeID *int) error {
+	device, err := s.deviceRepo.GetDeviceByID(ctx, deviceID)
 	if err != nil {
-		log.Printf("Error finding device %s: %v", deviceID, err)
 		return err
 	}
+	if homeID != nil && (device.HomeID == nil || *device.HomeID != *homeID) {
+		if err := s.homeService.CheckDeviceQuota(ctx, homeID); err != nil {
+			return err
+		}
+	}
 
+	// Writing back the whole row could undo a transfer accepted in between,
+	// so only the home and space are set, guarded on what was read.
+	if err := s.deviceRepo.SetDeviceHome(ctx, deviceID, device.UserID, device.HomeID, homeID); err != nil {
+		return err
+	}
+	previous := device
+	if homeID == nil || device.HomeID == nil || *device.HomeID != *homeID {
+		device.SpaceID = nil
+	}
 	device.HomeID = homeID
-	if err := s.deviceRepo.UpdateDevice(device); err != nil {
-		log.Printf("Error updating device %s: %v", deviceID, err)
+	before, after := audit.Diff(previous, device)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceUpdate,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   deviceID,
+		HomeIDs:    audit.Homes(previous.HomeID, device.HomeID),
+		Before:     before,
+		After:      after,
+	})
+	return nil
+}
+
+// SetActive activates or deactivates the device.
+func (s *DeviceService) SetActive(ctx context.Context, deviceID string, active bool) error {
+	device, err := s.deviceRepo.GetDeviceByID(ctx, deviceID)
+	if err != nil || device.IsActive == active {
 		return err
 	}
+
+	if err := s.deviceRepo.SetDeviceActive(ctx, deviceID, active); err != nil {
+		return err
+	}
+	previous := device
+	device.IsActive = active
+	before, after := audit.Diff(previous, device)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceUpdate,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   deviceID,
+		HomeIDs:    audit.Homes(device.HomeID),
+		Before:     before,
+		After:      after,
+	})
 	return nil
 }
 
-func (s *DeviceService) GetDevicesByUserID(userID int) ([]models.Device, error) {
-	devices, err := s.deviceRepo.GetDevicesByUserID(userID)
+// GetActiveChannels returns the channels of the active devices, which the
+// MQTT client subscribes to.
+func (s *DeviceService) GetActiveChannels(ctx context.Context) ([]string, error) {
+	return s.deviceRepo.GetActiveChannels(ctx)
+}
+
+func (s *DeviceService) GetDevicesByUserID(ctx context.Context, userID int) ([]models.Device, error) {
+	devices, err := s.deviceRepo.GetDevicesByUserID(ctx, userID)
 	if err != nil {
-		log.Printf("Error getting devices by user ID: %v", err)
 		return nil, err
 	}
 	return devices, nil
 }
 
-func (s *DeviceService) GetDeviceByID(deviceID string) (models.Device, error) {
-	device, err := s.deviceRepo.GetDeviceByID(deviceID)
+func (s *DeviceService) GetDeviceByID(ctx context.Context, deviceID string) (models.Device, error) {
+	device, err := s.deviceRepo.GetDeviceByID(ctx, deviceID)
 	if err != nil {
-		log.Printf("Error finding device by ID %s: %v", deviceID, err)
 		return device, err
 	}
 	return device, nil
 }
 
-func (s *DeviceService) AddDeviceData(deviceData models.DeviceData) error {
-	if err := s.deviceRepo.AddDeviceData(deviceData); err != nil {
-		log.Printf("Error adding device data: %v", err)
+func (s *DeviceService) AddDeviceData(ctx context.Context, deviceData models.DeviceData) error {
+	if err := s.deviceRepo.AddDeviceData(ctx, deviceData); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *DeviceService) GetDeviceAnalytics(deviceID string, homeID, roleID int) ([]models.DeviceData, error) {
-	// Implement analytics retrieval logic here
-	var analytics []models.DeviceData
-	// Example logic (to be replaced with actual implementation):
-	log.Printf("Fetching analytics for device %s in home %d with role %d", deviceID, homeID, roleID)
-	return analytics, nil
-}
-func (s *DeviceService) GetDeviceByChannel(channelID string) (models.Device, error) {
-	device, err := s.deviceRepo.GetDeviceByChannel(channelID)
+func (s *DeviceService) GetDeviceByChannel(ctx context.Context, channelID string) (models.Device, error) {
+	device, err := s.deviceRepo.GetDeviceByChannel(ctx, channelID)
 	if err != nil {
-		log.Printf("Error finding device by channel ID %s: %v", channelID, err)
 		return device, err
 	}
 	return device, nil
 }
+
+// AddDeviceDataBatch stores a batch of readings in one write.
+func (s *DeviceService) AddDeviceDataBatch(ctx context.Context, batch []models.DeviceData) error {
+	if err := s.deviceRepo.AddDeviceDataBatch(ctx, batch); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendCommand validates a command against the device's type and publishes it
+// on the device's command topic.
+func (s *DeviceService) SendCommand(ctx context.Context, deviceID string, command string, params map[string]interface{}) error {
+	device, err := s.deviceRepo.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	if device.DeviceTypeID == nil {
+		return apperrors.Validation(fmt.Sprintf("Device %s has no device type, so it has no supported commands", deviceID))
+	}
+	deviceType, err := s.deviceTypeService.GetDeviceTypeByID(ctx, *device.DeviceTypeID)
+	if err != nil {
+		return err
+	}
+	if err := s.deviceTypeService.ValidateCommand(deviceType, command, params); err != nil {
+		return err
+	}
+
+	if s.commandPublisher == nil {
+		return fmt.Errorf("no command transport configured")
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"command": command,
+		"params":  params,
+		"sent_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.commandPublisher.PublishCommand(device.ChannelID, payload); err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "Sent command", logging.DeviceIDKey, deviceID, "command", command)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceCommand,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   deviceID,
+		HomeIDs:    audit.Homes(device.HomeID),
+		After:      map[string]interface{}{"command": command, "params": params},
+	})
+	return nil
+}
+
+// GetDeviceType returns the device's type, or nil if it has none.
+func (s *DeviceService) GetDeviceType(ctx context.Context, device models.Device) (*models.DeviceType, error) {
+	if device.DeviceTypeID == nil {
+		return nil, nil
+	}
+	deviceType, err := s.deviceTypeService.GetDeviceTypeByID(ctx, *device.DeviceTypeID)
+	if err != nil {
+		return nil, err
+	}
+	return &deviceType, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type recordingPublisher struct {
+	channel string
+	payload []byte
+}
+
+func (p *recordingPublisher) PublishCommand(channelID string, payload []byte) error {
+	p.channel = channelID
+	p.payload = payload
+	return nil
+}
+
+func TestAssignDeviceToHome(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	homeID := s.addHome(t, alice)
+
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AssignDeviceToHome(ctx, "d1", &homeID); err != nil {
+		t.Fatal(err)
+	}
+	device, err := s.devices.GetDeviceByChannel(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.HomeID == nil || *device.HomeID != homeID {
+		t.Errorf("device home = %v, want %d", device.HomeID, homeID)
+	}
+
+	if err := s.devices.AssignDeviceToHome(ctx, "missing", &homeID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected pgx.ErrNoRows for an unknown device, got %v", err)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+
+	typeID, err := s.deviceType.AddDeviceType(ctx, models.DeviceType{
+		Name: "thermostat",
+		Commands: []models.DeviceCommand{{
+			Name:   "set_target",
+			Params: []models.TelemetryField{{Name: "target", Type: FieldNumber, Required: true}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: alice.ID, DeviceTypeID: &typeID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.devices.SendCommand(ctx, "d1", "set_target", map[string]interface{}{"target": 21.5}); err == nil {
+		t.Error("expected an error without a command transport")
+	}
+
+	publisher := &recordingPublisher{}
+	s.devices.SetCommandPublisher(publisher)
+
+	var violation *SchemaViolationError
+	if err := s.devices.SendCommand(ctx, "d1", "set_target", map[string]interface{}{}); !errors.As(err, &violation) {
+		t.Errorf("expected a schema violation for a missing parameter, got %v", err)
+	}
+	if err := s.devices.SendCommand(ctx, "d1", "reboot", nil); err == nil {
+		t.Error("expected an error for an unsupported command")
+	}
+
+	if err := s.devices.SendCommand(ctx, "d1", "set_target", map[string]interface{}{"target": 21.5}); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.channel != "c1" {
+		t.Errorf("published to channel %q, want c1", publisher.channel)
+	}
+	var sent map[string]interface{}
+	if err := json.Unmarshal(publisher.payload, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent["command"] != "set_target" {
+		t.Errorf("published command %v, want set_target", sent["command"])
+	}
+}
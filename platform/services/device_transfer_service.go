@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// errTransferNotFound is returned for transfers that do not exist or that
+// the caller is not a party to.
+var errTransferNotFound = apperrors.NotFound("Device transfer not found")
+
+// DeviceTransferService hands devices from one owner to another. The owner
+// offers the device, and it changes hands only when the recipient accepts:
+// it then leaves its home and gets a new channel ID, so that neither the
+// old home's members nor anyone who knew the old channel can reach it.
+type DeviceTransferService struct {
+	transfers repositories.DeviceTransferStore
+	devices   repositories.DeviceStore
+	users     repositories.UserStore
+	channels  ChannelListener
+	audit     *audit.Recorder
+	now       func() time.Time
+}
+
+// ChannelListener is told when a device's channel changes, so that the MQTT
+// client subscribes to the new channel without waiting for its next poll.
+type ChannelListener interface {
+	ChannelsChanged()
+}
+
+func NewDeviceTransferService(transfers repositories.DeviceTransferStore, devices repositories.DeviceStore, users repositories.UserStore, recorder *audit.Recorder) *DeviceTransferService {
+	return &DeviceTransferService{transfers: transfers, devices: devices, users: users, audit: recorder, now: time.Now}
+}
+
+// SetChannelListener sets who is told of rotated channels. The MQTT client
+// is created after the services, so it is wired in after construction.
+func (s *DeviceTransferService) SetChannelListener(listener ChannelListener) {
+	s.channels = listener
+}
+
+// Offer offers the owner's device to the user with the username. With
+// keepTelemetry, what the device recorded stays readable by the owner after
+// the transfer; otherwise it is purged when the recipient accepts.
+func (s *DeviceTransferService) Offer(ctx context.Context, ownerID int, deviceID, toUsername string, keepTelemetry bool) (models.DeviceTransfer, error) {
+	device, err := s.devices.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		return models.DeviceTransfer{}, err
+	}
+	if device.UserID != ownerID {
+		return models.DeviceTransfer{}, apperrors.Forbidden("Only the device's owner can transfer it")
+	}
+	recipient, err := s.users.GetUserByUsername(ctx, toUsername)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return models.DeviceTransfer{}, apperrors.Invalid("to_username", "no user has this username")
+	}
+	if err != nil {
+		return models.DeviceTransfer{}, err
+	}
+	switch {
+	case recipient.ID == ownerID:
+		return models.DeviceTransfer{}, apperrors.Invalid("to_username", "is the device's owner")
+	case recipient.IsServiceAccount():
+		return models.DeviceTransfer{}, apperrors.Invalid("to_username", "is a service account")
+	}
+
+	transfer := models.DeviceTransfer{DeviceID: deviceID, FromUserID: ownerID, ToUserID: recipient.ID, KeepTelemetry: keepTelemetry}
+	id, err := s.transfers.AddDeviceTransfer(ctx, transfer)
+	if err != nil {
+		return transfer, err
+	}
+	if transfer, err = s.transfers.GetDeviceTransferByID(ctx, id); err != nil {
+		return transfer, err
+	}
+	s.record(ctx, models.AuditDeviceTransfer, transfer, device.HomeID, nil, map[string]interface{}{
+		"transfer_id": transfer.ID, "to_user_id": transfer.ToUserID, "keep_telemetry": keepTelemetry,
+	})
+	return transfer, nil
+}
+
+// GetUserTransfers returns the pending transfers from or to the user.
+func (s *DeviceTransferService) GetUserTransfers(ctx context.Context, userID int) ([]models.DeviceTransfer, error) {
+	return s.transfers.GetPendingUserTransfers(ctx, userID)
+}
+
+// Accept gives the device to the recipient, out of any home, on channelID
+// or else a random one, and purges its telemetry unless the transfer keeps
+// it. It returns the device as it now is.
+func (s *DeviceTransferService) Accept(ctx context.Context, userID, transferID int, channelID string) (models.Device, error) {
+	transfer, err := s.pending(ctx, transferID, func(t models.DeviceTransfer) bool { return t.ToUserID == userID })
+	if err != nil {
+		return models.Device{}, err
+	}
+	device, err := s.devices.GetDeviceByID(ctx, transfer.DeviceID)
+	if err != nil {
+		return device, err
+	}
+	if channelID == "" {
+		if channelID, err = newChannelID(); err != nil {
+			return device, err
+		}
+	}
+	// The owner's last window is the one since they last received the
+	// device, which is purged unless the transfer keeps it.
+	windows, err := s.TelemetryWindows(ctx, device, transfer.FromUserID)
+	if err != nil {
+		return device, err
+	}
+	var since time.Time
+	if n := len(windows); n > 0 {
+		since = windows[n-1].From
+	}
+
+	if err := s.transfers.AcceptDeviceTransfer(ctx, transfer, channelID, since, s.now()); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return device, apperrors.Conflict("The transfer is no longer pending")
+		}
+		return device, err
+	}
+	if s.channels != nil {
+		s.channels.ChannelsChanged()
+	}
+	s.record(ctx, models.AuditDeviceAccept, transfer, device.HomeID,
+		map[string]interface{}{"user_id": device.UserID, "home_id": device.HomeID},
+		map[string]interface{}{"transfer_id": transfer.ID, "user_id": transfer.ToUserID, "home_id": nil, "channel_rotated": true, "telemetry_purged": !transfer.KeepTelemetry},
+	)
+	return s.devices.GetDeviceByID(ctx, transfer.DeviceID)
+}
+
+// Decline turns the transfer down. Only its recipient may.
+func (s *DeviceTransferService) Decline(ctx context.Context, userID, transferID int) error {
+	transfer, err := s.pending(ctx, transferID, func(t models.DeviceTransfer) bool { return t.ToUserID == userID })
+	if err != nil {
+		return err
+	}
+	return s.respond(ctx, transfer, models.TransferDeclined, models.AuditDeviceDecline)
+}
+
+// Cancel withdraws the transfer. Only the owner who offered it may.
+func (s *DeviceTransferService) Cancel(ctx context.Context, userID, transferID int) error {
+	transfer, err := s.pending(ctx, transferID, func(t models.DeviceTransfer) bool { return t.FromUserID == userID })
+	if err != nil {
+		return err
+	}
+	return s.respond(ctx, transfer, models.TransferCancelled, models.AuditDeviceCancel)
+}
+
+// TelemetryWindow is a span of a device's telemetry. A zero bound is open.
+type TelemetryWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+// TelemetryWindows returns the spans of the device's telemetry the user may
+// read as its owner, oldest first: each span they owned it for and kept its
+// telemetry when handing it on, and, for its current owner, the span since
+// they last received it. A user who owned the device more than once gets a
+// window for each time. Other users get none.
+func (s *DeviceTransferService) TelemetryWindows(ctx context.Context, device models.Device, userID int) ([]TelemetryWindow, error) {
+	transfers, err := s.transfers.GetAcceptedDeviceTransfers(ctx, device.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var windows []TelemetryWindow
+	var from time.Time
+	for _, transfer := range transfers {
+		if transfer.FromUserID == userID && transfer.KeepTelemetry {
+			windows = append(windows, TelemetryWindow{From: from, To: *transfer.RespondedAt})
+		}
+		from = *transfer.RespondedAt
+	}
+	if device.UserID == userID {
+		windows = append(windows, TelemetryWindow{From: from})
+	}
+	return windows, nil
+}
+
+// pending returns the pending transfer if party says the caller is the party
+// to it who may act. Transfers the caller is not a party to are not found.
+func (s *DeviceTransferService) pending(ctx context.Context, transferID int, party func(models.DeviceTransfer) bool) (models.DeviceTransfer, error) {
+	transfer, err := s.transfers.GetDeviceTransferByID(ctx, transferID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return transfer, errTransferNotFound
+	}
+	if err != nil {
+		return transfer, err
+	}
+	if !party(transfer) {
+		return transfer, errTransferNotFound
+	}
+	if transfer.Status != models.TransferPending {
+		return transfer, apperrors.Conflict("The transfer was already %s", transfer.Status)
+	}
+	return transfer, nil
+}
+
+// respond sets the status of a pending transfer and audits it.
+func (s *DeviceTransferService) respond(ctx context.Context, transfer models.DeviceTransfer, status, action string) error {
+	if err := s.transfers.RespondToDeviceTransfer(ctx, transfer.ID, status, s.now()); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return apperrors.Conflict("The transfer is no longer pending")
+		}
+		return err
+	}
+	var homeID *int
+	if device, err := s.devices.GetDeviceByID(ctx, transfer.DeviceID); err == nil {
+		homeID = device.HomeID
+	}
+	s.record(ctx, action, transfer, homeID, nil, map[string]interface{}{"transfer_id": transfer.ID, "status": status})
+	return nil
+}
+
+func (s *DeviceTransferService) record(ctx context.Context, action string, transfer models.DeviceTransfer, homeID *int, before, after map[string]interface{}) {
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   transfer.DeviceID,
+		HomeIDs:    audit.Homes(homeID),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// newChannelID returns a random channel ID, unguessable by the device's
+// previous owner.
+func newChannelID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating channel ID: %w", err)
+	}
+	return "ch-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+func TestDeviceTransfer(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	carol := s.addUser(t, "carol")
+	homeID := s.addHome(t, alice)
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: alice.ID, HomeID: &homeID}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	reading := func(at time.Time) models.DeviceData {
+		return models.DeviceData{DeviceID: "d1", CreatedAt: at, Data: map[string]interface{}{"temp": 20}}
+	}
+	if err := s.devices.AddDeviceDataBatch(ctx, []models.DeviceData{reading(now.Add(-3 * time.Hour)), reading(now.Add(-2 * time.Hour))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.transfers.Offer(ctx, bob.ID, "d1", "carol", true); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("offer by a non-owner: got %v, want forbidden", err)
+	}
+	if _, err := s.transfers.Offer(ctx, alice.ID, "d1", "alice", true); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("offer to the owner: got %v, want a validation error", err)
+	}
+	toBob, err := s.transfers.Offer(ctx, alice.ID, "d1", "bob", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.transfers.Offer(ctx, alice.ID, "d1", "carol", true); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("second pending offer: got %v, want conflict", err)
+	}
+	if pending, _ := s.transfers.GetUserTransfers(ctx, bob.ID); len(pending) != 1 || pending[0].ID != toBob.ID {
+		t.Errorf("bob's transfers %+v", pending)
+	}
+	if _, err := s.transfers.Accept(ctx, carol.ID, toBob.ID, ""); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("accepting another's transfer: got %v, want not found", err)
+	}
+
+	bobSince := now.Add(-90 * time.Minute)
+	s.transfers.now = func() time.Time { return bobSince }
+	device, err := s.transfers.Accept(ctx, bob.ID, toBob.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.UserID != bob.ID || device.HomeID != nil || device.ChannelID == "c1" || device.ChannelID == "" {
+		t.Errorf("device after transfer %+v", device)
+	}
+	if _, err := s.devices.GetDeviceByChannel(ctx, "c1"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("old channel: got %v, want not found", err)
+	}
+	if _, err := s.transfers.Accept(ctx, bob.ID, toBob.ID, ""); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting twice: got %v, want conflict", err)
+	}
+
+	// A move based on the device as alice read it before the transfer
+	// cannot undo it.
+	if err := s.store.SetDeviceHome(ctx, "d1", alice.ID, &homeID, nil); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("stale move: got %v, want conflict", err)
+	}
+	if moved, _ := s.devices.GetDeviceByID(ctx, "d1"); moved.UserID != bob.ID || moved.ChannelID != device.ChannelID {
+		t.Errorf("device after a stale move %+v", moved)
+	}
+
+	// Each owner reads what the device recorded while they owned it.
+	if windows, _ := s.transfers.TelemetryWindows(ctx, device, alice.ID); len(windows) != 1 || !windows[0].From.IsZero() || !windows[0].To.Equal(bobSince) {
+		t.Errorf("alice's windows %+v", windows)
+	}
+	if windows, _ := s.transfers.TelemetryWindows(ctx, device, bob.ID); len(windows) != 1 || !windows[0].From.Equal(bobSince) || !windows[0].To.IsZero() {
+		t.Errorf("bob's windows %+v", windows)
+	}
+	if windows, _ := s.transfers.TelemetryWindows(ctx, device, carol.ID); len(windows) != 0 {
+		t.Errorf("carol's windows %+v, want none", windows)
+	}
+
+	// Declined and cancelled transfers leave the device with bob.
+	if err := s.devices.AddDeviceData(ctx, reading(now.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	declined, err := s.transfers.Offer(ctx, bob.ID, "d1", "carol", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.transfers.Cancel(ctx, carol.ID, declined.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("cancel by the recipient: got %v, want not found", err)
+	}
+	if err := s.transfers.Decline(ctx, carol.ID, declined.ID); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := s.transfers.Offer(ctx, bob.ID, "d1", "carol", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.transfers.Cancel(ctx, bob.ID, cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.transfers.Accept(ctx, carol.ID, cancelled.ID, ""); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting a cancelled transfer: got %v, want conflict", err)
+	}
+
+	// Without keeping telemetry, bob's readings go with the device; alice's
+	// kept ones stay.
+	toCarol, err := s.transfers.Offer(ctx, bob.ID, "d1", "carol", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.transfers.now = func() time.Time { return now }
+	if device, err = s.transfers.Accept(ctx, carol.ID, toCarol.ID, "carol-d1"); err != nil || device.ChannelID != "carol-d1" {
+		t.Fatalf("accept on a chosen channel: %+v, %v", device, err)
+	}
+	readings, err := s.devices.deviceRepo.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceID: "d1", From: now.Add(-4 * time.Hour), To: now})
+	if err != nil || len(readings) != 2 {
+		t.Errorf("readings after purge %+v, %v, want alice's two", readings, err)
+	}
+	if windows, _ := s.transfers.TelemetryWindows(ctx, device, bob.ID); len(windows) != 0 {
+		t.Errorf("bob's windows after purging the telemetry %+v, want none", windows)
+	}
+
+	entries, err := s.store.GetAuditEntries(ctx, repositories.AuditQuery{TargetType: models.AuditTargetDevice, TargetID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Action]++
+	}
+	want := map[string]int{models.AuditDeviceTransfer: 4, models.AuditDeviceAccept: 2, models.AuditDeviceDecline: 1, models.AuditDeviceCancel: 1}
+	for action, n := range want {
+		if counts[action] != n {
+			t.Errorf("%d %s entries, want %d", counts[action], action, n)
+		}
+	}
+}
+
+// TestDeviceTransferBack checks that an owner who gets a device back still
+// reads what it recorded the first time they owned it, but not what it
+// recorded in between.
+func TestDeviceTransferBack(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	toBobAt, backAt := now.Add(-2*time.Hour), now.Add(-time.Hour)
+
+	toBob, err := s.transfers.Offer(ctx, alice.ID, "d1", "bob", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.transfers.now = func() time.Time { return toBobAt }
+	if _, err := s.transfers.Accept(ctx, bob.ID, toBob.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	back, err := s.transfers.Offer(ctx, bob.ID, "d1", "alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.transfers.now = func() time.Time { return backAt }
+	device, err := s.transfers.Accept(ctx, alice.ID, back.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TelemetryWindow{{To: toBobAt}, {From: backAt}}
+	windows, err := s.transfers.TelemetryWindows(ctx, device, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("alice's windows %+v, want %+v", windows, want)
+	}
+	for i := range want {
+		if !windows[i].From.Equal(want[i].From) || !windows[i].To.Equal(want[i].To) {
+			t.Errorf("alice's window %d %+v, want %+v", i, windows[i], want[i])
+		}
+	}
+
+	readings := []models.DeviceData{
+		{DeviceID: "d1", CreatedAt: now.Add(-150 * time.Minute), Data: map[string]interface{}{"owner": "alice"}},
+		{DeviceID: "d1", CreatedAt: now.Add(-90 * time.Minute), Data: map[string]interface{}{"owner": "bob"}},
+		{DeviceID: "d1", CreatedAt: now.Add(-30 * time.Minute), Data: map[string]interface{}{"owner": "alice"}},
+	}
+	if err := s.devices.AddDeviceDataBatch(ctx, readings); err != nil {
+		t.Fatal(err)
+	}
+	query := repositories.TelemetryQuery{DeviceID: "d1", From: now.Add(-3 * time.Hour), To: now}
+	data, err := s.telemetry.GetDeviceDataInWindows(ctx, query, windows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[0].Data["owner"] != "alice" || data[1].Data["owner"] != "alice" {
+		t.Errorf("alice reads %+v, want her two readings", data)
+	}
+	if !data[0].CreatedAt.After(data[1].CreatedAt) {
+		t.Error("readings are not newest first")
+	}
+}
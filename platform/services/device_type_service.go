@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// Schema validation modes applied when telemetry does not match its device type.
+const (
+	// ValidationReject drops the reading.
+	ValidationReject = "reject"
+	// ValidationTag stores the reading unchanged with its violations attached.
+	ValidationTag = "tag"
+	// ValidationCoerce converts values to the declared type and clamps them to
+	// the declared range, rejecting the reading if that is not possible.
+	ValidationCoerce = "coerce"
+)
+
+// Telemetry field and command parameter types.
+const (
+	FieldNumber  = "number"
+	FieldInteger = "integer"
+	FieldBoolean = "boolean"
+	FieldString  = "string"
+)
+
+// SchemaViolationError is returned when a reading is rejected by its device type schema.
+type SchemaViolationError struct {
+	DeviceType string
+	Violations []string
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("telemetry does not match device type %s: %s", e.DeviceType, strings.Join(e.Violations, "; "))
+}
+
+// Is makes a SchemaViolationError match apperrors.ErrValidation.
+func (e *SchemaViolationError) Is(target error) bool {
+	return target == apperrors.ErrValidation
+}
+
+type DeviceTypeService struct {
+	deviceTypeRepo repositories.DeviceTypeStore
+	defaultMode    string
+	audit          *audit.Recorder
+}
+
+// NewDeviceTypeService returns the service with defaultMode, if set, as the
+// validation mode of device types without one.
+func NewDeviceTypeService(deviceTypeRepo repositories.DeviceTypeStore, defaultMode string, recorder *audit.Recorder) (*DeviceTypeService, error) {
+	if defaultMode == "" {
+		defaultMode = ValidationTag
+	}
+	if !validationMode(defaultMode) {
+		return nil, fmt.Errorf("unsupported validation mode: %s", defaultMode)
+	}
+	return &DeviceTypeService{deviceTypeRepo: deviceTypeRepo, defaultMode: defaultMode, audit: recorder}, nil
+}
+
+func (s *DeviceTypeService) AddDeviceType(ctx context.Context, deviceType models.DeviceType) (int, error) {
+	if err := checkDeviceType(deviceType); err != nil {
+		return 0, err
+	}
+	id, err := s.deviceTypeRepo.AddDeviceType(ctx, deviceType)
+	if err != nil {
+		return 0, err
+	}
+	deviceType.ID = id
+	_, after := audit.Diff(nil, deviceType)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceTypeCreate,
+		TargetType: models.AuditTargetDeviceType,
+		TargetID:   strconv.Itoa(id),
+		After:      after,
+	})
+	return id, nil
+}
+
+func (s *DeviceTypeService) GetDeviceTypeByID(ctx context.Context, id int) (models.DeviceType, error) {
+	deviceType, err := s.deviceTypeRepo.GetDeviceTypeByID(ctx, id)
+	if err != nil {
+		return deviceType, err
+	}
+	return deviceType, nil
+}
+
+func (s *DeviceTypeService) GetDeviceTypes(ctx context.Context) ([]models.DeviceType, error) {
+	deviceTypes, err := s.deviceTypeRepo.GetDeviceTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return deviceTypes, nil
+}
+
+// ValidateTelemetry checks data against the device type's fields. It returns
+// the data to store and, in tag mode, the violations to store alongside it.
+func (s *DeviceTypeService) ValidateTelemetry(deviceType models.DeviceType, data map[string]interface{}) (map[string]interface{}, []string, error) {
+	if len(deviceType.Fields) == 0 {
+		return data, nil, nil
+	}
+
+	mode := deviceType.ValidationMode
+	if mode == "" {
+		mode = s.defaultMode
+	}
+
+	checked, violations := checkValues(deviceType.Fields, data, mode == ValidationCoerce)
+	if len(violations) == 0 {
+		return checked, nil, nil
+	}
+	if mode == ValidationTag {
+		return data, violations, nil
+	}
+	return nil, nil, &SchemaViolationError{DeviceType: deviceType.Name, Violations: violations}
+}
+
+// ValidateCommand checks a command and its parameters against the device type.
+func (s *DeviceTypeService) ValidateCommand(deviceType models.DeviceType, command string, params map[string]interface{}) error {
+	for _, cmd := range deviceType.Commands {
+		if cmd.Name != command {
+			continue
+		}
+		if _, violations := checkValues(cmd.Params, params, false); len(violations) > 0 {
+			return &SchemaViolationError{DeviceType: deviceType.Name, Violations: violations}
+		}
+		return nil
+	}
+	return apperrors.Invalid("command", "device type %s does not support command %s", deviceType.Name, command)
+}
+
+// validationMode reports whether mode is one of the validation modes.
+func validationMode(mode string) bool {
+	switch mode {
+	case ValidationReject, ValidationTag, ValidationCoerce:
+		return true
+	}
+	return false
+}
+
+func checkDeviceType(deviceType models.DeviceType) error {
+	if deviceType.Name == "" {
+		return apperrors.Invalid("name", "is required")
+	}
+	if deviceType.ValidationMode != "" && !validationMode(deviceType.ValidationMode) {
+		return apperrors.Invalid("validation_mode", "unsupported validation mode %s", deviceType.ValidationMode)
+	}
+
+	fields := append([]models.TelemetryField{}, deviceType.Fields...)
+	for _, cmd := range deviceType.Commands {
+		fields = append(fields, cmd.Params...)
+	}
+	for _, field := range fields {
+		switch field.Type {
+		case FieldNumber, FieldInteger, FieldBoolean, FieldString:
+		default:
+			return apperrors.Invalid("fields", "field %s has unsupported type %q", field.Name, field.Type)
+		}
+	}
+	return nil
+}
+
+// checkValues validates values against fields. With coerce set it converts
+// and clamps values where it can, drops undeclared fields, and only reports
+// what it could not fix.
+func checkValues(fields []models.TelemetryField, values map[string]interface{}, coerce bool) (map[string]interface{}, []string) {
+	var violations []string
+	out := make(map[string]interface{}, len(values))
+	declared := make(map[string]bool, len(fields))
+
+	for _, field := range fields {
+		declared[field.Name] = true
+		value, ok := values[field.Name]
+		if !ok {
+			if field.Required {
+				violations = append(violations, fmt.Sprintf("%s: required field is missing", field.Name))
+			}
+			continue
+		}
+
+		converted, err := convertValue(field, value, coerce)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", field.Name, err))
+			continue
+		}
+		out[field.Name] = converted
+	}
+
+	for name, value := range values {
+		if declared[name] {
+			continue
+		}
+		if coerce {
+			// Undeclared fields are dropped rather than stored.
+			continue
+		}
+		violations = append(violations, fmt.Sprintf("%s: field is not declared by the device type", name))
+		out[name] = value
+	}
+	return out, violations
+}
+
+func convertValue(field models.TelemetryField, value interface{}, coerce bool) (interface{}, error) {
+	switch field.Type {
+	case FieldBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if coerce {
+			switch v := value.(type) {
+			case float64:
+				return v != 0, nil
+			case string:
+				if b, err := strconv.ParseBool(v); err == nil {
+					return b, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("expected boolean, got %T", value)
+
+	case FieldString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		if coerce {
+			return fmt.Sprint(value), nil
+		}
+		return nil, fmt.Errorf("expected string, got %T", value)
+
+	default:
+		number, ok := value.(float64)
+		if !ok && coerce {
+			switch v := value.(type) {
+			case string:
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				ok = err == nil
+				number = parsed
+			case bool:
+				ok = true
+				if v {
+					number = 1
+				}
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("expected %s, got %T", field.Type, value)
+		}
+
+		if field.Type == FieldInteger && number != math.Trunc(number) {
+			if !coerce {
+				return nil, fmt.Errorf("expected integer, got %v", number)
+			}
+			number = math.Round(number)
+		}
+
+		if field.Min != nil && number < *field.Min {
+			if !coerce {
+				return nil, fmt.Errorf("%v is below minimum %v", number, *field.Min)
+			}
+			number = *field.Min
+		}
+		if field.Max != nil && number > *field.Max {
+			if !coerce {
+				return nil, fmt.Errorf("%v is above maximum %v", number, *field.Max)
+			}
+			number = *field.Max
+		}
+		return number, nil
+	}
+}
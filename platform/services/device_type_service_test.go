@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestValidateTelemetry(t *testing.T) {
+	s := newTestServices(t)
+	fields := []models.TelemetryField{
+		{Name: "temp", Type: FieldNumber, Min: float(-40), Max: float(85), Required: true},
+		{Name: "on", Type: FieldBoolean},
+	}
+	reading := map[string]interface{}{"temp": "120", "on": true, "extra": 1.0}
+
+	tests := []struct {
+		mode           string
+		wantErr        bool
+		wantViolations int
+		wantTemp       interface{}
+	}{
+		{ValidationReject, true, 0, nil},
+		{ValidationTag, false, 2, "120"},
+		{ValidationCoerce, false, 0, 85.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			deviceType := models.DeviceType{Name: "sensor", ValidationMode: tt.mode, Fields: fields}
+			data, violations, err := s.deviceType.ValidateTelemetry(deviceType, reading)
+
+			var violation *SchemaViolationError
+			if tt.wantErr {
+				if !errors.As(err, &violation) {
+					t.Fatalf("expected a schema violation, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != tt.wantViolations {
+				t.Errorf("got violations %v, want %d", violations, tt.wantViolations)
+			}
+			if data["temp"] != tt.wantTemp {
+				t.Errorf("temp = %v, want %v", data["temp"], tt.wantTemp)
+			}
+		})
+	}
+}
+
+func TestAddDeviceType(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+
+	if _, err := s.deviceType.AddDeviceType(ctx, models.DeviceType{Name: "sensor", ValidationMode: "drop"}); err == nil {
+		t.Error("expected an error for an unsupported validation mode")
+	}
+	if _, err := s.deviceType.AddDeviceType(ctx, models.DeviceType{Name: "sensor"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.deviceType.AddDeviceType(ctx, models.DeviceType{Name: "sensor"})
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		t.Errorf("expected a unique violation for a duplicate name, got %v", err)
+	}
+}
+
+func TestDefaultValidationMode(t *testing.T) {
+	for _, mode := range []string{"", ValidationReject, ValidationTag, ValidationCoerce} {
+		if _, err := NewDeviceTypeService(nil, mode, nil); err != nil {
+			t.Errorf("mode %q: %v", mode, err)
+		}
+	}
+	if _, err := NewDeviceTypeService(nil, "drop", nil); err == nil {
+		t.Error("expected an error for an unsupported default mode")
+	}
+}
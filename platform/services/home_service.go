@@ -1,72 +1,442 @@
 package services
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
 
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
 	"PragatiIot/platform/models"
 	"PragatiIot/platform/repositories"
 )
 
+// HomeService manages homes and who may do what in them. What a user may do
+// is the union of the permissions of the home's owner, if they own it, of
+// their role in the home, and of their role in the home's organization (see
+// models.OrgRolePermissions). Authorize is the one check handlers call.
 type HomeService struct {
-	homeRepo    *repositories.HomeRepository
+	homeRepo    repositories.HomeStore
 	roleService *RoleService
 	userService *UserService
+	orgService  *OrganizationService
+	audit       *audit.Recorder
 }
 
-func NewHomeService(homeRepo *repositories.HomeRepository, roleService *RoleService) *HomeService {
-	return &HomeService{homeRepo: homeRepo, roleService: roleService}
+func NewHomeService(homeRepo repositories.HomeStore, roleService *RoleService, userService *UserService, orgService *OrganizationService, recorder *audit.Recorder) *HomeService {
+	return &HomeService{homeRepo: homeRepo, roleService: roleService, userService: userService, orgService: orgService, audit: recorder}
 }
 
-func (s *HomeService) AddHome(home models.Home) error {
-	if err := s.homeRepo.AddHome(home); err != nil {
-		log.Printf("Error adding home: %v", err)
+// AddHome adds the home and returns its ID. Only an owner or admin of the
+// home's organization may add a home to it, within its homes quota.
+func (s *HomeService) AddHome(ctx context.Context, home models.Home) (int, error) {
+	if home.OrgID != nil {
+		if _, err := s.orgService.require(ctx, *home.OrgID, home.UserID, models.OrgRoleAdmin); err != nil {
+			return 0, err
+		}
+		if err := s.orgService.CheckQuota(ctx, *home.OrgID, QuotaHomes); err != nil {
+			return 0, err
+		}
+	}
+	id, err := s.homeRepo.AddHome(ctx, home)
+	if err != nil {
+		return 0, err
+	}
+	home.ID = id
+	_, after := audit.Diff(nil, home)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditHomeCreate,
+		TargetType: models.AuditTargetHome,
+		TargetID:   strconv.Itoa(id),
+		HomeIDs:    []int{id},
+		After:      after,
+	})
+	return id, nil
+}
+
+// AddMember gives the service account the role in the home on behalf of the
+// actor, who needs the home.members.manage permission and may only hand out
+// roles whose permissions they hold themselves. People must consent to
+// joining a home, so they are invited instead (see InvitationService.Invite).
+func (s *HomeService) AddMember(ctx context.Context, actorID, homeID, userID int, roleName string) error {
+	if _, err := s.checkGrant(ctx, actorID, homeID, roleName); err != nil {
 		return err
 	}
-	return nil
+	user, err := s.userService.GetUserByID(ctx, userID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return apperrors.Invalid("user_id", "no user has this ID")
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsServiceAccount() {
+		return apperrors.Invalid("user_id", "is not a service account; invite people to the home instead")
+	}
+	return s.AddUserToHome(ctx, homeID, userID, roleName)
+}
+
+// checkGrant returns the role if the actor may give it to members of the
+// home: they hold home.members.manage and every permission of the role.
+func (s *HomeService) checkGrant(ctx context.Context, actorID, homeID int, roleName string) (models.Role, error) {
+	if err := s.Authorize(ctx, homeID, actorID, models.PermHomeMembersManage); err != nil {
+		return models.Role{}, err
+	}
+	role, err := s.roleService.GetHomeRole(ctx, homeID, roleName)
+	if err != nil {
+		return role, err
+	}
+	return role, s.requireHeld(ctx, homeID, actorID, role.Permissions)
 }
 
-func (s *HomeService) AddUserToHome(homeID, userID int, roleName string) error {
-	role, err := s.roleService.GetRoleByName(roleName)
+// AddUserToHome gives the user the built-in or custom role in the home. A
+// home of an organization only admits the organization's members.
+func (s *HomeService) AddUserToHome(ctx context.Context, homeID, userID int, roleName string) error {
+	role, err := s.roleService.GetHomeRole(ctx, homeID, roleName)
 	if err != nil {
-		log.Printf("Error getting role by name: %v", err)
 		return err
 	}
+	orgRole, err := s.orgRole(ctx, homeID, userID)
+	if err != nil {
+		return err
+	}
+	if orgRole != nil && *orgRole == "" {
+		return apperrors.Invalid("user_id", "is not a member of the home's organization")
+	}
 
 	homeUser := models.HomeUser{
 		HomeID: homeID,
 		UserID: userID,
 		RoleID: role.ID,
 	}
-	if err := s.homeRepo.AddUserToHome(homeUser); err != nil {
-		log.Printf("Error adding user to home: %v", err)
+	if err := s.homeRepo.AddUserToHome(ctx, homeUser); err != nil {
 		return err
 	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditMembershipAdd,
+		TargetType: models.AuditTargetMembership,
+		TargetID:   fmt.Sprintf("%d:%d", homeID, userID),
+		HomeIDs:    []int{homeID},
+		After:      map[string]interface{}{"home_id": homeID, "user_id": userID, "role": role.Name},
+	})
 	return nil
 }
 
-func (s *HomeService) GetHomesByUserID(userID int) ([]models.Home, error) {
-	homes, err := s.homeRepo.GetHomesByUserID(userID)
+func (s *HomeService) GetHomesByUserID(ctx context.Context, userID int) ([]models.Home, error) {
+	homes, err := s.homeRepo.GetHomesByUserID(ctx, userID)
 	if err != nil {
-		log.Printf("Error getting homes by user ID: %v", err)
 		return nil, err
 	}
 	return homes, nil
 }
 
-func (s *HomeService) GetHomeUserRole(homeID, userID int) (int, error) {
-	roleID, err := s.homeRepo.GetHomeUserRole(homeID, userID)
+// GetHomesByOrgID returns the organization's homes, to its members only.
+func (s *HomeService) GetHomesByOrgID(ctx context.Context, orgID, userID int) ([]models.Home, error) {
+	if _, err := s.orgService.require(ctx, orgID, userID, models.OrgRoleViewer); err != nil {
+		return nil, err
+	}
+	return s.homeRepo.GetHomesByOrgID(ctx, orgID)
+}
+
+func (s *HomeService) GetHomeByID(ctx context.Context, id int) (models.Home, error) {
+	return s.homeRepo.GetHomeByID(ctx, id)
+}
+
+func (s *HomeService) GetHomeUserRole(ctx context.Context, homeID, userID int) (int, error) {
+	roleID, err := s.homeRepo.GetHomeUserRole(ctx, homeID, userID)
 	if err != nil {
-		log.Printf("Error getting role for user %d in home %d: %v", userID, homeID, err)
 		return 0, err
 	}
 	return roleID, nil
 }
 
-func (s *HomeService) GetUserByUsername(username string) (models.User, error) {
-	user, err := s.userService.GetUserByUsername(username)
+func (s *HomeService) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	user, err := s.userService.GetUserByUsername(ctx, username)
 	if err != nil {
-		log.Printf("Error getting user by username %s: %v", username, err)
 		return user, err
 	}
 	return user, nil
 }
+
+// GetPermittedHomeIDs returns the homes the user owns or holds the
+// permission in, directly or through the home's organization.
+func (s *HomeService) GetPermittedHomeIDs(ctx context.Context, userID int, permission string) ([]int, error) {
+	return s.homeRepo.GetPermittedHomeIDs(ctx, userID, permission)
+}
+
+// errAdminMFARequired refuses a member of a home that requires MFA who has
+// not enabled it.
+var errAdminMFARequired = apperrors.Forbidden("This home requires multi-factor authentication for anything beyond reading")
+
+// Permissions returns the permissions the user holds in the home: all of
+// them if they own it, plus those of their role in it and in its
+// organization. A home that does not exist grants none.
+func (s *HomeService) Permissions(ctx context.Context, homeID, userID int) ([]string, error) {
+	home, err := s.homeRepo.GetHomeByID(ctx, homeID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if home.UserID == userID {
+		return slices.Clone(models.Permissions), nil
+	}
+
+	var permissions []string
+	roleID, err := s.homeRepo.GetHomeUserRole(ctx, homeID, userID)
+	switch {
+	case err == nil:
+		role, err := s.roleService.GetRoleByID(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, role.Permissions...)
+	case !errors.Is(err, apperrors.ErrNotFound):
+		return nil, err
+	}
+	if home.OrgID != nil {
+		orgRole, err := s.orgService.Role(ctx, *home.OrgID, userID)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, models.OrgRolePermissions(orgRole)...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions), nil
+}
+
+// Authorize refuses the user with a forbidden error unless they hold the
+// permission in the home. If the home requires MFA, only the read
+// permissions are granted to users without it. Service accounts, which
+// cannot enroll, are exempt; their owners decide what they may do.
+func (s *HomeService) Authorize(ctx context.Context, homeID, userID int, permission string) error {
+	permissions, err := s.Permissions(ctx, homeID, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(permissions, permission) {
+		return apperrors.Forbidden("Requires the %s permission in this home", permission)
+	}
+	if slices.Contains(models.ReadPermissions, permission) {
+		return nil
+	}
+
+	home, err := s.homeRepo.GetHomeByID(ctx, homeID)
+	if err != nil {
+		return err
+	}
+	if !home.RequireMFA {
+		return nil
+	}
+	user, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled && !user.IsServiceAccount() {
+		return errAdminMFARequired
+	}
+	return nil
+}
+
+// SetRequireMFA sets whether the home requires its members to use MFA for
+// anything beyond reading. It needs the home.manage permission, and only a
+// user who uses MFA may turn it on, so they cannot lock themselves out.
+func (s *HomeService) SetRequireMFA(ctx context.Context, homeID int, user models.User, require bool) error {
+	if err := s.Authorize(ctx, homeID, user.ID, models.PermHomeManage); err != nil {
+		return err
+	}
+	if require && !user.MFAEnabled {
+		return apperrors.Conflict("Enable multi-factor authentication before requiring it")
+	}
+
+	home, err := s.homeRepo.GetHomeByID(ctx, homeID)
+	if err != nil {
+		return err
+	}
+	if home.RequireMFA == require {
+		return nil
+	}
+	if err := s.homeRepo.SetHomeRequireMFA(ctx, homeID, require); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditHomeUpdate,
+		TargetType: models.AuditTargetHome,
+		TargetID:   strconv.Itoa(homeID),
+		HomeIDs:    []int{homeID},
+		Before:     map[string]interface{}{"require_mfa": home.RequireMFA},
+		After:      map[string]interface{}{"require_mfa": require},
+	})
+	return nil
+}
+
+// GetRoles returns the roles that can be held in the home, to those who can
+// see it.
+func (s *HomeService) GetRoles(ctx context.Context, homeID, userID int) ([]models.Role, error) {
+	if err := s.AuthorizeView(ctx, homeID, userID); err != nil {
+		return nil, err
+	}
+	return s.roleService.GetHomeRoles(ctx, homeID)
+}
+
+// CreateRole adds a custom role to the home. It needs the home.roles.manage
+// permission, and the role may only grant permissions the actor holds.
+func (s *HomeService) CreateRole(ctx context.Context, actorID, homeID int, name string, permissions []string) (models.Role, error) {
+	if err := s.Authorize(ctx, homeID, actorID, models.PermHomeRolesManage); err != nil {
+		return models.Role{}, err
+	}
+	if err := checkPermissions(permissions); err != nil {
+		return models.Role{}, err
+	}
+	if err := s.requireHeld(ctx, homeID, actorID, permissions); err != nil {
+		return models.Role{}, err
+	}
+	role, err := s.roleService.AddRole(ctx, models.Role{Name: name, HomeID: &homeID, Permissions: permissions})
+	if err != nil {
+		return role, err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditRoleCreate,
+		TargetType: models.AuditTargetRole,
+		TargetID:   strconv.Itoa(role.ID),
+		HomeIDs:    []int{homeID},
+		After:      map[string]interface{}{"home_id": homeID, "name": name, "permissions": permissions},
+	})
+	return role, nil
+}
+
+// UpdateRole renames a custom role of the home and replaces its
+// permissions, which the actor must hold both before and after the change.
+func (s *HomeService) UpdateRole(ctx context.Context, actorID, homeID, roleID int, name string, permissions []string) (models.Role, error) {
+	if err := s.Authorize(ctx, homeID, actorID, models.PermHomeRolesManage); err != nil {
+		return models.Role{}, err
+	}
+	previous, err := s.roleService.GetCustomRole(ctx, homeID, roleID)
+	if err != nil {
+		return previous, err
+	}
+	if err := checkPermissions(permissions); err != nil {
+		return previous, err
+	}
+	if err := s.requireHeld(ctx, homeID, actorID, append(slices.Clone(previous.Permissions), permissions...)); err != nil {
+		return previous, err
+	}
+	role := models.Role{ID: roleID, Name: name, HomeID: &homeID, Permissions: permissions}
+	if err := s.roleService.UpdateRole(ctx, role); err != nil {
+		return role, err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditRoleUpdate,
+		TargetType: models.AuditTargetRole,
+		TargetID:   strconv.Itoa(roleID),
+		HomeIDs:    []int{homeID},
+		Before:     map[string]interface{}{"name": previous.Name, "permissions": previous.Permissions},
+		After:      map[string]interface{}{"name": name, "permissions": permissions},
+	})
+	return role, nil
+}
+
+// DeleteRole deletes a custom role of the home that no member holds.
+func (s *HomeService) DeleteRole(ctx context.Context, actorID, homeID, roleID int) error {
+	if err := s.Authorize(ctx, homeID, actorID, models.PermHomeRolesManage); err != nil {
+		return err
+	}
+	role, err := s.roleService.GetCustomRole(ctx, homeID, roleID)
+	if err != nil {
+		return err
+	}
+	if err := s.roleService.DeleteRole(ctx, roleID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditRoleDelete,
+		TargetType: models.AuditTargetRole,
+		TargetID:   strconv.Itoa(roleID),
+		HomeIDs:    []int{homeID},
+		Before:     map[string]interface{}{"home_id": homeID, "name": role.Name, "permissions": role.Permissions},
+	})
+	return nil
+}
+
+// IsHomeMember reports whether the user holds any role in the home,
+// directly or through its organization.
+func (s *HomeService) IsHomeMember(ctx context.Context, homeID, userID int) bool {
+	if _, err := s.homeRepo.GetHomeUserRole(ctx, homeID, userID); err == nil {
+		return true
+	}
+	orgRole, err := s.orgRole(ctx, homeID, userID)
+	return err == nil && orgRole != nil && *orgRole != ""
+}
+
+// CanView reports whether the user may see the home: they own it or hold a
+// role in it.
+func (s *HomeService) CanView(ctx context.Context, home models.Home, userID int) bool {
+	return home.UserID == userID || s.IsHomeMember(ctx, home.ID, userID)
+}
+
+// AuthorizeView refuses the user with a forbidden error unless they may see
+// the home. Unknown homes are refused the same way.
+func (s *HomeService) AuthorizeView(ctx context.Context, homeID, userID int) error {
+	home, err := s.homeRepo.GetHomeByID(ctx, homeID)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return err
+	}
+	if err != nil || !s.CanView(ctx, home, userID) {
+		return apperrors.Forbidden("Not allowed to view this home")
+	}
+	return nil
+}
+
+// CheckDeviceQuota refuses adding a device to the home if it belongs to an
+// organization whose plan allows no more devices.
+func (s *HomeService) CheckDeviceQuota(ctx context.Context, homeID *int) error {
+	if homeID == nil {
+		return nil
+	}
+	home, err := s.homeRepo.GetHomeByID(ctx, *homeID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// The device store reports the unknown home.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if home.OrgID == nil {
+		return nil
+	}
+	return s.orgService.CheckQuota(ctx, *home.OrgID, QuotaDevices)
+}
+
+// requireHeld refuses the actor unless they hold every one of permissions in
+// the home, so nobody can hand out more than they have.
+func (s *HomeService) requireHeld(ctx context.Context, homeID, actorID int, permissions []string) error {
+	held, err := s.Permissions(ctx, homeID, actorID)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission) {
+			return apperrors.Forbidden("Cannot grant the %s permission, which you do not hold", permission)
+		}
+	}
+	return nil
+}
+
+// orgRole returns the user's role in the organization of the home: nil if
+// the home has none or does not exist, "" if the user is not a member.
+func (s *HomeService) orgRole(ctx context.Context, homeID, userID int) (*string, error) {
+	home, err := s.homeRepo.GetHomeByID(ctx, homeID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil || home.OrgID == nil {
+		return nil, err
+	}
+	role, err := s.orgService.Role(ctx, *home.OrgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
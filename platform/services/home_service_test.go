@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestHomeRoles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	carol := s.addUser(t, "carol")
+	homeID := s.addHome(t, alice)
+
+	if err := s.homes.AddUserToHome(ctx, homeID, bob.ID, "View"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user                 models.User
+		manage, read, member bool
+	}{
+		{alice, true, true, true},
+		{bob, false, true, true},
+		{carol, false, false, false},
+	}
+	for _, tt := range tests {
+		if err := s.homes.Authorize(ctx, homeID, tt.user.ID, models.PermHomeManage); (err == nil) != tt.manage {
+			t.Errorf("Authorize(%s, home.manage) = %v, want allowed %v", tt.user.Username, err, tt.manage)
+		}
+		if err := s.homes.Authorize(ctx, homeID, tt.user.ID, models.PermTelemetryRead); (err == nil) != tt.read {
+			t.Errorf("Authorize(%s, telemetry.read) = %v, want allowed %v", tt.user.Username, err, tt.read)
+		}
+		if member := s.homes.IsHomeMember(ctx, homeID, tt.user.ID); member != tt.member {
+			t.Errorf("IsHomeMember(%s) = %v, want %v", tt.user.Username, member, tt.member)
+		}
+	}
+}
+
+func TestAddUserToHomeUnknownRole(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	homeID := s.addHome(t, alice)
+
+	err := s.homes.AddUserToHome(ctx, homeID, alice.ID, "Owner")
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("expected a validation error for an unknown role, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/notify"
+	"PragatiIot/platform/repositories"
+)
+
+// maxInvitationTTL bounds how far off an invitation's expiry may be.
+const maxInvitationTTL = 30 * 24 * time.Hour
+
+// errInvitationNotFound is returned for invitations that do not exist or
+// are not addressed to the caller, so invitees cannot probe others'.
+var errInvitationNotFound = apperrors.NotFound("Invitation not found")
+
+// InvitationConfig configures invitations to homes.
+type InvitationConfig struct {
+	// BaseURL is the address of the client app. Notifications link to its
+	// /invitations page, which lists the invitee's invitations.
+	BaseURL string
+	// TTL is how long an invitation stays open unless the inviter says.
+	TTL time.Duration
+}
+
+// InvitationService invites users to homes by email address or username.
+// An invitation only adds the invitee to the home when they accept it, and
+// the invitee and inviter are told of each step through the notifier.
+type InvitationService struct {
+	invitations repositories.InvitationStore
+	users       repositories.UserStore
+	homes       *HomeService
+	notifier    notify.Notifier
+	audit       *audit.Recorder
+	config      InvitationConfig
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+func NewInvitationService(invitations repositories.InvitationStore, users repositories.UserStore, homes *HomeService, notifier notify.Notifier, recorder *audit.Recorder, config InvitationConfig, logger *slog.Logger) *InvitationService {
+	if config.TTL <= 0 {
+		config.TTL = 7 * 24 * time.Hour
+	}
+	return &InvitationService{invitations: invitations, users: users, homes: homes, notifier: notifier, audit: recorder, config: config, logger: logger, now: time.Now}
+}
+
+// Invite offers the role in the home to the user with the username, or to
+// the email address. The inviter needs home.members.manage and every
+// permission of the role. Without expiresAt, the invitation is open for the
+// configured TTL. A pending invitation to the same address is refused
+// unless it expired, in which case it is revoked and replaced.
+func (s *InvitationService) Invite(ctx context.Context, actorID, homeID int, email, username, roleName string, expiresAt *time.Time) (models.HomeInvitation, error) {
+	role, err := s.homes.checkGrant(ctx, actorID, homeID, roleName)
+	if err != nil {
+		return models.HomeInvitation{}, err
+	}
+	inv := models.HomeInvitation{HomeID: homeID, Email: email, RoleID: role.ID, RoleName: role.Name, InvitedBy: actorID}
+	if err := s.resolveInvitee(ctx, &inv, username); err != nil {
+		return inv, err
+	}
+
+	now := s.now()
+	inv.ExpiresAt = now.Add(s.config.TTL)
+	if expiresAt != nil {
+		if !expiresAt.After(now) || expiresAt.After(now.Add(maxInvitationTTL)) {
+			return inv, apperrors.Invalid("expires_at", "must be in the next %d days", int(maxInvitationTTL.Hours()/24))
+		}
+		inv.ExpiresAt = *expiresAt
+	}
+	if err := s.revokeExpired(ctx, homeID, inv.Email, now); err != nil {
+		return inv, err
+	}
+
+	id, err := s.invitations.AddInvitation(ctx, inv)
+	if err != nil {
+		return inv, err
+	}
+	inv, err = s.invitations.GetInvitationByID(ctx, id)
+	if err != nil {
+		return inv, err
+	}
+	s.record(ctx, models.AuditInvitationCreate, inv, nil, map[string]interface{}{
+		"home_id": homeID, "email": inv.Email, "user_id": inv.UserID, "role": inv.RoleName, "expires_at": inv.ExpiresAt,
+	})
+	s.notifyInvitee(ctx, inv, actorID)
+	return inv, nil
+}
+
+// GetHomeInvitations returns the home's open invitations, to those who may
+// invite.
+func (s *InvitationService) GetHomeInvitations(ctx context.Context, actorID, homeID int) ([]models.HomeInvitation, error) {
+	if err := s.homes.Authorize(ctx, homeID, actorID, models.PermHomeMembersManage); err != nil {
+		return nil, err
+	}
+	invitations, err := s.invitations.GetPendingHomeInvitations(ctx, homeID)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(invitations), nil
+}
+
+// Revoke withdraws a pending invitation to the home. It needs
+// home.members.manage there; other homes' invitations are not found.
+func (s *InvitationService) Revoke(ctx context.Context, actorID, homeID, invitationID int) error {
+	if err := s.homes.Authorize(ctx, homeID, actorID, models.PermHomeMembersManage); err != nil {
+		return err
+	}
+	inv, err := s.invitations.GetInvitationByID(ctx, invitationID)
+	if errors.Is(err, apperrors.ErrNotFound) || err == nil && inv.HomeID != homeID {
+		return errInvitationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.respond(ctx, inv, models.InvitationRevoked, models.AuditInvitationRevoke)
+}
+
+// GetUserInvitations returns the open invitations to the user: those naming
+// them, and those to their email address if they verified it.
+func (s *InvitationService) GetUserInvitations(ctx context.Context, user models.User) ([]models.HomeInvitation, error) {
+	invitations, err := s.invitations.GetPendingUserInvitations(ctx, user.ID, verifiedEmail(user))
+	if err != nil {
+		return nil, err
+	}
+	return s.open(invitations), nil
+}
+
+// Accept adds the user to the invitation's home with its role and tells the
+// inviter.
+func (s *InvitationService) Accept(ctx context.Context, user models.User, invitationID int) error {
+	inv, err := s.addressed(ctx, user, invitationID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkInvitee(ctx, inv.HomeID, user.ID, "invitation_id"); err != nil {
+		return err
+	}
+	// The member is added first, so an invitation is never left accepted
+	// without the membership. A second accept fails to add them again.
+	if err := s.homes.AddUserToHome(ctx, inv.HomeID, user.ID, inv.RoleName); err != nil {
+		return err
+	}
+	if err := s.respond(ctx, inv, models.InvitationAccepted, models.AuditInvitationAccept); err != nil {
+		return err
+	}
+	s.notifyInviter(ctx, inv, user, notify.EventInvitationAccepted, "accepted")
+	return nil
+}
+
+// Decline turns the invitation down and tells the inviter.
+func (s *InvitationService) Decline(ctx context.Context, user models.User, invitationID int) error {
+	inv, err := s.addressed(ctx, user, invitationID)
+	if err != nil {
+		return err
+	}
+	if err := s.respond(ctx, inv, models.InvitationDeclined, models.AuditInvitationDecline); err != nil {
+		return err
+	}
+	s.notifyInviter(ctx, inv, user, notify.EventInvitationDeclined, "declined")
+	return nil
+}
+
+// resolveInvitee sets the invitation's email and user from the username, or
+// the user from the email if it is already a user's, and refuses users who
+// could not accept it.
+func (s *InvitationService) resolveInvitee(ctx context.Context, inv *models.HomeInvitation, username string) error {
+	var user models.User
+	var err error
+	field := "email"
+	switch {
+	case username != "":
+		field = "username"
+		user, err = s.users.GetUserByUsername(ctx, username)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return apperrors.Invalid(field, "no user has this username")
+		}
+	case inv.Email != "":
+		user, err = s.users.GetUserByEmail(ctx, inv.Email)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			// Whoever signs up with the address and verifies it may answer.
+			return nil
+		}
+	default:
+		return apperrors.Invalid("email", "give an email address or a username")
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.IsServiceAccount() {
+		return apperrors.Invalid(field, "is a service account; give it a role directly")
+	}
+	if err := s.checkInvitee(ctx, inv.HomeID, user.ID, field); err != nil {
+		return err
+	}
+	inv.Email = user.Email
+	inv.UserID = &user.ID
+	return nil
+}
+
+// checkInvitee refuses users who already own or hold a role in the home,
+// and, for a home of an organization, those outside the organization, with
+// a validation error on field.
+func (s *InvitationService) checkInvitee(ctx context.Context, homeID, userID int, field string) error {
+	home, err := s.homes.GetHomeByID(ctx, homeID)
+	if err != nil {
+		return err
+	}
+	_, err = s.homes.GetHomeUserRole(ctx, homeID, userID)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return err
+	}
+	if home.UserID == userID || err == nil {
+		return apperrors.Conflict("The user is already a member of this home")
+	}
+	orgRole, err := s.homes.orgRole(ctx, homeID, userID)
+	if err != nil {
+		return err
+	}
+	if orgRole != nil && *orgRole == "" {
+		return apperrors.Invalid(field, "is not a member of the home's organization")
+	}
+	return nil
+}
+
+// revokeExpired revokes an expired pending invitation to the address, so a
+// new one can take its place.
+func (s *InvitationService) revokeExpired(ctx context.Context, homeID int, email string, now time.Time) error {
+	pending, err := s.invitations.GetPendingHomeInvitations(ctx, homeID)
+	if err != nil {
+		return err
+	}
+	for _, inv := range pending {
+		if strings.EqualFold(inv.Email, email) && inv.Expired(now) {
+			return s.invitations.RespondToInvitation(ctx, inv.ID, models.InvitationRevoked, now)
+		}
+	}
+	return nil
+}
+
+// addressed returns the open invitation if it is to the user. Others'
+// invitations are not found.
+func (s *InvitationService) addressed(ctx context.Context, user models.User, invitationID int) (models.HomeInvitation, error) {
+	inv, err := s.invitations.GetInvitationByID(ctx, invitationID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return inv, errInvitationNotFound
+	}
+	if err != nil {
+		return inv, err
+	}
+	toUser := inv.UserID != nil && *inv.UserID == user.ID
+	toEmail := inv.UserID == nil && inv.Email != "" && strings.EqualFold(inv.Email, verifiedEmail(user))
+	if !toUser && !toEmail {
+		return inv, errInvitationNotFound
+	}
+	if inv.Status != models.InvitationPending {
+		return inv, apperrors.Conflict("The invitation was already %s", inv.Status)
+	}
+	if inv.Expired(s.now()) {
+		return inv, apperrors.Conflict("The invitation has expired")
+	}
+	return inv, nil
+}
+
+// respond sets the status of a pending invitation and audits it.
+func (s *InvitationService) respond(ctx context.Context, inv models.HomeInvitation, status, action string) error {
+	if err := s.invitations.RespondToInvitation(ctx, inv.ID, status, s.now()); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return apperrors.Conflict("The invitation is no longer pending")
+		}
+		return err
+	}
+	s.record(ctx, action, inv, map[string]interface{}{"status": inv.Status}, map[string]interface{}{"status": status})
+	return nil
+}
+
+// open leaves out the expired invitations.
+func (s *InvitationService) open(invitations []models.HomeInvitation) []models.HomeInvitation {
+	now := s.now()
+	open := make([]models.HomeInvitation, 0, len(invitations))
+	for _, inv := range invitations {
+		if !inv.Expired(now) {
+			open = append(open, inv)
+		}
+	}
+	return open
+}
+
+func (s *InvitationService) record(ctx context.Context, action string, inv models.HomeInvitation, before, after map[string]interface{}) {
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetInvitation,
+		TargetID:   strconv.Itoa(inv.ID),
+		HomeIDs:    []int{inv.HomeID},
+		Before:     before,
+		After:      after,
+	})
+}
+
+// notifyInvitee tells the invitee of the invitation. A failure is logged;
+// the invitation still shows in their list.
+func (s *InvitationService) notifyInvitee(ctx context.Context, inv models.HomeInvitation, actorID int) {
+	inviter := "Someone"
+	if actor, err := s.users.GetUserByID(ctx, actorID); err == nil {
+		inviter = actor.Username
+	}
+	answer := "Accept or decline it at"
+	if inv.UserID == nil {
+		answer = "Sign up with this email address, verify it, and accept or decline it at"
+	}
+	err := s.notifier.Notify(ctx, notify.Notification{
+		Event:   notify.EventInvitationCreated,
+		UserID:  inv.UserID,
+		Email:   inv.Email,
+		Subject: fmt.Sprintf("You are invited to %s", inv.HomeName),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join %s as %s. %s\n\n%s\n\nThe invitation expires on %s.\n",
+			inviter, inv.HomeName, inv.RoleName, answer, s.link(), inv.ExpiresAt.UTC().Format(time.RFC1123)),
+		Data: invitationData(inv),
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to notify invitee", "invitation_id", inv.ID, "error", err)
+	}
+}
+
+// notifyInviter tells the inviter the invitee answered. A failure is logged.
+func (s *InvitationService) notifyInviter(ctx context.Context, inv models.HomeInvitation, invitee models.User, event, answer string) {
+	inviter, err := s.users.GetUserByID(ctx, inv.InvitedBy)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to notify inviter", "invitation_id", inv.ID, "error", err)
+		return
+	}
+	err = s.notifier.Notify(ctx, notify.Notification{
+		Event:   event,
+		UserID:  &inviter.ID,
+		Email:   inviter.Email,
+		Subject: fmt.Sprintf("%s %s your invitation to %s", invitee.Username, answer, inv.HomeName),
+		Body:    fmt.Sprintf("Hi %s,\n\n%s %s your invitation to join %s as %s.\n", inviter.Username, invitee.Username, answer, inv.HomeName, inv.RoleName),
+		Data:    invitationData(inv),
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to notify inviter", "invitation_id", inv.ID, "error", err)
+	}
+}
+
+func (s *InvitationService) link() string {
+	return strings.TrimSuffix(s.config.BaseURL, "/") + "/invitations"
+}
+
+func invitationData(inv models.HomeInvitation) map[string]string {
+	return map[string]string{
+		"invitation_id": strconv.Itoa(inv.ID),
+		"home_id":       strconv.Itoa(inv.HomeID),
+		"role":          inv.RoleName,
+	}
+}
+
+// verifiedEmail returns the user's email address if they verified it, or
+// "" so that it matches no invitation.
+func verifiedEmail(user models.User) string {
+	if !user.EmailVerified {
+		return ""
+	}
+	return user.Email
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestInvitations(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	carol := s.addUser(t, "carol")
+	homeID := s.addHome(t, alice)
+
+	inv, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "bob", models.RoleView, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.UserID == nil || *inv.UserID != bob.ID || inv.Email != bob.Email || inv.RoleName != models.RoleView || inv.Status != models.InvitationPending {
+		t.Errorf("invitation %+v", inv)
+	}
+	if _, err := s.invitations.Invite(ctx, alice.ID, homeID, bob.Email, "", models.RoleView, nil); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("inviting twice: got %v, want conflict", err)
+	}
+	if _, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "nobody", models.RoleView, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("unknown username: got %v, want a validation error", err)
+	}
+	if _, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "alice", models.RoleView, nil); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("inviting a member: got %v, want conflict", err)
+	}
+	if _, err := s.invitations.Invite(ctx, bob.ID, homeID, "", "carol", models.RoleView, nil); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("invited by a non-member: got %v, want forbidden", err)
+	}
+	if len(s.mail.messages) == 0 || s.mail.messages[len(s.mail.messages)-1].To != bob.Email {
+		t.Error("bob was not notified")
+	}
+
+	pending, err := s.invitations.GetUserInvitations(ctx, bob)
+	if err != nil || len(pending) != 1 || pending[0].HomeName != "alice's home" {
+		t.Fatalf("bob's invitations %+v, %v", pending, err)
+	}
+	if err := s.invitations.Accept(ctx, carol, inv.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("accepting another's invitation: got %v, want not found", err)
+	}
+	if err := s.invitations.Accept(ctx, bob, inv.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.Authorize(ctx, homeID, bob.ID, models.PermTelemetryRead); err != nil {
+		t.Errorf("bob after accepting: %v", err)
+	}
+	if err := s.invitations.Accept(ctx, bob, inv.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting twice: got %v, want conflict", err)
+	}
+	if last := s.mail.messages[len(s.mail.messages)-1]; last.To != alice.Email {
+		t.Errorf("last message to %s, want the inviter", last.To)
+	}
+
+	// Inviters cannot hand out more than they hold.
+	if err := s.homes.AddUserToHome(ctx, homeID, carol.ID, models.RoleView); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.homes.CreateRole(ctx, alice.ID, homeID, "Doorman", []string{models.PermHomeMembersManage}); err != nil {
+		t.Fatal(err)
+	}
+	dave := s.addUser(t, "dave")
+	if err := s.homes.AddUserToHome(ctx, homeID, dave.ID, "Doorman"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.invitations.Invite(ctx, dave.ID, homeID, "eve@example.com", "", models.RoleAdmin, nil); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("doorman inviting an Admin: got %v, want forbidden", err)
+	}
+
+	// Declined and revoked invitations cannot be accepted.
+	eve := s.addUser(t, "eve")
+	declined, err := s.invitations.Invite(ctx, dave.ID, homeID, "", "eve", "Doorman", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.invitations.Decline(ctx, eve, declined.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.invitations.Accept(ctx, eve, declined.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting a declined invitation: got %v, want conflict", err)
+	}
+	revoked, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "eve", models.RoleView, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.invitations.GetHomeInvitations(ctx, alice.ID, homeID); len(list) != 1 || list[0].ID != revoked.ID {
+		t.Errorf("home invitations %+v, want the one to eve", list)
+	}
+	if _, err := s.invitations.GetHomeInvitations(ctx, carol.ID, homeID); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("viewer listing invitations: got %v, want forbidden", err)
+	}
+	if err := s.invitations.Revoke(ctx, alice.ID, homeID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.invitations.Accept(ctx, eve, revoked.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting a revoked invitation: got %v, want conflict", err)
+	}
+	if _, err := s.homes.GetHomeUserRole(ctx, homeID, eve.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("eve is a member: %v", err)
+	}
+}
+
+func TestInvitationExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	homeID := s.addHome(t, alice)
+
+	tooLate := time.Now().Add(60 * 24 * time.Hour)
+	if _, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "bob", models.RoleView, &tooLate); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("expiry in 60 days: got %v, want a validation error", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	inv, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "bob", models.RoleView, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.invitations.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := s.invitations.Accept(ctx, bob, inv.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("accepting an expired invitation: got %v, want conflict", err)
+	}
+	if pending, _ := s.invitations.GetUserInvitations(ctx, bob); len(pending) != 0 {
+		t.Errorf("expired invitation listed: %+v", pending)
+	}
+	// An expired invitation does not block a new one.
+	if _, err := s.invitations.Invite(ctx, alice.ID, homeID, "", "bob", models.RoleView, nil); err != nil {
+		t.Errorf("inviting again after expiry: %v", err)
+	}
+}
+
+func TestInvitationByEmail(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	homeID := s.addHome(t, alice)
+
+	// Addresses are matched whatever their case.
+	inv, err := s.invitations.Invite(ctx, alice.ID, homeID, "Erin@Example.com", "", models.RoleView, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.UserID != nil {
+		t.Errorf("invitation to an unknown address names user %d", *inv.UserID)
+	}
+
+	// The invitation is erin's only once the address is verified.
+	erin := register(t, s, "erin")
+	if pending, _ := s.invitations.GetUserInvitations(ctx, erin); len(pending) != 0 {
+		t.Errorf("unverified user sees %+v", pending)
+	}
+	if err := s.invitations.Accept(ctx, erin, inv.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("accepting unverified: got %v, want not found", err)
+	}
+	if err := s.accounts.VerifyEmail(ctx, s.mail.lastToken(t, "erin@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	erin, _ = s.accounts.GetUser(ctx, erin.ID)
+	if pending, _ := s.invitations.GetUserInvitations(ctx, erin); len(pending) != 1 {
+		t.Errorf("verified user sees %+v, want the invitation", pending)
+	}
+	if err := s.invitations.Accept(ctx, erin, inv.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.Authorize(ctx, homeID, erin.ID, models.PermTelemetryRead); err != nil {
+		t.Errorf("erin after accepting: %v", err)
+	}
+}
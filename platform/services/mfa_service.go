@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+	"PragatiIot/platform/totp"
+	"PragatiIot/platform/utils"
+)
+
+// recoveryCodeCount is how many recovery codes a user is given at a time.
+const recoveryCodeCount = 10
+
+var (
+	errMFANotConfigured = apperrors.Forbidden("Multi-factor authentication is not configured on this server")
+	errMFANotEnabled    = apperrors.Conflict("Multi-factor authentication is not enabled")
+	// errInvalidCode does not say whether the code was wrong, already used
+	// or too old.
+	errInvalidCode     = apperrors.Invalid("code", "is incorrect")
+	errInvalidMFAToken = apperrors.Invalid("mfa_token", "is invalid or has expired")
+)
+
+// MFAConfig configures TOTP multi-factor authentication.
+type MFAConfig struct {
+	// Issuer names the platform in authenticator apps.
+	Issuer string
+	// ChallengeTTL is how long a user has to give a code after their
+	// password.
+	ChallengeTTL time.Duration
+}
+
+// MFAService manages users' TOTP enrollments and recovery codes, and
+// completes the logins of users who enabled MFA. Secrets are sealed with the
+// sealer, bound to the user's ID; without a sealer users cannot enroll.
+type MFAService struct {
+	users    repositories.UserStore
+	tokens   repositories.UserTokenStore
+	mfa      repositories.MFAStore
+	sealer   *utils.Sealer
+	accounts *AccountService
+	config   MFAConfig
+	now      func() time.Time
+}
+
+func NewMFAService(users repositories.UserStore, tokens repositories.UserTokenStore, mfa repositories.MFAStore, sealer *utils.Sealer, accounts *AccountService, config MFAConfig) *MFAService {
+	if config.Issuer == "" {
+		config.Issuer = "PragatiIot"
+	}
+	if config.ChallengeTTL <= 0 {
+		config.ChallengeTTL = 5 * time.Minute
+	}
+	return &MFAService{users: users, tokens: tokens, mfa: mfa, sealer: sealer, accounts: accounts, config: config, now: time.Now}
+}
+
+// BeginEnrollment gives the user a new TOTP secret and the otpauth:// URI to
+// show as a QR code. MFA is not enabled until ConfirmEnrollment.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID int) (secret, uri string, err error) {
+	if s.sealer == nil {
+		return "", "", errMFANotConfigured
+	}
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.MFAEnabled {
+		return "", "", apperrors.Conflict("Multi-factor authentication is already enabled")
+	}
+
+	secret, err = totp.NewSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := s.sealer.Seal([]byte(secret), sealContext(userID))
+	if err != nil {
+		return "", "", fmt.Errorf("error sealing TOTP secret: %w", err)
+	}
+	if err := s.mfa.SetMFASecret(ctx, userID, sealed); err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(s.config.Issuer, user.Username, secret), nil
+}
+
+// ConfirmEnrollment enables MFA once the user gives a code of the secret
+// from BeginEnrollment, and returns their recovery codes. Only the codes'
+// hashes are kept, so they cannot be shown again.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID int, code string) ([]string, error) {
+	enrollment, err := s.mfa.GetMFA(ctx, userID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, apperrors.Conflict("Start enrolling before confirming a code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.EnabledAt != nil {
+		return nil, apperrors.Conflict("Multi-factor authentication is already enabled")
+	}
+	secret, err := s.open(enrollment)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, s.now())
+	if !ok {
+		return nil, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.EnableMFA(ctx, userID, step, hashes, s.now()); err != nil {
+		return nil, err
+	}
+	s.record(ctx, models.AuditUserEnableMFA, userID)
+	return codes, nil
+}
+
+// Disable turns MFA off for the user after checking a code.
+func (s *MFAService) Disable(ctx context.Context, userID int, code string) error {
+	if err := s.verify(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.mfa.DisableMFA(ctx, userID); err != nil {
+		return err
+	}
+	s.record(ctx, models.AuditUserDisableMFA, userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// after checking a code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	s.record(ctx, models.AuditUserRecoveryCodes, userID)
+	return codes, nil
+}
+
+// Challenge returns the token a user who gave the right password passes to
+// CompleteLogin with a code.
+func (s *MFAService) Challenge(ctx context.Context, user models.User) (string, error) {
+	return s.accounts.issue(ctx, user.ID, models.TokenMFALogin, s.config.ChallengeTTL)
+}
+
+// CompleteLogin returns the user of the challenge token if the code is one
+// of their TOTP codes or unused recovery codes. A wrong code counts as a
+// failed login; the token stays valid until it expires or the user is
+// locked.
+func (s *MFAService) CompleteLogin(ctx context.Context, token, code string) (models.User, error) {
+	now := s.now()
+	t, err := s.tokens.GetUserToken(ctx, models.TokenMFALogin, hashToken(token), now)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return models.User{}, errInvalidMFAToken
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user, err := s.users.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return user, err
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user, errLocked(user.LockedUntil.Sub(now))
+	}
+
+	if err := s.verify(ctx, user.ID, code); err != nil {
+		if !errors.Is(err, errInvalidCode) {
+			return user, err
+		}
+		if err := s.accounts.failLogin(ctx, user, now); err != nil {
+			// A locked user starts over with their password.
+			if deleteErr := s.tokens.DeleteUserTokens(ctx, user.ID, models.TokenMFALogin); deleteErr != nil {
+				return user, deleteErr
+			}
+			return user, err
+		}
+		return user, errInvalidCode
+	}
+
+	if _, err := s.tokens.ConsumeUserToken(ctx, models.TokenMFALogin, hashToken(token), now); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return user, errInvalidMFAToken
+		}
+		return user, err
+	}
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := s.users.ResetLoginFailures(ctx, user.ID); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// verify checks a code of the user's enabled MFA: a TOTP code that was not
+// used before, or an unused recovery code, which is used up.
+func (s *MFAService) verify(ctx context.Context, userID int, code string) error {
+	enrollment, err := s.mfa.GetMFA(ctx, userID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return errMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if enrollment.EnabledAt == nil {
+		return errMFANotEnabled
+	}
+
+	code = normalizeCode(code)
+	if !isTOTPCode(code) {
+		err := s.mfa.UseRecoveryCode(ctx, userID, hashToken(code), s.now())
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return errInvalidCode
+		}
+		return err
+	}
+	secret, err := s.open(enrollment)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, s.now())
+	if !ok {
+		return errInvalidCode
+	}
+	err = s.mfa.UseMFAStep(ctx, userID, step)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return errInvalidCode
+	}
+	return err
+}
+
+func (s *MFAService) open(enrollment models.UserMFA) (string, error) {
+	if s.sealer == nil {
+		return "", errMFANotConfigured
+	}
+	secret, err := s.sealer.Open(enrollment.SealedSecret, sealContext(enrollment.UserID))
+	if err != nil {
+		return "", fmt.Errorf("error opening TOTP secret of user %d: %w", enrollment.UserID, err)
+	}
+	return string(secret), nil
+}
+
+func (s *MFAService) record(ctx context.Context, action string, userID int) {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		user = models.User{ID: userID}
+	}
+	s.accounts.record(ctx, action, user, nil, nil)
+}
+
+// sealContext binds a sealed secret to its user, so it cannot be copied to
+// another user's enrollment.
+func sealContext(userID int) []byte {
+	return []byte("user_mfa:" + strconv.Itoa(userID))
+}
+
+// newRecoveryCodes returns recovery codes, formatted like "3f9a2-c41d0", and
+// their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode drops the spaces and dashes users type or copy with a code.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
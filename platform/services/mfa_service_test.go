@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/totp"
+)
+
+// code returns the TOTP code of the secret at t.
+func code(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	c, err := totp.Code(secret, totp.Step(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// enableMFA enrolls the user at now and returns the secret and recovery
+// codes.
+func enableMFA(t *testing.T, s *testServices, user models.User, now time.Time) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	secret, uri, err := s.mfa.BeginEnrollment(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/PragatiIot:"+user.Username+"?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("provisioning URI %s", uri)
+	}
+	codes, err := s.mfa.ConfirmEnrollment(ctx, user.ID, code(t, secret, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+func TestMFALogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.mfa.now = func() time.Time { return now }
+	ada := register(t, s, "ada")
+
+	if _, err := s.mfa.ConfirmEnrollment(ctx, ada.ID, "123456"); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("confirming without enrolling: got %v, want conflict", err)
+	}
+	secret, codes := enableMFA(t, s, ada, now)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	enrollment, err := s.store.GetMFA(ctx, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(enrollment.SealedSecret, secret) {
+		t.Error("the secret is stored in the clear")
+	}
+	if _, _, err := s.mfa.BeginEnrollment(ctx, ada.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("enrolling twice: got %v, want conflict", err)
+	}
+
+	user, err := s.accounts.Login(ctx, "ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.MFAEnabled {
+		t.Fatal("user logs in without MFA")
+	}
+	token, err := s.mfa.Challenge(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The code used to confirm the enrollment cannot be replayed.
+	if _, err := s.mfa.CompleteLogin(ctx, token, code(t, secret, now)); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("replayed code: got %v, want a validation error", err)
+	}
+	now = now.Add(totp.Period)
+	if _, err := s.mfa.CompleteLogin(ctx, token, code(t, secret, now)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.mfa.CompleteLogin(ctx, token, code(t, secret, now.Add(totp.Period))); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("reused MFA token: got %v, want a validation error", err)
+	}
+
+	// Recovery codes are single use, and accepted however they are typed.
+	token, err = s.mfa.Challenge(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.mfa.CompleteLogin(ctx, token, strings.ToUpper(codes[0])); err != nil {
+		t.Fatal(err)
+	}
+	token, err = s.mfa.Challenge(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.mfa.CompleteLogin(ctx, token, codes[0]); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("used recovery code: got %v, want a validation error", err)
+	}
+
+	if err := s.mfa.Disable(ctx, ada.ID, "000000"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("disabling with a wrong code: got %v, want a validation error", err)
+	}
+	if err := s.mfa.Disable(ctx, ada.ID, codes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.store.GetUserByID(ctx, ada.ID); user.MFAEnabled {
+		t.Error("MFA still enabled")
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.accounts.config.MaxLoginFailures = 3
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.mfa.now = func() time.Time { return now }
+	ada := register(t, s, "ada")
+	enableMFA(t, s, ada, now)
+
+	user, err := s.accounts.Login(ctx, "ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.mfa.Challenge(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.mfa.CompleteLogin(ctx, token, "000000"); !errors.Is(err, apperrors.ErrValidation) {
+			t.Fatalf("wrong code %d: got %v, want a validation error", i+1, err)
+		}
+	}
+	// The right password does not reset the count while the code is
+	// missing.
+	if _, err := s.accounts.Login(ctx, "ada", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.mfa.CompleteLogin(ctx, token, "000000"); !errors.Is(err, apperrors.ErrRateLimited) {
+		t.Errorf("third wrong code: got %v, want locked", err)
+	}
+}
+
+func TestHomeRequireMFA(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	now := time.Now()
+	ada := register(t, s, "ada")
+	bob := register(t, s, "bob")
+	home := s.addHome(t, ada)
+	if err := s.homes.AddUserToHome(ctx, home, bob.ID, "Admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.homes.SetRequireMFA(ctx, home, ada, true); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("requiring MFA without it: got %v, want conflict", err)
+	}
+	_, codes := enableMFA(t, s, ada, now)
+	ada, _ = s.store.GetUserByID(ctx, ada.ID)
+	if err := s.homes.SetRequireMFA(ctx, home, ada, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.homes.Authorize(ctx, home, ada.ID, models.PermHomeManage); err != nil {
+		t.Errorf("admin with MFA: %v", err)
+	}
+	if err := s.homes.Authorize(ctx, home, bob.ID, models.PermDeviceCommand); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("admin without MFA: got %v, want forbidden", err)
+	}
+	if err := s.homes.Authorize(ctx, home, bob.ID, models.PermTelemetryRead); err != nil {
+		t.Errorf("admin without MFA reading: %v", err)
+	}
+	if err := s.homes.SetRequireMFA(ctx, home, bob, false); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("admin without MFA lifting the requirement: got %v, want forbidden", err)
+	}
+
+	if err := s.mfa.Disable(ctx, ada.ID, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.Authorize(ctx, home, ada.ID, models.PermHomeManage); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("admin who disabled MFA: got %v, want forbidden", err)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// errOrgNotFound is returned to users outside an organization, so they
+// cannot tell whether it exists.
+var errOrgNotFound = apperrors.NotFound("Organization not found")
+
+// Quotas an organization's plan limits.
+const (
+	QuotaHomes   = "homes"
+	QuotaDevices = "devices"
+	QuotaMembers = "members"
+)
+
+// OrgConfig configures new organizations.
+type OrgConfig struct {
+	// DefaultPlan is the plan new organizations start on.
+	DefaultPlan string
+	// MaxHomes, MaxDevices and MaxMembers are the quotas of new
+	// organizations; nil is unlimited. Billing changes them per
+	// organization.
+	MaxHomes   *int
+	MaxDevices *int
+	MaxMembers *int
+}
+
+// OrganizationService manages organizations, the customers that own homes,
+// and their members. A member's organization role is inherited in every
+// home of the organization, and users outside it see none of its data.
+type OrganizationService struct {
+	orgs   repositories.OrganizationStore
+	audit  *audit.Recorder
+	config OrgConfig
+}
+
+func NewOrganizationService(orgs repositories.OrganizationStore, recorder *audit.Recorder, config OrgConfig) *OrganizationService {
+	if config.DefaultPlan == "" {
+		config.DefaultPlan = "free"
+	}
+	return &OrganizationService{orgs: orgs, audit: recorder, config: config}
+}
+
+// CreateOrganization adds an organization on the default plan with the user
+// as its owner.
+func (s *OrganizationService) CreateOrganization(ctx context.Context, ownerID int, name, billingEmail string) (models.Organization, error) {
+	org := models.Organization{
+		Name:         name,
+		Plan:         s.config.DefaultPlan,
+		BillingEmail: billingEmail,
+		MaxHomes:     s.config.MaxHomes,
+		MaxDevices:   s.config.MaxDevices,
+		MaxMembers:   s.config.MaxMembers,
+	}
+	id, err := s.orgs.AddOrganization(ctx, org, ownerID)
+	if err != nil {
+		return org, err
+	}
+	org, err = s.orgs.GetOrganizationByID(ctx, id)
+	if err != nil {
+		return org, err
+	}
+	_, after := audit.Diff(nil, org)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditOrgCreate,
+		TargetType: models.AuditTargetOrganization,
+		TargetID:   strconv.Itoa(id),
+		After:      after,
+	})
+	return org, nil
+}
+
+// GetOrganizations returns the user's memberships with their organizations.
+func (s *OrganizationService) GetOrganizations(ctx context.Context, userID int) ([]models.OrgMember, []models.Organization, error) {
+	members, err := s.orgs.GetUserOrgMembers(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	orgs := make([]models.Organization, 0, len(members))
+	for _, m := range members {
+		org, err := s.orgs.GetOrganizationByID(ctx, m.OrgID)
+		if err != nil {
+			return nil, nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return members, orgs, nil
+}
+
+// GetOrganization returns the organization and the user's role in it, to
+// its members only.
+func (s *OrganizationService) GetOrganization(ctx context.Context, orgID, userID int) (models.Organization, string, error) {
+	role, err := s.require(ctx, orgID, userID, models.OrgRoleViewer)
+	if err != nil {
+		return models.Organization{}, "", err
+	}
+	org, err := s.orgs.GetOrganizationByID(ctx, orgID)
+	return org, role, err
+}
+
+// UpdateOrganization changes the organization's name and billing email.
+// Only owners may; the plan and quotas are left to billing.
+func (s *OrganizationService) UpdateOrganization(ctx context.Context, orgID, userID int, name, billingEmail *string) (models.Organization, error) {
+	if _, err := s.require(ctx, orgID, userID, models.OrgRoleOwner); err != nil {
+		return models.Organization{}, err
+	}
+	org, err := s.orgs.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		return org, err
+	}
+	previous := org
+	if name != nil {
+		org.Name = *name
+	}
+	if billingEmail != nil {
+		org.BillingEmail = *billingEmail
+	}
+	if err := s.orgs.UpdateOrganization(ctx, org); err != nil {
+		return org, err
+	}
+	before, after := audit.Diff(previous, org)
+	if len(after) > 0 {
+		s.audit.Record(ctx, models.AuditEntry{
+			Action:     models.AuditOrgUpdate,
+			TargetType: models.AuditTargetOrganization,
+			TargetID:   strconv.Itoa(orgID),
+			Before:     before,
+			After:      after,
+		})
+	}
+	return org, nil
+}
+
+// GetMembers returns the organization's members, to its members only.
+func (s *OrganizationService) GetMembers(ctx context.Context, orgID, userID int) ([]models.OrgMember, error) {
+	if _, err := s.require(ctx, orgID, userID, models.OrgRoleViewer); err != nil {
+		return nil, err
+	}
+	return s.orgs.GetOrgMembers(ctx, orgID)
+}
+
+// SetMember adds a member with the role, or changes their role. Owners and
+// admins may; only owners may make or unmake owners, and the organization
+// keeps at least one. New members count against the members quota.
+func (s *OrganizationService) SetMember(ctx context.Context, orgID, actorID, userID int, role string) error {
+	actorRole, err := s.require(ctx, orgID, actorID, models.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	current, err := s.Role(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if current == role {
+		return nil
+	}
+	if (role == models.OrgRoleOwner || current == models.OrgRoleOwner) && actorRole != models.OrgRoleOwner {
+		return apperrors.Forbidden("Only owners may grant or revoke the owner role")
+	}
+	if current == models.OrgRoleOwner {
+		if err := s.keepOwner(ctx, orgID); err != nil {
+			return err
+		}
+	}
+	if current == "" {
+		if err := s.CheckQuota(ctx, orgID, QuotaMembers); err != nil {
+			return err
+		}
+	}
+
+	if err := s.orgs.SetOrgMember(ctx, models.OrgMember{OrgID: orgID, UserID: userID, Role: role}); err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Action:     models.AuditOrgMemberSet,
+		TargetType: models.AuditTargetOrgMember,
+		TargetID:   fmt.Sprintf("%d:%d", orgID, userID),
+		After:      map[string]interface{}{"org_id": orgID, "user_id": userID, "role": role},
+	}
+	if current != "" {
+		entry.Before = map[string]interface{}{"role": current}
+	}
+	s.audit.Record(ctx, entry)
+	return nil
+}
+
+// RemoveMember removes a member from the organization. Owners and admins
+// may remove others, only owners may remove an owner, and anyone may leave;
+// the last owner may not.
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, actorID, userID int) error {
+	role, err := s.Role(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if actorID != userID {
+		min := models.OrgRoleAdmin
+		if role == models.OrgRoleOwner {
+			min = models.OrgRoleOwner
+		}
+		if _, err := s.require(ctx, orgID, actorID, min); err != nil {
+			return err
+		}
+	}
+	if role == "" {
+		return apperrors.NotFound("Organization member not found")
+	}
+	if role == models.OrgRoleOwner {
+		if err := s.keepOwner(ctx, orgID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.orgs.RemoveOrgMember(ctx, orgID, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditOrgMemberRemove,
+		TargetType: models.AuditTargetOrgMember,
+		TargetID:   fmt.Sprintf("%d:%d", orgID, userID),
+		Before:     map[string]interface{}{"org_id": orgID, "user_id": userID, "role": role},
+	})
+	return nil
+}
+
+// Usage returns the organization with what it uses of its quotas, to its
+// members only.
+func (s *OrganizationService) Usage(ctx context.Context, orgID, userID int) (models.Organization, models.OrgUsage, error) {
+	org, _, err := s.GetOrganization(ctx, orgID, userID)
+	if err != nil {
+		return org, models.OrgUsage{}, err
+	}
+	usage, err := s.orgs.GetOrgUsage(ctx, orgID)
+	return org, usage, err
+}
+
+// Role returns the user's role in the organization, or "" if they are not
+// a member.
+func (s *OrganizationService) Role(ctx context.Context, orgID, userID int) (string, error) {
+	member, err := s.orgs.GetOrgMember(ctx, orgID, userID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// CheckQuota refuses adding one more of quota to the organization if its
+// plan does not allow it.
+func (s *OrganizationService) CheckQuota(ctx context.Context, orgID int, quota string) error {
+	org, err := s.orgs.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	usage, err := s.orgs.GetOrgUsage(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	var limit *int
+	var used int
+	switch quota {
+	case QuotaHomes:
+		limit, used = org.MaxHomes, usage.Homes
+	case QuotaDevices:
+		limit, used = org.MaxDevices, usage.Devices
+	case QuotaMembers:
+		limit, used = org.MaxMembers, usage.Members
+	default:
+		return fmt.Errorf("unknown quota %s", quota)
+	}
+	if limit != nil && used >= *limit {
+		return apperrors.Forbidden("The organization's %s plan allows at most %d %s", org.Plan, *limit, quota)
+	}
+	return nil
+}
+
+// require returns the user's role in the organization if it is at least
+// min. Users outside the organization are told it does not exist.
+func (s *OrganizationService) require(ctx context.Context, orgID, userID int, min string) (string, error) {
+	role, err := s.Role(ctx, orgID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", errOrgNotFound
+	}
+	if !models.OrgRoleAtLeast(role, min) {
+		return "", apperrors.Forbidden("Requires the %s role in the organization", min)
+	}
+	return role, nil
+}
+
+// keepOwner refuses to demote or remove an owner of the organization if
+// they are the last one.
+func (s *OrganizationService) keepOwner(ctx context.Context, orgID int) error {
+	members, err := s.orgs.GetOrgMembers(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+	}
+	if owners <= 1 {
+		return apperrors.Conflict("An organization must keep at least one owner")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestOrganizationRoles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	ada := s.addUser(t, "ada")
+	bob := s.addUser(t, "bob")
+	carol := s.addUser(t, "carol")
+	dave := s.addUser(t, "dave")
+
+	org, err := s.orgs.CreateOrganization(ctx, ada.ID, "Acme", "billing@acme.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.Plan != "free" {
+		t.Errorf("plan %q, want free", org.Plan)
+	}
+	if err := s.orgs.SetMember(ctx, org.ID, ada.ID, bob.ID, models.OrgRoleOperator); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.orgs.SetMember(ctx, org.ID, ada.ID, carol.ID, models.OrgRoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.homes.AddHome(ctx, models.Home{HomeName: "Plant", UserID: bob.ID, OrgID: &org.ID}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("operator adding a home: got %v, want forbidden", err)
+	}
+	homeID, err := s.homes.AddHome(ctx, models.Home{HomeName: "Plant", UserID: ada.ID, OrgID: &org.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user                    models.User
+		admin, operator, member bool
+	}{
+		{ada, true, true, true},
+		{bob, false, true, true},
+		{carol, false, false, true},
+		{dave, false, false, false},
+	}
+	for _, tt := range tests {
+		if err := s.homes.Authorize(ctx, homeID, tt.user.ID, models.PermHomeMembersManage); (err == nil) != tt.admin {
+			t.Errorf("Authorize(%s, home.members.manage) = %v, want allowed %v", tt.user.Username, err, tt.admin)
+		}
+		if err := s.homes.Authorize(ctx, homeID, tt.user.ID, models.PermDeviceCommand); (err == nil) != tt.operator {
+			t.Errorf("Authorize(%s, device.command) = %v, want allowed %v", tt.user.Username, err, tt.operator)
+		}
+		if member := s.homes.IsHomeMember(ctx, homeID, tt.user.ID); member != tt.member {
+			t.Errorf("IsHomeMember(%s) = %v, want %v", tt.user.Username, member, tt.member)
+		}
+	}
+
+	// Users outside the organization see none of it.
+	if _, _, err := s.orgs.GetOrganization(ctx, org.ID, dave.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("outsider reading the organization: got %v, want not found", err)
+	}
+	if _, err := s.homes.GetHomesByOrgID(ctx, org.ID, dave.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("outsider listing homes: got %v, want not found", err)
+	}
+	if err := s.homes.AddUserToHome(ctx, homeID, dave.ID, "View"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("adding an outsider to the home: got %v, want a validation error", err)
+	}
+	if adminHomes, _ := s.homes.GetPermittedHomeIDs(ctx, ada.ID, models.PermHomeManage); len(adminHomes) != 1 || adminHomes[0] != homeID {
+		t.Errorf("managed homes %v, want [%d]", adminHomes, homeID)
+	}
+	if commandHomes, _ := s.homes.GetPermittedHomeIDs(ctx, bob.ID, models.PermDeviceCommand); len(commandHomes) != 1 {
+		t.Errorf("operator's homes %v, want [%d]", commandHomes, homeID)
+	}
+
+	// Only owners manage owners, and the last one cannot go.
+	if err := s.orgs.SetMember(ctx, org.ID, ada.ID, bob.ID, models.OrgRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.orgs.SetMember(ctx, org.ID, bob.ID, carol.ID, models.OrgRoleOwner); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("admin granting owner: got %v, want forbidden", err)
+	}
+	if err := s.orgs.RemoveMember(ctx, org.ID, bob.ID, ada.ID); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("admin removing an owner: got %v, want forbidden", err)
+	}
+	if err := s.orgs.RemoveMember(ctx, org.ID, ada.ID, ada.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("last owner leaving: got %v, want conflict", err)
+	}
+	if err := s.orgs.RemoveMember(ctx, org.ID, carol.ID, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.homes.IsHomeMember(ctx, homeID, carol.ID) {
+		t.Error("a former member keeps their role in the home")
+	}
+
+	// The home passes to the remaining admin when its owner is deleted.
+	if err := s.store.DeleteUser(ctx, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	if home, err := s.store.GetHomeByID(ctx, homeID); err != nil || home.UserID != bob.ID {
+		t.Errorf("home after deleting its owner: %+v, %v", home, err)
+	}
+}
+
+func TestOrganizationQuotas(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	one := 1
+	s.orgs.config.MaxHomes, s.orgs.config.MaxDevices, s.orgs.config.MaxMembers = &one, &one, &one
+	ada := s.addUser(t, "ada")
+	bob := s.addUser(t, "bob")
+
+	org, err := s.orgs.CreateOrganization(ctx, ada.ID, "Acme", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	homeID, err := s.homes.AddHome(ctx, models.Home{HomeName: "Plant", UserID: ada.ID, OrgID: &org.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.homes.AddHome(ctx, models.Home{HomeName: "Depot", UserID: ada.ID, OrgID: &org.ID}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("second home: got %v, want forbidden", err)
+	}
+	if err := s.orgs.SetMember(ctx, org.ID, ada.ID, bob.ID, models.OrgRoleViewer); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("second member: got %v, want forbidden", err)
+	}
+
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d1", ChannelID: "c1", UserID: ada.ID, HomeID: &homeID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AddDevice(ctx, models.Device{DeviceID: "d2", ChannelID: "c2", UserID: ada.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.devices.AssignDeviceToHome(ctx, "d2", &homeID); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("second device: got %v, want forbidden", err)
+	}
+	// Moving a device within its home does not count twice.
+	if err := s.devices.AssignDeviceToHome(ctx, "d1", &homeID); err != nil {
+		t.Errorf("reassigning a device to its home: %v", err)
+	}
+
+	_, usage, err := s.orgs.Usage(ctx, org.ID, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (models.OrgUsage{Homes: 1, Devices: 1, Members: 1}) {
+		t.Errorf("usage %+v", usage)
+	}
+}
@@ -1,25 +1,128 @@
 package services
 
 import (
-	"log"
-
+	"PragatiIot/platform/apperrors"
 	"PragatiIot/platform/models"
 	"PragatiIot/platform/repositories"
+	"context"
+	"errors"
+	"slices"
 )
 
+// errRoleNotFound is returned for roles that do not exist in the home.
+var errRoleNotFound = apperrors.NotFound("Role not found")
+
+// RoleService manages roles: the built-in Admin and View roles, and the
+// custom roles homes define as their own sets of permissions.
 type RoleService struct {
-	roleRepo *repositories.RoleRepository
+	roleRepo repositories.RoleStore
 }
 
-func NewRoleService(roleRepo *repositories.RoleRepository) *RoleService {
+func NewRoleService(roleRepo repositories.RoleStore) *RoleService {
 	return &RoleService{roleRepo: roleRepo}
 }
 
-func (s *RoleService) GetRoleByName(roleName string) (models.Role, error) {
-	role, err := s.roleRepo.GetRoleByName(roleName)
+func (s *RoleService) GetRoleByName(ctx context.Context, roleName string) (models.Role, error) {
+	role, err := s.roleRepo.GetRoleByName(ctx, roleName)
+	if err != nil {
+		return role, err
+	}
+	return role, nil
+}
+
+func (s *RoleService) GetRoleByID(ctx context.Context, id int) (models.Role, error) {
+	return s.roleRepo.GetRoleByID(ctx, id)
+}
+
+// GetHomeRole returns the built-in or the home's custom role with the name.
+// An unknown name is a validation error on role.
+func (s *RoleService) GetHomeRole(ctx context.Context, homeID int, roleName string) (models.Role, error) {
+	role, err := s.roleRepo.GetHomeRole(ctx, homeID, roleName)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return role, apperrors.Invalid("role", "unknown role %s", roleName)
+	}
+	return role, err
+}
+
+// GetHomeRoles returns the roles that can be held in the home.
+func (s *RoleService) GetHomeRoles(ctx context.Context, homeID int) ([]models.Role, error) {
+	return s.roleRepo.GetHomeRoles(ctx, homeID)
+}
+
+// GetCustomRole returns the home's custom role with the ID. Built-in roles
+// cannot be changed, and other homes' roles are not found.
+func (s *RoleService) GetCustomRole(ctx context.Context, homeID, id int) (models.Role, error) {
+	role, err := s.roleRepo.GetRoleByID(ctx, id)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return role, errRoleNotFound
+	}
+	if err != nil {
+		return role, err
+	}
+	if role.HomeID == nil {
+		return role, apperrors.Forbidden("Built-in roles cannot be changed")
+	}
+	if *role.HomeID != homeID {
+		return role, errRoleNotFound
+	}
+	return role, nil
+}
+
+// AddRole adds the custom role and returns it with its ID.
+func (s *RoleService) AddRole(ctx context.Context, role models.Role) (models.Role, error) {
+	if err := s.validate(ctx, role); err != nil {
+		return role, err
+	}
+	id, err := s.roleRepo.AddRole(ctx, role)
 	if err != nil {
-		log.Printf("Error getting role by name: %v", err)
 		return role, err
 	}
+	role.ID = id
 	return role, nil
 }
+
+// UpdateRole saves the custom role's name and permissions.
+func (s *RoleService) UpdateRole(ctx context.Context, role models.Role) error {
+	if err := s.validate(ctx, role); err != nil {
+		return err
+	}
+	return s.roleRepo.UpdateRole(ctx, role)
+}
+
+// DeleteRole deletes the custom role if no member holds it.
+func (s *RoleService) DeleteRole(ctx context.Context, id int) error {
+	members, err := s.roleRepo.CountRoleMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if members > 0 {
+		return apperrors.Conflict("The role is held by %d members; give them another role first", members)
+	}
+	return s.roleRepo.DeleteRole(ctx, id)
+}
+
+// validate refuses unknown permissions and custom roles named after a
+// built-in role, which would shadow it.
+func (s *RoleService) validate(ctx context.Context, role models.Role) error {
+	if err := checkPermissions(role.Permissions); err != nil {
+		return err
+	}
+	_, err := s.roleRepo.GetRoleByName(ctx, role.Name)
+	if err == nil {
+		return apperrors.Conflict("%s is a built-in role", role.Name)
+	}
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// checkPermissions refuses unknown permissions.
+func checkPermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if !slices.Contains(models.Permissions, permission) {
+			return apperrors.Invalid("permissions", "unknown permission %s", permission)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestCustomRoles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	bob := s.addUser(t, "bob")
+	carol := s.addUser(t, "carol")
+	dave := s.addUser(t, "dave")
+	homeID := s.addHome(t, alice)
+	otherHome := s.addHome(t, dave)
+
+	installer, err := s.homes.CreateRole(ctx, alice.ID, homeID, "Installer", []string{models.PermDeviceAssign, models.PermTelemetryRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.homes.CreateRole(ctx, alice.ID, homeID, "Installer", []string{models.PermTelemetryRead}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("duplicate name: got %v, want conflict", err)
+	}
+	if _, err := s.homes.CreateRole(ctx, alice.ID, homeID, models.RoleAdmin, []string{models.PermTelemetryRead}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("built-in name: got %v, want conflict", err)
+	}
+	if _, err := s.homes.CreateRole(ctx, alice.ID, homeID, "Janitor", []string{"home.sweep"}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("unknown permission: got %v, want a validation error", err)
+	}
+	if _, err := s.homes.CreateRole(ctx, alice.ID, homeID, "Doorman", []string{models.PermHomeMembersManage}); err != nil {
+		t.Fatal(err)
+	}
+
+	// As if bob and carol had accepted invitations.
+	if err := s.homes.AddUserToHome(ctx, homeID, bob.ID, "Installer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.AddUserToHome(ctx, homeID, carol.ID, "Doorman"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.Authorize(ctx, homeID, bob.ID, models.PermDeviceAssign); err != nil {
+		t.Errorf("installer assigning devices: %v", err)
+	}
+	if err := s.homes.Authorize(ctx, homeID, bob.ID, models.PermDeviceCommand); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("installer sending commands: got %v, want forbidden", err)
+	}
+	if homes, _ := s.homes.GetPermittedHomeIDs(ctx, bob.ID, models.PermDeviceAssign); len(homes) != 1 || homes[0] != homeID {
+		t.Errorf("installer's homes %v, want [%d]", homes, homeID)
+	}
+	if err := s.homes.AddMember(ctx, bob.ID, homeID, dave.ID, models.RoleView); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("installer adding a member: got %v, want forbidden", err)
+	}
+
+	// Nobody hands out more than they hold.
+	if err := s.homes.AddMember(ctx, carol.ID, homeID, dave.ID, models.RoleAdmin); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("doorman granting Admin: got %v, want forbidden", err)
+	}
+	if err := s.homes.AddMember(ctx, carol.ID, homeID, dave.ID, "Doorman"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("doorman adding a person directly: got %v, want a validation error", err)
+	}
+	bot, err := s.serviceAccounts.CreateServiceAccount(ctx, alice.ID, "alice-bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.AddMember(ctx, carol.ID, homeID, bot.ID, "Doorman"); err != nil {
+		t.Errorf("doorman granting their own role: %v", err)
+	}
+	if _, err := s.homes.CreateRole(ctx, carol.ID, homeID, "Boss", []string{models.PermHomeMembersManage}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("creating a role without home.roles.manage: got %v, want forbidden", err)
+	}
+
+	// Changing a role changes what its holders may do.
+	if _, err := s.homes.UpdateRole(ctx, alice.ID, homeID, installer.ID, "Technician", []string{models.PermDeviceAssign, models.PermDeviceCommand}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.Authorize(ctx, homeID, bob.ID, models.PermDeviceCommand); err != nil {
+		t.Errorf("technician sending commands: %v", err)
+	}
+	admin, _ := s.store.GetRoleByName(ctx, models.RoleAdmin)
+	if _, err := s.homes.UpdateRole(ctx, alice.ID, homeID, admin.ID, "Boss", models.Permissions); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("changing a built-in role: got %v, want forbidden", err)
+	}
+	if err := s.homes.DeleteRole(ctx, dave.ID, otherHome, installer.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("deleting another home's role: got %v, want not found", err)
+	}
+	if err := s.homes.DeleteRole(ctx, alice.ID, homeID, installer.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("deleting a held role: got %v, want conflict", err)
+	}
+
+	roles, err := s.homes.GetRoles(ctx, homeID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 4 || roles[0].Name != models.RoleAdmin || roles[2].Name != "Technician" {
+		t.Errorf("roles %+v", roles)
+	}
+	if roles, _ := s.homes.GetRoles(ctx, otherHome, dave.ID); len(roles) != 2 {
+		t.Errorf("another home sees %d roles, want the 2 built-in ones", len(roles))
+	}
+}
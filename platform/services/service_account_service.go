@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise.
+const apiKeyPrefix = "pk_"
+
+// apiKeyTouchInterval limits how often a key's last use is written.
+const apiKeyTouchInterval = time.Minute
+
+// errInvalidAPIKey does not say whether the key is unknown, revoked or
+// expired.
+var errInvalidAPIKey = apperrors.Unauthorized("Invalid API key")
+
+// ServiceAccountService manages service accounts, which integrations use
+// instead of a person's login, and their API keys. A service account is a
+// user with an owner: it can be added to homes and own devices like any
+// user, but it has no password and authenticates with its keys.
+type ServiceAccountService struct {
+	users repositories.UserStore
+	keys  repositories.APIKeyStore
+	homes repositories.HomeStore
+	audit *audit.Recorder
+	now   func() time.Time
+}
+
+func NewServiceAccountService(users repositories.UserStore, keys repositories.APIKeyStore, homes repositories.HomeStore, recorder *audit.Recorder) *ServiceAccountService {
+	return &ServiceAccountService{users: users, keys: keys, homes: homes, audit: recorder, now: time.Now}
+}
+
+// CreateServiceAccount adds a service account named name owned by the user.
+func (s *ServiceAccountService) CreateServiceAccount(ctx context.Context, ownerID int, name string) (models.User, error) {
+	if err := s.users.AddUser(ctx, models.User{Username: name, OwnerID: &ownerID}); err != nil {
+		return models.User{}, err
+	}
+	account, err := s.users.GetUserByUsername(ctx, name)
+	if err != nil {
+		return account, err
+	}
+	_, after := audit.Diff(nil, account)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(account.ID),
+		After:      after,
+	})
+	return account, nil
+}
+
+func (s *ServiceAccountService) GetServiceAccounts(ctx context.Context, ownerID int) ([]models.User, error) {
+	return s.users.GetServiceAccounts(ctx, ownerID)
+}
+
+// DeleteServiceAccount deletes the owner's service account with its keys,
+// as repositories.UserStore.DeleteUser deletes a user.
+func (s *ServiceAccountService) DeleteServiceAccount(ctx context.Context, ownerID, id int) error {
+	account, err := s.serviceAccount(ctx, ownerID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.users.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	before, _ := audit.Diff(account, nil)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditUserDelete,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(id),
+		Before:     before,
+	})
+	return nil
+}
+
+// CreateAPIKey adds a key to the owner's service account and returns it
+// with the key itself, which is not stored and cannot be shown again. The
+// key may be restricted to homes the owner administers.
+func (s *ServiceAccountService) CreateAPIKey(ctx context.Context, ownerID, accountID int, name string, scopes []string, homeIDs []int, expiresAt *time.Time) (models.APIKey, string, error) {
+	if _, err := s.serviceAccount(ctx, ownerID, accountID); err != nil {
+		return models.APIKey{}, "", err
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return models.APIKey{}, "", apperrors.Invalid("scopes", "unknown scope %s", scope)
+		}
+	}
+	if len(homeIDs) > 0 {
+		adminHomes, err := s.homes.GetPermittedHomeIDs(ctx, ownerID, models.PermHomeManage)
+		if err != nil {
+			return models.APIKey{}, "", err
+		}
+		for _, homeID := range homeIDs {
+			if !slices.Contains(adminHomes, homeID) {
+				return models.APIKey{}, "", apperrors.Invalid("home_ids", "home %d is not one you administer", homeID)
+			}
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return models.APIKey{}, "", apperrors.Invalid("expires_at", "must be in the future")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.APIKey{}, "", fmt.Errorf("error generating API key: %w", err)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	key := models.APIKey{
+		ServiceAccountID: accountID,
+		Name:             name,
+		Prefix:           secret[:len(apiKeyPrefix)+8],
+		KeyHash:          hashToken(secret),
+		Scopes:           scopes,
+		HomeIDs:          homeIDs,
+		ExpiresAt:        expiresAt,
+	}
+	id, err := s.keys.AddAPIKey(ctx, key)
+	if err != nil {
+		return key, "", err
+	}
+	key, err = s.keys.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		return key, "", err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditAPIKeyCreate,
+		TargetType: models.AuditTargetAPIKey,
+		TargetID:   strconv.Itoa(id),
+		HomeIDs:    homeIDs,
+		After: map[string]interface{}{
+			"service_account_id": accountID, "name": name, "prefix": key.Prefix,
+			"scopes": scopes, "home_ids": homeIDs, "expires_at": expiresAt,
+		},
+	})
+	return key, secret, nil
+}
+
+func (s *ServiceAccountService) GetAPIKeys(ctx context.Context, ownerID, accountID int) ([]models.APIKey, error) {
+	if _, err := s.serviceAccount(ctx, ownerID, accountID); err != nil {
+		return nil, err
+	}
+	return s.keys.GetAPIKeys(ctx, accountID)
+}
+
+// RevokeAPIKey revokes a key of one of the owner's service accounts. It
+// cannot be used again.
+func (s *ServiceAccountService) RevokeAPIKey(ctx context.Context, ownerID, keyID int) error {
+	key, err := s.keys.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.serviceAccount(ctx, ownerID, key.ServiceAccountID); err != nil {
+		return apperrors.NotFound("API key not found")
+	}
+	now := s.now()
+	if err := s.keys.RevokeAPIKey(ctx, keyID, now); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditAPIKeyRevoke,
+		TargetType: models.AuditTargetAPIKey,
+		TargetID:   strconv.Itoa(keyID),
+		HomeIDs:    key.HomeIDs,
+		After:      map[string]interface{}{"revoked_at": now.UTC()},
+	})
+	return nil
+}
+
+// AuthenticateAPIKey returns the service account an unrevoked, unexpired
+// key belongs to, and the key.
+func (s *ServiceAccountService) AuthenticateAPIKey(ctx context.Context, secret string) (models.User, models.APIKey, error) {
+	key, err := s.keys.GetAPIKeyByHash(ctx, hashToken(secret))
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return models.User{}, key, errInvalidAPIKey
+	}
+	if err != nil {
+		return models.User{}, key, err
+	}
+	now := s.now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return models.User{}, key, errInvalidAPIKey
+	}
+	account, err := s.users.GetUserByID(ctx, key.ServiceAccountID)
+	if err != nil {
+		return account, key, err
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.keys.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return account, key, err
+		}
+	}
+	return account, key, nil
+}
+
+// serviceAccount returns the owner's service account with the ID. Other
+// users' accounts are not found, so their IDs are not revealed.
+func (s *ServiceAccountService) serviceAccount(ctx context.Context, ownerID, id int) (models.User, error) {
+	account, err := s.users.GetUserByID(ctx, id)
+	if err != nil {
+		return account, err
+	}
+	if account.OwnerID == nil || *account.OwnerID != ownerID {
+		return models.User{}, apperrors.NotFound("service account not found")
+	}
+	return account, nil
+}
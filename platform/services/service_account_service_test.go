@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+)
+
+func TestServiceAccountAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := register(t, s, "alice")
+	bob := register(t, s, "bob")
+	home := s.addHome(t, alice)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.serviceAccounts.now = func() time.Time { return now }
+
+	bot, err := s.serviceAccounts.CreateServiceAccount(ctx, alice.ID, "alice-bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bot.IsServiceAccount() || *bot.OwnerID != alice.ID {
+		t.Fatalf("service account = %+v, want one owned by alice", bot)
+	}
+	if _, err := s.accounts.Login(ctx, "alice-bot", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("service account login: got %v, want invalid credentials", err)
+	}
+
+	scopes := []string{models.ScopeDevicesRead}
+	if _, _, err := s.serviceAccounts.CreateAPIKey(ctx, bob.ID, bot.ID, "ci", scopes, nil, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("key for another user's account: got %v, want not found", err)
+	}
+	if _, _, err := s.serviceAccounts.CreateAPIKey(ctx, alice.ID, bot.ID, "ci", []string{"devices:delete"}, nil, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("unknown scope: got %v, want a validation error", err)
+	}
+	bobHome := s.addHome(t, bob)
+	if _, _, err := s.serviceAccounts.CreateAPIKey(ctx, alice.ID, bot.ID, "ci", scopes, []int{bobHome}, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("key for another user's home: got %v, want a validation error", err)
+	}
+
+	expires := now.Add(time.Hour)
+	key, secret, err := s.serviceAccounts.CreateAPIKey(ctx, alice.ID, bot.ID, "ci", scopes, []int{home}, &expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, key.Prefix) || key.KeyHash == secret {
+		t.Errorf("key %q has prefix %q and hash %q", secret, key.Prefix, key.KeyHash)
+	}
+
+	account, got, err := s.serviceAccounts.AuthenticateAPIKey(ctx, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != bot.ID || got.ID != key.ID {
+		t.Errorf("authenticated as %d with key %d, want %d with %d", account.ID, got.ID, bot.ID, key.ID)
+	}
+	if keys, _ := s.serviceAccounts.GetAPIKeys(ctx, alice.ID, bot.ID); len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("keys = %+v, want one with its last use", keys)
+	}
+
+	now = expires
+	if _, _, err := s.serviceAccounts.AuthenticateAPIKey(ctx, secret); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("expired key: got %v, want unauthorized", err)
+	}
+
+	key, secret, err = s.serviceAccounts.CreateAPIKey(ctx, alice.ID, bot.ID, "deploy", scopes, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.serviceAccounts.RevokeAPIKey(ctx, bob.ID, key.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("bob revoking alice's key: got %v, want not found", err)
+	}
+	if err := s.serviceAccounts.RevokeAPIKey(ctx, alice.ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.serviceAccounts.AuthenticateAPIKey(ctx, secret); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("revoked key: got %v, want unauthorized", err)
+	}
+	if _, _, err := s.serviceAccounts.AuthenticateAPIKey(ctx, "pk_unknown"); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("unknown key: got %v, want unauthorized", err)
+	}
+
+	// Deleting the owner deletes the service account and its keys.
+	if err := s.store.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.GetUserByID(ctx, bot.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("service account after its owner's deletion: got %v, want not found", err)
+	}
+	if _, err := s.store.GetAPIKeyByID(ctx, key.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("key after its owner's deletion: got %v, want not found", err)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/mailer"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/notify"
+	"PragatiIot/platform/repositories/memory"
+	"PragatiIot/platform/utils"
+)
+
+// testServices wires the services to one in-memory store, as main wires
+// them to one database.
+type testServices struct {
+	store           *memory.Store
+	users           *UserService
+	homes           *HomeService
+	orgs            *OrganizationService
+	deviceType      *DeviceTypeService
+	devices         *DeviceService
+	telemetry       *TelemetryService
+	accounts        *AccountService
+	audit           *AuditService
+	serviceAccounts *ServiceAccountService
+	mfa             *MFAService
+	invitations     *InvitationService
+	transfers       *DeviceTransferService
+	spaces          *SpaceService
+	groups          *DeviceGroupService
+	jobs            *DeviceJobService
+	mail            *mailbox
+}
+
+func newTestServices(t *testing.T) *testServices {
+	t.Helper()
+	store := memory.New()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	recorder := audit.NewRecorder(store, store, logger)
+
+	users := NewUserService(store, recorder)
+	orgs := NewOrganizationService(store, recorder, OrgConfig{})
+	homes := NewHomeService(store, NewRoleService(store), users, orgs, recorder)
+	deviceTypes, err := NewDeviceTypeService(store, ValidationTag, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := &mailbox{}
+	accounts := NewAccountService(store, store, mail, recorder, AccountConfig{BaseURL: "https://app.example.com"}, logger)
+	devices := NewDeviceService(store, homes, deviceTypes, recorder, logger)
+	groups := NewDeviceGroupService(store, store, store, store, recorder)
+	sealer, err := utils.NewSealer("test:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServices{
+		store:           store,
+		users:           users,
+		homes:           homes,
+		orgs:            orgs,
+		deviceType:      deviceTypes,
+		devices:         devices,
+		telemetry:       NewTelemetryService(store, store, store, 0, recorder, logger),
+		audit:           NewAuditService(store, store),
+		serviceAccounts: NewServiceAccountService(store, store, store, recorder),
+		accounts:        accounts,
+		mfa:             NewMFAService(store, store, store, sealer, accounts, MFAConfig{}),
+		invitations:     NewInvitationService(store, store, homes, notify.NewMailNotifier(mail), recorder, InvitationConfig{BaseURL: "https://app.example.com"}, logger),
+		transfers:       NewDeviceTransferService(store, store, store, recorder),
+		spaces:          NewSpaceService(store, store, recorder),
+		groups:          groups,
+		jobs:            NewDeviceJobService(store, groups, devices, homes, store, recorder, DeviceJobConfig{}, logger),
+		mail:            mail,
+	}
+}
+
+// mailbox is a Mailer that keeps the messages it is sent.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the link of the last message sent to
+// address.
+func (m *mailbox) lastToken(t *testing.T, address string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != address {
+			continue
+		}
+		match := tokenPattern.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("no token in %q", m.messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Fatalf("no message sent to %s", address)
+	return ""
+}
+
+// addUser registers a user and returns it with its assigned ID.
+func (s *testServices) addUser(t *testing.T, username string) models.User {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.users.AddUser(ctx, models.User{Username: username, Email: username + "@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// addHome creates a home owned by user, with user as its Admin, and returns
+// its ID.
+func (s *testServices) addHome(t *testing.T, user models.User) int {
+	t.Helper()
+	ctx := context.Background()
+	homeID, err := s.homes.AddHome(ctx, models.Home{HomeName: user.Username + "'s home", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.homes.AddUserToHome(ctx, homeID, user.ID, "Admin"); err != nil {
+		t.Fatal(err)
+	}
+	return homeID
+}
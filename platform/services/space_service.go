@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+// errSpaceNotFound is returned for spaces that do not exist in the home.
+var errSpaceNotFound = apperrors.NotFound("Space not found")
+
+// SpaceService manages the spaces of homes, the buildings, floors, rooms and
+// zones devices are placed in, and reads devices, telemetry and rollups by
+// space. A space stands for everything inside it: a floor's devices include
+// those in its rooms and their zones.
+type SpaceService struct {
+	spaces  repositories.SpaceStore
+	devices repositories.DeviceStore
+	audit   *audit.Recorder
+}
+
+func NewSpaceService(spaces repositories.SpaceStore, devices repositories.DeviceStore, recorder *audit.Recorder) *SpaceService {
+	return &SpaceService{spaces: spaces, devices: devices, audit: recorder}
+}
+
+// GetSpaces returns the home's spaces in the order they were added.
+func (s *SpaceService) GetSpaces(ctx context.Context, homeID int) ([]models.Space, error) {
+	return s.spaces.GetHomeSpaces(ctx, homeID)
+}
+
+// GetSpace returns the home's space with the ID. Other homes' spaces are not
+// found.
+func (s *SpaceService) GetSpace(ctx context.Context, homeID, id int) (models.Space, error) {
+	space, err := s.spaces.GetSpaceByID(ctx, id)
+	if errors.Is(err, apperrors.ErrNotFound) || err == nil && space.HomeID != homeID {
+		return space, errSpaceNotFound
+	}
+	return space, err
+}
+
+// AddSpace adds the space and returns it with its ID.
+func (s *SpaceService) AddSpace(ctx context.Context, space models.Space) (models.Space, error) {
+	if err := s.checkNesting(ctx, space, nil); err != nil {
+		return space, err
+	}
+	id, err := s.spaces.AddSpace(ctx, space)
+	if err != nil {
+		return space, err
+	}
+	if space, err = s.spaces.GetSpaceByID(ctx, id); err != nil {
+		return space, err
+	}
+	_, after := audit.Diff(nil, spaceFields(space))
+	s.record(ctx, models.AuditSpaceCreate, space, nil, after)
+	return space, nil
+}
+
+// UpdateSpace renames the home's space, changes its kind or moves it under
+// another parent, keeping the kinds ordered along every branch.
+func (s *SpaceService) UpdateSpace(ctx context.Context, space models.Space) (models.Space, error) {
+	previous, err := s.GetSpace(ctx, space.HomeID, space.ID)
+	if err != nil {
+		return space, err
+	}
+	spaces, err := s.spaces.GetHomeSpaces(ctx, space.HomeID)
+	if err != nil {
+		return space, err
+	}
+	if err := s.checkNesting(ctx, space, spaces); err != nil {
+		return space, err
+	}
+	if err := s.spaces.UpdateSpace(ctx, space); err != nil {
+		return space, err
+	}
+	space.CreatedAt = previous.CreatedAt
+	before, after := audit.Diff(spaceFields(previous), spaceFields(space))
+	s.record(ctx, models.AuditSpaceUpdate, space, before, after)
+	return space, nil
+}
+
+// DeleteSpace deletes the home's space if it has no spaces inside it. Its
+// devices are left in no space.
+func (s *SpaceService) DeleteSpace(ctx context.Context, homeID, id int) error {
+	space, err := s.GetSpace(ctx, homeID, id)
+	if err != nil {
+		return err
+	}
+	spaces, err := s.spaces.GetHomeSpaces(ctx, homeID)
+	if err != nil {
+		return err
+	}
+	if children := len(childSpaces(spaces, id)); children > 0 {
+		return apperrors.Conflict("The space contains %d spaces; move or delete them first", children)
+	}
+	if err := s.spaces.DeleteSpace(ctx, id); err != nil {
+		return err
+	}
+	before, _ := audit.Diff(spaceFields(space), nil)
+	s.record(ctx, models.AuditSpaceDelete, space, before, nil)
+	return nil
+}
+
+// AssignDevice places the device in a space of its home, or in no space if
+// spaceID is nil.
+func (s *SpaceService) AssignDevice(ctx context.Context, deviceID string, spaceID *int) error {
+	device, err := s.devices.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if device.HomeID == nil {
+		if spaceID != nil {
+			return apperrors.Invalid("space_id", "the device is in no home")
+		}
+		// A device in no home is in no space.
+		return nil
+	}
+	if spaceID != nil {
+		if _, err := s.GetSpace(ctx, *device.HomeID, *spaceID); err != nil {
+			if errors.Is(err, apperrors.ErrNotFound) {
+				return apperrors.Invalid("space_id", "is not a space of the device's home")
+			}
+			return err
+		}
+	}
+
+	// The update only matches while the device is in the space's home; if
+	// it has moved since it was read, nothing changes.
+	if err := s.devices.SetDeviceSpace(ctx, deviceID, *device.HomeID, spaceID); err != nil {
+		return err
+	}
+	previous := device
+	device.SpaceID = spaceID
+	before, after := audit.Diff(previous, device)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditDeviceUpdate,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   deviceID,
+		HomeIDs:    audit.Homes(device.HomeID),
+		Before:     before,
+		After:      after,
+	})
+	return nil
+}
+
+// GetDevices returns the home's devices in the space or the spaces inside
+// it, or all of them if spaceID is nil.
+func (s *SpaceService) GetDevices(ctx context.Context, homeID int, spaceID *int) ([]models.Device, error) {
+	devices, err := s.devices.GetDevicesByHomeID(ctx, homeID)
+	if err != nil || spaceID == nil {
+		return devices, err
+	}
+	if _, err := s.GetSpace(ctx, homeID, *spaceID); err != nil {
+		return nil, err
+	}
+	spaces, err := s.spaces.GetHomeSpaces(ctx, homeID)
+	if err != nil {
+		return nil, err
+	}
+	within := subtree(spaces, *spaceID)
+	return slices.DeleteFunc(devices, func(d models.Device) bool {
+		return d.SpaceID == nil || !within[*d.SpaceID]
+	}), nil
+}
+
+// GetTelemetry returns the readings taken in the home by its devices in the
+// space or the spaces inside it, newest first. Devices are counted in the
+// space they are in now.
+func (s *SpaceService) GetTelemetry(ctx context.Context, homeID int, spaceID *int, from, to time.Time, limit int) ([]models.DeviceData, error) {
+	devices, err := s.GetDevices(ctx, homeID, spaceID)
+	if err != nil || len(devices) == 0 {
+		return nil, err
+	}
+	deviceIDs := make([]string, len(devices))
+	for i, d := range devices {
+		deviceIDs[i] = d.DeviceID
+	}
+	return s.devices.GetDeviceData(ctx, repositories.TelemetryQuery{DeviceIDs: deviceIDs, HomeID: &homeID, From: from, To: to, Limit: limit})
+}
+
+// GetAnalytics combines the home's rollups per space, for every space of the
+// kind, or of any kind if kind is empty, in the space asked for, itself
+// included, or in the whole home if spaceID is nil. Each space's figures
+// cover the devices in it and in the spaces inside it, as they are placed
+// now. An empty metric selects every field.
+func (s *SpaceService) GetAnalytics(ctx context.Context, homeID int, spaceID *int, kind, metric, granularity string, from, to time.Time) ([]models.SpaceAnalytics, error) {
+	granularity, err := rollupGranularity(granularity)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.GetDevices(ctx, homeID, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	spaces, err := s.spaces.GetHomeSpaces(ctx, homeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []models.Space
+	var scope map[int]bool
+	if spaceID != nil {
+		scope = subtree(spaces, *spaceID)
+	}
+	for _, sp := range spaces {
+		if (scope == nil || scope[sp.ID]) && (kind == "" || sp.Kind == kind) {
+			groups = append(groups, sp)
+		}
+	}
+	var placed []models.Device
+	for _, d := range devices {
+		if d.SpaceID != nil {
+			placed = append(placed, d)
+		}
+	}
+	if len(groups) == 0 || len(placed) == 0 {
+		return nil, nil
+	}
+
+	deviceIDs := make([]string, len(placed))
+	spaceOf := make(map[string]int, len(placed))
+	for i, d := range placed {
+		deviceIDs[i] = d.DeviceID
+		spaceOf[d.DeviceID] = *d.SpaceID
+	}
+	rollups, err := s.devices.GetHomeAnalytics(ctx, homeID, deviceIDs, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var analytics []models.SpaceAnalytics
+	for _, group := range groups {
+		within := subtree(spaces, group.ID)
+		type bucket struct {
+			metric string
+			period time.Time
+		}
+		combined := make(map[bucket]*models.SpaceAnalytics)
+		var order []bucket
+		for _, r := range rollups {
+			if metric != "" && r.Metric != metric || !within[spaceOf[r.DeviceID]] {
+				continue
+			}
+			key := bucket{r.Metric, r.Period}
+			a, ok := combined[key]
+			if !ok {
+				a = &models.SpaceAnalytics{SpaceID: group.ID, Metric: r.Metric, Granularity: granularity, Period: r.Period, Min: r.Min, Max: r.Max}
+				combined[key] = a
+				order = append(order, key)
+			}
+			a.Devices++
+			a.Count += r.Count
+			a.Sum += r.Sum
+			a.Min = min(a.Min, r.Min)
+			a.Max = max(a.Max, r.Max)
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			if !order[i].period.Equal(order[j].period) {
+				return order[i].period.Before(order[j].period)
+			}
+			return order[i].metric < order[j].metric
+		})
+		for _, key := range order {
+			a := combined[key]
+			if a.Count > 0 {
+				a.Avg = a.Sum / float64(a.Count)
+			}
+			analytics = append(analytics, *a)
+		}
+	}
+	return analytics, nil
+}
+
+// checkNesting refuses a space whose parent is not a space of its home of an
+// earlier kind. When updating, spaces holds the home's spaces, and the
+// space's children must then remain of later kinds than it.
+func (s *SpaceService) checkNesting(ctx context.Context, space models.Space, spaces []models.Space) error {
+	rank := slices.Index(models.SpaceKinds, space.Kind)
+	if rank < 0 {
+		return apperrors.Invalid("kind", "unknown kind %s", space.Kind)
+	}
+	if space.ParentID != nil {
+		parent, err := s.GetSpace(ctx, space.HomeID, *space.ParentID)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return apperrors.Invalid("parent_id", "is not a space of the home")
+		}
+		if err != nil {
+			return err
+		}
+		if slices.Index(models.SpaceKinds, parent.Kind) >= rank {
+			return apperrors.Invalid("parent_id", "a %s cannot be inside a %s", space.Kind, parent.Kind)
+		}
+	}
+	for _, child := range childSpaces(spaces, space.ID) {
+		if slices.Index(models.SpaceKinds, child.Kind) <= rank {
+			return apperrors.Invalid("kind", "the space contains a %s, which cannot be inside a %s", child.Kind, space.Kind)
+		}
+	}
+	return nil
+}
+
+func (s *SpaceService) record(ctx context.Context, action string, space models.Space, before, after map[string]interface{}) {
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetSpace,
+		TargetID:   strconv.Itoa(space.ID),
+		HomeIDs:    []int{space.HomeID},
+		Before:     before,
+		After:      after,
+	})
+}
+
+// spaceFields returns the audited fields of the space.
+func spaceFields(space models.Space) map[string]interface{} {
+	return map[string]interface{}{"home_id": space.HomeID, "parent_id": space.ParentID, "name": space.Name, "kind": space.Kind}
+}
+
+// childSpaces returns the spaces directly inside the space with the ID.
+func childSpaces(spaces []models.Space, id int) []models.Space {
+	var children []models.Space
+	for _, sp := range spaces {
+		if sp.ParentID != nil && *sp.ParentID == id {
+			children = append(children, sp)
+		}
+	}
+	return children
+}
+
+// subtree returns the IDs of the space with the ID and of every space inside
+// it.
+func subtree(spaces []models.Space, id int) map[int]bool {
+	within := map[int]bool{id: true}
+	for queue := []int{id}; len(queue) > 0; queue = queue[1:] {
+		for _, child := range childSpaces(spaces, queue[0]) {
+			within[child.ID] = true
+			queue = append(queue, child.ID)
+		}
+	}
+	return within
+}
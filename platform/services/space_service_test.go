@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+func TestSpaces(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	alice := s.addUser(t, "alice")
+	homeID := s.addHome(t, alice)
+	otherHomeID := s.addHome(t, s.addUser(t, "bob"))
+
+	add := func(parentID *int, name, kind string) models.Space {
+		t.Helper()
+		space, err := s.spaces.AddSpace(ctx, models.Space{HomeID: homeID, ParentID: parentID, Name: name, Kind: kind})
+		if err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+		return space
+	}
+	building := add(nil, "Main", models.SpaceBuilding)
+	floor := add(&building.ID, "Ground", models.SpaceFloor)
+	kitchen := add(&floor.ID, "Kitchen", models.SpaceRoom)
+	hall := add(&floor.ID, "Hall", models.SpaceRoom)
+	hob := add(&kitchen.ID, "Hob", models.SpaceZone)
+
+	if _, err := s.spaces.AddSpace(ctx, models.Space{HomeID: homeID, ParentID: &hob.ID, Name: "Pantry", Kind: models.SpaceRoom}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("room inside a zone: got %v, want a validation error", err)
+	}
+	if _, err := s.spaces.AddSpace(ctx, models.Space{HomeID: otherHomeID, ParentID: &floor.ID, Name: "Attic", Kind: models.SpaceRoom}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("parent in another home: got %v, want a validation error", err)
+	}
+	if _, err := s.spaces.AddSpace(ctx, models.Space{HomeID: homeID, ParentID: &floor.ID, Name: "Hall", Kind: models.SpaceRoom}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("sibling with the same name: got %v, want conflict", err)
+	}
+	kitchen.Kind = models.SpaceZone
+	if _, err := s.spaces.UpdateSpace(ctx, kitchen); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("room with zones made a zone: got %v, want a validation error", err)
+	}
+	kitchen.Kind = models.SpaceRoom
+
+	for deviceID, spaceID := range map[string]*int{"d1": &kitchen.ID, "d2": &hob.ID, "d3": &hall.ID, "d4": nil} {
+		if err := s.devices.AddDevice(ctx, models.Device{DeviceID: deviceID, ChannelID: "c-" + deviceID, UserID: alice.ID, HomeID: &homeID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.spaces.AssignDevice(ctx, deviceID, spaceID); err != nil {
+			t.Fatalf("assign %s: %v", deviceID, err)
+		}
+	}
+	other, err := s.spaces.AddSpace(ctx, models.Space{HomeID: otherHomeID, Name: "Shed", Kind: models.SpaceBuilding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.spaces.AssignDevice(ctx, "d4", &other.ID); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("space of another home: got %v, want a validation error", err)
+	}
+
+	for spaceID, want := range map[int]int{floor.ID: 3, kitchen.ID: 2, hob.ID: 1} {
+		if devices, err := s.spaces.GetDevices(ctx, homeID, &spaceID); err != nil || len(devices) != want {
+			t.Errorf("devices in space %d: %d, %v, want %d", spaceID, len(devices), err, want)
+		}
+	}
+
+	// The kitchen's average covers its hob; the hall's is its own.
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	var batch []models.DeviceData
+	for deviceID, temp := range map[string]float64{"d1": 20, "d2": 24, "d3": 18, "d4": 30} {
+		batch = append(batch, models.DeviceData{DeviceID: deviceID, HomeID: &homeID, CreatedAt: hour, Data: map[string]interface{}{"temp": temp}})
+	}
+	if err := s.devices.AddDeviceDataBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.Rollup(ctx, repositories.RollupHourly, hour, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	readings, err := s.spaces.GetTelemetry(ctx, homeID, &kitchen.ID, hour, now.Add(time.Minute), 0)
+	if err != nil || len(readings) != 2 {
+		t.Errorf("kitchen readings %+v, %v", readings, err)
+	}
+	analytics, err := s.spaces.GetAnalytics(ctx, homeID, nil, models.SpaceRoom, "temp", "", hour, now.Add(time.Minute))
+	if err != nil || len(analytics) != 2 {
+		t.Fatalf("analytics per room %+v, %v", analytics, err)
+	}
+	want := map[int]models.SpaceAnalytics{
+		kitchen.ID: {Devices: 2, Count: 2, Min: 20, Max: 24, Avg: 22, Sum: 44},
+		hall.ID:    {Devices: 1, Count: 1, Min: 18, Max: 18, Avg: 18, Sum: 18},
+	}
+	for _, a := range analytics {
+		w := want[a.SpaceID]
+		if a.Devices != w.Devices || a.Count != w.Count || a.Min != w.Min || a.Max != w.Max || a.Avg != w.Avg || a.Sum != w.Sum {
+			t.Errorf("space %d: %+v, want %+v", a.SpaceID, a, w)
+		}
+	}
+
+	if err := s.spaces.DeleteSpace(ctx, homeID, floor.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("delete a floor with rooms: got %v, want conflict", err)
+	}
+	if err := s.spaces.DeleteSpace(ctx, otherHomeID, hob.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("delete through another home: got %v, want not found", err)
+	}
+	if err := s.spaces.DeleteSpace(ctx, homeID, hob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if device, _ := s.devices.GetDeviceByID(ctx, "d2"); device.SpaceID != nil {
+		t.Errorf("device of a deleted space in space %d", *device.SpaceID)
+	}
+	if err := s.devices.AssignDeviceToHome(ctx, "d1", &otherHomeID); err != nil {
+		t.Fatal(err)
+	}
+	if device, _ := s.devices.GetDeviceByID(ctx, "d1"); device.SpaceID != nil {
+		t.Errorf("device moved to another home still in space %d", *device.SpaceID)
+	}
+	// A placement based on the device as it was before the move changes
+	// nothing.
+	if err := s.store.SetDeviceSpace(ctx, "d1", homeID, &floor.ID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("stale placement: got %v, want conflict", err)
+	}
+	if device, _ := s.devices.GetDeviceByID(ctx, "d1"); device.SpaceID != nil || *device.HomeID != otherHomeID {
+		t.Errorf("device after a stale placement %+v", device)
+	}
+}
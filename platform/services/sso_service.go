@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/oidc"
+	"PragatiIot/platform/repositories"
+)
+
+// ssoLoginTTL is how long a user has to sign in at the identity provider.
+const ssoLoginTTL = 10 * time.Minute
+
+// errSSOFailed does not say why the provider or the platform rejected a
+// login; the reason is logged.
+var errSSOFailed = apperrors.Unauthorized("Single sign-on failed")
+
+// errInvalidState does not say whether the state is unknown, used or
+// expired.
+var errInvalidState = apperrors.Invalid("state", "is invalid or has expired")
+
+// invalidUsernameChars are replaced when a username is derived from a
+// provider's claims, so it is one a user could have registered.
+var invalidUsernameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SSOService signs users in with OpenID Connect identity providers. Users
+// are added the first time they sign in, and the platform issues its own
+// tokens to them as it does to users who log in with a password.
+type SSOService struct {
+	providers map[string]*oidc.Provider
+	users     repositories.UserStore
+	logins    repositories.SSOStore
+	homes     *HomeService
+	audit     *audit.Recorder
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+func NewSSOService(providers map[string]*oidc.Provider, users repositories.UserStore, logins repositories.SSOStore, homes *HomeService, recorder *audit.Recorder, logger *slog.Logger) *SSOService {
+	return &SSOService{providers: providers, users: users, logins: logins, homes: homes, audit: recorder, logger: logger, now: time.Now}
+}
+
+// Providers returns the names of the identity providers, sorted.
+func (s *SSOService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginLogin starts a login with the provider and returns the provider's
+// URL to send the user to.
+func (s *SSOService) BeginLogin(ctx context.Context, name string) (string, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return "", err
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = oidc.NewVerifier(); err != nil {
+			return "", err
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	err = s.logins.AddSSOLogin(ctx, models.SSOLogin{
+		Provider:  name,
+		StateHash: hashToken(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: s.now().Add(ssoLoginTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(ctx, state, nonce, verifier)
+}
+
+// CompleteLogin finishes a login when the provider redirects back with the
+// state and a code, and returns the user signed in. A user signing in for
+// the first time is added, or linked to the account with their email
+// address if the provider and the platform both verified it. The user is
+// then added to the homes their groups are mapped to.
+func (s *SSOService) CompleteLogin(ctx context.Context, name, state, code string) (models.User, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return models.User{}, err
+	}
+	login, err := s.logins.ConsumeSSOLogin(ctx, hashToken(state), s.now())
+	if errors.Is(err, apperrors.ErrNotFound) || (err == nil && login.Provider != name) {
+		return models.User{}, errInvalidState
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.Verifier, login.Nonce)
+	if errors.Is(err, oidc.ErrRejected) {
+		s.logger.WarnContext(ctx, "Single sign-on rejected", "provider", name, "error", err)
+		return models.User{}, errSSOFailed
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.signIn(ctx, name, claims)
+	if err != nil {
+		return user, err
+	}
+	s.grantGroupRoles(ctx, provider.Config().GroupRoles, user, claims.Groups)
+	return user, nil
+}
+
+// signIn returns the user with the identity, adding or linking it first if
+// it is new.
+func (s *SSOService) signIn(ctx context.Context, provider string, claims oidc.Claims) (models.User, error) {
+	identity, err := s.logins.GetUserIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return s.users.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		return models.User{}, err
+	}
+	if claims.Email == "" {
+		return models.User{}, apperrors.Unauthorized("The identity provider did not share an email address")
+	}
+
+	user, err := s.users.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified || !user.EmailVerified || user.IsServiceAccount() {
+			return models.User{}, apperrors.Conflict("An account with this email address already exists; log in with its password")
+		}
+		if err := s.link(ctx, user, provider, claims.Subject); err != nil {
+			return user, err
+		}
+		s.audit.Record(ctx, audit.By(models.AuditEntry{
+			Action:     models.AuditUserLinkIdentity,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.Itoa(user.ID),
+			After:      map[string]interface{}{"identity_provider": provider},
+		}, user))
+		return user, nil
+	case errors.Is(err, apperrors.ErrNotFound):
+		return s.provision(ctx, provider, claims)
+	default:
+		return models.User{}, err
+	}
+}
+
+// provision adds a user for a new identity. It has no password.
+func (s *SSOService) provision(ctx context.Context, provider string, claims oidc.Claims) (models.User, error) {
+	username, err := s.availableUsername(ctx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{Username: username, Email: claims.Email, EmailVerified: claims.EmailVerified}
+	if err := s.users.AddUser(ctx, user); err != nil {
+		return user, err
+	}
+	user, err = s.users.GetUserByUsername(ctx, username)
+	if err != nil {
+		return user, err
+	}
+	if err := s.link(ctx, user, provider, claims.Subject); err != nil {
+		return user, err
+	}
+	_, after := audit.Diff(nil, user)
+	after["identity_provider"] = provider
+	s.audit.Record(ctx, audit.By(models.AuditEntry{
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		After:      after,
+	}, user))
+	return user, nil
+}
+
+func (s *SSOService) link(ctx context.Context, user models.User, provider, subject string) error {
+	return s.logins.AddUserIdentity(ctx, models.UserIdentity{UserID: user.ID, Provider: provider, Subject: subject})
+}
+
+// availableUsername derives a username from the provider's username claim,
+// or the email address, numbering it if it is taken.
+func (s *SSOService) availableUsername(ctx context.Context, claims oidc.Claims) (string, error) {
+	base := claims.Username
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(invalidUsernameChars.ReplaceAllString(base, "-"), "-")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	for n := 1; n <= 100; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+		_, err := s.users.GetUserByUsername(ctx, candidate)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", apperrors.Conflict("No username based on %s is available", base)
+}
+
+// grantGroupRoles adds the user to the homes their groups are mapped to,
+// with the first mapped role for each home. Memberships the user already
+// has are left as they are. A mapping that cannot be applied, such as one
+// naming a deleted home, is logged rather than failing the login.
+func (s *SSOService) grantGroupRoles(ctx context.Context, mappings []oidc.GroupRole, user models.User, groups []string) {
+	for _, mapping := range mappings {
+		if !slices.Contains(groups, mapping.Group) || s.homes.IsHomeMember(ctx, mapping.HomeID, user.ID) {
+			continue
+		}
+		if err := s.homes.AddUserToHome(ctx, mapping.HomeID, user.ID, mapping.Role); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to grant home role for group", "group", mapping.Group, "home_id", mapping.HomeID,
+				"role", mapping.Role, "user_id", user.ID, "error", err)
+		}
+	}
+}
+
+func (s *SSOService) provider(name string) (*oidc.Provider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, apperrors.NotFound("identity provider %s not found", name)
+	}
+	return provider, nil
+}
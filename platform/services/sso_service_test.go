@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/oidc"
+	"PragatiIot/platform/oidc/oidctest"
+)
+
+// ssoLogin signs in at the provider as the claims and completes the login.
+func ssoLogin(t *testing.T, sso *SSOService, idp *oidctest.Server, claims map[string]interface{}) (models.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, err := sso.BeginLogin(ctx, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.SignIn(claims)
+	back, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sso.CompleteLogin(ctx, "corp", back.Query().Get("state"), back.Query().Get("code"))
+}
+
+func TestSSOLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	owner := register(t, s, "owner")
+	home := s.addHome(t, owner)
+
+	idp := oidctest.NewServer("platform", "secret")
+	defer idp.Close()
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "platform",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/oidc/corp/callback",
+		GroupRoles: []oidc.GroupRole{
+			{Group: "facilities", HomeID: home, Role: "Admin"},
+			{Group: "staff", HomeID: home, Role: "View"},
+			{Group: "staff", HomeID: 999, Role: "View"},
+		},
+	}, nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sso := NewSSOService(map[string]*oidc.Provider{"corp": provider}, s.store, s.store, s.homes, nil, logger)
+
+	ada := map[string]interface{}{
+		"sub": "u-1", "email": "ada@corp.example", "email_verified": true,
+		"preferred_username": "Ada Lovelace", "groups": []string{"staff", "facilities"},
+	}
+	user, err := ssoLogin(t, sso, idp, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "Ada-Lovelace" || user.Email != "ada@corp.example" || !user.EmailVerified || user.PasswordHash != "" {
+		t.Errorf("provisioned %+v", user)
+	}
+	// The facilities mapping comes first, and the unknown home is skipped.
+	if err := s.homes.Authorize(ctx, home, user.ID, models.PermHomeManage); err != nil {
+		t.Errorf("group member is admin of the mapped home: %v", err)
+	}
+
+	again, err := ssoLogin(t, sso, idp, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login signed in user %d, want %d", again.ID, user.ID)
+	}
+
+	// A username that is taken is numbered.
+	other, err := ssoLogin(t, sso, idp, map[string]interface{}{"sub": "u-2", "email": "ada@other.example", "preferred_username": "Ada-Lovelace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Username != "Ada-Lovelace-2" {
+		t.Errorf("username = %q, want Ada-Lovelace-2", other.Username)
+	}
+
+	// An existing account is linked only if both sides verified the email.
+	if _, err := ssoLogin(t, sso, idp, map[string]interface{}{"sub": "u-3", "email": owner.Email}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("unverified email of an existing account: got %v, want conflict", err)
+	}
+	owner.EmailVerified = true
+	if err := s.store.UpdateUser(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	linked, err := ssoLogin(t, sso, idp, map[string]interface{}{"sub": "u-3", "email": owner.Email, "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.ID != owner.ID {
+		t.Errorf("linked user %d, want %d", linked.ID, owner.ID)
+	}
+
+	// States are single use.
+	authURL, err := sso.BeginLogin(ctx, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := back.Query().Get("state"), back.Query().Get("code")
+	if _, err := sso.CompleteLogin(ctx, "corp", state, code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sso.CompleteLogin(ctx, "corp", state, code); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("reused state: got %v, want a validation error", err)
+	}
+	if _, err := sso.BeginLogin(ctx, "unknown"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("unknown provider: got %v, want not found", err)
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"PragatiIot/platform/apperrors"
+	"PragatiIot/platform/audit"
+	"PragatiIot/platform/models"
+	"PragatiIot/platform/repositories"
+)
+
+type TelemetryService struct {
+	deviceRepo           repositories.DeviceStore
+	retentionRepo        repositories.RetentionPolicyStore
+	maintainer           repositories.TelemetryMaintainer
+	defaultRetentionDays int
+	audit                *audit.Recorder
+	logger               *slog.Logger
+}
+
+// NewTelemetryService returns a service for reading telemetry and, when
+// maintainer is not nil, keeping its partitions, retention and rollups current.
+func NewTelemetryService(deviceRepo repositories.DeviceStore, retentionRepo repositories.RetentionPolicyStore, maintainer repositories.TelemetryMaintainer, defaultRetentionDays int, recorder *audit.Recorder, logger *slog.Logger) *TelemetryService {
+	return &TelemetryService{
+		deviceRepo:           deviceRepo,
+		retentionRepo:        retentionRepo,
+		maintainer:           maintainer,
+		defaultRetentionDays: defaultRetentionDays,
+		audit:                recorder,
+		logger:               logger,
+	}
+}
+
+func (s *TelemetryService) GetDeviceData(ctx context.Context, query repositories.TelemetryQuery) ([]models.DeviceData, error) {
+	data, err := s.deviceRepo.GetDeviceData(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetDeviceDataInWindows returns the readings the query selects within any
+// of the windows, newest first and at most the query's limit.
+func (s *TelemetryService) GetDeviceDataInWindows(ctx context.Context, query repositories.TelemetryQuery, windows []TelemetryWindow) ([]models.DeviceData, error) {
+	var data []models.DeviceData
+	for _, window := range windows {
+		q := query
+		if q.From.Before(window.From) {
+			q.From = window.From
+		}
+		if !window.To.IsZero() && (q.To.IsZero() || q.To.After(window.To)) {
+			q.To = window.To
+		}
+		if !q.To.IsZero() && !q.From.Before(q.To) {
+			continue
+		}
+		readings, err := s.deviceRepo.GetDeviceData(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, readings...)
+	}
+	sort.SliceStable(data, func(i, j int) bool { return data[i].CreatedAt.After(data[j].CreatedAt) })
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = repositories.DefaultTelemetryLimit
+	}
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+func (s *TelemetryService) GetDeviceAnalytics(ctx context.Context, deviceID string, homeID int, granularity string, from, to time.Time) ([]models.DeviceAnalytics, error) {
+	granularity, err := rollupGranularity(granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics, err := s.deviceRepo.GetDeviceAnalytics(ctx, deviceID, homeID, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return analytics, nil
+}
+
+// rollupGranularity returns the rollup granularity asked for, hourly by
+// default.
+func rollupGranularity(granularity string) (string, error) {
+	if granularity == "" {
+		return repositories.RollupHourly, nil
+	}
+	if granularity != repositories.RollupHourly && granularity != repositories.RollupDaily {
+		return "", apperrors.Invalid("granularity", "unsupported granularity %s", granularity)
+	}
+	return granularity, nil
+}
+
+func (s *TelemetryService) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	if (policy.HomeID == nil) == (policy.DeviceTypeID == nil) {
+		return apperrors.Validation("A retention policy applies to exactly one of home_id or device_type_id")
+	}
+	if policy.RetentionDays <= 0 {
+		return apperrors.Invalid("retention_days", "must be positive")
+	}
+	policies, err := s.retentionRepo.GetRetentionPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	// The policy being replaced, if any, without its ID, which the new
+	// policy does not carry.
+	var previous interface{}
+	for _, p := range policies {
+		if retentionTarget(p) == retentionTarget(policy) {
+			p.ID = 0
+			previous = p
+		}
+	}
+
+	if err := s.retentionRepo.SetRetentionPolicy(ctx, policy); err != nil {
+		return err
+	}
+	before, after := audit.Diff(previous, policy)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditRetentionPolicySet,
+		TargetType: models.AuditTargetRetentionPolicy,
+		TargetID:   retentionTarget(policy),
+		HomeIDs:    audit.Homes(policy.HomeID),
+		Before:     before,
+		After:      after,
+	})
+	return nil
+}
+
+// retentionTarget names what a policy applies to, such as "home:3".
+func retentionTarget(policy models.RetentionPolicy) string {
+	if policy.HomeID != nil {
+		return "home:" + strconv.Itoa(*policy.HomeID)
+	}
+	return "device_type:" + strconv.Itoa(*policy.DeviceTypeID)
+}
+
+func (s *TelemetryService) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	policies, err := s.retentionRepo.GetRetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// RunMaintenance creates upcoming partitions, refreshes rollups and applies
+// retention every interval until ctx is cancelled.
+func (s *TelemetryService) RunMaintenance(ctx context.Context, interval time.Duration) {
+	if s.maintainer == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// A run that has not finished by the next tick is abandoned.
+		runCtx, cancel := context.WithTimeout(ctx, interval)
+		s.maintain(runCtx, time.Now().UTC())
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *TelemetryService) maintain(ctx context.Context, now time.Time) {
+	if err := s.maintainer.EnsurePartitions(ctx, now); err != nil {
+		s.logger.ErrorContext(ctx, "Error creating telemetry partitions", "error", err)
+	}
+
+	// Refresh the previous bucket as well as the current one so readings that
+	// arrived just after a boundary are included.
+	if err := s.maintainer.Rollup(ctx, repositories.RollupHourly, now.Add(-time.Hour), now); err != nil {
+		s.logger.ErrorContext(ctx, "Error rolling up telemetry", "granularity", repositories.RollupHourly, "error", err)
+	}
+	if err := s.maintainer.Rollup(ctx, repositories.RollupDaily, now.AddDate(0, 0, -1), now); err != nil {
+		s.logger.ErrorContext(ctx, "Error rolling up telemetry", "granularity", repositories.RollupDaily, "error", err)
+	}
+
+	if err := s.maintainer.ApplyRetention(ctx, now, s.defaultRetentionDays); err != nil {
+		s.logger.ErrorContext(ctx, "Error applying telemetry retention", "error", err)
+	}
+}
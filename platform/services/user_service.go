@@ -1,32 +1,47 @@
 package services
 
 import (
-	"log"
-
+	"PragatiIot/platform/audit"
 	"PragatiIot/platform/models"
 	"PragatiIot/platform/repositories"
+	"context"
+	"strconv"
 )
 
 type UserService struct {
-	userRepo *repositories.UserRepository
+	userRepo repositories.UserStore
+	audit    *audit.Recorder
 }
 
-func NewUserService(userRepo *repositories.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(userRepo repositories.UserStore, recorder *audit.Recorder) *UserService {
+	return &UserService{userRepo: userRepo, audit: recorder}
 }
 
-func (s *UserService) AddUser(user models.User) error {
-	if err := s.userRepo.AddUser(user); err != nil {
-		log.Printf("Error adding user: %v", err)
+func (s *UserService) AddUser(ctx context.Context, user models.User) error {
+	if err := s.userRepo.AddUser(ctx, user); err != nil {
+		return err
+	}
+	created, err := s.userRepo.GetUserByUsername(ctx, user.Username)
+	if err != nil {
 		return err
 	}
+	_, after := audit.Diff(nil, created)
+	s.audit.Record(ctx, models.AuditEntry{
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(created.ID),
+		After:      after,
+	})
 	return nil
 }
 
-func (s *UserService) GetUserByUsername(username string) (models.User, error) {
-	user, err := s.userRepo.GetUserByUsername(username)
+func (s *UserService) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	return s.userRepo.GetUserByID(ctx, id)
+}
+
+func (s *UserService) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	user, err := s.userRepo.GetUserByUsername(ctx, username)
 	if err != nil {
-		log.Printf("Error getting user by username %s: %v", username, err)
 		return user, err
 	}
 	return user, nil
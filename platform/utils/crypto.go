@@ -5,7 +5,10 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 )
 
 // Encrypt encrypts plain text string into cipher text string
@@ -53,3 +56,78 @@ func Decrypt(key, cryptoText string) (string, error) {
 
 	return string(cipherText), nil
 }
+
+// Sealer encrypts secrets at rest with AES-GCM, which unlike Encrypt also
+// detects tampering. A sealed value names the key that sealed it, so keys
+// can be rotated: values are sealed with the first key and opened with any.
+type Sealer struct {
+	keyID string
+	aeads map[string]cipher.AEAD
+}
+
+// NewSealer returns a Sealer for keys given as "id:key,id:key", each key
+// base64-encoded and 16, 24 or 32 bytes long. The first key seals.
+func NewSealer(spec string) (*Sealer, error) {
+	s := &Sealer{aeads: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key %q is not id:base64", entry)
+		}
+		if _, dup := s.aeads[id]; dup {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding key %s: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key %s: %w", id, err)
+		}
+		if s.keyID == "" {
+			s.keyID = id
+		}
+		s.aeads[id] = aead
+	}
+	return s, nil
+}
+
+// Seal encrypts plaintext. additionalData, such as the ID of the record the
+// value belongs to, is authenticated but not stored: Open fails unless it
+// is given the same, so sealed values cannot be moved between records.
+func (s *Sealer) Seal(plaintext, additionalData []byte) (string, error) {
+	aead := s.aeads[s.keyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return s.keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed with any of the keys.
+func (s *Sealer) Open(value string, additionalData []byte) ([]byte, error) {
+	id, encoded, _ := strings.Cut(value, ":")
+	aead, ok := s.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("sealed with unknown key %q", id)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding sealed value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sealed value: %w", err)
+	}
+	return plaintext, nil
+}